@@ -2,15 +2,23 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/thebartekbanach/imcaxy/pkg/cache"
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	imaginaryprocessor "github.com/thebartekbanach/imcaxy/pkg/processor/imaginary"
 	"github.com/thebartekbanach/imcaxy/pkg/proxy"
+	"github.com/thebartekbanach/imcaxy/pkg/warming"
 )
 
 func handleRequest(ctx context.Context, proxyService proxy.ProxyService) http.HandlerFunc {
@@ -66,14 +74,37 @@ func handleInvalidationRequest(ctx context.Context, invalidationService cache.In
 			return
 		}
 
-		urls := r.URL.Query()["urls"]
-		if len(urls) == 0 {
+		patterns := []cacherepositories.InvalidationPattern{}
+		patternParams := []struct {
+			param       string
+			patternType cacherepositories.InvalidationPatternType
+		}{
+			{"urls", cacherepositories.ExactURLPattern},
+			{"prefixes", cacherepositories.PrefixPattern},
+			{"globs", cacherepositories.GlobPattern},
+			{"regexes", cacherepositories.RegexPattern},
+		}
+
+		for _, patternParam := range patternParams {
+			for _, pattern := range r.URL.Query()[patternParam.param] {
+				patterns = append(patterns, cacherepositories.InvalidationPattern{Type: patternParam.patternType, Pattern: pattern})
+			}
+		}
+
+		if len(patterns) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("urls, prefixes, globs or regexes query parameter is required"))
+			return
+		}
+
+		confirmed := r.URL.Query().Get("confirm") == "true"
+		result, invalidationErr := invalidationService.InvalidatePatterns(ctx, projectName, latestCommitHash, patterns, confirmed)
+		if errors.Is(invalidationErr, cache.ErrInvalidPattern) {
 			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("urls query parameter is required"))
+			w.Write([]byte(invalidationErr.Error()))
 			return
 		}
 
-		result, invalidationErr := invalidationService.Invalidate(ctx, projectName, latestCommitHash, urls)
 		jsonResult, marshalErr := json.Marshal(result)
 		if marshalErr != nil {
 			log.Printf("error ocurred when marshalling invalidated entries: %s", marshalErr)
@@ -82,7 +113,10 @@ func handleInvalidationRequest(ctx context.Context, invalidationService cache.In
 			return
 		}
 
-		if invalidationErr != nil {
+		if errors.Is(invalidationErr, cache.ErrTooManyMatchingEntries) {
+			log.Printf("invalidation was stopped: %s", invalidationErr)
+			w.WriteHeader(http.StatusConflict)
+		} else if invalidationErr != nil {
 			log.Printf("error ocurred when invalidating: %s", invalidationErr)
 			w.WriteHeader(http.StatusInternalServerError)
 		} else {
@@ -139,3 +173,246 @@ func handleLatestInvalidationInfoRequest(ctx context.Context, invalidationServic
 		w.Write(jsonResult)
 	}
 }
+
+// authorizeAdminRequest writes the error response when the request is not authorized,
+// admin endpoints are not available at all until their access token is set
+func authorizeAdminRequest(w http.ResponseWriter, r *http.Request, rawAccessToken string) bool {
+	if rawAccessToken == "" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("admin access token is not configured"))
+		return false
+	}
+
+	accessToken := fmt.Sprintf("Bearer %s", rawAccessToken)
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(accessToken)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("access token authorization failed"))
+		return false
+	}
+
+	return true
+}
+
+func handleBackendsStatusRequest(imaginaryProcessingService *imaginaryprocessor.Processor) http.HandlerFunc {
+	rawAccessToken := os.Getenv("IMCAXY_ADMIN_SECURITY_TOKEN")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("only GET method is allowed"))
+			return
+		}
+
+		if !authorizeAdminRequest(w, r, rawAccessToken) {
+			return
+		}
+
+		result := map[string][]imaginaryprocessor.BackendStatus{
+			"imaginary": imaginaryProcessingService.BackendsStatus(),
+		}
+
+		jsonResult, err := json.Marshal(result)
+		if err != nil {
+			log.Printf("error ocurred when marshalling backends status: %s", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("error ocurred when marshalling backends status"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonResult)
+	}
+}
+
+// handleWarmingJobsRequest starts jobs on POST /admin/warming/jobs
+// and returns their status on GET /admin/warming/jobs/<id>
+func handleWarmingJobsRequest(ctx context.Context, warmer *warming.Warmer) http.HandlerFunc {
+	rawAccessToken := os.Getenv("IMCAXY_ADMIN_SECURITY_TOKEN")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorizeAdminRequest(w, r, rawAccessToken) {
+			return
+		}
+
+		jobID := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/admin/warming/jobs"), "/")
+		if jobID == "" && r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("only POST method is allowed"))
+			return
+		}
+
+		if jobID != "" && r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("only GET method is allowed"))
+			return
+		}
+
+		var job warming.Job
+		status := http.StatusOK
+		if jobID == "" {
+			var request warming.JobRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("request body must be a warming job json"))
+				return
+			}
+
+			// job outlives the request, so it is run using the server context
+			var err error
+			job, err = warmer.Start(ctx, request)
+			if errors.Is(err, warming.ErrEmptyJob) || errors.Is(err, warming.ErrTooManyItems) || errors.Is(err, warming.ErrUnknownPreset) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(err.Error()))
+				return
+			}
+
+			if err != nil {
+				log.Printf("error ocurred when starting warming job: %s", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("error ocurred when starting warming job"))
+				return
+			}
+
+			status = http.StatusAccepted
+		} else {
+			var found bool
+			if job, found = warmer.Job(jobID); !found {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("warming job not found"))
+				return
+			}
+		}
+
+		jsonResult, err := json.Marshal(job)
+		if err != nil {
+			log.Printf("error ocurred when marshalling warming job: %s", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("error ocurred when marshalling warming job"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(jsonResult)
+	}
+}
+
+// handleCacheEntriesRequest returns page of entries matching the query
+// parameters on GET /admin/cache/entries
+func handleCacheEntriesRequest(ctx context.Context, cacheBrowser *cache.CacheBrowser) http.HandlerFunc {
+	return handleCacheBrowserRequest(ctx, "cache entries", func(ctx context.Context, query cacherepositories.CachedImagesQuery, options cache.BrowseOptions) (interface{}, error) {
+		return cacheBrowser.Entries(ctx, query, options)
+	})
+}
+
+// handleCacheSourcesRequest returns page of source images with number and total
+// size of their cached images matching the query parameters on GET /admin/cache/sources
+func handleCacheSourcesRequest(ctx context.Context, cacheBrowser *cache.CacheBrowser) http.HandlerFunc {
+	return handleCacheBrowserRequest(ctx, "cache sources", func(ctx context.Context, query cacherepositories.CachedImagesQuery, options cache.BrowseOptions) (interface{}, error) {
+		return cacheBrowser.Sources(ctx, query, options)
+	})
+}
+
+type browseFunc func(ctx context.Context, query cacherepositories.CachedImagesQuery, options cache.BrowseOptions) (interface{}, error)
+
+func handleCacheBrowserRequest(ctx context.Context, name string, browse browseFunc) http.HandlerFunc {
+	rawAccessToken := os.Getenv("IMCAXY_ADMIN_SECURITY_TOKEN")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("only GET method is allowed"))
+			return
+		}
+
+		if !authorizeAdminRequest(w, r, rawAccessToken) {
+			return
+		}
+
+		query, options, err := parseCacheBrowserParams(r.URL.Query())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		result, err := browse(ctx, query, options)
+		if errors.Is(err, cache.ErrUnknownSortField) || errors.Is(err, cache.ErrInvalidCursor) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		if err != nil {
+			log.Printf("error ocurred when browsing %s: %s", name, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("error ocurred when browsing " + name))
+			return
+		}
+
+		jsonResult, err := json.Marshal(result)
+		if err != nil {
+			log.Printf("error ocurred when marshalling %s: %s", name, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("error ocurred when marshalling " + name))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonResult)
+	}
+}
+
+func parseCacheBrowserParams(params url.Values) (query cacherepositories.CachedImagesQuery, options cache.BrowseOptions, err error) {
+	query = cacherepositories.CachedImagesQuery{
+		SourceImageURL:       params.Get("sourceImageURL"),
+		SourceImageURLPrefix: params.Get("sourceImageURLPrefix"),
+		ProcessorType:        params.Get("processorType"),
+		ProcessorEndpoint:    params.Get("processorEndpoint"),
+		MimeType:             params.Get("mimeType"),
+	}
+
+	options = cache.BrowseOptions{
+		SortBy: cacherepositories.CachedImagesSortField(params.Get("sortBy")),
+		Cursor: params.Get("cursor"),
+	}
+
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		options.Descending = true
+	default:
+		return query, options, errors.New("order query parameter must be asc or desc")
+	}
+
+	integers := map[string]*int64{"minSize": &query.MinImageSize, "maxSize": &query.MaxImageSize}
+	for param, value := range integers {
+		if raw := params.Get(param); raw != "" {
+			if *value, err = strconv.ParseInt(raw, 10, 64); err != nil || *value < 0 {
+				return query, options, fmt.Errorf("%s query parameter must be a non-negative integer", param)
+			}
+		}
+	}
+
+	if raw := params.Get("limit"); raw != "" {
+		if options.Limit, err = strconv.Atoi(raw); err != nil || options.Limit < 1 {
+			return query, options, errors.New("limit query parameter must be a positive integer")
+		}
+	}
+
+	times := map[string]*time.Time{"createdAfter": &query.CreatedAfter, "createdBefore": &query.CreatedBefore}
+	for param, value := range times {
+		if raw := params.Get(param); raw != "" {
+			if *value, err = time.Parse(time.RFC3339, raw); err != nil {
+				return query, options, fmt.Errorf("%s query parameter must be a RFC 3339 time", param)
+			}
+		}
+	}
+
+	return query, options, nil
+}
@@ -1,29 +1,347 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"flag"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/thebartekbanach/imcaxy/pkg/cache"
+	"github.com/thebartekbanach/imcaxy/pkg/proxy"
+	"github.com/thebartekbanach/imcaxy/pkg/warming"
 )
 
+// shutdownTimeout is the time given to handled requests to finish when the server is stopped
+const shutdownTimeout = 30 * time.Second
+
+// stoppingServices are services which finish their work after the server context
+// is cancelled, like the last write of collected cache accesses
+var stoppingServices sync.WaitGroup
+
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate-storage-keys" {
+		migrateStorageKeys(ctx)
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		reconcile(ctx, len(os.Args) > 2 && os.Args[2] == "--dry-run")
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "scrub" {
+		scrub(ctx, len(os.Args) > 2 && os.Args[2] == "--dry-run")
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		exportCache(ctx, os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		importCache(ctx, os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "warm" {
+		warm(ctx, os.Args[2:])
+		return
+	}
+
 	log.Println("initializing cache service")
 	cacheService := InitializeCache(ctx)
 
+	log.Println("initializing cache expiration sweeper")
+	InitializeCacheSweeper(ctx)
+
+	log.Println("initializing cache quota evictor")
+	InitializeCacheEvictor(ctx)
+
+	log.Println("initializing cache reconciler")
+	InitializeCacheReconciler(ctx).Start(ctx)
+
 	log.Println("initializing invalidation service")
 	invalidationService := InitializeInvalidator(ctx, cacheService)
 
+	log.Println("initializing imaginary processing service")
+	imaginaryProcessingService := InitializeImaginaryProcessor(ctx)
+
 	log.Println("initializing proxy service")
-	proxyService := InitializeProxy(ctx, cacheService)
+	proxyService := InitializeProxy(ctx, cacheService, imaginaryProcessingService)
+
+	log.Println("initializing cache warmer")
+	warmer := InitializeWarmer(ctx, proxyService)
+
+	log.Println("initializing cache browser")
+	cacheBrowser := InitializeCacheBrowser(ctx)
 
 	log.Println("registering http handlers")
 	http.HandleFunc("/", handleRequest(ctx, proxyService))
 	http.HandleFunc("/invalidate", handleInvalidationRequest(ctx, invalidationService))
 	http.HandleFunc("/lastInvalidation", handleLatestInvalidationInfoRequest(ctx, invalidationService))
+	http.HandleFunc("/admin/warming/jobs", handleWarmingJobsRequest(ctx, warmer))
+	http.HandleFunc("/admin/warming/jobs/", handleWarmingJobsRequest(ctx, warmer))
+	http.HandleFunc("/admin/cache/entries", handleCacheEntriesRequest(ctx, cacheBrowser))
+	http.HandleFunc("/admin/cache/sources", handleCacheSourcesRequest(ctx, cacheBrowser))
+	if imaginaryProcessingService != nil {
+		http.HandleFunc("/admin/backends", handleBackendsStatusRequest(imaginaryProcessingService))
+	}
+
+	server := &http.Server{Addr: ":80"}
+	go func() {
+		log.Println("listening on port 80")
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	<-signals
+
+	log.Println("shutting down")
+	shutdown(server, proxyService, cancel)
+}
+
+// shutdown waits for handled requests and saves of their images before the server context
+// is cancelled, requests use the server context, so they would be cancelled otherwise
+func shutdown(server *http.Server, proxyService proxy.ProxyService, cancel context.CancelFunc) {
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("handled requests did not finish before shutdown: %s", err)
+	}
+
+	proxyService.WaitForSaves()
+
+	cancel()
+	stoppingServices.Wait()
+}
+
+func migrateStorageKeys(ctx context.Context) {
+	log.Println("migrating cached images to hashed storage keys")
+	migratedImages, err := InitializeStorageKeysMigration(ctx).Migrate(ctx)
+	if err != nil {
+		log.Fatalf("storage keys migration failed after %d migrated images: %s", migratedImages, err)
+	}
+
+	log.Printf("migrated %d cached images", migratedImages)
+}
+
+func reconcile(ctx context.Context, dryRun bool) {
+	log.Println("reconciling cached images metadata with images storage")
+	report, err := InitializeCacheReconciler(ctx).Reconcile(ctx, dryRun)
+	if err != nil {
+		log.Fatalf("reconciliation failed after %d checked entries and %d checked images: %s", report.CheckedEntries, report.CheckedImages, err)
+	}
+
+	printReport(os.Stdout, report)
+}
+
+func scrub(ctx context.Context, dryRun bool) {
+	log.Println("verifying checksums of cached images")
+	report, err := InitializeCacheScrubber(ctx).Scrub(ctx, dryRun)
+	if err != nil {
+		log.Fatalf("scrub failed after %d checked images: %s", report.CheckedImages, err)
+	}
+
+	printReport(os.Stdout, report)
+}
+
+// exportCache writes the archive to the standard output when the archive path is -,
+// so the report is printed to the standard error then
+func exportCache(ctx context.Context, args []string) {
+	filter := cache.ExportFilter{}
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	project := flags.String("project", "", "name of project quota from IMCAXY_CACHE_PROJECT_QUOTAS whose images are exported")
+	flags.StringVar(&filter.SourceImageURLPrefix, "source-prefix", "", "prefix of source image URLs of exported images")
+	createdAfter := flags.String("created-after", "", "RFC 3339 time after which exported images were cached")
+	createdBefore := flags.String("created-before", "", "RFC 3339 time before which exported images were cached")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Fatal("usage: export [--project <name>] [--source-prefix <prefix>] [--created-after <time>] [--created-before <time>] <archive path or ->")
+	}
+
+	if *project != "" {
+		filter.SourceImageURLPattern = projectSourceImageURLPattern(*project)
+	}
+
+	filter.CreatedAfter = parseTimeFlag("created-after", *createdAfter)
+	filter.CreatedBefore = parseTimeFlag("created-before", *createdBefore)
+
+	archive, reportOutput := os.Stdout, os.Stdout
+	if path := flags.Arg(0); path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			log.Fatalf("could not create archive: %s", err)
+		}
+
+		defer file.Close()
+		archive = file
+	} else {
+		reportOutput = os.Stderr
+	}
+
+	log.Println("exporting cached images")
+	report, err := InitializeCacheArchiver(ctx).Export(ctx, archive, filter)
+	if err != nil {
+		log.Fatalf("export failed after %d exported images: %s", report.ExportedImages, err)
+	}
+
+	printReport(reportOutput, report)
+}
+
+func importCache(ctx context.Context, args []string) {
+	if len(args) != 1 {
+		log.Fatal("usage: import <archive path or ->")
+	}
+
+	archive := os.Stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			log.Fatalf("could not open archive: %s", err)
+		}
+
+		defer file.Close()
+		archive = file
+	}
+
+	log.Println("importing cached images")
+	report, err := InitializeCacheArchiver(ctx).Import(ctx, archive)
+	if err != nil {
+		log.Fatalf("import failed after %d imported images: %s", report.ImportedImages, err)
+	}
+
+	printReport(os.Stdout, report)
+}
+
+// projects are defined by quotas, so they are matched by the same source image URL patterns
+func projectSourceImageURLPattern(project string) string {
+	for _, quota := range InitializeQuotaEvictorConfig().Quotas {
+		if quota.Name == project {
+			return quota.SourceImageURL
+		}
+	}
+
+	log.Fatalf("project %s is not defined in IMCAXY_CACHE_PROJECT_QUOTAS", project)
+	return ""
+}
+
+func parseTimeFlag(name, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Fatalf("--%s must be RFC 3339 time, got: %s", name, value)
+	}
+
+	return parsed
+}
+
+// warm runs the warming job in this process, source image URLs
+// are read from the standard input when the only argument is -
+func warm(ctx context.Context, args []string) {
+	request := warming.JobRequest{}
+	flags := flag.NewFlagSet("warm", flag.ExitOnError)
+	flags.Var((*stringsFlag)(&request.Presets), "preset", "name of preset warmed for every source image URL, can be repeated")
+	flags.Var((*stringsFlag)(&request.Requests), "request", "request path warmed for every source image URL when it contains {url}, can be repeated")
+	flags.StringVar(&request.Origin, "origin", "", "origin sent with all requests")
+	flags.Parse(args)
+
+	request.SourceImageURLs = flags.Args()
+	if len(request.SourceImageURLs) == 1 && request.SourceImageURLs[0] == "-" {
+		request.SourceImageURLs = readLines(os.Stdin)
+	}
+
+	cacheService := InitializeCache(ctx)
+	proxyService := InitializeProxy(ctx, cacheService, InitializeImaginaryProcessor(ctx))
+	warmer := InitializeWarmer(ctx, proxyService)
+
+	job, err := warmer.Start(ctx, request)
+	if err != nil {
+		log.Fatalf("could not start warming job: %s", err)
+	}
+
+	log.Printf("warming %d requests", job.TotalItems)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				progress, _ := warmer.Job(job.ID)
+				log.Printf(
+					"warmed %d, skipped %d and failed %d of %d requests",
+					progress.WarmedItems, progress.SkippedItems, progress.FailedItems, progress.TotalItems,
+				)
+			}
+		}
+	}()
+
+	job, err = warmer.Wait(ctx, job.ID)
+	close(done)
+	if err != nil {
+		log.Fatalf("warming failed: %s", err)
+	}
+
+	// processed images are saved in the background
+	proxyService.WaitForSaves()
+	printReport(os.Stdout, job)
+}
+
+func readLines(file *os.File) []string {
+	lines := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("could not read standard input: %s", err)
+	}
+
+	return lines
+}
+
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
 
-	log.Println("listening on port 80")
-	log.Fatal(http.ListenAndServe(":80", nil))
+func printReport(w io.Writer, report interface{}) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatalf("could not print report: %s", err)
+	}
 }
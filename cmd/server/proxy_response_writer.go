@@ -2,8 +2,11 @@ package main
 
 import (
 	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type proxyResponseWriter struct {
@@ -24,3 +27,14 @@ func (w *proxyResponseWriter) WriteErrorWithFallback(code int, message string, f
 	io.Copy(w.w, fallbackImageReader)
 	fallbackImageReader.Close()
 }
+
+func (w *proxyResponseWriter) WriteErrorWithRetryAfter(code int, message string, retryAfter time.Duration) {
+	w.w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	w.w.WriteHeader(code)
+	io.Copy(w.w, strings.NewReader(message))
+}
+
+func (w *proxyResponseWriter) WriteRedirect(code int, location string) {
+	w.w.Header().Set("Location", location)
+	w.w.WriteHeader(code)
+}
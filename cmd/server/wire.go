@@ -5,22 +5,34 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
 	"log"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/wire"
 	"github.com/thebartekbanach/imcaxy/pkg/cache"
 	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
 	dbconnections "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/connections"
+	"github.com/thebartekbanach/imcaxy/pkg/circuitbreaker"
 	"github.com/thebartekbanach/imcaxy/pkg/filefetcher"
 	"github.com/thebartekbanach/imcaxy/pkg/hub"
 	datahubstorage "github.com/thebartekbanach/imcaxy/pkg/hub/storage"
 	"github.com/thebartekbanach/imcaxy/pkg/processor"
+	canonicalprocessor "github.com/thebartekbanach/imcaxy/pkg/processor/canonical"
+	genericprocessor "github.com/thebartekbanach/imcaxy/pkg/processor/generic"
 	imaginaryprocessor "github.com/thebartekbanach/imcaxy/pkg/processor/imaginary"
+	imgproxyprocessor "github.com/thebartekbanach/imcaxy/pkg/processor/imgproxy"
+	nativeprocessor "github.com/thebartekbanach/imcaxy/pkg/processor/native"
+	rawprocessor "github.com/thebartekbanach/imcaxy/pkg/processor/raw"
+	thumborprocessor "github.com/thebartekbanach/imcaxy/pkg/processor/thumbor"
 	"github.com/thebartekbanach/imcaxy/pkg/proxy"
+	"github.com/thebartekbanach/imcaxy/pkg/retry"
+	"github.com/thebartekbanach/imcaxy/pkg/warming"
 )
 
 func InitializeMongoConnectionConfig() dbconnections.CacheDBConfig {
@@ -53,9 +65,95 @@ func InitializeMongoConnection(ctx context.Context, mongoConfig dbconnections.Ca
 		log.Panicf("Error ocurred when initializing MongoDB connection: %s", err)
 	}
 
+	if err := cacherepositories.CreateMongoCacheDBIndexes(ctx, cacheDbConnection); err != nil {
+		log.Panicf("Error ocurred when creating MongoDB indexes: %s", err)
+	}
+
 	return cacheDbConnection
 }
 
+func InitializeSQLConnectionConfig(dialect dbconnections.SQLDialect) dbconnections.SQLCacheDBConfig {
+	config := dbconnections.SQLCacheDBConfig{
+		Dialect:          dialect,
+		ConnectionString: os.Getenv("IMCAXY_SQL_CONNECTION_STRING"),
+	}
+
+	if config.ConnectionString == "" {
+		log.Panic("IMCAXY_SQL_CONNECTION_STRING is required environment variable when SQL database is used")
+	}
+
+	return config
+}
+
+// InitializeSQLConnection migrates the schema of the database before it is used
+func InitializeSQLConnection(ctx context.Context, sqlConfig dbconnections.SQLCacheDBConfig) dbconnections.CacheDBConnection {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	cacheDbConnection, err := dbconnections.NewSQLCacheDBProductionConnection(ctx, sqlConfig)
+	if err != nil {
+		log.Panicf("Error ocurred when initializing SQL database connection: %s", err)
+	}
+
+	appliedMigrations, err := cacherepositories.MigrateSQLCacheDB(ctx, cacheDbConnection)
+	if err != nil {
+		log.Panicf("Error ocurred when migrating SQL database: %s", err)
+	}
+
+	if appliedMigrations > 0 {
+		log.Printf("Applied %d SQL database migrations", appliedMigrations)
+	}
+
+	return cacheDbConnection
+}
+
+var embeddedConnection struct {
+	once sync.Once
+	conn dbconnections.BoltCacheDBConnection
+}
+
+// InitializeEmbeddedConnection opens the embedded database only once, because its
+// file can be opened only by one connection, which is shared by all services
+func InitializeEmbeddedConnection(path string) dbconnections.BoltCacheDBConnection {
+	embeddedConnection.once.Do(func() {
+		conn, err := dbconnections.NewBoltCacheDBProductionConnection(dbconnections.BoltCacheDBConfig{Path: path})
+		if err != nil {
+			log.Panicf("Error ocurred when opening embedded database: %s", err)
+		}
+
+		if err := cacherepositories.CreateBoltCacheDBBuckets(conn); err != nil {
+			log.Panicf("Error ocurred when creating buckets of embedded database: %s", err)
+		}
+
+		embeddedConnection.conn = conn
+	})
+
+	return embeddedConnection.conn
+}
+
+// InitializeCacheDBConnection selects the database keeping metadata of cached
+// images, connection is initialized only to the selected database
+func InitializeCacheDBConnection(ctx context.Context) dbconnections.CacheDBConnection {
+	if path := os.Getenv("IMCAXY_EMBEDDED_DATABASE"); path != "" {
+		return InitializeEmbeddedConnection(path)
+	}
+
+	switch database := os.Getenv("IMCAXY_CACHE_DATABASE"); database {
+	case "", "mongo":
+		return InitializeMongoConnection(ctx, InitializeMongoConnectionConfig())
+
+	case "postgres":
+		return InitializeSQLConnection(ctx, InitializeSQLConnectionConfig(dbconnections.PostgresDialect))
+
+	case "sqlite":
+		return InitializeSQLConnection(ctx, InitializeSQLConnectionConfig(dbconnections.SQLiteDialect))
+
+	default:
+		log.Panicf("IMCAXY_CACHE_DATABASE must be one of: mongo, postgres, sqlite, got: %s", database)
+		return nil
+	}
+}
+
 func InitializeMinioConnectionConfig() dbconnections.MinioBlockStorageProductionConnectionConfig {
 	config := dbconnections.MinioBlockStorageProductionConnectionConfig{
 		Endpoint:  os.Getenv("IMCAXY_MINIO_ENDPOINT"),
@@ -105,20 +203,762 @@ func InitializeMinioConnection(ctx context.Context, minioConfig dbconnections.Mi
 	return &minioBlockStorageConnection
 }
 
-func InitializeImaginaryProcessingService() imaginaryprocessor.Processor {
+func InitializeDiskImagesStorageConfig() cacherepositories.DiskImagesStorageConfig {
+	config := cacherepositories.DiskImagesStorageConfig{
+		Directory: os.Getenv("IMCAXY_CACHE_DISK_DIRECTORY"),
+		MaxSize:   10 * 1024 * 1024 * 1024,
+	}
+
+	if maxSize := os.Getenv("IMCAXY_CACHE_DISK_SIZE"); maxSize != "" {
+		value, err := strconv.ParseInt(maxSize, 10, 64)
+		if err != nil || value <= 0 {
+			log.Panicf("IMCAXY_CACHE_DISK_SIZE must be a positive number of bytes, got: %s", maxSize)
+		}
+
+		config.MaxSize = value
+	}
+
+	return config
+}
+
+// InitializeImagesStorage selects the storage backend, Minio
+// connection is initialized only when Minio backend is selected
+func InitializeImagesStorage(ctx context.Context) cacherepositories.CachedImagesStorage {
+	if path := os.Getenv("IMCAXY_EMBEDDED_DATABASE"); path != "" {
+		return cacherepositories.NewBoltImagesStorage(InitializeEmbeddedConnection(path))
+	}
+
+	switch backend := os.Getenv("IMCAXY_CACHE_STORAGE"); backend {
+	case "", "minio":
+		minioConnection := InitializeMinioConnection(ctx, InitializeMinioConnectionConfig())
+		return cacherepositories.NewCachedImagesStorage(minioConnection)
+
+	case "filesystem":
+		directory := os.Getenv("IMCAXY_CACHE_STORAGE_DIRECTORY")
+		if directory == "" {
+			log.Panic("IMCAXY_CACHE_STORAGE_DIRECTORY is required environment variable when filesystem storage is used")
+		}
+
+		storage, err := cacherepositories.NewFileImagesStorage(directory)
+		if err != nil {
+			log.Panicf("Error ocurred when initializing filesystem storage: %s", err)
+		}
+
+		return storage
+
+	default:
+		log.Panicf("IMCAXY_CACHE_STORAGE must be one of: minio, filesystem, got: %s", backend)
+		return nil
+	}
+}
+
+// InitializeTieredImagesStorage puts the disk tier in front of the storage when it is enabled,
+// it is used only by the cache service, because every disk tier has its own index
+func InitializeTieredImagesStorage(ctx context.Context, diskConfig cacherepositories.DiskImagesStorageConfig) cacherepositories.CachedImagesStorage {
+	storage := InitializeImagesStorage(ctx)
+	if diskConfig.Directory == "" {
+		return storage
+	}
+
+	diskStorage, err := cacherepositories.NewDiskImagesStorage(diskConfig, storage)
+	if err != nil {
+		log.Panicf("Error ocurred when initializing disk cache tier: %s", err)
+	}
+
+	return diskStorage
+}
+
+func InitializeExpirationPolicy() cache.ExpirationPolicy {
+	policy := cache.ExpirationPolicy{}
+
+	if defaultTTL := os.Getenv("IMCAXY_CACHE_TTL"); defaultTTL != "" {
+		value, err := time.ParseDuration(defaultTTL)
+		if err != nil || value < 0 {
+			log.Panicf("IMCAXY_CACHE_TTL must be a non-negative duration, got: %s", defaultTTL)
+		}
+
+		policy.DefaultTTL = value
+	}
+
+	if rules := os.Getenv("IMCAXY_CACHE_TTL_RULES"); rules != "" {
+		value, err := cache.ParseExpirationRules([]byte(rules))
+		if err != nil {
+			log.Panicf("Error ocurred when parsing IMCAXY_CACHE_TTL_RULES: %s", err)
+		}
+
+		policy.Rules = value
+	}
+
+	return policy
+}
+
+func InitializeExpirationSweeperConfig() cache.ExpirationSweeperConfig {
+	config := cache.ExpirationSweeperConfig{
+		Interval:       10 * time.Minute,
+		BatchSize:      100,
+		PendingTimeout: time.Hour,
+	}
+
+	if interval := os.Getenv("IMCAXY_CACHE_SWEEP_INTERVAL"); interval != "" {
+		value, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Panicf("Error ocurred when parsing IMCAXY_CACHE_SWEEP_INTERVAL: %s", err)
+		}
+
+		config.Interval = value
+	}
+
+	if batchSize := os.Getenv("IMCAXY_CACHE_SWEEP_BATCH_SIZE"); batchSize != "" {
+		value, err := strconv.Atoi(batchSize)
+		if err != nil || value < 1 {
+			log.Panicf("IMCAXY_CACHE_SWEEP_BATCH_SIZE must be a positive integer, got: %s", batchSize)
+		}
+
+		config.BatchSize = value
+	}
+
+	if pendingTimeout := os.Getenv("IMCAXY_CACHE_PENDING_TIMEOUT"); pendingTimeout != "" {
+		value, err := time.ParseDuration(pendingTimeout)
+		if err != nil || value < 0 {
+			log.Panicf("IMCAXY_CACHE_PENDING_TIMEOUT must be a non-negative duration, got: %s", pendingTimeout)
+		}
+
+		config.PendingTimeout = value
+	}
+
+	return config
+}
+
+func InitializeExpirationSweeper(
+	ctx context.Context,
+	config cache.ExpirationSweeperConfig,
+	imagesRepository cacherepositories.CachedImagesRepository,
+	imagesStorage cacherepositories.CachedImagesStorage,
+) *cache.ExpirationSweeper {
+	sweeper := cache.NewExpirationSweeper(config, imagesRepository, imagesStorage)
+	sweeper.Start(ctx)
+	return sweeper
+}
+
+func InitializeAccessRecorderConfig() cache.AccessRecorderConfig {
+	config := cache.AccessRecorderConfig{
+		FlushInterval: 30 * time.Second,
+	}
+
+	if flushInterval := os.Getenv("IMCAXY_CACHE_ACCESS_FLUSH_INTERVAL"); flushInterval != "" {
+		value, err := time.ParseDuration(flushInterval)
+		if err != nil || value <= 0 {
+			log.Panicf("IMCAXY_CACHE_ACCESS_FLUSH_INTERVAL must be a positive duration, got: %s", flushInterval)
+		}
+
+		config.FlushInterval = value
+	}
+
+	return config
+}
+
+func InitializeAccessRecorder(
+	ctx context.Context,
+	config cache.AccessRecorderConfig,
+	imagesRepository cacherepositories.CachedImagesRepository,
+) *cache.AccessRecorder {
+	recorder := cache.NewAccessRecorder(config, imagesRepository)
+	recorder.Start(ctx)
+
+	// collected accesses are written when the server context is cancelled
+	stoppingServices.Add(1)
+	go func() {
+		<-recorder.Stopped()
+		stoppingServices.Done()
+	}()
+
+	return recorder
+}
+
+func InitializeMemoryTierConfig() cache.MemoryTierConfig {
+	config := cache.MemoryTierConfig{
+		MaxSize:      64 * 1024 * 1024,
+		MaxEntrySize: 1024 * 1024,
+	}
+
+	if maxSize := os.Getenv("IMCAXY_CACHE_MEMORY_SIZE"); maxSize != "" {
+		value, err := strconv.ParseInt(maxSize, 10, 64)
+		if err != nil || value < 0 {
+			log.Panicf("IMCAXY_CACHE_MEMORY_SIZE must be a non-negative number of bytes, got: %s", maxSize)
+		}
+
+		config.MaxSize = value
+	}
+
+	if maxEntrySize := os.Getenv("IMCAXY_CACHE_MEMORY_MAX_ENTRY_SIZE"); maxEntrySize != "" {
+		value, err := strconv.ParseInt(maxEntrySize, 10, 64)
+		if err != nil || value <= 0 {
+			log.Panicf("IMCAXY_CACHE_MEMORY_MAX_ENTRY_SIZE must be a positive number of bytes, got: %s", maxEntrySize)
+		}
+
+		config.MaxEntrySize = value
+	}
+
+	return config
+}
+
+func InitializeIntegrityPolicy() cache.IntegrityPolicy {
+	policy := cache.IntegrityPolicy{
+		VerificationRatio: 0.01,
+	}
+
+	if ratio := os.Getenv("IMCAXY_CACHE_CHECKSUM_VERIFICATION_RATIO"); ratio != "" {
+		value, err := strconv.ParseFloat(ratio, 64)
+		if err != nil || value < 0 || value > 1 {
+			log.Panicf("IMCAXY_CACHE_CHECKSUM_VERIFICATION_RATIO must be a number in range [0, 1], got: %s", ratio)
+		}
+
+		policy.VerificationRatio = value
+	}
+
+	return policy
+}
+
+func InitializeQuotaEvictorConfig() cache.QuotaEvictorConfig {
+	config := cache.QuotaEvictorConfig{
+		HighWaterMark: 0.9,
+		LowWaterMark:  0.8,
+		Order:         cacherepositories.LeastRecentlyUsed,
+		Interval:      time.Minute,
+		BatchSize:     100,
+	}
+
+	if quota := os.Getenv("IMCAXY_CACHE_QUOTA"); quota != "" {
+		value, err := strconv.ParseInt(quota, 10, 64)
+		if err != nil || value <= 0 {
+			log.Panicf("IMCAXY_CACHE_QUOTA must be a positive number of bytes, got: %s", quota)
+		}
+
+		config.Quotas = append(config.Quotas, cache.Quota{Name: "global", MaxSize: value})
+	}
+
+	if projectQuotas := os.Getenv("IMCAXY_CACHE_PROJECT_QUOTAS"); projectQuotas != "" {
+		value, err := cache.ParseQuotas([]byte(projectQuotas))
+		if err != nil {
+			log.Panicf("Error ocurred when parsing IMCAXY_CACHE_PROJECT_QUOTAS: %s", err)
+		}
+
+		config.Quotas = append(config.Quotas, value...)
+	}
+
+	if highWaterMark := os.Getenv("IMCAXY_CACHE_HIGH_WATER_MARK"); highWaterMark != "" {
+		value, err := strconv.ParseFloat(highWaterMark, 64)
+		if err != nil || value <= 0 || value > 1 {
+			log.Panicf("IMCAXY_CACHE_HIGH_WATER_MARK must be a number in range (0, 1], got: %s", highWaterMark)
+		}
+
+		config.HighWaterMark = value
+	}
+
+	if lowWaterMark := os.Getenv("IMCAXY_CACHE_LOW_WATER_MARK"); lowWaterMark != "" {
+		value, err := strconv.ParseFloat(lowWaterMark, 64)
+		if err != nil || value < 0 || value > 1 {
+			log.Panicf("IMCAXY_CACHE_LOW_WATER_MARK must be a number in range [0, 1], got: %s", lowWaterMark)
+		}
+
+		config.LowWaterMark = value
+	}
+
+	if config.LowWaterMark > config.HighWaterMark {
+		log.Panicf("IMCAXY_CACHE_LOW_WATER_MARK must not be greater than IMCAXY_CACHE_HIGH_WATER_MARK")
+	}
+
+	if order := os.Getenv("IMCAXY_CACHE_EVICTION_POLICY"); order != "" {
+		config.Order = cacherepositories.EvictionOrder(order)
+	}
+
+	if config.Order != cacherepositories.LeastRecentlyUsed && config.Order != cacherepositories.LeastFrequentlyUsed {
+		log.Panicf("IMCAXY_CACHE_EVICTION_POLICY must be one of: lru, lfu, got: %s", config.Order)
+	}
+
+	if interval := os.Getenv("IMCAXY_CACHE_EVICTION_INTERVAL"); interval != "" {
+		value, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Panicf("Error ocurred when parsing IMCAXY_CACHE_EVICTION_INTERVAL: %s", err)
+		}
+
+		config.Interval = value
+	}
+
+	if batchSize := os.Getenv("IMCAXY_CACHE_EVICTION_BATCH_SIZE"); batchSize != "" {
+		value, err := strconv.Atoi(batchSize)
+		if err != nil || value < 1 {
+			log.Panicf("IMCAXY_CACHE_EVICTION_BATCH_SIZE must be a positive integer, got: %s", batchSize)
+		}
+
+		config.BatchSize = value
+	}
+
+	return config
+}
+
+func InitializeQuotaEvictor(
+	ctx context.Context,
+	config cache.QuotaEvictorConfig,
+	imagesRepository cacherepositories.CachedImagesRepository,
+	imagesStorage cacherepositories.CachedImagesStorage,
+) *cache.QuotaEvictor {
+	evictor := cache.NewQuotaEvictor(config, imagesRepository, imagesStorage)
+	evictor.Start(ctx)
+	return evictor
+}
+
+func InitializeReconcilerConfig() cache.ReconcilerConfig {
+	config := cache.ReconcilerConfig{
+		MinAge:    time.Hour,
+		BatchSize: 100,
+	}
+
+	if interval := os.Getenv("IMCAXY_CACHE_RECONCILIATION_INTERVAL"); interval != "" {
+		value, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Panicf("Error ocurred when parsing IMCAXY_CACHE_RECONCILIATION_INTERVAL: %s", err)
+		}
+
+		config.Interval = value
+	}
+
+	if minAge := os.Getenv("IMCAXY_CACHE_RECONCILIATION_MIN_AGE"); minAge != "" {
+		value, err := time.ParseDuration(minAge)
+		if err != nil || value < 0 {
+			log.Panicf("IMCAXY_CACHE_RECONCILIATION_MIN_AGE must be a non-negative duration, got: %s", minAge)
+		}
+
+		config.MinAge = value
+	}
+
+	if batchSize := os.Getenv("IMCAXY_CACHE_RECONCILIATION_BATCH_SIZE"); batchSize != "" {
+		value, err := strconv.Atoi(batchSize)
+		if err != nil || value < 1 {
+			log.Panicf("IMCAXY_CACHE_RECONCILIATION_BATCH_SIZE must be a positive integer, got: %s", batchSize)
+		}
+
+		config.BatchSize = value
+	}
+
+	return config
+}
+
+func InitializeScrubberConfig() cache.ScrubberConfig {
+	config := cache.ScrubberConfig{
+		BatchSize: 100,
+	}
+
+	if batchSize := os.Getenv("IMCAXY_CACHE_SCRUB_BATCH_SIZE"); batchSize != "" {
+		value, err := strconv.Atoi(batchSize)
+		if err != nil || value < 1 {
+			log.Panicf("IMCAXY_CACHE_SCRUB_BATCH_SIZE must be a positive integer, got: %s", batchSize)
+		}
+
+		config.BatchSize = value
+	}
+
+	return config
+}
+
+func InitializeInvalidationServiceConfig() cache.InvalidationServiceConfig {
+	config := cache.InvalidationServiceConfig{
+		MaxPatternMatches: 1000,
+	}
+
+	if maxPatternMatches := os.Getenv("IMCAXY_INVALIDATION_MAX_PATTERN_MATCHES"); maxPatternMatches != "" {
+		value, err := strconv.Atoi(maxPatternMatches)
+		if err != nil || value < 1 {
+			log.Panicf("IMCAXY_INVALIDATION_MAX_PATTERN_MATCHES must be a positive integer, got: %s", maxPatternMatches)
+		}
+
+		config.MaxPatternMatches = value
+	}
+
+	return config
+}
+
+func InitializeCacheArchiverConfig() cache.CacheArchiverConfig {
+	config := cache.CacheArchiverConfig{
+		BatchSize: 100,
+	}
+
+	if batchSize := os.Getenv("IMCAXY_CACHE_ARCHIVE_BATCH_SIZE"); batchSize != "" {
+		value, err := strconv.Atoi(batchSize)
+		if err != nil || value < 1 {
+			log.Panicf("IMCAXY_CACHE_ARCHIVE_BATCH_SIZE must be a positive integer, got: %s", batchSize)
+		}
+
+		config.BatchSize = value
+	}
+
+	return config
+}
+
+func InitializeWarmerConfig() warming.WarmerConfig {
+	config := warming.WarmerConfig{
+		Concurrency: 4,
+		MaxJobItems: 10000,
+	}
+
+	if concurrency := os.Getenv("IMCAXY_WARMING_CONCURRENCY"); concurrency != "" {
+		value, err := strconv.Atoi(concurrency)
+		if err != nil || value < 1 {
+			log.Panicf("IMCAXY_WARMING_CONCURRENCY must be a positive integer, got: %s", concurrency)
+		}
+
+		config.Concurrency = value
+	}
+
+	if maxJobItems := os.Getenv("IMCAXY_WARMING_MAX_JOB_ITEMS"); maxJobItems != "" {
+		value, err := strconv.Atoi(maxJobItems)
+		if err != nil || value < 1 {
+			log.Panicf("IMCAXY_WARMING_MAX_JOB_ITEMS must be a positive integer, got: %s", maxJobItems)
+		}
+
+		config.MaxJobItems = value
+	}
+
+	if presets := os.Getenv("IMCAXY_WARMING_PRESETS"); presets != "" {
+		value, err := warming.ParsePresets([]byte(presets))
+		if err != nil {
+			log.Panicf("Error ocurred when parsing IMCAXY_WARMING_PRESETS: %s", err)
+		}
+
+		config.Presets = value
+	}
+
+	return config
+}
+
+func InitializeRetryPolicy() retry.Policy {
+	policy := retry.DefaultPolicy()
+
+	if maxAttempts := os.Getenv("IMCAXY_RETRY_MAX_ATTEMPTS"); maxAttempts != "" {
+		value, err := strconv.Atoi(maxAttempts)
+		if err != nil || value < 1 {
+			log.Panicf("IMCAXY_RETRY_MAX_ATTEMPTS must be a positive integer, got: %s", maxAttempts)
+		}
+
+		policy.MaxAttempts = value
+	}
+
+	if initialBackoff := os.Getenv("IMCAXY_RETRY_INITIAL_BACKOFF"); initialBackoff != "" {
+		value, err := time.ParseDuration(initialBackoff)
+		if err != nil {
+			log.Panicf("Error ocurred when parsing IMCAXY_RETRY_INITIAL_BACKOFF: %s", err)
+		}
+
+		policy.InitialBackoff = value
+	}
+
+	if maxBackoff := os.Getenv("IMCAXY_RETRY_MAX_BACKOFF"); maxBackoff != "" {
+		value, err := time.ParseDuration(maxBackoff)
+		if err != nil {
+			log.Panicf("Error ocurred when parsing IMCAXY_RETRY_MAX_BACKOFF: %s", err)
+		}
+
+		policy.MaxBackoff = value
+	}
+
+	if multiplier := os.Getenv("IMCAXY_RETRY_BACKOFF_MULTIPLIER"); multiplier != "" {
+		value, err := strconv.ParseFloat(multiplier, 64)
+		if err != nil || value < 1 {
+			log.Panicf("IMCAXY_RETRY_BACKOFF_MULTIPLIER must be a number not lower than 1, got: %s", multiplier)
+		}
+
+		policy.Multiplier = value
+	}
+
+	if jitter := os.Getenv("IMCAXY_RETRY_JITTER"); jitter != "" {
+		value, err := strconv.ParseFloat(jitter, 64)
+		if err != nil || value < 0 || value > 1 {
+			log.Panicf("IMCAXY_RETRY_JITTER must be a number in range from 0 to 1, got: %s", jitter)
+		}
+
+		policy.Jitter = value
+	}
+
+	if statusCodes := os.Getenv("IMCAXY_RETRY_STATUS_CODES"); statusCodes != "" {
+		policy.RetryableStatusCodes = []int{}
+		for _, statusCode := range strings.Split(statusCodes, ",") {
+			value, err := strconv.Atoi(strings.TrimSpace(statusCode))
+			if err != nil {
+				log.Panicf("IMCAXY_RETRY_STATUS_CODES must be a comma separated list of status codes, got: %s", statusCodes)
+			}
+
+			policy.RetryableStatusCodes = append(policy.RetryableStatusCodes, value)
+		}
+	}
+
+	return policy
+}
+
+func InitializeCircuitBreakerConfig() circuitbreaker.Config {
+	config := circuitbreaker.Config{
+		FailureThreshold:    5,
+		OpenDuration:        30 * time.Second,
+		HalfOpenMaxRequests: 1,
+	}
+
+	if failureThreshold := os.Getenv("IMCAXY_CIRCUIT_BREAKER_FAILURE_THRESHOLD"); failureThreshold != "" {
+		value, err := strconv.Atoi(failureThreshold)
+		if err != nil || value < 0 {
+			log.Panicf("IMCAXY_CIRCUIT_BREAKER_FAILURE_THRESHOLD must be a non-negative integer, got: %s", failureThreshold)
+		}
+
+		config.FailureThreshold = value
+	}
+
+	if openDuration := os.Getenv("IMCAXY_CIRCUIT_BREAKER_OPEN_DURATION"); openDuration != "" {
+		value, err := time.ParseDuration(openDuration)
+		if err != nil {
+			log.Panicf("Error ocurred when parsing IMCAXY_CIRCUIT_BREAKER_OPEN_DURATION: %s", err)
+		}
+
+		config.OpenDuration = value
+	}
+
+	if halfOpenRequests := os.Getenv("IMCAXY_CIRCUIT_BREAKER_HALF_OPEN_REQUESTS"); halfOpenRequests != "" {
+		value, err := strconv.Atoi(halfOpenRequests)
+		if err != nil || value < 1 {
+			log.Panicf("IMCAXY_CIRCUIT_BREAKER_HALF_OPEN_REQUESTS must be a positive integer, got: %s", halfOpenRequests)
+		}
+
+		config.HalfOpenMaxRequests = value
+	}
+
+	return config
+}
+
+func InitializeImaginaryProcessingService(ctx context.Context, retryPolicy retry.Policy, circuitBreaker circuitbreaker.Config) *imaginaryprocessor.Processor {
 	config := imaginaryprocessor.Config{
-		ImaginaryServiceURL: os.Getenv("IMCAXY_IMAGINARY_SERVICE_URL"),
+		ImaginaryServiceURL:    os.Getenv("IMCAXY_IMAGINARY_SERVICE_URL"),
+		BalancingStrategy:      imaginaryprocessor.BalancingStrategy(os.Getenv("IMCAXY_IMAGINARY_BALANCING_STRATEGY")),
+		MaxConsecutiveFailures: 5,
+		EjectionDuration:       30 * time.Second,
+		HealthCheck: imaginaryprocessor.HealthCheckConfig{
+			Interval: 10 * time.Second,
+			Timeout:  2 * time.Second,
+			Path:     "/health",
+		},
+		CircuitBreaker: circuitBreaker,
+		RetryPolicy:    retryPolicy,
 	}
 
-	if config.ImaginaryServiceURL == "" {
-		log.Panic("IMCAXY_IMAGINARY_SERVICE_URL is required environment variable")
+	if backends := os.Getenv("IMCAXY_IMAGINARY_SERVICE_URLS"); backends != "" {
+		for _, backend := range strings.Split(backends, ",") {
+			backendConfig := imaginaryprocessor.BackendConfig{URL: strings.TrimSpace(backend), Weight: 1}
+
+			if separatorIndex := strings.LastIndex(backendConfig.URL, "="); separatorIndex != -1 {
+				weight, err := strconv.Atoi(backendConfig.URL[separatorIndex+1:])
+				if err != nil || weight < 1 {
+					log.Panicf("Weight of imaginary backend must be a positive integer, got: %s", backend)
+				}
+
+				backendConfig.URL = backendConfig.URL[:separatorIndex]
+				backendConfig.Weight = weight
+			}
+
+			if _, err := url.Parse(backendConfig.URL); err != nil || backendConfig.URL == "" {
+				log.Panicf("Error ocurred when parsing IMCAXY_IMAGINARY_SERVICE_URLS entry %s: %v", backend, err)
+			}
+
+			config.Backends = append(config.Backends, backendConfig)
+		}
+	}
+
+	if config.ImaginaryServiceURL == "" && len(config.Backends) == 0 {
+		log.Println("imaginary processing service is disabled, IMCAXY_IMAGINARY_SERVICE_URL and IMCAXY_IMAGINARY_SERVICE_URLS are not set")
+		return nil
 	}
 
 	if _, err := url.Parse(config.ImaginaryServiceURL); err != nil {
 		log.Panicf("Error ocurred when parsing IMCAXY_IMAGINARY_SERVICE_URL: %s", err)
 	}
 
-	return imaginaryprocessor.NewProcessor(config)
+	switch config.BalancingStrategy {
+	case "":
+		config.BalancingStrategy = imaginaryprocessor.LeastOutstandingRequests
+	case imaginaryprocessor.LeastOutstandingRequests, imaginaryprocessor.WeightedRoundRobin:
+	default:
+		log.Panicf("IMCAXY_IMAGINARY_BALANCING_STRATEGY must be one of: least-outstanding, weighted-round-robin, got: %s", config.BalancingStrategy)
+	}
+
+	if interval := os.Getenv("IMCAXY_IMAGINARY_HEALTH_CHECK_INTERVAL"); interval != "" {
+		value, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Panicf("Error ocurred when parsing IMCAXY_IMAGINARY_HEALTH_CHECK_INTERVAL: %s", err)
+		}
+
+		config.HealthCheck.Interval = value
+	}
+
+	if timeout := os.Getenv("IMCAXY_IMAGINARY_HEALTH_CHECK_TIMEOUT"); timeout != "" {
+		value, err := time.ParseDuration(timeout)
+		if err != nil {
+			log.Panicf("Error ocurred when parsing IMCAXY_IMAGINARY_HEALTH_CHECK_TIMEOUT: %s", err)
+		}
+
+		config.HealthCheck.Timeout = value
+	}
+
+	if maxFailures := os.Getenv("IMCAXY_IMAGINARY_MAX_CONSECUTIVE_FAILURES"); maxFailures != "" {
+		value, err := strconv.Atoi(maxFailures)
+		if err != nil || value < 0 {
+			log.Panicf("IMCAXY_IMAGINARY_MAX_CONSECUTIVE_FAILURES must be a non-negative integer, got: %s", maxFailures)
+		}
+
+		config.MaxConsecutiveFailures = value
+	}
+
+	if ejectionDuration := os.Getenv("IMCAXY_IMAGINARY_EJECTION_DURATION"); ejectionDuration != "" {
+		value, err := time.ParseDuration(ejectionDuration)
+		if err != nil {
+			log.Panicf("Error ocurred when parsing IMCAXY_IMAGINARY_EJECTION_DURATION: %s", err)
+		}
+
+		config.EjectionDuration = value
+	}
+
+	processor := imaginaryprocessor.NewProcessor(config)
+	processor.StartHealthChecks(ctx)
+	return &processor
+}
+
+func InitializeNativeProcessingService(retryPolicy retry.Policy) *nativeprocessor.Processor {
+	if os.Getenv("IMCAXY_NATIVE_PROCESSOR_ENABLED") == "false" {
+		return nil
+	}
+
+	config := nativeprocessor.DefaultConfig()
+	config.RetryPolicy = retryPolicy
+
+	if maxSourceImageSize := os.Getenv("IMCAXY_NATIVE_MAX_SOURCE_IMAGE_SIZE"); maxSourceImageSize != "" {
+		value, err := strconv.ParseInt(maxSourceImageSize, 10, 64)
+		if err != nil || value < 1 {
+			log.Panicf("IMCAXY_NATIVE_MAX_SOURCE_IMAGE_SIZE must be a positive integer, got: %s", maxSourceImageSize)
+		}
+
+		config.MaxSourceImageSize = value
+	}
+
+	if maxImagePixels := os.Getenv("IMCAXY_NATIVE_MAX_IMAGE_PIXELS"); maxImagePixels != "" {
+		value, err := strconv.ParseInt(maxImagePixels, 10, 64)
+		if err != nil || value < 1 {
+			log.Panicf("IMCAXY_NATIVE_MAX_IMAGE_PIXELS must be a positive integer, got: %s", maxImagePixels)
+		}
+
+		config.MaxImagePixels = value
+	}
+
+	if maxConcurrentOperations := os.Getenv("IMCAXY_NATIVE_MAX_CONCURRENT_OPERATIONS"); maxConcurrentOperations != "" {
+		value, err := strconv.Atoi(maxConcurrentOperations)
+		if err != nil || value < 1 {
+			log.Panicf("IMCAXY_NATIVE_MAX_CONCURRENT_OPERATIONS must be a positive integer, got: %s", maxConcurrentOperations)
+		}
+
+		config.MaxConcurrentOperations = value
+	}
+
+	processor := nativeprocessor.NewProcessor(config)
+	return &processor
+}
+
+func InitializeThumborProcessingService(imaginaryProcessingService *imaginaryprocessor.Processor) *thumborprocessor.Processor {
+	if imaginaryProcessingService == nil {
+		return nil
+	}
+
+	config := thumborprocessor.Config{
+		SecurityKey: os.Getenv("IMCAXY_THUMBOR_SECURITY_KEY"),
+		AllowUnsafe: os.Getenv("IMCAXY_THUMBOR_ALLOW_UNSAFE") != "false",
+	}
+
+	processor := thumborprocessor.NewProcessor(config, imaginaryProcessingService)
+	return &processor
+}
+
+func InitializeImgproxyProcessingService(imaginaryProcessingService *imaginaryprocessor.Processor) *imgproxyprocessor.Processor {
+	if imaginaryProcessingService == nil {
+		return nil
+	}
+
+	key, err := hex.DecodeString(os.Getenv("IMCAXY_IMGPROXY_KEY"))
+	if err != nil {
+		log.Panicf("Error ocurred when decoding IMCAXY_IMGPROXY_KEY: %s", err)
+	}
+
+	salt, err := hex.DecodeString(os.Getenv("IMCAXY_IMGPROXY_SALT"))
+	if err != nil {
+		log.Panicf("Error ocurred when decoding IMCAXY_IMGPROXY_SALT: %s", err)
+	}
+
+	if len(key) > 0 && len(salt) == 0 {
+		log.Panic("IMCAXY_IMGPROXY_SALT is required environment variable when IMCAXY_IMGPROXY_KEY is set")
+	}
+
+	processor := imgproxyprocessor.NewProcessor(imgproxyprocessor.Config{Key: key, Salt: salt}, imaginaryProcessingService)
+	return &processor
+}
+
+func InitializeRawProcessingService(fetcher filefetcher.Fetcher) *rawprocessor.Processor {
+	if os.Getenv("IMCAXY_RAW_PROCESSOR_ENABLED") == "false" {
+		return nil
+	}
+
+	processor := rawprocessor.NewProcessor(fetcher)
+	return &processor
+}
+
+func InitializeGenericProcessingServices(retryPolicy retry.Policy) []*genericprocessor.Processor {
+	rawConfigs := os.Getenv("IMCAXY_GENERIC_PROCESSORS")
+	if rawConfigs == "" {
+		return nil
+	}
+
+	configs, err := genericprocessor.ParseConfigs([]byte(rawConfigs))
+	if err != nil {
+		log.Panicf("Error ocurred when parsing IMCAXY_GENERIC_PROCESSORS: %s", err)
+	}
+
+	processors := make([]*genericprocessor.Processor, len(configs))
+	for i, config := range configs {
+		config.RetryPolicy = retryPolicy
+		processor := genericprocessor.NewProcessor(config)
+		processors[i] = &processor
+	}
+
+	return processors
+}
+
+// canonicalizeProcessors wraps processors accepting query params,
+// path based thumbor and imgproxy processors are left as they are
+func canonicalizeProcessors(processors map[string]processor.ProcessingService, genericProcessingServices []*genericprocessor.Processor) {
+	rules := map[string]canonicalprocessor.Rules{
+		"imaginary": canonicalprocessor.ImaginaryRules(),
+		"native":    canonicalprocessor.NativeRules(),
+		"raw":       canonicalprocessor.SourceURLRules("url"),
+	}
+
+	for _, genericProcessingService := range genericProcessingServices {
+		rules[genericProcessingService.Name()] = canonicalprocessor.SourceURLRules(genericProcessingService.SourceURLParam())
+	}
+
+	ignoredParams := []string{}
+	if rawIgnoredParams := os.Getenv("IMCAXY_CANONICAL_IGNORED_PARAMS"); rawIgnoredParams != "" {
+		ignoredParams = strings.Split(rawIgnoredParams, ",")
+	}
+
+	for processorType, processorRules := range rules {
+		processingService, registered := processors[processorType]
+		if !registered {
+			continue
+		}
+
+		canonicalProcessor := canonicalprocessor.NewProcessor(processorRules.WithIgnoredParams(ignoredParams...), processingService)
+		processors[processorType] = &canonicalProcessor
+	}
 }
 
 func InitializeDataHub(ctx context.Context, storage datahubstorage.StorageAdapter) hub.DataHub {
@@ -127,13 +967,58 @@ func InitializeDataHub(ctx context.Context, storage datahubstorage.StorageAdapte
 	return dataHub
 }
 
-func InitializeProxyConfig(imaginaryProcessingService imaginaryprocessor.Processor) proxy.ProxyServiceConfig {
+func InitializeProxyConfig(
+	imaginaryProcessingService *imaginaryprocessor.Processor,
+	nativeProcessingService *nativeprocessor.Processor,
+	thumborProcessingService *thumborprocessor.Processor,
+	imgproxyProcessingService *imgproxyprocessor.Processor,
+	rawProcessingService *rawprocessor.Processor,
+	genericProcessingServices []*genericprocessor.Processor,
+	circuitBreaker circuitbreaker.Config,
+) proxy.ProxyServiceConfig {
 	config := proxy.ProxyServiceConfig{
-		Processors: map[string]processor.ProcessingService{
-			"imaginary": &imaginaryProcessingService,
-		},
-		AllowedDomains: strings.Split(os.Getenv("IMCAXY_ALLOWED_DOMAINS"), ","),
-		AllowedOrigins: strings.Split(os.Getenv("IMCAXY_ALLOWED_ORIGINS"), ","),
+		Processors:           map[string]processor.ProcessingService{},
+		AllowedDomains:       strings.Split(os.Getenv("IMCAXY_ALLOWED_DOMAINS"), ","),
+		AllowedOrigins:       strings.Split(os.Getenv("IMCAXY_ALLOWED_ORIGINS"), ","),
+		CircuitBreaker:       circuitBreaker,
+		CircuitOpenBehaviour: proxy.CircuitOpenBehaviour(os.Getenv("IMCAXY_CIRCUIT_OPEN_BEHAVIOUR")),
+	}
+
+	if imaginaryProcessingService != nil {
+		config.Processors["imaginary"] = imaginaryProcessingService
+	}
+
+	if nativeProcessingService != nil {
+		config.Processors["native"] = nativeProcessingService
+	}
+
+	if thumborProcessingService != nil {
+		config.Processors["thumbor"] = thumborProcessingService
+	}
+
+	if imgproxyProcessingService != nil {
+		config.Processors["imgproxy"] = imgproxyProcessingService
+	}
+
+	if rawProcessingService != nil {
+		config.Processors["raw"] = rawProcessingService
+	}
+
+	for _, genericProcessingService := range genericProcessingServices {
+		if _, exists := config.Processors[genericProcessingService.Name()]; exists {
+			log.Panicf("generic processor name %s is already used by another processor", genericProcessingService.Name())
+		}
+
+		config.Processors[genericProcessingService.Name()] = genericProcessingService
+	}
+
+	if os.Getenv("IMCAXY_CANONICALIZE_REQUESTS") == "true" {
+		canonicalizeProcessors(config.Processors, genericProcessingServices)
+		config.RedirectToCanonical = os.Getenv("IMCAXY_CANONICAL_REDIRECT") == "true"
+	}
+
+	if len(config.Processors) == 0 {
+		log.Panic("at least one processing service must be enabled")
 	}
 
 	if len(config.AllowedDomains) == 0 || config.AllowedDomains[0] == "" && len(config.AllowedDomains) == 1 {
@@ -144,47 +1029,179 @@ func InitializeProxyConfig(imaginaryProcessingService imaginaryprocessor.Process
 		config.AllowedOrigins = []string{"*"}
 	}
 
+	switch config.CircuitOpenBehaviour {
+	case "":
+		config.CircuitOpenBehaviour = proxy.FallbackOnOpenCircuit
+	case proxy.FallbackOnOpenCircuit, proxy.RejectOnOpenCircuit:
+	default:
+		log.Panicf("IMCAXY_CIRCUIT_OPEN_BEHAVIOUR must be one of: fallback, reject, got: %s", config.CircuitOpenBehaviour)
+	}
+
 	return config
 }
 
 func InitializeCache(ctx context.Context) cache.CacheService {
 	wire.Build(
-		InitializeMinioConnectionConfig,
-		InitializeMinioConnection,
-		cacherepositories.NewCachedImagesStorage,
+		InitializeDiskImagesStorageConfig,
+		InitializeTieredImagesStorage,
 
-		InitializeMongoConnectionConfig,
-		InitializeMongoConnection,
+		InitializeCacheDBConnection,
 		cacherepositories.NewCachedImagesRepository,
 
+		InitializeExpirationPolicy,
+		InitializeAccessRecorderConfig,
+		InitializeAccessRecorder,
+		InitializeMemoryTierConfig,
+		cache.NewMemoryTier,
+		InitializeIntegrityPolicy,
 		cache.NewCacheService,
 	)
 
 	return &cache.CacheServiceImplementation{}
 }
 
+func InitializeCacheSweeper(ctx context.Context) *cache.ExpirationSweeper {
+	wire.Build(
+		InitializeImagesStorage,
+
+		InitializeCacheDBConnection,
+		cacherepositories.NewCachedImagesRepository,
+
+		InitializeExpirationSweeperConfig,
+		InitializeExpirationSweeper,
+	)
+
+	return &cache.ExpirationSweeper{}
+}
+
+func InitializeCacheEvictor(ctx context.Context) *cache.QuotaEvictor {
+	wire.Build(
+		InitializeImagesStorage,
+
+		InitializeCacheDBConnection,
+		cacherepositories.NewCachedImagesRepository,
+
+		InitializeQuotaEvictorConfig,
+		InitializeQuotaEvictor,
+	)
+
+	return &cache.QuotaEvictor{}
+}
+
+func InitializeStorageKeysMigration(ctx context.Context) cache.StorageKeysMigrationService {
+	wire.Build(
+		InitializeImagesStorage,
+
+		InitializeCacheDBConnection,
+		cacherepositories.NewCachedImagesRepository,
+
+		cache.NewStorageKeysMigrationService,
+	)
+
+	return &cache.StorageKeysMigrationServiceImplementation{}
+}
+
+func InitializeCacheReconciler(ctx context.Context) *cache.Reconciler {
+	wire.Build(
+		InitializeImagesStorage,
+
+		InitializeCacheDBConnection,
+		cacherepositories.NewCachedImagesRepository,
+
+		InitializeReconcilerConfig,
+		cache.NewReconciler,
+	)
+
+	return &cache.Reconciler{}
+}
+
+func InitializeCacheScrubber(ctx context.Context) *cache.Scrubber {
+	wire.Build(
+		InitializeImagesStorage,
+
+		InitializeCacheDBConnection,
+		cacherepositories.NewCachedImagesRepository,
+
+		InitializeScrubberConfig,
+		cache.NewScrubber,
+	)
+
+	return &cache.Scrubber{}
+}
+
+func InitializeCacheArchiver(ctx context.Context) *cache.CacheArchiver {
+	wire.Build(
+		InitializeImagesStorage,
+
+		InitializeCacheDBConnection,
+		cacherepositories.NewCachedImagesRepository,
+
+		InitializeCacheArchiverConfig,
+		cache.NewCacheArchiver,
+	)
+
+	return &cache.CacheArchiver{}
+}
+
+func InitializeCacheBrowser(ctx context.Context) *cache.CacheBrowser {
+	wire.Build(
+		InitializeCacheDBConnection,
+		cacherepositories.NewCachedImagesRepository,
+
+		cache.NewCacheBrowser,
+	)
+
+	return &cache.CacheBrowser{}
+}
+
 func InitializeInvalidator(ctx context.Context, cacheService cache.CacheService) cache.InvalidationService {
 	wire.Build(
-		InitializeMongoConnectionConfig,
-		InitializeMongoConnection,
+		InitializeCacheDBConnection,
 		cacherepositories.NewInvalidationsRepository,
+
+		InitializeInvalidationServiceConfig,
 		cache.NewInvalidationService,
 	)
 
 	return &cache.InvalidationServiceImplementation{}
 }
 
-func InitializeProxy(ctx context.Context, cache cache.CacheService) proxy.ProxyService {
+func InitializeImaginaryProcessor(ctx context.Context) *imaginaryprocessor.Processor {
+	wire.Build(
+		InitializeRetryPolicy,
+		InitializeCircuitBreakerConfig,
+		InitializeImaginaryProcessingService,
+	)
+
+	return nil
+}
+
+func InitializeProxy(ctx context.Context, cache cache.CacheService, imaginaryProcessingService *imaginaryprocessor.Processor) proxy.ProxyService {
 	wire.Build(
 		datahubstorage.NewStorage,
 		InitializeDataHub,
 
+		InitializeRetryPolicy,
 		filefetcher.NewDataHubFetcher,
-		InitializeImaginaryProcessingService,
+		InitializeNativeProcessingService,
+		InitializeThumborProcessingService,
+		InitializeImgproxyProcessingService,
+		InitializeRawProcessingService,
+		InitializeGenericProcessingServices,
 
+		InitializeCircuitBreakerConfig,
 		InitializeProxyConfig,
 		proxy.NewProxyService,
 	)
 
 	return &proxy.ProxyServiceImplementation{}
 }
+
+func InitializeWarmer(ctx context.Context, proxyService proxy.ProxyService) *warming.Warmer {
+	wire.Build(
+		InitializeWarmerConfig,
+		warming.NewWarmer,
+	)
+
+	return &warming.Warmer{}
+}
@@ -7,9 +7,13 @@ require (
 	github.com/golang/mock v1.6.0
 	github.com/google/uuid v1.3.0
 	github.com/google/wire v0.5.0
+	github.com/lib/pq v1.10.4
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/minio/minio-go/v7 v7.0.15
 	github.com/phayes/freeport v0.0.0-20180830031419-95f893ade6f2
 	github.com/ryanuber/go-glob v1.0.0
+	go.etcd.io/bbolt v1.3.6
 	go.mongodb.org/mongo-driver v1.7.4
+	golang.org/x/image v0.0.0-20211028202545-6944b10bf410
 	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4
 )
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+)
+
+type AccessRecorderConfig struct {
+	// FlushInterval between writes of collected accesses to the repository
+	FlushInterval time.Duration
+}
+
+// AccessRecorder collects cache hits in memory and writes them
+// to the repository in batches, so cache hits do not write to the database
+type AccessRecorder struct {
+	config           AccessRecorderConfig
+	imagesRepository cacherepositories.CachedImagesRepository
+
+	lock     sync.Mutex
+	accesses map[string]*cacherepositories.CachedImageAccess
+	stopped  chan struct{}
+}
+
+func NewAccessRecorder(config AccessRecorderConfig, imagesRepository cacherepositories.CachedImagesRepository) *AccessRecorder {
+	return &AccessRecorder{
+		config:           config,
+		imagesRepository: imagesRepository,
+		accesses:         map[string]*cacherepositories.CachedImageAccess{},
+		stopped:          make(chan struct{}),
+	}
+}
+
+func (r *AccessRecorder) Record(requestSignature, processorType string, accessedAt time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	key := processorType + "::" + requestSignature
+	access, exists := r.accesses[key]
+	if !exists {
+		access = &cacherepositories.CachedImageAccess{
+			RequestSignature: requestSignature,
+			ProcessorType:    processorType,
+		}
+		r.accesses[key] = access
+	}
+
+	if accessedAt.After(access.LastAccessedAt) {
+		access.LastAccessedAt = accessedAt
+	}
+	access.Count++
+}
+
+// Flush writes all collected accesses to the repository,
+// accesses are dropped when the write fails
+func (r *AccessRecorder) Flush(ctx context.Context) error {
+	r.lock.Lock()
+	collected := r.accesses
+	r.accesses = map[string]*cacherepositories.CachedImageAccess{}
+	r.lock.Unlock()
+
+	if len(collected) == 0 {
+		return nil
+	}
+
+	accesses := make([]cacherepositories.CachedImageAccess, 0, len(collected))
+	for _, access := range collected {
+		accesses = append(accesses, *access)
+	}
+
+	return r.imagesRepository.RecordCachedImageAccesses(ctx, accesses)
+}
+
+// Start flushes collected accesses periodically and once more when the context is cancelled
+func (r *AccessRecorder) Start(ctx context.Context) {
+	go func() {
+		defer close(r.stopped)
+
+		ticker := time.NewTicker(r.config.FlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				// context is already cancelled, so the last flush uses a new one
+				flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				if err := r.Flush(flushCtx); err != nil {
+					log.Printf("failed to flush cache accesses: %s", err)
+				}
+				cancel()
+				return
+			case <-ticker.C:
+				if err := r.Flush(ctx); err != nil {
+					log.Printf("failed to flush cache accesses: %s", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stopped is closed when the recorder started by Start has written
+// the last accesses after its context was cancelled
+func (r *AccessRecorder) Stopped() <-chan struct{} {
+	return r.stopped
+}
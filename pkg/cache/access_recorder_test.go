@@ -0,0 +1,92 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/thebartekbanach/imcaxy/pkg/cache"
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	mock_cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/mocks"
+	mock_hub "github.com/thebartekbanach/imcaxy/pkg/hub/mocks"
+)
+
+func TestAccessRecorder_FlushShouldWriteAggregatedAccessesInOneBatch(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	recorder := cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo)
+
+	now := time.Now()
+	recorder.Record("first", "imaginary", now)
+	recorder.Record("first", "imaginary", now.Add(-time.Minute))
+	recorder.Record("first", "native", now)
+
+	var recorded []cacherepositories.CachedImageAccess
+	mockImagesRepo.EXPECT().RecordCachedImageAccesses(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, accesses []cacherepositories.CachedImageAccess) error {
+			recorded = accesses
+			return nil
+		},
+	).Times(1)
+
+	if err := recorder.Flush(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(recorded) != 2 {
+		t.Fatalf("Expected accesses of 2 entries, got %v", recorded)
+	}
+
+	for _, access := range recorded {
+		if access.ProcessorType == "imaginary" && (access.Count != 2 || !access.LastAccessedAt.Equal(now)) {
+			t.Errorf("Expected 2 accesses with the latest access time, got %v", access)
+		}
+	}
+
+	// accesses are written only once
+	if err := recorder.Flush(context.Background()); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+}
+
+func TestAccessRecorder_StartShouldWriteCollectedAccessesWhenContextIsCancelled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	recorder := cache.NewAccessRecorder(cache.AccessRecorderConfig{FlushInterval: time.Hour}, mockImagesRepo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	recorder.Start(ctx)
+	recorder.Record("first", "imaginary", time.Now())
+
+	mockImagesRepo.EXPECT().RecordCachedImageAccesses(gomock.Any(), gomock.Len(1)).Return(nil).Times(1)
+	cancel()
+
+	select {
+	case <-recorder.Stopped():
+	case <-time.After(time.Second):
+		t.Fatal("Expected recorder to stop after the context is cancelled")
+	}
+}
+
+func TestAccessRecorder_CacheHitShouldBeRecorded(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+	mockStreamInput := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+	recorder := cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo)
+
+	mockImagesStorage.InstantSave("test-signature", "imaginary", []byte("test data"))
+	mockImagesRepo.EXPECT().GetCachedImageInfo(gomock.Any(), "test-signature", "imaginary").Return(cacherepositories.CachedImageModel{}, nil)
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, recorder, cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+	if err := cacheService.Get(context.Background(), "test-signature", "imaginary", &mockStreamInput); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	mockStreamInput.Wait()
+
+	mockImagesRepo.EXPECT().RecordCachedImageAccesses(gomock.Any(), gomock.Len(1)).Return(nil)
+	if err := recorder.Flush(context.Background()); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"github.com/thebartekbanach/imcaxy/pkg/hub"
+)
+
+// bufferedStreamInput keeps the whole image written by the images storage,
+// so the image can be verified before it is written to the real stream
+type bufferedStreamInput struct {
+	buffer bytes.Buffer
+	err    error
+	done   chan struct{}
+	once   sync.Once
+}
+
+var _ hub.DataStreamInput = (*bufferedStreamInput)(nil)
+
+func newBufferedStreamInput() *bufferedStreamInput {
+	return &bufferedStreamInput{done: make(chan struct{})}
+}
+
+func (s *bufferedStreamInput) Write(p []byte) (n int, err error) {
+	return s.buffer.Write(p)
+}
+
+func (s *bufferedStreamInput) ReadFrom(r io.Reader) (n int64, err error) {
+	return s.buffer.ReadFrom(r)
+}
+
+func (s *bufferedStreamInput) Close(errorToForward error) error {
+	s.once.Do(func() {
+		if errorToForward != io.EOF {
+			s.err = errorToForward
+		}
+
+		close(s.done)
+	})
+
+	return nil
+}
+
+// wait returns the whole image when the images storage closes the stream
+func (s *bufferedStreamInput) wait(ctx context.Context) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.done:
+		return s.buffer.Bytes(), s.err
+	}
+}
@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/thebartekbanach/imcaxy/pkg/hub"
+)
+
+// bytesStreamOutput lets images read whole into memory to be saved in the images storage
+type bytesStreamOutput struct {
+	*bytes.Reader
+}
+
+var _ hub.DataStreamOutput = (*bytesStreamOutput)(nil)
+
+func newBytesStreamOutput(data []byte) *bytesStreamOutput {
+	return &bytesStreamOutput{bytes.NewReader(data)}
+}
+
+// WriteTo writes the whole image and reports its end with io.EOF, like data hub streams
+func (s *bytesStreamOutput) WriteTo(w io.Writer) (n int64, err error) {
+	if _, err := s.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err = s.Reader.WriteTo(w)
+	if err == nil {
+		err = io.EOF
+	}
+
+	return
+}
+
+func (s *bytesStreamOutput) Close() error {
+	return nil
+}
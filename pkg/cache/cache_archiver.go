@@ -0,0 +1,318 @@
+package cache
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	"github.com/thebartekbanach/imcaxy/pkg/metrics"
+)
+
+type CacheArchiverConfig struct {
+	BatchSize int
+}
+
+// ExportFilter selects exported entries, its empty fields match all entries
+type ExportFilter struct {
+	// SourceImageURLPattern is glob pattern, for example the one of a project quota
+	SourceImageURLPattern string
+	SourceImageURLPrefix  string
+	CreatedAfter          time.Time
+	CreatedBefore         time.Time
+}
+
+func (f ExportFilter) query() cacherepositories.CachedImagesQuery {
+	return cacherepositories.CachedImagesQuery{
+		SourceImageURLPattern: f.SourceImageURLPattern,
+		SourceImageURLPrefix:  f.SourceImageURLPrefix,
+		CreatedAfter:          f.CreatedAfter,
+		CreatedBefore:         f.CreatedBefore,
+	}
+}
+
+// CacheArchiver moves cached images between environments using tar archives,
+// which start with the manifest followed by metadata and image of every entry
+type CacheArchiver struct {
+	config           CacheArchiverConfig
+	imagesRepository cacherepositories.CachedImagesRepository
+	imagesStorage    cacherepositories.CachedImagesStorage
+}
+
+type ExportReport struct {
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+
+	// CheckedEntries are ready entries matching the filter
+	CheckedEntries int   `json:"checkedEntries"`
+	ExportedImages int   `json:"exportedImages"`
+	ExportedBytes  int64 `json:"exportedBytes"`
+
+	// entries without images or with corrupted images are not exported
+	MissingImages   ReportedIssues `json:"missingImages"`
+	CorruptedImages ReportedIssues `json:"corruptedImages"`
+}
+
+type ImportReport struct {
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+
+	ImportedImages int   `json:"importedImages"`
+	ImportedBytes  int64 `json:"importedBytes"`
+	// SkippedImages were already cached under the same request signature
+	SkippedImages   int            `json:"skippedImages"`
+	CorruptedImages ReportedIssues `json:"corruptedImages"`
+}
+
+type archiveManifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+const (
+	archiveVersion      = 1
+	archiveManifestName = "imcaxy-cache.json"
+	archiveMetadataExt  = ".json"
+	archiveImageExt     = ".image"
+)
+
+func NewCacheArchiver(
+	config CacheArchiverConfig,
+	imagesRepository cacherepositories.CachedImagesRepository,
+	imagesStorage cacherepositories.CachedImagesStorage,
+) *CacheArchiver {
+	return &CacheArchiver{config, imagesRepository, imagesStorage}
+}
+
+// Export writes ready entries matching the filter to the archive, images are read
+// one by one, so the archive is written while it is read by the caller
+func (a *CacheArchiver) Export(ctx context.Context, w io.Writer, filter ExportFilter) (report ExportReport, err error) {
+	report.StartedAt = time.Now()
+	defer func() { report.FinishedAt = time.Now() }()
+
+	archive := tar.NewWriter(w)
+	if err := writeArchiveJSON(archive, archiveManifestName, archiveManifest{archiveVersion, report.StartedAt}); err != nil {
+		return report, err
+	}
+
+	query := filter.query()
+	page := cacherepositories.CachedImagesPage{Limit: a.config.BatchSize}
+	for {
+		entries, err := a.imagesRepository.SearchCachedImageInfos(ctx, query, page)
+		if err != nil {
+			return report, err
+		}
+
+		for _, entry := range entries {
+			report.CheckedEntries++
+			if entry.IsExpired(report.StartedAt) {
+				continue
+			}
+
+			if err := a.exportEntry(ctx, archive, entry, &report); err != nil {
+				return report, err
+			}
+		}
+
+		if len(entries) < page.Limit {
+			return report, archive.Close()
+		}
+
+		page.After = &entries[len(entries)-1]
+	}
+}
+
+func (a *CacheArchiver) exportEntry(ctx context.Context, archive *tar.Writer, entry cacherepositories.CachedImageModel, report *ExportReport) error {
+	// entries saved under legacy keys are archived under their hashed keys,
+	// imported entries get their storage keys from the repository anyway
+	if entry.StorageKey == "" {
+		entry.StorageKey = cacherepositories.StorageKey(entry.RequestSignature, entry.ProcessorType)
+	}
+
+	buffer := newBufferedStreamInput()
+	err := a.imagesStorage.Get(ctx, entry.RequestSignature, entry.ProcessorType, entry.Checksum, buffer)
+	if err == cacherepositories.ErrImageNotFound {
+		report.MissingImages.add(entry.StorageKey)
+		return nil
+	}
+
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	data, err := buffer.wait(ctx)
+	if err != nil {
+		return err
+	}
+
+	if entry.Checksum != "" && checksum(data) != entry.Checksum {
+		report.CorruptedImages.add(entry.StorageKey)
+		return nil
+	}
+
+	if err := writeArchiveJSON(archive, entry.StorageKey+archiveMetadataExt, entry); err != nil {
+		return err
+	}
+
+	header := &tar.Header{Name: entry.StorageKey + archiveImageExt, Mode: 0644, Size: int64(len(data)), ModTime: entry.CreatedAt}
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+
+	if _, err := archive.Write(data); err != nil {
+		return err
+	}
+
+	metrics.Add("cache_exported_entries", 1)
+	report.ExportedImages++
+	report.ExportedBytes += int64(len(data))
+	return nil
+}
+
+// Import saves entries of the archive which are not cached yet, expiration and creation
+// times of entries are kept, so imported entries expire at the same time as exported ones
+func (a *CacheArchiver) Import(ctx context.Context, r io.Reader) (report ImportReport, err error) {
+	report.StartedAt = time.Now()
+	defer func() { report.FinishedAt = time.Now() }()
+
+	archive := tar.NewReader(r)
+	manifest := archiveManifest{}
+	if err := readArchiveJSON(archive, archiveManifestName, &manifest); err != nil {
+		return report, err
+	}
+
+	if manifest.Version != archiveVersion {
+		return report, fmt.Errorf("%w: %d", ErrUnsupportedArchiveVersion, manifest.Version)
+	}
+
+	for {
+		entry := cacherepositories.CachedImageModel{}
+		err := readArchiveJSON(archive, "", &entry)
+		if err == io.EOF {
+			return report, nil
+		}
+
+		if err != nil {
+			return report, err
+		}
+
+		data, err := readArchiveImage(archive, entry.StorageKey)
+		if err != nil {
+			return report, err
+		}
+
+		if err := a.importEntry(ctx, entry, data, &report); err != nil {
+			return report, err
+		}
+	}
+}
+
+func (a *CacheArchiver) importEntry(ctx context.Context, entry cacherepositories.CachedImageModel, data []byte, report *ImportReport) error {
+	imageChecksum := checksum(data)
+	if entry.Checksum != "" && entry.Checksum != imageChecksum {
+		report.CorruptedImages.add(entry.StorageKey)
+		return nil
+	}
+
+	// storage key and access statistics are set by the repository
+	entry.State = cacherepositories.CachedImagePending
+	entry.StorageKey = ""
+	entry.AccessCount = 0
+	entry.LastAccessedAt = time.Time{}
+
+	err := a.imagesRepository.CreateCachedImageInfo(ctx, entry)
+	if err == cacherepositories.ErrCachedImageAlreadyExists {
+		report.SkippedImages++
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	size := int64(len(data))
+	if err := a.saveImage(ctx, entry, size, imageChecksum, data); err != nil {
+		a.imagesRepository.DeleteCachedImageInfo(ctx, entry.RequestSignature, entry.ProcessorType)
+		return err
+	}
+
+	if err := a.imagesRepository.MarkCachedImageReady(ctx, entry.RequestSignature, entry.ProcessorType, size, imageChecksum); err != nil {
+		return err
+	}
+
+	metrics.Add("cache_imported_entries", 1)
+	report.ImportedImages++
+	report.ImportedBytes += size
+	return nil
+}
+
+// image without entry was not served, so it is replaced by the imported one
+func (a *CacheArchiver) saveImage(ctx context.Context, entry cacherepositories.CachedImageModel, size int64, imageChecksum string, data []byte) error {
+	err := a.imagesStorage.Save(ctx, entry.RequestSignature, entry.ProcessorType, entry.MimeType, size, imageChecksum, newBytesStreamOutput(data))
+	if err != cacherepositories.ErrImageAlreadyExists {
+		return err
+	}
+
+	if err := a.imagesStorage.Delete(ctx, entry.RequestSignature, entry.ProcessorType); err != nil && err != cacherepositories.ErrImageNotFound {
+		return err
+	}
+
+	return a.imagesStorage.Save(ctx, entry.RequestSignature, entry.ProcessorType, entry.MimeType, size, imageChecksum, newBytesStreamOutput(data))
+}
+
+func writeArchiveJSON(archive *tar.Writer, name string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	if err := archive.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+
+	_, err = archive.Write(data)
+	return err
+}
+
+// readArchiveJSON reads the next file, which has to have the given name,
+// any metadata file is read when the name is empty
+func readArchiveJSON(archive *tar.Reader, name string, value interface{}) error {
+	header, err := archive.Next()
+	if err != nil {
+		return err
+	}
+
+	if (name != "" && header.Name != name) || (name == "" && !strings.HasSuffix(header.Name, archiveMetadataExt)) {
+		return fmt.Errorf("%w: expected %s, got %s", ErrInvalidArchive, name, header.Name)
+	}
+
+	return json.NewDecoder(archive).Decode(value)
+}
+
+func readArchiveImage(archive *tar.Reader, storageKey string) ([]byte, error) {
+	header, err := archive.Next()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: image of %s is missing", ErrInvalidArchive, storageKey)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Name != storageKey+archiveImageExt {
+		return nil, fmt.Errorf("%w: expected image of %s, got %s", ErrInvalidArchive, storageKey, header.Name)
+	}
+
+	return ioutil.ReadAll(archive)
+}
+
+var (
+	ErrInvalidArchive            = errors.New("invalid cache archive")
+	ErrUnsupportedArchiveVersion = errors.New("unsupported cache archive version")
+)
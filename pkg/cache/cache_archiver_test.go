@@ -0,0 +1,186 @@
+package cache_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/thebartekbanach/imcaxy/pkg/cache"
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	dbconnections "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/connections"
+	mock_cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/mocks"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func newTestingArchivedCache(t *testing.T) (cacherepositories.CachedImagesRepository, *mock_cacherepositories.MockCachedImagesStorage, *cache.CacheArchiver) {
+	repo, storage := newTestingCache(t)
+	archiver := cache.NewCacheArchiver(cache.CacheArchiverConfig{BatchSize: 2}, repo, storage)
+	return repo, storage, archiver
+}
+
+func saveTestingArchivedImage(t *testing.T, repo cacherepositories.CachedImagesRepository, storage *mock_cacherepositories.MockCachedImagesStorage, info cacherepositories.CachedImageModel, data string) {
+	info.ProcessorType = "imaginary"
+	info.ImageSize = int64(len(data))
+	info.Checksum = fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+	createTestingCacheEntry(t, repo, info)
+	storage.InstantSave(info.RequestSignature, "imaginary", []byte(data))
+}
+
+func TestCacheArchiver_ImportShouldSaveExportedImages(t *testing.T) {
+	sourceRepo, sourceStorage, source := newTestingArchivedCache(t)
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	saveTestingArchivedImage(t, sourceRepo, sourceStorage, cacherepositories.CachedImageModel{RequestSignature: "first", MimeType: "image/png", ExpiresAt: expiresAt}, "first image")
+	saveTestingArchivedImage(t, sourceRepo, sourceStorage, cacherepositories.CachedImageModel{RequestSignature: "second"}, "second image")
+	saveTestingArchivedImage(t, sourceRepo, sourceStorage, cacherepositories.CachedImageModel{RequestSignature: "third"}, "third image")
+
+	archive := &bytes.Buffer{}
+	exportReport, err := source.Export(context.Background(), archive, cache.ExportFilter{})
+	if err != nil || exportReport.ExportedImages != 3 {
+		t.Fatalf("Expected 3 exported images, got: %+v, %v", exportReport, err)
+	}
+
+	targetRepo, targetStorage, target := newTestingArchivedCache(t)
+	importReport, err := target.Import(context.Background(), archive)
+	if err != nil || importReport.ImportedImages != 3 || importReport.ImportedBytes != exportReport.ExportedBytes {
+		t.Fatalf("Expected 3 imported images, got: %+v, %v", importReport, err)
+	}
+
+	info, err := targetRepo.GetCachedImageInfo(context.Background(), "first", "imaginary")
+	if err != nil || info.MimeType != "image/png" || !info.ExpiresAt.Equal(expiresAt) || info.ImageSize != 11 {
+		t.Errorf("Expected metadata of imported image to be kept, got: %+v, %v", info, err)
+	}
+
+	if !targetStorage.Exists("first", "imaginary") {
+		t.Error("Expected image to be saved in images storage")
+	}
+}
+
+func TestCacheArchiver_ExportShouldExportOnlyMatchingEntries(t *testing.T) {
+	repo, storage, archiver := newTestingArchivedCache(t)
+	saveTestingArchivedImage(t, repo, storage, cacherepositories.CachedImageModel{RequestSignature: "matching", SourceImageURL: "https://project-a.com/a.jpg"}, "a")
+	saveTestingArchivedImage(t, repo, storage, cacherepositories.CachedImageModel{RequestSignature: "other-source", SourceImageURL: "https://project-b.com/b.jpg"}, "b")
+	saveTestingArchivedImage(t, repo, storage, cacherepositories.CachedImageModel{RequestSignature: "too-old", SourceImageURL: "https://project-a.com/c.jpg", CreatedAt: time.Now().Add(-48 * time.Hour)}, "c")
+	saveTestingArchivedImage(t, repo, storage, cacherepositories.CachedImageModel{RequestSignature: "pending", SourceImageURL: "https://project-a.com/d.jpg", State: cacherepositories.CachedImagePending}, "d")
+
+	filter := cache.ExportFilter{
+		SourceImageURLPattern: "https://*.com/*",
+		SourceImageURLPrefix:  "https://project-a.com/",
+		CreatedAfter:          time.Now().Add(-24 * time.Hour),
+	}
+
+	report, err := archiver.Export(context.Background(), &bytes.Buffer{}, filter)
+	if err != nil || report.CheckedEntries != 1 || report.ExportedImages != 1 {
+		t.Errorf("Expected only matching entry to be checked and exported, got: %+v, %v", report, err)
+	}
+}
+
+func TestCacheArchiver_ExportShouldExportEntriesOfLegacyKeys(t *testing.T) {
+	sourceRepo, sourceStorage, source := newTestingArchivedCache(t)
+	saveTestingArchivedImage(t, sourceRepo, sourceStorage, cacherepositories.CachedImageModel{RequestSignature: "legacy"}, "legacy image")
+	if err := sourceRepo.UpdateCachedImageStorageKey(context.Background(), "legacy", "imaginary", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := &bytes.Buffer{}
+	exportReport, err := source.Export(context.Background(), archive, cache.ExportFilter{})
+	if err != nil || exportReport.ExportedImages != 1 {
+		t.Fatalf("Expected entry of legacy key to be exported, got: %+v, %v", exportReport, err)
+	}
+
+	targetRepo, _, target := newTestingArchivedCache(t)
+	if _, err := target.Import(context.Background(), archive); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := targetRepo.GetCachedImageInfo(context.Background(), "legacy", "imaginary")
+	if err != nil || info.StorageKey != cacherepositories.StorageKey("legacy", "imaginary") {
+		t.Errorf("Expected entry of legacy key to be imported under hashed key, got: %+v, %v", info, err)
+	}
+}
+
+func TestCacheArchiverIntegration_ExportShouldExportAllLegacyEntriesWithoutCreationTime(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping cacheArchiver integration tests")
+	}
+
+	ctx := context.Background()
+	conn := dbconnections.NewCacheDBTestingConnection(t)
+	storage := mock_cacherepositories.NewMockCachedImagesStorage()
+
+	// entries saved before creation times were kept, there are more of them than fit in a batch
+	for i := 0; i < 5; i++ {
+		signature := fmt.Sprintf("legacy-%d", i)
+		if _, err := conn.Collection("cachedImages").InsertOne(ctx, bson.M{"requestSignature": signature, "processorType": "imaginary", "imageSize": 6}); err != nil {
+			t.Fatal(err)
+		}
+
+		storage.InstantSave(signature, "imaginary", []byte("legacy"))
+	}
+
+	if err := cacherepositories.CreateMongoCacheDBIndexes(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+
+	archiver := cache.NewCacheArchiver(cache.CacheArchiverConfig{BatchSize: 2}, cacherepositories.NewCachedImagesRepository(conn), storage)
+	report, err := archiver.Export(ctx, &bytes.Buffer{}, cache.ExportFilter{})
+	if err != nil || report.CheckedEntries != 5 || report.ExportedImages != 5 {
+		t.Errorf("Expected all legacy entries to be exported, got: %+v, %v", report, err)
+	}
+}
+
+func TestCacheArchiver_ExportShouldSkipMissingAndCorruptedImages(t *testing.T) {
+	repo, storage, archiver := newTestingArchivedCache(t)
+	saveTestingArchivedImage(t, repo, storage, cacherepositories.CachedImageModel{RequestSignature: "valid"}, "valid")
+	saveTestingArchivedImage(t, repo, storage, cacherepositories.CachedImageModel{RequestSignature: "corrupted"}, "corrupted")
+	saveTestingArchivedImage(t, repo, storage, cacherepositories.CachedImageModel{RequestSignature: "missing"}, "missing")
+	storage.InstantSave("corrupted", "imaginary", []byte("c0rrupted"))
+	storage.Delete(context.Background(), "missing", "imaginary")
+
+	report, err := archiver.Export(context.Background(), &bytes.Buffer{}, cache.ExportFilter{})
+	if err != nil || report.ExportedImages != 1 || report.CorruptedImages.Count != 1 || report.MissingImages.Count != 1 {
+		t.Errorf("Expected only valid image to be exported, got: %+v, %v", report, err)
+	}
+}
+
+func TestCacheArchiver_ImportShouldSkipAlreadyCachedImages(t *testing.T) {
+	sourceRepo, sourceStorage, source := newTestingArchivedCache(t)
+	saveTestingArchivedImage(t, sourceRepo, sourceStorage, cacherepositories.CachedImageModel{RequestSignature: "cached"}, "exported image")
+	saveTestingArchivedImage(t, sourceRepo, sourceStorage, cacherepositories.CachedImageModel{RequestSignature: "new"}, "new image")
+
+	archive := &bytes.Buffer{}
+	if _, err := source.Export(context.Background(), archive, cache.ExportFilter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	targetRepo, targetStorage, target := newTestingArchivedCache(t)
+	saveTestingArchivedImage(t, targetRepo, targetStorage, cacherepositories.CachedImageModel{RequestSignature: "cached"}, "cached image")
+
+	report, err := target.Import(context.Background(), archive)
+	if err != nil || report.ImportedImages != 1 || report.SkippedImages != 1 {
+		t.Fatalf("Expected one imported and one skipped image, got: %+v, %v", report, err)
+	}
+
+	info, _ := targetRepo.GetCachedImageInfo(context.Background(), "cached", "imaginary")
+	if info.ImageSize != int64(len("cached image")) {
+		t.Errorf("Expected already cached image to be kept, got: %+v", info)
+	}
+}
+
+func TestCacheArchiver_ImportShouldRejectArchiveWithoutManifest(t *testing.T) {
+	_, _, archiver := newTestingArchivedCache(t)
+
+	archive := &bytes.Buffer{}
+	writer := tar.NewWriter(archive)
+	writer.WriteHeader(&tar.Header{Name: "image.json", Mode: 0644, Size: 2})
+	writer.Write([]byte("{}"))
+	writer.Close()
+
+	if _, err := archiver.Import(context.Background(), archive); !errors.Is(err, cache.ErrInvalidArchive) {
+		t.Errorf("Expected invalid archive error, got: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+)
+
+// CacheBrowser pages through ready entries of the cache, pages are selected by opaque
+// cursors made from the last entry of the previous page, so they stay stable when
+// entries are added or removed between requests
+type CacheBrowser struct {
+	imagesRepository cacherepositories.CachedImagesRepository
+}
+
+type BrowseOptions struct {
+	SortBy     cacherepositories.CachedImagesSortField
+	Descending bool
+	// Cursor is the next cursor of the previous page, empty for the first page
+	Cursor string
+	// Limit defaults to DefaultBrowsePageSize and is capped at MaxBrowsePageSize
+	Limit int
+}
+
+type EntriesPage struct {
+	Entries []cacherepositories.CachedImageModel `json:"entries"`
+	// NextCursor is empty when there are no more entries
+	NextCursor string `json:"nextCursor"`
+}
+
+type SourcesPage struct {
+	Sources    []cacherepositories.CachedImageSourceStats `json:"sources"`
+	NextCursor string                                     `json:"nextCursor"`
+}
+
+const (
+	DefaultBrowsePageSize = 100
+	MaxBrowsePageSize     = 1000
+)
+
+// entriesCursor keeps sort options, so cursor can not be used with other ones
+type entriesCursor struct {
+	SortBy           cacherepositories.CachedImagesSortField `json:"s"`
+	Descending       bool                                    `json:"d"`
+	CreatedAt        time.Time                               `json:"c"`
+	ImageSize        int64                                   `json:"i"`
+	SourceImageURL   string                                  `json:"u"`
+	RequestSignature string                                  `json:"r"`
+	ProcessorType    string                                  `json:"p"`
+}
+
+type sourcesCursor struct {
+	SourceImageURL string `json:"u"`
+}
+
+func NewCacheBrowser(imagesRepository cacherepositories.CachedImagesRepository) *CacheBrowser {
+	return &CacheBrowser{imagesRepository}
+}
+
+func (b *CacheBrowser) Entries(ctx context.Context, query cacherepositories.CachedImagesQuery, options BrowseOptions) (EntriesPage, error) {
+	if options.SortBy == "" {
+		options.SortBy = cacherepositories.SortByCreatedAt
+	}
+
+	switch options.SortBy {
+	case cacherepositories.SortByCreatedAt, cacherepositories.SortByImageSize, cacherepositories.SortBySourceImageURL:
+	default:
+		return EntriesPage{}, fmt.Errorf("%w: %s", ErrUnknownSortField, options.SortBy)
+	}
+
+	page := cacherepositories.CachedImagesPage{
+		SortBy:     options.SortBy,
+		Descending: options.Descending,
+		Limit:      browsePageSize(options.Limit),
+	}
+
+	if options.Cursor != "" {
+		cursor := entriesCursor{}
+		if err := decodeBrowseCursor(options.Cursor, &cursor); err != nil {
+			return EntriesPage{}, err
+		}
+
+		if cursor.SortBy != options.SortBy || cursor.Descending != options.Descending {
+			return EntriesPage{}, fmt.Errorf("%w: cursor was made for other sort order", ErrInvalidCursor)
+		}
+
+		page.After = &cacherepositories.CachedImageModel{
+			CreatedAt:        cursor.CreatedAt,
+			ImageSize:        cursor.ImageSize,
+			SourceImageURL:   cursor.SourceImageURL,
+			RequestSignature: cursor.RequestSignature,
+			ProcessorType:    cursor.ProcessorType,
+		}
+	}
+
+	entries, err := b.imagesRepository.SearchCachedImageInfos(ctx, query, page)
+	if err != nil {
+		return EntriesPage{}, err
+	}
+
+	result := EntriesPage{Entries: append([]cacherepositories.CachedImageModel{}, entries...)}
+	if len(entries) == page.Limit {
+		last := entries[len(entries)-1]
+		result.NextCursor, err = encodeBrowseCursor(entriesCursor{
+			SortBy:           options.SortBy,
+			Descending:       options.Descending,
+			CreatedAt:        last.CreatedAt,
+			ImageSize:        last.ImageSize,
+			SourceImageURL:   last.SourceImageURL,
+			RequestSignature: last.RequestSignature,
+			ProcessorType:    last.ProcessorType,
+		})
+	}
+
+	return result, err
+}
+
+// Sources returns number and total size of images per source image url, ordered
+// by source image urls, sort options are ignored
+func (b *CacheBrowser) Sources(ctx context.Context, query cacherepositories.CachedImagesQuery, options BrowseOptions) (SourcesPage, error) {
+	cursor := sourcesCursor{}
+	if options.Cursor != "" {
+		if err := decodeBrowseCursor(options.Cursor, &cursor); err != nil {
+			return SourcesPage{}, err
+		}
+	}
+
+	limit := browsePageSize(options.Limit)
+	sources, err := b.imagesRepository.GetCachedImageSourcesStats(ctx, query, cursor.SourceImageURL, limit)
+	if err != nil {
+		return SourcesPage{}, err
+	}
+
+	result := SourcesPage{Sources: append([]cacherepositories.CachedImageSourceStats{}, sources...)}
+	if len(sources) == limit {
+		result.NextCursor, err = encodeBrowseCursor(sourcesCursor{sources[len(sources)-1].SourceImageURL})
+	}
+
+	return result, err
+}
+
+func browsePageSize(limit int) int {
+	if limit <= 0 {
+		return DefaultBrowsePageSize
+	}
+
+	if limit > MaxBrowsePageSize {
+		return MaxBrowsePageSize
+	}
+
+	return limit
+}
+
+func encodeBrowseCursor(cursor interface{}) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeBrowseCursor(encoded string, cursor interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidCursor, err)
+	}
+
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidCursor, err)
+	}
+
+	return nil
+}
+
+var (
+	ErrUnknownSortField = errors.New("unknown sort field")
+	ErrInvalidCursor    = errors.New("invalid cursor")
+)
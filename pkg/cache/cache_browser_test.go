@@ -0,0 +1,74 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/thebartekbanach/imcaxy/pkg/cache"
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+)
+
+func newTestingCacheBrowser(t *testing.T, signatures ...string) *cache.CacheBrowser {
+	repo, _ := newTestingCache(t)
+	for _, signature := range signatures {
+		createTestingCacheEntry(t, repo, cacherepositories.CachedImageModel{RequestSignature: signature, ProcessorType: "imaginary", SourceImageURL: "https://example.com/" + signature})
+	}
+
+	return cache.NewCacheBrowser(repo)
+}
+
+func TestCacheBrowser_EntriesShouldBePagedUsingNextCursor(t *testing.T) {
+	browser := newTestingCacheBrowser(t, "a", "b", "c")
+
+	options := cache.BrowseOptions{SortBy: cacherepositories.SortBySourceImageURL, Descending: true, Limit: 2}
+	signatures := []string{}
+	for pages := 0; pages < 3; pages++ {
+		page, err := browser.Entries(context.Background(), cacherepositories.CachedImagesQuery{}, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, entry := range page.Entries {
+			signatures = append(signatures, entry.RequestSignature)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+
+		options.Cursor = page.NextCursor
+	}
+
+	if len(signatures) != 3 || signatures[0] != "c" || signatures[1] != "b" || signatures[2] != "a" {
+		t.Errorf("Expected entries c, b and a, got: %v", signatures)
+	}
+}
+
+func TestCacheBrowser_EntriesShouldRejectCursorOfOtherSortOrder(t *testing.T) {
+	browser := newTestingCacheBrowser(t, "a", "b")
+
+	page, err := browser.Entries(context.Background(), cacherepositories.CachedImagesQuery{}, cache.BrowseOptions{Limit: 1})
+	if err != nil || page.NextCursor == "" {
+		t.Fatalf("Expected first page with next cursor, got: %+v, %v", page, err)
+	}
+
+	options := cache.BrowseOptions{SortBy: cacherepositories.SortByImageSize, Cursor: page.NextCursor, Limit: 1}
+	if _, err := browser.Entries(context.Background(), cacherepositories.CachedImagesQuery{}, options); !errors.Is(err, cache.ErrInvalidCursor) {
+		t.Errorf("Expected invalid cursor error, got: %v", err)
+	}
+}
+
+func TestCacheBrowser_SourcesShouldBePagedUsingNextCursor(t *testing.T) {
+	browser := newTestingCacheBrowser(t, "a", "b", "c")
+
+	first, err := browser.Sources(context.Background(), cacherepositories.CachedImagesQuery{}, cache.BrowseOptions{Limit: 2})
+	if err != nil || len(first.Sources) != 2 || first.NextCursor == "" {
+		t.Fatalf("Expected first page of 2 sources, got: %+v, %v", first, err)
+	}
+
+	second, err := browser.Sources(context.Background(), cacherepositories.CachedImagesQuery{}, cache.BrowseOptions{Limit: 2, Cursor: first.NextCursor})
+	if err != nil || len(second.Sources) != 1 || second.Sources[0].SourceImageURL != "https://example.com/c" || second.NextCursor != "" {
+		t.Errorf("Expected last page with source of c, got: %+v, %v", second, err)
+	}
+}
@@ -3,42 +3,144 @@ package cache
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"time"
 
 	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
 	"github.com/thebartekbanach/imcaxy/pkg/hub"
+	"github.com/thebartekbanach/imcaxy/pkg/metrics"
 )
 
 type CacheServiceImplementation struct {
 	imagesRepository cacherepositories.CachedImagesRepository
 	imagesStorage    cacherepositories.CachedImagesStorage
+	expirationPolicy ExpirationPolicy
+	accessRecorder   *AccessRecorder
+	memoryTier       *MemoryTier
+	integrityPolicy  IntegrityPolicy
 }
 
 func NewCacheService(
 	imagesRepository cacherepositories.CachedImagesRepository,
 	imagesStorage cacherepositories.CachedImagesStorage,
+	expirationPolicy ExpirationPolicy,
+	accessRecorder *AccessRecorder,
+	memoryTier *MemoryTier,
+	integrityPolicy IntegrityPolicy,
 ) CacheService {
 	return &CacheServiceImplementation{
 		imagesRepository,
 		imagesStorage,
+		expirationPolicy,
+		accessRecorder,
+		memoryTier,
+		integrityPolicy,
 	}
 }
 
 func (s *CacheServiceImplementation) Get(ctx context.Context, requestSignature, processorType string, w hub.DataStreamInput) error {
-	if err := s.imagesStorage.Get(ctx, requestSignature, processorType, w); err != nil && err != io.EOF {
+	now := time.Now()
+	info, err := s.imagesRepository.GetCachedImageInfo(ctx, requestSignature, processorType)
+	if err == cacherepositories.ErrCachedImageNotFound {
+		// entry could be removed by the sweeper or the evictor
+		s.memoryTier.Remove(requestSignature, processorType)
+		return ErrEntryNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// expired entry is removed, so it can be saved again
+	if info.IsExpired(now) {
+		s.removeEntry(ctx, info)
+		metrics.Add("cache_expired_entries", 1)
+		return ErrEntryNotFound
+	}
+
+	version := memoryTierVersion(info)
+	if data, found := s.memoryTier.Get(requestSignature, processorType, version); found {
+		_, err := w.Write(data)
+		w.Close(err)
+		s.accessRecorder.Record(requestSignature, processorType, now)
+		return nil
+	}
+
+	input := s.memoryTier.wrapInput(requestSignature, processorType, version, w)
+	if s.integrityPolicy.verifies(info) {
+		err = s.getVerified(ctx, requestSignature, processorType, info.Checksum, input)
+	} else {
+		err = s.imagesStorage.Get(ctx, requestSignature, processorType, info.Checksum, input)
+	}
+
+	if err != nil && err != io.EOF {
 		if err == cacherepositories.ErrImageNotFound {
+			metrics.Add("cache_storage_misses", 1)
+			s.removeEntryWithoutImage(ctx, requestSignature, processorType, info, now)
+			return ErrEntryNotFound
+		}
+
+		// corrupted image is removed, so it is processed and cached again
+		if err == errChecksumMismatch {
+			metrics.Add("cache_corrupted_entries", 1)
+			s.removeEntry(ctx, cacherepositories.CachedImageModel{RequestSignature: requestSignature, ProcessorType: processorType})
 			return ErrEntryNotFound
 		}
 
 		return err
 	}
 
+	metrics.Add("cache_storage_hits", 1)
+	s.accessRecorder.Record(requestSignature, processorType, now)
 	return nil
 }
 
+// Contains does not remove expired entries, they are removed when requested or by the sweeper
+func (s *CacheServiceImplementation) Contains(ctx context.Context, requestSignature, processorType string) (bool, error) {
+	info, err := s.imagesRepository.GetCachedImageInfo(ctx, requestSignature, processorType)
+	if err == cacherepositories.ErrCachedImageNotFound {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return !info.IsExpired(time.Now()), nil
+}
+
+// getVerified writes the image to the stream only when its checksum matches,
+// so the stream can be still used when the image is corrupted
+func (s *CacheServiceImplementation) getVerified(ctx context.Context, requestSignature, processorType, expectedChecksum string, w hub.DataStreamInput) error {
+	buffer := newBufferedStreamInput()
+	if err := s.imagesStorage.Get(ctx, requestSignature, processorType, expectedChecksum, buffer); err != nil && err != io.EOF {
+		return err
+	}
+
+	data, err := buffer.wait(ctx)
+	if err != nil {
+		return err
+	}
+
+	if checksum(data) != expectedChecksum {
+		return errChecksumMismatch
+	}
+
+	_, err = w.Write(data)
+	w.Close(err)
+	return nil
+}
+
+// Save creates pending entry before the image is saved and marks it ready only
+// when the whole image is saved, so entries without images are never read
 func (s *CacheServiceImplementation) Save(ctx context.Context, imageInfo cacherepositories.CachedImageModel, r hub.DataStreamOutput) error {
 	defer r.Close()
 
+	// creation time is set by the repository
+	imageInfo.ExpiresAt = s.expirationPolicy.ExpirationTime(imageInfo, time.Now())
+	imageInfo.State = cacherepositories.CachedImagePending
+
 	if err := s.imagesRepository.CreateCachedImageInfo(ctx, imageInfo); err != nil {
 		if err == cacherepositories.ErrCachedImageAlreadyExists {
 			return ErrEntryAlreadyExists
@@ -47,22 +149,126 @@ func (s *CacheServiceImplementation) Save(ctx context.Context, imageInfo cachere
 		return err
 	}
 
-	if err := s.imagesStorage.Save(ctx, imageInfo.RequestSignature, imageInfo.ProcessorType, imageInfo.MimeType, imageInfo.ImageSize, r); err != nil {
-		s.imagesRepository.DeleteCachedImageInfo(ctx, imageInfo.RequestSignature, imageInfo.ProcessorType)
-		s.imagesStorage.Delete(ctx, imageInfo.RequestSignature, imageInfo.ProcessorType)
+	// checksum is computed while the storage reads the image, so it is not known
+	// when the image is saved and it is set after that, size of chunked processor
+	// responses is known only after the whole stream is read
+	output := newCountingStreamOutput(r)
+	if err := s.imagesStorage.Save(ctx, imageInfo.RequestSignature, imageInfo.ProcessorType, imageInfo.MimeType, imageInfo.ImageSize, "", output); err != nil {
+		s.removeUnsavedEntry(imageInfo)
+		return err
+	}
+
+	imageChecksum, err := output.checksum()
+	if err != nil {
+		s.removeUnsavedEntry(imageInfo)
+		return err
+	}
+
+	if err := s.imagesStorage.SetChecksum(ctx, imageInfo.RequestSignature, imageInfo.ProcessorType, imageChecksum); err != nil {
+		s.removeUnsavedEntry(imageInfo)
+		return err
+	}
+
+	size := imageInfo.ImageSize
+	if size < 0 {
+		size = output.size
+	}
+
+	// entry could be invalidated or removed as abandoned in the meantime
+	if err := s.imagesRepository.MarkCachedImageReady(ctx, imageInfo.RequestSignature, imageInfo.ProcessorType, size, imageChecksum); err != nil {
+		s.removeUnsavedEntry(imageInfo)
 		return err
 	}
 
+	imageInfo.Checksum = imageChecksum
+	s.addToMemoryTier(imageInfo, size, r)
 	return nil
 }
 
+// saved image is still available in the stream, so it is read again
+func (s *CacheServiceImplementation) addToMemoryTier(imageInfo cacherepositories.CachedImageModel, size int64, r hub.DataStreamOutput) {
+	if !s.memoryTier.admits(size) {
+		return
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(io.NewSectionReader(r, 0, size), data); err != nil {
+		return
+	}
+
+	s.memoryTier.Add(imageInfo.RequestSignature, imageInfo.ProcessorType, memoryTierVersion(imageInfo), data)
+}
+
+// save fails also when its context is cancelled, so the entry
+// is removed using another one to not leave it without image
+func (s *CacheServiceImplementation) removeUnsavedEntry(imageInfo cacherepositories.CachedImageModel) {
+	ctx, cancel := context.WithTimeout(context.Background(), unsavedEntryRemovalTimeout)
+	defer cancel()
+
+	s.removeEntry(ctx, imageInfo)
+}
+
+// entry without image fails on every request, so it is removed and the image can be cached again,
+// legacy entries younger than entrySaveTimeout can be still saved, so their images can be not saved yet
+func (s *CacheServiceImplementation) removeEntryWithoutImage(ctx context.Context, requestSignature, processorType string, info cacherepositories.CachedImageModel, now time.Time) {
+	if info.State != cacherepositories.CachedImageReady && now.Sub(info.CreatedAt) < entrySaveTimeout {
+		return
+	}
+
+	s.memoryTier.Remove(requestSignature, processorType)
+	if err := s.imagesRepository.DeleteCachedImageInfo(ctx, requestSignature, processorType); err == nil {
+		metrics.Add("cache_healed_entries", 1)
+	}
+}
+
+func (s *CacheServiceImplementation) removeEntry(ctx context.Context, imageInfo cacherepositories.CachedImageModel) {
+	s.memoryTier.Remove(imageInfo.RequestSignature, imageInfo.ProcessorType)
+	s.imagesRepository.DeleteCachedImageInfo(ctx, imageInfo.RequestSignature, imageInfo.ProcessorType)
+	s.imagesStorage.Delete(ctx, imageInfo.RequestSignature, imageInfo.ProcessorType)
+}
+
 func (s *CacheServiceImplementation) InvalidateAllEntriesForURL(ctx context.Context, sourceImageURL string) (removedEntries []cacherepositories.CachedImageModel, err error) {
 	entries, err := s.imagesRepository.GetCachedImageInfosOfSource(ctx, sourceImageURL)
 	if err != nil {
 		return
 	}
 
+	return s.removeEntries(ctx, entries)
+}
+
+func (s *CacheServiceImplementation) InvalidateAllEntriesMatching(ctx context.Context, pattern cacherepositories.InvalidationPattern, maxEntries int) ([]cacherepositories.CachedImageModel, error) {
+	matcher, err := compileInvalidationPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	// the walk stops on the first entry over the limit, so at most maxEntries entries are kept in memory
+	entries := []cacherepositories.CachedImageModel{}
+	err = s.imagesRepository.WalkCachedImageInfosOfSourcePrefix(ctx, matcher.prefix, func(entry cacherepositories.CachedImageModel) error {
+		if !matcher.matches(entry.SourceImageURL) {
+			return nil
+		}
+
+		if maxEntries > 0 && len(entries) == maxEntries {
+			return fmt.Errorf("%w: %s matches more than %d entries", ErrTooManyMatchingEntries, pattern, maxEntries)
+		}
+
+		entries = append(entries, entry)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.removeEntries(ctx, entries)
+}
+
+// removeEntries stops on the first error and returns entries removed before it
+func (s *CacheServiceImplementation) removeEntries(ctx context.Context, entries []cacherepositories.CachedImageModel) (removedEntries []cacherepositories.CachedImageModel, err error) {
 	for _, entry := range entries {
+		s.memoryTier.Remove(entry.RequestSignature, entry.ProcessorType)
+
 		err = s.imagesRepository.DeleteCachedImageInfo(ctx, entry.RequestSignature, entry.ProcessorType)
 		if err != nil {
 			return
@@ -79,7 +285,16 @@ func (s *CacheServiceImplementation) InvalidateAllEntriesForURL(ctx context.Cont
 	return
 }
 
+const (
+	entrySaveTimeout           = time.Hour
+	unsavedEntryRemovalTimeout = 10 * time.Second
+)
+
 var (
 	ErrEntryNotFound      = errors.New("entry not found")
 	ErrEntryAlreadyExists = errors.New("entry already exists")
+
+	ErrTooManyMatchingEntries = errors.New("invalidation pattern matches too many entries")
+
+	errChecksumMismatch = errors.New("checksum of cached image does not match")
 )
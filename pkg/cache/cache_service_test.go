@@ -3,11 +3,14 @@ package cache_test
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/thebartekbanach/imcaxy/pkg/cache"
@@ -16,6 +19,7 @@ import (
 	mock_cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/mocks"
 	"github.com/thebartekbanach/imcaxy/pkg/hub"
 	mock_hub "github.com/thebartekbanach/imcaxy/pkg/hub/mocks"
+	datahubstorage "github.com/thebartekbanach/imcaxy/pkg/hub/storage"
 )
 
 func TestCacheService_GetCorrectlyGetsInformationFromImageStorage(t *testing.T) {
@@ -27,7 +31,8 @@ func TestCacheService_GetCorrectlyGetsInformationFromImageStorage(t *testing.T)
 
 	mockImagesStorage.InstantSave("test-signature", "imaginary", testData)
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+	mockImagesRepo.EXPECT().GetCachedImageInfo(gomock.Any(), "test-signature", "imaginary").Return(cacherepositories.CachedImageModel{}, nil)
 	cacheService.Get(context.Background(), "test-signature", "imaginary", &mockStreamInput)
 
 	mockStreamInput.Wait()
@@ -43,7 +48,8 @@ func TestCacheService_GetShouldReturnErrorIfEntryNotFound(t *testing.T) {
 	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
 	mockStreamInput := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+	mockImagesRepo.EXPECT().GetCachedImageInfo(gomock.Any(), "test-signature", "imaginary").Return(cacherepositories.CachedImageModel{}, cacherepositories.ErrCachedImageNotFound)
 	err := cacheService.Get(context.Background(), "test-signature", "imaginary", &mockStreamInput)
 
 	if err != cache.ErrEntryNotFound {
@@ -59,12 +65,107 @@ func TestCacheService_GetDoesNotCloseStreamInputOnErrImageNotFoundError(t *testi
 
 	mockStreamInput.EXPECT().Close(gomock.Any()).Times(0)
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 	// image with signature "unknown-signature" processed by "imaginary" processor
 	// is not defined in cache (so cache mock returns ErrImageNotFound)
+	mockImagesRepo.EXPECT().GetCachedImageInfo(gomock.Any(), "unknown-signature", "imaginary").Return(cacherepositories.CachedImageModel{}, nil)
+	mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), "unknown-signature", "imaginary").Return(nil)
 	cacheService.Get(context.Background(), "unknown-signature", "imaginary", mockStreamInput)
 }
 
+func TestCacheService_GetShouldRemoveEntryWithoutImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+	mockStreamInput := mock_hub.NewMockDataStreamInput(mockCtrl)
+
+	entry := cacherepositories.CachedImageModel{RequestSignature: "signature", ProcessorType: "imaginary", CreatedAt: time.Now().Add(-2 * time.Hour)}
+	mockImagesRepo.EXPECT().GetCachedImageInfo(gomock.Any(), "signature", "imaginary").Return(entry, nil)
+	mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), "signature", "imaginary").Return(nil)
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+	if err := cacheService.Get(context.Background(), "signature", "imaginary", mockStreamInput); err != cache.ErrEntryNotFound {
+		t.Errorf("Expected ErrEntryNotFound error, got: %v", err)
+	}
+}
+
+func TestCacheService_GetShouldRemoveRecentlyCreatedReadyEntryWithoutImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+	mockStreamInput := mock_hub.NewMockDataStreamInput(mockCtrl)
+
+	entry := cacherepositories.CachedImageModel{RequestSignature: "signature", ProcessorType: "imaginary", State: cacherepositories.CachedImageReady, CreatedAt: time.Now()}
+	mockImagesRepo.EXPECT().GetCachedImageInfo(gomock.Any(), "signature", "imaginary").Return(entry, nil)
+	mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), "signature", "imaginary").Return(nil)
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+	if err := cacheService.Get(context.Background(), "signature", "imaginary", mockStreamInput); err != cache.ErrEntryNotFound {
+		t.Errorf("Expected ErrEntryNotFound error, got: %v", err)
+	}
+}
+
+func TestCacheService_GetShouldKeepRecentlyCreatedEntryWithoutImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+	mockStreamInput := mock_hub.NewMockDataStreamInput(mockCtrl)
+
+	// image of legacy entry, which is not pending when it is saved, can be still saved
+	entry := cacherepositories.CachedImageModel{RequestSignature: "signature", ProcessorType: "imaginary", CreatedAt: time.Now()}
+	mockImagesRepo.EXPECT().GetCachedImageInfo(gomock.Any(), "signature", "imaginary").Return(entry, nil)
+	mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+	if err := cacheService.Get(context.Background(), "signature", "imaginary", mockStreamInput); err != cache.ErrEntryNotFound {
+		t.Errorf("Expected ErrEntryNotFound error, got: %v", err)
+	}
+}
+
+func TestCacheService_GetShouldServeVerifiedImage(t *testing.T) {
+	testData := []byte{0x1, 0x2, 0x3}
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+	mockStreamInput := mock_hub.NewMockTestingDataStreamInput(t, [][]byte{testData}, nil, nil)
+
+	entry := cacherepositories.CachedImageModel{RequestSignature: "signature", ProcessorType: "imaginary", Checksum: fmt.Sprintf("%x", sha256.Sum256(testData))}
+	mockImagesRepo.EXPECT().GetCachedImageInfo(gomock.Any(), "signature", "imaginary").Return(entry, nil)
+	mockImagesStorage.InstantSave("signature", "imaginary", testData)
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{VerificationRatio: 1})
+	if err := cacheService.Get(context.Background(), "signature", "imaginary", &mockStreamInput); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+
+	mockStreamInput.Wait()
+}
+
+func TestCacheService_GetShouldRemoveCorruptedImageWithoutServingIt(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+	mockStreamInput := mock_hub.NewMockDataStreamInput(mockCtrl)
+
+	entry := cacherepositories.CachedImageModel{RequestSignature: "signature", ProcessorType: "imaginary", Checksum: fmt.Sprintf("%x", sha256.Sum256([]byte("saved data")))}
+	mockImagesRepo.EXPECT().GetCachedImageInfo(gomock.Any(), "signature", "imaginary").Return(entry, nil)
+	mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), "signature", "imaginary").Return(nil)
+	mockImagesStorage.InstantSave("signature", "imaginary", []byte("corrupted data"))
+
+	// stream is reused to serve processed image
+	mockStreamInput.EXPECT().Write(gomock.Any()).Times(0)
+	mockStreamInput.EXPECT().Close(gomock.Any()).Times(0)
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{VerificationRatio: 1})
+	if err := cacheService.Get(context.Background(), "signature", "imaginary", mockStreamInput); err != cache.ErrEntryNotFound {
+		t.Errorf("Expected ErrEntryNotFound error, got: %v", err)
+	}
+
+	if mockImagesStorage.Exists("signature", "imaginary") {
+		t.Errorf("Expected corrupted image to be removed from storage")
+	}
+}
+
 func TestCacheService_GetClosesStreamDoesNotCloseInputOnAnyImagesStorageError(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
@@ -75,10 +176,96 @@ func TestCacheService_GetClosesStreamDoesNotCloseInputOnAnyImagesStorageError(t
 	mockImagesStorage.ReturnError(testError)
 	mockStreamInput.EXPECT().Close(gomock.Any()).Times(0)
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+	mockImagesRepo.EXPECT().GetCachedImageInfo(gomock.Any(), "unknown-signature", "imaginary").Return(cacherepositories.CachedImageModel{}, nil)
 	cacheService.Get(context.Background(), "unknown-signature", "imaginary", mockStreamInput)
 }
 
+func TestCacheService_GetShouldTreatExpiredEntryAsMissAndRemoveIt(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+	mockStreamInput := mock_hub.NewMockDataStreamInput(mockCtrl)
+
+	mockImagesStorage.InstantSave("test-signature", "imaginary", []byte("test data"))
+	expiredInfo := cacherepositories.CachedImageModel{
+		RequestSignature: "test-signature",
+		ProcessorType:    "imaginary",
+		ExpiresAt:        time.Now().Add(-time.Minute),
+	}
+
+	mockImagesRepo.EXPECT().GetCachedImageInfo(gomock.Any(), "test-signature", "imaginary").Return(expiredInfo, nil)
+	mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), "test-signature", "imaginary").Return(nil)
+	mockStreamInput.EXPECT().Close(gomock.Any()).Times(0)
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+	err := cacheService.Get(context.Background(), "test-signature", "imaginary", mockStreamInput)
+
+	if err != cache.ErrEntryNotFound {
+		t.Errorf("Expected ErrEntryNotFound error, got: %v", err)
+	}
+
+	if mockImagesStorage.Exists("test-signature", "imaginary") {
+		t.Errorf("Expected expired image to be removed from storage")
+	}
+}
+
+func TestCacheService_ContainsShouldReportOnlyNotExpiredEntries(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+	mockImagesRepo.EXPECT().GetCachedImageInfo(gomock.Any(), "cached", "imaginary").Return(cacherepositories.CachedImageModel{}, nil)
+	mockImagesRepo.EXPECT().GetCachedImageInfo(gomock.Any(), "expired", "imaginary").Return(cacherepositories.CachedImageModel{ExpiresAt: time.Now().Add(-time.Minute)}, nil)
+	mockImagesRepo.EXPECT().GetCachedImageInfo(gomock.Any(), "unknown", "imaginary").Return(cacherepositories.CachedImageModel{}, cacherepositories.ErrCachedImageNotFound)
+
+	expected := map[string]bool{"cached": true, "expired": false, "unknown": false}
+	for signature, expectedContains := range expected {
+		contains, err := cacheService.Contains(context.Background(), signature, "imaginary")
+		if err != nil || contains != expectedContains {
+			t.Errorf("Expected %s entry to be contained: %v, got: %v, %v", signature, expectedContains, contains, err)
+		}
+	}
+}
+
+func TestCacheService_SaveShouldSetExpirationTimeUsingPolicy(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+	mockStreamOutput := mock_hub.NewMockTestingDataStreamOutput(t, [][]byte{{0x1}}, nil, nil)
+
+	cachedImageInfo := cacherepositories.CachedImageModel{
+		RequestSignature:  "test-signature",
+		ProcessorType:     "imaginary",
+		ProcessorEndpoint: "/thumbnail",
+		ImageSize:         1,
+	}
+	policy := cache.ExpirationPolicy{
+		DefaultTTL: 24 * time.Hour,
+		Rules:      []cache.ExpirationRule{{ProcessorEndpoint: "/thumbnail", TTL: time.Hour}},
+	}
+
+	var savedInfo cacherepositories.CachedImageModel
+	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, info cacherepositories.CachedImageModel) error {
+			savedInfo = info
+			return nil
+		},
+	)
+	mockImagesRepo.EXPECT().MarkCachedImageReady(gomock.Any(), "test-signature", "imaginary", int64(1), gomock.Any()).Return(nil)
+
+	before := time.Now()
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, policy, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+	if err := cacheService.Save(context.Background(), cachedImageInfo, mockStreamOutput); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if savedInfo.ExpiresAt.Before(before.Add(time.Hour)) || savedInfo.ExpiresAt.After(time.Now().Add(time.Hour)) {
+		t.Errorf("Expected entry to expire in an hour, got expiration time %v", savedInfo.ExpiresAt)
+	}
+}
+
 func TestCacheService_SaveShouldCorrectlySaveImage(t *testing.T) {
 	testData := [][]byte{{0x1, 0x2, 0x3}}
 	mockCtrl := gomock.NewController(t)
@@ -100,19 +287,92 @@ func TestCacheService_SaveShouldCorrectlySaveImage(t *testing.T) {
 			"url":    {"http://google.com/image.jpg"},
 		},
 	}
-	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), cachedImageInfo).Return(nil)
+	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), pendingImageInfo(cachedImageInfo)).Return(nil)
+	mockImagesRepo.EXPECT().MarkCachedImageReady(gomock.Any(), cachedImageInfo.RequestSignature, "imaginary", int64(0), gomock.Any()).Return(nil)
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 	err := cacheService.Save(context.Background(), cachedImageInfo, mockStreamOutput)
 
 	if err != nil {
 		t.Errorf("Expected no error, got: %v", err)
 	}
 
+	mockImagesRepo.EXPECT().GetCachedImageInfo(gomock.Any(), cachedImageInfo.RequestSignature, "imaginary").Return(cachedImageInfo, nil)
 	cacheService.Get(context.Background(), cachedImageInfo.RequestSignature, "imaginary", &mockStreamInput)
 	mockStreamInput.Wait()
 }
 
+func TestCacheService_SaveShouldKeepChecksumOfImageInStorage(t *testing.T) {
+	testData := [][]byte{{0x1, 0x2, 0x3}}
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+	mockStreamOutput := mock_hub.NewMockTestingDataStreamOutput(t, testData, nil, nil)
+
+	cachedImageInfo := cacherepositories.CachedImageModel{RequestSignature: "signature", ProcessorType: "imaginary", MimeType: "image/jpeg", ImageSize: 3}
+	expectedChecksum := fmt.Sprintf("%x", sha256.Sum256(testData[0]))
+	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), gomock.Any()).Return(nil)
+	mockImagesRepo.EXPECT().MarkCachedImageReady(gomock.Any(), "signature", "imaginary", int64(3), expectedChecksum).Return(nil)
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+	if err := cacheService.Save(context.Background(), cachedImageInfo, mockStreamOutput); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if checksum := mockImagesStorage.Checksum("signature", "imaginary"); checksum != expectedChecksum {
+		t.Errorf("Expected storage to keep checksum %s, got: %s", expectedChecksum, checksum)
+	}
+}
+
+func TestCacheService_SaveShouldUpdateSizeOfImageOfUnknownSize(t *testing.T) {
+	testData := [][]byte{{0x1, 0x2, 0x3}, {0x4, 0x5}}
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+	mockStreamOutput := mock_hub.NewMockTestingDataStreamOutput(t, testData, nil, nil)
+
+	cachedImageInfo := cacherepositories.CachedImageModel{
+		RawRequest:        "/crop?width=500&height=500&url=http://google.com/image.jpg",
+		RequestSignature:  "|/crop|height=500|url=http://google.com/image.jpg|width=500|",
+		ProcessorType:     "imaginary",
+		MimeType:          "image/jpeg",
+		ImageSize:         -1,
+		ProcessorEndpoint: "/crop",
+		SourceImageURL:    "http://google.com/image.jpg",
+	}
+	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), pendingImageInfo(cachedImageInfo)).Return(nil)
+	expectedChecksum := fmt.Sprintf("%x", sha256.Sum256([]byte{0x1, 0x2, 0x3, 0x4, 0x5}))
+	mockImagesRepo.EXPECT().MarkCachedImageReady(gomock.Any(), cachedImageInfo.RequestSignature, "imaginary", int64(5), expectedChecksum).Return(nil)
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+	err := cacheService.Save(context.Background(), cachedImageInfo, mockStreamOutput)
+
+	if err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+}
+
+func TestCacheService_SaveShouldRemoveImageOfEntryRemovedWhileSaving(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+	mockStreamOutput, cachedImageInfo, _ := getTestDataReadStream(t)
+
+	// entry was invalidated before its image was saved
+	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), pendingImageInfo(cachedImageInfo)).Return(nil)
+	mockImagesRepo.EXPECT().MarkCachedImageReady(gomock.Any(), cachedImageInfo.RequestSignature, "imaginary", cachedImageInfo.ImageSize, gomock.Any()).Return(cacherepositories.ErrCachedImageNotFound)
+	mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), cachedImageInfo.RequestSignature, "imaginary").Return(cacherepositories.ErrCachedImageNotFound)
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+	if err := cacheService.Save(context.Background(), cachedImageInfo, mockStreamOutput); err != cacherepositories.ErrCachedImageNotFound {
+		t.Errorf("Expected ErrCachedImageNotFound error, got: %v", err)
+	}
+
+	if mockImagesStorage.Exists(cachedImageInfo.RequestSignature, cachedImageInfo.ProcessorType) {
+		t.Errorf("Expected image of removed entry to be removed from storage")
+	}
+}
+
 func TestCacheService_SaveShouldReturnErrorIfEntryAlreadyExists(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
@@ -132,9 +392,9 @@ func TestCacheService_SaveShouldReturnErrorIfEntryAlreadyExists(t *testing.T) {
 			"url":    {"http://google.com/image.jpg"},
 		},
 	}
-	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), cachedImageInfo).Return(cacherepositories.ErrCachedImageAlreadyExists)
+	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), pendingImageInfo(cachedImageInfo)).Return(cacherepositories.ErrCachedImageAlreadyExists)
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 	err := cacheService.Save(context.Background(), cachedImageInfo, mockStreamOutput)
 
 	if err != cache.ErrEntryAlreadyExists {
@@ -162,9 +422,9 @@ func TestCacheService_SaveShouldReturnErrorReturnedByImagesRepository(t *testing
 		},
 	}
 	createError := errors.New("network error")
-	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), cachedImageInfo).Return(createError)
+	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), pendingImageInfo(cachedImageInfo)).Return(createError)
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 	err := cacheService.Save(context.Background(), cachedImageInfo, mockStreamOutput)
 
 	if err != createError {
@@ -192,10 +452,10 @@ func TestCacheService_SaveShouldReturnErrorReturnedByStreamOutput(t *testing.T)
 			"url":    {"http://google.com/image.jpg"},
 		},
 	}
-	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), cachedImageInfo).Return(nil)
+	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), pendingImageInfo(cachedImageInfo)).Return(nil)
 	mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 	err := cacheService.Save(context.Background(), cachedImageInfo, mockStreamOutput)
 
 	if err != streamReadError {
@@ -222,10 +482,10 @@ func TestCacheService_SaveShouldRollbackChangesFromImagesRepositoryOnStorageSave
 			"url":    {"http://google.com/image.jpg"},
 		},
 	}
-	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), cachedImageInfo).Return(nil)
+	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), pendingImageInfo(cachedImageInfo)).Return(nil)
 	mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), cachedImageInfo.RequestSignature, cachedImageInfo.ProcessorType).Return(nil)
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 	cacheService.Save(context.Background(), cachedImageInfo, mockStreamOutput)
 }
 
@@ -249,9 +509,9 @@ func TestCacheService_SaveShouldNotSaveImageInStorageOnImagesRepositoryInfoSaveE
 			"url":    {"http://google.com/image.jpg"},
 		},
 	}
-	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), cachedImageInfo).Return(errors.New("some error"))
+	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), pendingImageInfo(cachedImageInfo)).Return(errors.New("some error"))
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 	cacheService.Save(context.Background(), cachedImageInfo, mockStreamOutput)
 
 	if mockImagesStorage.Exists(cachedImageInfo.RequestSignature, cachedImageInfo.ProcessorType) {
@@ -278,10 +538,10 @@ func TestCacheService_SaveClosesStreamOutputOnErrCachedImageAlreadyExistsImagesR
 			"url":    {"http://google.com/image.jpg"},
 		},
 	}
-	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), imageInfo).Return(cacherepositories.ErrCachedImageAlreadyExists)
+	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), pendingImageInfo(imageInfo)).Return(cacherepositories.ErrCachedImageAlreadyExists)
 	mockStreamOutput.EXPECT().Close().Return(nil)
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 	cacheService.Save(context.Background(), imageInfo, mockStreamOutput)
 }
 
@@ -305,10 +565,10 @@ func TestCacheService_SaveClosesStreamOutputOnAnyImagesRepoError(t *testing.T) {
 		},
 	}
 	testError := errors.New("some error")
-	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), imageInfo).Return(testError)
+	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), pendingImageInfo(imageInfo)).Return(testError)
 	mockStreamOutput.EXPECT().Close().Return(nil)
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 	cacheService.Save(context.Background(), imageInfo, mockStreamOutput)
 }
 
@@ -331,13 +591,13 @@ func TestCacheService_SaveClosesStreamOutputOnAnyImagesStorageError(t *testing.T
 			"url":    {"http://google.com/image.jpg"},
 		},
 	}
-	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), imageInfo).Return(nil)
+	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), pendingImageInfo(imageInfo)).Return(nil)
 	mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), imageInfo.RequestSignature, imageInfo.ProcessorType).Return(nil)
 	mockStreamOutput.EXPECT().Close().Return(nil)
 	testError := errors.New("some error")
 	mockImagesStorage.ReturnError(testError)
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 	cacheService.Save(context.Background(), imageInfo, mockStreamOutput)
 }
 
@@ -380,7 +640,7 @@ func TestCacheService_InvalidateAllEntriesForURLShouldDeleteAllCachedImagesOfGiv
 		mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), image.RequestSignature, image.ProcessorType).Return(nil)
 	}
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 	removedEntries, _ := cacheService.InvalidateAllEntriesForURL(context.Background(), "http://google.com/image.jpg")
 
 	if len(removedEntries) != 2 {
@@ -436,7 +696,7 @@ func TestCacheService_InvalidateAllEntriesForURLShouldStopDeletingAndReturnError
 	mockImagesStorage.InstantSave(cachedImages[0].RequestSignature, cachedImages[0].ProcessorType, []byte{0x0})
 	mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), cachedImages[0].RequestSignature, cachedImages[0].ProcessorType).Return(errors.New("some error"))
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 	cacheService.InvalidateAllEntriesForURL(context.Background(), "http://google.com/image.jpg")
 
 	if !mockImagesStorage.Exists(cachedImages[0].RequestSignature, cachedImages[0].ProcessorType) {
@@ -487,7 +747,7 @@ func TestCacheService_InvalidateAllEntriesForURLShouldStopDeletingAndReturnError
 	// the cachedImages[1] is unknown to storage, so it will return not found error and because of that
 	// it should not call mockImagesRepo.DeleteCachedImageInfo
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 	cacheService.InvalidateAllEntriesForURL(context.Background(), "http://google.com/image.jpg")
 }
 
@@ -531,7 +791,7 @@ func TestCacheService_InvalidateAllEntriesForURLShouldReturnAllRemovedImagesInfo
 		mockImagesStorage.InstantSave(image.RequestSignature, image.ProcessorType, []byte{0x0})
 	}
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 	removedImages, _ := cacheService.InvalidateAllEntriesForURL(context.Background(), "http://google.com/image.jpg")
 
 	if len(removedImages) != len(cachedImages) {
@@ -580,7 +840,7 @@ func TestCacheService_InvalidateAllEntriesForURLShouldReturnOnlyRemovedImagesIfE
 		mockImagesStorage.InstantSave(image.RequestSignature, image.ProcessorType, []byte{0x0})
 	}
 
-	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage)
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 	removedImages, _ := cacheService.InvalidateAllEntriesForURL(context.Background(), "http://google.com/image.jpg")
 
 	if len(removedImages) != 1 {
@@ -635,7 +895,7 @@ func TestCacheServiceIntegration_SavesAndGetsImageCorrectly(t *testing.T) {
 	dataStreamOutput, imageInfo, testData := getTestDataReadStream(t)
 	mockDataStreamInput := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
 
-	cacheService := cache.NewCacheService(imagesCache, imagesStorage)
+	cacheService := cache.NewCacheService(imagesCache, imagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, imagesCache), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 
 	if err := cacheService.Save(context.Background(), imageInfo, dataStreamOutput); err != nil {
 		t.Fatal(err)
@@ -656,6 +916,44 @@ func TestCacheServiceIntegration_SavesAndGetsImageCorrectly(t *testing.T) {
 	}
 }
 
+func TestCacheServiceIntegration_SaveKeepsChecksumInObjectMetadata(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping cacheService integration tests")
+	}
+
+	mongoTestingConnection := dbconnections.NewCacheDBTestingConnection(t)
+	minioTestingConnection := dbconnections.NewMinioBlockStorageTestingConnection(t)
+	imagesCache := cacherepositories.NewCachedImagesRepository(mongoTestingConnection)
+	imagesStorage := cacherepositories.NewCachedImagesStorage(minioTestingConnection)
+	dataStreamOutput, imageInfo, testData := getTestDataReadStream(t)
+
+	cacheService := cache.NewCacheService(imagesCache, imagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, imagesCache), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+
+	if err := cacheService.Save(context.Background(), imageInfo, dataStreamOutput); err != nil {
+		t.Fatal(err)
+	}
+
+	object, err := minioTestingConnection.GetObject(context.Background(), cacherepositories.StorageKey(imageInfo.RequestSignature, imageInfo.ProcessorType))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer object.Close()
+
+	objectInfo, err := object.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedChecksum := fmt.Sprintf("%x", sha256.Sum256(testData))
+	if checksum := objectInfo.UserMetadata[dbconnections.ChecksumMetadataKey]; checksum != expectedChecksum {
+		t.Errorf("Expected object metadata to contain checksum %s, got: %v", expectedChecksum, objectInfo.UserMetadata)
+	}
+
+	if objectInfo.ContentType != imageInfo.MimeType {
+		t.Errorf("Expected object to keep content type %s, got: %s", imageInfo.MimeType, objectInfo.ContentType)
+	}
+}
+
 func TestCacheServiceIntegration_GetReturnsErrorWhenImageIsNotFound(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping cacheService integration tests")
@@ -667,7 +965,7 @@ func TestCacheServiceIntegration_GetReturnsErrorWhenImageIsNotFound(t *testing.T
 	imagesStorage := cacherepositories.NewCachedImagesStorage(minioTestingConnection)
 	mockDataStreamInput := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
 
-	cacheService := cache.NewCacheService(imagesCache, imagesStorage)
+	cacheService := cache.NewCacheService(imagesCache, imagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, imagesCache), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 
 	if err := cacheService.Get(context.Background(), "unknown-signature", "imaginary", &mockDataStreamInput); err != cache.ErrEntryNotFound {
 		t.Errorf("Expected to get ErrEntryNotFound error, but got: %v", err)
@@ -685,7 +983,7 @@ func TestCacheServiceIntegration_SaveReturnsErrorWhenImageAlreadyExists(t *testi
 	imagesStorage := cacherepositories.NewCachedImagesStorage(minioTestingConnection)
 	dataStreamOutput, imageInfo, _ := getTestDataReadStream(t)
 
-	cacheService := cache.NewCacheService(imagesCache, imagesStorage)
+	cacheService := cache.NewCacheService(imagesCache, imagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, imagesCache), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 	cacheService.Save(context.Background(), imageInfo, dataStreamOutput)
 
 	if err := cacheService.Save(context.Background(), imageInfo, dataStreamOutput); err != cache.ErrEntryAlreadyExists {
@@ -703,7 +1001,7 @@ func TestCacheServiceIntegration_InvaildateAllEntriesForURLRemovesAllEntriesOfGi
 	imagesCache := cacherepositories.NewCachedImagesRepository(mongoTestingConnection)
 	imagesStorage := cacherepositories.NewCachedImagesStorage(minioTestingConnection)
 
-	cacheService := cache.NewCacheService(imagesCache, imagesStorage)
+	cacheService := cache.NewCacheService(imagesCache, imagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, imagesCache), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
 
 	signaturesExpectedToBeDeleted := make([]string, 3)
 	for i := 0; i < 3; i++ {
@@ -747,3 +1045,184 @@ func containsInvalidatedEntry(signaturesExpectedToBeDeleted []string, invalidate
 	}
 	return false
 }
+
+// entries are created in pending state until their images are saved
+func pendingImageInfo(info cacherepositories.CachedImageModel) cacherepositories.CachedImageModel {
+	info.State = cacherepositories.CachedImagePending
+	return info
+}
+
+func TestCacheService_InvalidateAllEntriesMatchingShouldDeleteOnlyEntriesMatchingThePattern(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+
+	cachedImages := []cacherepositories.CachedImageModel{
+		{RequestSignature: "a", ProcessorType: "imaginary", SourceImageURL: "http://google.com/products/a.jpg"},
+		{RequestSignature: "b", ProcessorType: "imaginary", SourceImageURL: "http://google.com/products/b.png"},
+		{RequestSignature: "c", ProcessorType: "imaginary", SourceImageURL: "http://google.com/products/new/c.jpg"},
+	}
+	mockImagesRepo.EXPECT().WalkCachedImageInfosOfSourcePrefix(gomock.Any(), "http://google.com/products/", gomock.Any()).DoAndReturn(walkCachedImageInfos(cachedImages, nil))
+	for _, image := range cachedImages {
+		mockImagesStorage.InstantSave(image.RequestSignature, image.ProcessorType, []byte{})
+	}
+
+	mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), "a", "imaginary").Return(nil)
+	mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), "c", "imaginary").Return(nil)
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+	pattern := cacherepositories.InvalidationPattern{Type: cacherepositories.RegexPattern, Pattern: `http://google\.com/products/.*\.jpg`}
+	removedEntries, err := cacheService.InvalidateAllEntriesMatching(context.Background(), pattern, 10)
+
+	if err != nil || len(removedEntries) != 2 {
+		t.Errorf("Expected 2 entries to be removed, got: %v, %v", removedEntries, err)
+	}
+
+	if !mockImagesStorage.Exists("b", "imaginary") {
+		t.Errorf("Expected not matching image to stay in storage")
+	}
+}
+
+func TestCacheService_InvalidateAllEntriesMatchingShouldNotDeleteAnythingWhenTooManyEntriesMatch(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+
+	cachedImages := []cacherepositories.CachedImageModel{
+		{RequestSignature: "a", ProcessorType: "imaginary", SourceImageURL: "http://google.com/a.jpg"},
+		{RequestSignature: "b", ProcessorType: "imaginary", SourceImageURL: "http://google.com/b.jpg"},
+	}
+	mockImagesRepo.EXPECT().WalkCachedImageInfosOfSourcePrefix(gomock.Any(), "http://google.com/", gomock.Any()).DoAndReturn(walkCachedImageInfos(cachedImages, nil))
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+	pattern := cacherepositories.InvalidationPattern{Type: cacherepositories.GlobPattern, Pattern: "http://google.com/*.jpg"}
+	removedEntries, err := cacheService.InvalidateAllEntriesMatching(context.Background(), pattern, 1)
+
+	if !errors.Is(err, cache.ErrTooManyMatchingEntries) || len(removedEntries) != 0 {
+		t.Errorf("Expected ErrTooManyMatchingEntries and no removed entries, got: %v, %v", removedEntries, err)
+	}
+}
+
+func TestCacheService_InvalidateAllEntriesMatchingShouldStopWalkingEntriesOverTheLimit(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+
+	cachedImages := []cacherepositories.CachedImageModel{
+		{RequestSignature: "a", ProcessorType: "imaginary", SourceImageURL: "http://google.com/a.jpg"},
+		{RequestSignature: "b", ProcessorType: "imaginary", SourceImageURL: "http://google.com/b.png"},
+		{RequestSignature: "c", ProcessorType: "imaginary", SourceImageURL: "http://google.com/c.jpg"},
+		{RequestSignature: "d", ProcessorType: "imaginary", SourceImageURL: "http://google.com/d.jpg"},
+	}
+
+	walkedEntries := 0
+	mockImagesRepo.EXPECT().WalkCachedImageInfosOfSourcePrefix(gomock.Any(), "", gomock.Any()).DoAndReturn(walkCachedImageInfos(cachedImages, &walkedEntries))
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+	pattern := cacherepositories.InvalidationPattern{Type: cacherepositories.RegexPattern, Pattern: `.*\.jpg`}
+	_, err := cacheService.InvalidateAllEntriesMatching(context.Background(), pattern, 1)
+
+	if !errors.Is(err, cache.ErrTooManyMatchingEntries) || walkedEntries != 3 {
+		t.Errorf("Expected ErrTooManyMatchingEntries after 3 walked entries, got: %v after %d entries", err, walkedEntries)
+	}
+}
+
+// walkCachedImageInfos walks the entries the same way as the repository and counts walked entries
+func walkCachedImageInfos(infos []cacherepositories.CachedImageModel, walkedEntries *int) func(context.Context, string, func(cacherepositories.CachedImageModel) error) error {
+	return func(ctx context.Context, prefix string, walkFn func(cacherepositories.CachedImageModel) error) error {
+		for _, info := range infos {
+			if walkedEntries != nil {
+				*walkedEntries++
+			}
+
+			if err := walkFn(info); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+func TestCacheService_InvalidateAllEntriesMatchingShouldRejectInvalidRegex(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+	pattern := cacherepositories.InvalidationPattern{Type: cacherepositories.RegexPattern, Pattern: "http://google.com/(.jpg"}
+
+	if _, err := cacheService.InvalidateAllEntriesMatching(context.Background(), pattern, 0); !errors.Is(err, cache.ErrInvalidPattern) {
+		t.Errorf("Expected ErrInvalidPattern, got: %v", err)
+	}
+}
+
+// streamingImagesStorage reports the first read of the image, before the image is read to the end
+type streamingImagesStorage struct {
+	*mock_cacherepositories.MockCachedImagesStorage
+	firstRead chan struct{}
+}
+
+func (s *streamingImagesStorage) Save(ctx context.Context, requestSignature, processorType, mimeType string, size int64, checksum string, reader hub.DataStreamOutput) error {
+	buff := make([]byte, 1)
+	if _, err := io.ReadFull(reader, buff); err != nil {
+		return err
+	}
+
+	close(s.firstRead)
+	rest, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	s.InstantSave(requestSignature, processorType, append(buff, rest...))
+	return nil
+}
+
+func TestCacheService_SaveShouldStreamImageToStorageBeforeItIsWhole(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := &streamingImagesStorage{mock_cacherepositories.NewMockCachedImagesStorage(), make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	datahub := hub.NewDataHub(datahubstorage.NewStorage())
+	datahub.StartMonitors(ctx)
+
+	input, err := datahub.CreateStream("stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := datahub.GetStreamOutput("stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cachedImageInfo := cacherepositories.CachedImageModel{RequestSignature: "signature", ProcessorType: "imaginary", ImageSize: -1}
+	expectedChecksum := fmt.Sprintf("%x", sha256.Sum256([]byte("first chunk, second chunk")))
+	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), pendingImageInfo(cachedImageInfo)).Return(nil)
+	mockImagesRepo.EXPECT().MarkCachedImageReady(gomock.Any(), "signature", "imaginary", int64(25), expectedChecksum).Return(nil)
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), cache.NewMemoryTier(cache.MemoryTierConfig{}), cache.IntegrityPolicy{})
+
+	input.Write([]byte("first chunk, "))
+	saved := make(chan error, 1)
+	go func() {
+		saved <- cacheService.Save(context.Background(), cachedImageInfo, output)
+	}()
+
+	select {
+	case <-mockImagesStorage.firstRead:
+	case <-time.After(time.Second):
+		t.Fatal("storage did not receive the image before it was whole")
+	}
+
+	input.Write([]byte("second chunk"))
+	input.Close(nil)
+
+	if err := <-saved; err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math"
+
+	"github.com/thebartekbanach/imcaxy/pkg/hub"
+)
+
+// countingStreamOutput remembers the furthest byte read from the stream,
+// which is the size of the whole stream once it has been read to the end,
+// and computes the checksum of bytes read from the beginning of the stream.
+// It does not close the underlying stream, so saved image can be read again.
+type countingStreamOutput struct {
+	hub.DataStreamOutput
+
+	pos  int64
+	size int64
+
+	// hash covers bytes from the beginning of the stream up to hashed
+	hash   hash.Hash
+	hashed int64
+}
+
+var _ hub.DataStreamOutput = (*countingStreamOutput)(nil)
+
+func newCountingStreamOutput(r hub.DataStreamOutput) *countingStreamOutput {
+	return &countingStreamOutput{DataStreamOutput: r, hash: sha256.New()}
+}
+
+func (s *countingStreamOutput) Read(p []byte) (n int, err error) {
+	n, err = s.DataStreamOutput.Read(p)
+	s.hashRead(s.pos, p[:n])
+	s.pos += int64(n)
+	s.update(s.pos)
+	return
+}
+
+func (s *countingStreamOutput) Seek(offset int64, whence int) (n int64, err error) {
+	n, err = s.DataStreamOutput.Seek(offset, whence)
+	s.pos = n
+	return
+}
+
+func (s *countingStreamOutput) ReadAt(p []byte, off int64) (n int, err error) {
+	n, err = s.DataStreamOutput.ReadAt(p, off)
+	s.hashRead(off, p[:n])
+	s.update(off + int64(n))
+	return
+}
+
+// WriteTo writes the stream from its beginning
+func (s *countingStreamOutput) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = s.DataStreamOutput.WriteTo(&countingStreamWriter{s, w, 0})
+	s.update(n)
+	return
+}
+
+func (s *countingStreamOutput) Close() error {
+	return nil
+}
+
+// checksum reads the part of the stream which was not read yet, so it is
+// known only after the whole stream is written and it is called after the save
+func (s *countingStreamOutput) checksum() (string, error) {
+	rest := io.NewSectionReader(s, s.hashed, math.MaxInt64-s.hashed)
+	if _, err := io.Copy(ioutil.Discard, rest); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(s.hash.Sum(nil)), nil
+}
+
+func (s *countingStreamOutput) update(end int64) {
+	if end > s.size {
+		s.size = end
+	}
+}
+
+// storages can read the stream in any order,
+// so only bytes continuing the hashed part are hashed
+func (s *countingStreamOutput) hashRead(off int64, p []byte) {
+	end := off + int64(len(p))
+	if off > s.hashed || end <= s.hashed {
+		return
+	}
+
+	s.hash.Write(p[s.hashed-off:])
+	s.hashed = end
+}
+
+type countingStreamWriter struct {
+	stream *countingStreamOutput
+	w      io.Writer
+	pos    int64
+}
+
+func (w *countingStreamWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	w.stream.hashRead(w.pos, p[:n])
+	w.pos += int64(n)
+	return
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ryanuber/go-glob"
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+)
+
+// ExpirationRule matches entries by all of its non-empty fields.
+type ExpirationRule struct {
+	ProcessorType     string
+	ProcessorEndpoint string
+
+	// SourceImageURL is a glob pattern, so all images
+	// of a project can be matched by its domain.
+	SourceImageURL string
+
+	// ProcessingParams match presets, entry has to have
+	// all of listed params set to given values.
+	ProcessingParams map[string]string
+
+	// TTL of zero means that matched entries never expire.
+	TTL time.Duration
+}
+
+type ExpirationPolicy struct {
+	// DefaultTTL is used when no rule matches, zero disables expiration.
+	DefaultTTL time.Duration
+
+	// Rules are checked in order, the first matching rule is used.
+	Rules []ExpirationRule
+}
+
+// ExpirationTime returns zero time if the entry never expires
+func (policy ExpirationPolicy) ExpirationTime(info cacherepositories.CachedImageModel, createdAt time.Time) time.Time {
+	ttl := policy.DefaultTTL
+	for _, rule := range policy.Rules {
+		if rule.matches(info) {
+			ttl = rule.TTL
+			break
+		}
+	}
+
+	if ttl <= 0 {
+		return time.Time{}
+	}
+
+	return createdAt.Add(ttl)
+}
+
+func (rule ExpirationRule) matches(info cacherepositories.CachedImageModel) bool {
+	if rule.ProcessorType != "" && rule.ProcessorType != info.ProcessorType {
+		return false
+	}
+
+	if rule.ProcessorEndpoint != "" && rule.ProcessorEndpoint != info.ProcessorEndpoint {
+		return false
+	}
+
+	if rule.SourceImageURL != "" && !glob.Glob(rule.SourceImageURL, info.SourceImageURL) {
+		return false
+	}
+
+	for param, value := range rule.ProcessingParams {
+		values := info.ProcessingParams[param]
+		if len(values) != 1 || values[0] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+type expirationRuleJSON struct {
+	ProcessorType     string            `json:"processorType"`
+	ProcessorEndpoint string            `json:"processorEndpoint"`
+	SourceImageURL    string            `json:"sourceImageURL"`
+	ProcessingParams  map[string]string `json:"processingParams"`
+	TTL               string            `json:"ttl"`
+}
+
+// ParseExpirationRules parses JSON array of rules with TTLs in time.ParseDuration format
+func ParseExpirationRules(data []byte) ([]ExpirationRule, error) {
+	var rawRules []expirationRuleJSON
+	if err := json.Unmarshal(data, &rawRules); err != nil {
+		return nil, err
+	}
+
+	rules := make([]ExpirationRule, len(rawRules))
+	for i, rawRule := range rawRules {
+		ttl, err := time.ParseDuration(rawRule.TTL)
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("rule %d: %w: %s", i, ErrInvalidTTL, rawRule.TTL)
+		}
+
+		rules[i] = ExpirationRule{
+			ProcessorType:     rawRule.ProcessorType,
+			ProcessorEndpoint: rawRule.ProcessorEndpoint,
+			SourceImageURL:    rawRule.SourceImageURL,
+			ProcessingParams:  rawRule.ProcessingParams,
+			TTL:               ttl,
+		}
+	}
+
+	return rules, nil
+}
+
+var ErrInvalidTTL = errors.New("invalid ttl")
@@ -0,0 +1,73 @@
+package cache_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/thebartekbanach/imcaxy/pkg/cache"
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+)
+
+func TestExpirationPolicy_ShouldUseFirstMatchingRule(t *testing.T) {
+	createdAt := time.Now()
+	policy := cache.ExpirationPolicy{
+		DefaultTTL: 30 * 24 * time.Hour,
+		Rules: []cache.ExpirationRule{
+			{ProcessingParams: map[string]string{"width": "64", "height": "64"}, TTL: 0},
+			{SourceImageURL: "https://*.project-a.com/*", TTL: 7 * 24 * time.Hour},
+			{ProcessorType: "imaginary", ProcessorEndpoint: "/thumbnail", TTL: time.Hour},
+		},
+	}
+
+	cases := []struct {
+		info     cacherepositories.CachedImageModel
+		expected time.Time
+	}{
+		{
+			cacherepositories.CachedImageModel{ProcessingParams: map[string][]string{"width": {"64"}, "height": {"64"}}},
+			time.Time{},
+		},
+		{
+			cacherepositories.CachedImageModel{SourceImageURL: "https://cdn.project-a.com/image.jpg", ProcessorEndpoint: "/thumbnail"},
+			createdAt.Add(7 * 24 * time.Hour),
+		},
+		{
+			cacherepositories.CachedImageModel{ProcessorType: "imaginary", ProcessorEndpoint: "/thumbnail"},
+			createdAt.Add(time.Hour),
+		},
+		{
+			cacherepositories.CachedImageModel{ProcessorType: "native", ProcessorEndpoint: "/thumbnail"},
+			createdAt.Add(30 * 24 * time.Hour),
+		},
+	}
+
+	for i, c := range cases {
+		if expiresAt := policy.ExpirationTime(c.info, createdAt); !expiresAt.Equal(c.expected) {
+			t.Errorf("Expected expiration time of case %d to be %v, got %v", i, c.expected, expiresAt)
+		}
+	}
+}
+
+func TestExpirationPolicy_ShouldNotExpireEntriesWithoutTTL(t *testing.T) {
+	policy := cache.ExpirationPolicy{}
+
+	if expiresAt := policy.ExpirationTime(cacherepositories.CachedImageModel{}, time.Now()); !expiresAt.IsZero() {
+		t.Errorf("Expected entry never to expire, got expiration time %v", expiresAt)
+	}
+}
+
+func TestParseExpirationRules_ShouldParseRules(t *testing.T) {
+	rules, err := cache.ParseExpirationRules([]byte(`[{"processorEndpoint": "/thumbnail", "ttl": "1h30m"}]`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(rules) != 1 || rules[0].ProcessorEndpoint != "/thumbnail" || rules[0].TTL != 90*time.Minute {
+		t.Errorf("Expected single rule with 1h30m TTL, got %+v", rules)
+	}
+
+	if _, err := cache.ParseExpirationRules([]byte(`[{"ttl": "forever"}]`)); !errors.Is(err, cache.ErrInvalidTTL) {
+		t.Errorf("Expected ErrInvalidTTL error, got %v", err)
+	}
+}
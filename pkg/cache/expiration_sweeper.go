@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"time"
+
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	"github.com/thebartekbanach/imcaxy/pkg/metrics"
+)
+
+type ExpirationSweeperConfig struct {
+	// Interval between sweeps, zero disables the sweeper.
+	Interval  time.Duration
+	BatchSize int
+	// PendingTimeout after which entries still pending are abandoned,
+	// zero disables removal of abandoned entries.
+	PendingTimeout time.Duration
+}
+
+// ExpirationSweeper periodically removes expired entries, entries expired between
+// sweeps are removed when they are read. It removes also entries which were never
+// marked ready, for example because the instance saving them crashed.
+type ExpirationSweeper struct {
+	config           ExpirationSweeperConfig
+	imagesRepository cacherepositories.CachedImagesRepository
+	imagesStorage    cacherepositories.CachedImagesStorage
+}
+
+func NewExpirationSweeper(
+	config ExpirationSweeperConfig,
+	imagesRepository cacherepositories.CachedImagesRepository,
+	imagesStorage cacherepositories.CachedImagesStorage,
+) *ExpirationSweeper {
+	return &ExpirationSweeper{config, imagesRepository, imagesStorage}
+}
+
+func (s *ExpirationSweeper) Start(ctx context.Context) {
+	if s.config.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if removedEntries, err := s.Sweep(ctx); err != nil {
+					log.Printf("expiration sweep failed after removing %d entries: %s", removedEntries, err)
+				}
+			}
+		}
+	}()
+}
+
+// Sweep removes expired and abandoned entries in batches until there are none left
+func (s *ExpirationSweeper) Sweep(ctx context.Context) (removedEntries int, err error) {
+	now := time.Now()
+	removedEntries, err = s.sweep(ctx, "cache_expired_entries", func(limit int) ([]cacherepositories.CachedImageModel, error) {
+		return s.imagesRepository.GetExpiredCachedImageInfos(ctx, now, limit)
+	})
+
+	if err != nil || s.config.PendingTimeout <= 0 {
+		return removedEntries, err
+	}
+
+	removedAbandonedEntries, err := s.sweep(ctx, "cache_abandoned_entries", func(limit int) ([]cacherepositories.CachedImageModel, error) {
+		return s.imagesRepository.GetPendingCachedImageInfos(ctx, now.Add(-s.config.PendingTimeout), limit)
+	})
+
+	return removedEntries + removedAbandonedEntries, err
+}
+
+func (s *ExpirationSweeper) sweep(
+	ctx context.Context,
+	metric string,
+	getEntries func(limit int) ([]cacherepositories.CachedImageModel, error),
+) (removedEntries int, err error) {
+	for {
+		entries, err := getEntries(s.config.BatchSize)
+		if err != nil {
+			return removedEntries, err
+		}
+
+		for _, entry := range entries {
+			if err := removeEntryIfExists(ctx, s.imagesRepository, s.imagesStorage, entry); err != nil {
+				return removedEntries, err
+			}
+
+			removedEntries++
+			metrics.Add(metric, 1)
+		}
+
+		if len(entries) < s.config.BatchSize {
+			return removedEntries, nil
+		}
+	}
+}
+
+// entry could be already removed when it was read
+func removeEntryIfExists(
+	ctx context.Context,
+	imagesRepository cacherepositories.CachedImagesRepository,
+	imagesStorage cacherepositories.CachedImagesStorage,
+	entry cacherepositories.CachedImageModel,
+) error {
+	err := imagesRepository.DeleteCachedImageInfo(ctx, entry.RequestSignature, entry.ProcessorType)
+	if err != nil && err != cacherepositories.ErrCachedImageNotFound {
+		return err
+	}
+
+	err = imagesStorage.Delete(ctx, entry.RequestSignature, entry.ProcessorType)
+	if err != nil && err != cacherepositories.ErrImageNotFound {
+		return err
+	}
+
+	return nil
+}
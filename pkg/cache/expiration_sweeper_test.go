@@ -0,0 +1,104 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/thebartekbanach/imcaxy/pkg/cache"
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	mock_cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/mocks"
+)
+
+func expiredEntries(count int) []cacherepositories.CachedImageModel {
+	entries := make([]cacherepositories.CachedImageModel, count)
+	for i := range entries {
+		entries[i] = cacherepositories.CachedImageModel{
+			RequestSignature: fmt.Sprintf("signature-%d", i),
+			ProcessorType:    "imaginary",
+		}
+	}
+
+	return entries
+}
+
+func TestExpirationSweeper_SweepShouldRemoveExpiredEntriesInBatches(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+
+	firstBatch, secondBatch := expiredEntries(2), expiredEntries(3)[2:]
+	for _, entry := range append(firstBatch, secondBatch...) {
+		mockImagesStorage.InstantSave(entry.RequestSignature, entry.ProcessorType, []byte("test data"))
+		mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), entry.RequestSignature, entry.ProcessorType).Return(nil)
+	}
+
+	gomock.InOrder(
+		mockImagesRepo.EXPECT().GetExpiredCachedImageInfos(gomock.Any(), gomock.Any(), 2).Return(firstBatch, nil),
+		mockImagesRepo.EXPECT().GetExpiredCachedImageInfos(gomock.Any(), gomock.Any(), 2).Return(secondBatch, nil),
+	)
+
+	sweeper := cache.NewExpirationSweeper(cache.ExpirationSweeperConfig{BatchSize: 2}, mockImagesRepo, mockImagesStorage)
+	removedEntries, err := sweeper.Sweep(context.Background())
+
+	if err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+
+	if removedEntries != 3 {
+		t.Errorf("Expected 3 removed entries, got %d", removedEntries)
+	}
+
+	if mockImagesStorage.Exists("signature-0", "imaginary") {
+		t.Errorf("Expected expired image to be removed from storage")
+	}
+}
+
+func TestExpirationSweeper_SweepShouldIgnoreEntriesAlreadyRemoved(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+
+	mockImagesRepo.EXPECT().GetExpiredCachedImageInfos(gomock.Any(), gomock.Any(), 10).Return(expiredEntries(1), nil)
+	mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), "signature-0", "imaginary").Return(cacherepositories.ErrCachedImageNotFound)
+
+	sweeper := cache.NewExpirationSweeper(cache.ExpirationSweeperConfig{BatchSize: 10}, mockImagesRepo, mockImagesStorage)
+	if _, err := sweeper.Sweep(context.Background()); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+}
+
+func TestExpirationSweeper_SweepShouldRemoveAbandonedPendingEntries(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+
+	abandonedEntries := expiredEntries(1)
+	mockImagesStorage.InstantSave("signature-0", "imaginary", []byte("test data"))
+
+	before := time.Now()
+	mockImagesRepo.EXPECT().GetExpiredCachedImageInfos(gomock.Any(), gomock.Any(), 2).Return(nil, nil)
+	mockImagesRepo.EXPECT().GetPendingCachedImageInfos(gomock.Any(), gomock.Any(), 2).DoAndReturn(
+		func(ctx context.Context, createdBefore time.Time, limit int) ([]cacherepositories.CachedImageModel, error) {
+			if createdBefore.Before(before.Add(-time.Hour)) || createdBefore.After(time.Now().Add(-time.Hour)) {
+				t.Errorf("Expected entries pending for an hour to be abandoned, got entries created before %v", createdBefore)
+			}
+
+			return abandonedEntries, nil
+		},
+	)
+	mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), "signature-0", "imaginary").Return(nil)
+
+	sweeper := cache.NewExpirationSweeper(cache.ExpirationSweeperConfig{BatchSize: 2, PendingTimeout: time.Hour}, mockImagesRepo, mockImagesStorage)
+	removedEntries, err := sweeper.Sweep(context.Background())
+
+	if err != nil || removedEntries != 1 {
+		t.Errorf("Expected 1 removed entry, got %d, error: %v", removedEntries, err)
+	}
+
+	if mockImagesStorage.Exists("signature-0", "imaginary") {
+		t.Errorf("Expected image of abandoned entry to be removed from storage")
+	}
+}
@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+)
+
+// IntegrityPolicy selects reads of cached images which are verified using
+// their checksums, verified images are read whole before they are served,
+// so corrupted images are never served.
+type IntegrityPolicy struct {
+	// VerificationRatio is a fraction of verified reads, from 0 to 1.
+	VerificationRatio float64
+}
+
+// verifies skips images saved before checksums were introduced
+func (policy IntegrityPolicy) verifies(info cacherepositories.CachedImageModel) bool {
+	return info.Checksum != "" && policy.VerificationRatio > 0 && rand.Float64() < policy.VerificationRatio
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
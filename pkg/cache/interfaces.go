@@ -9,11 +9,24 @@ import (
 
 type CacheService interface {
 	Get(ctx context.Context, requestSignature, processorType string, w hub.DataStreamInput) error
+	// Contains reports whether the image is cached without reading it
+	Contains(ctx context.Context, requestSignature, processorType string) (bool, error)
 	Save(ctx context.Context, imageInfo cacherepositories.CachedImageModel, r hub.DataStreamOutput) error
 	InvalidateAllEntriesForURL(ctx context.Context, sourceImageURL string) ([]cacherepositories.CachedImageModel, error)
+	// InvalidateAllEntriesMatching invalidates entries of all source image urls matching the pattern,
+	// nothing is invalidated when more than maxEntries entries match, unless maxEntries is zero
+	InvalidateAllEntriesMatching(ctx context.Context, pattern cacherepositories.InvalidationPattern, maxEntries int) ([]cacherepositories.CachedImageModel, error)
 }
 
 type InvalidationService interface {
 	GetLastKnownInvalidation(ctx context.Context, projectName string) (cacherepositories.InvalidationModel, error)
 	Invalidate(ctx context.Context, projectName string, latestCommitHash string, urls []string) (cacherepositories.InvalidationModel, error)
+	// InvalidatePatterns invalidates entries matching the patterns, patterns other than exact urls
+	// may invalidate only a limited number of entries each, unless the invalidation is confirmed
+	InvalidatePatterns(ctx context.Context, projectName string, latestCommitHash string, patterns []cacherepositories.InvalidationPattern, confirmed bool) (cacherepositories.InvalidationModel, error)
+}
+
+type StorageKeysMigrationService interface {
+	// Migrate moves images saved under legacy storage keys to hashed keys
+	Migrate(ctx context.Context) (migratedImages int, err error)
 }
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ryanuber/go-glob"
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+)
+
+// sourceImageURLMatcher finds entries of the pattern by the literal prefix of all matching
+// source image urls, using the index of source image urls, and then checks every found url
+type sourceImageURLMatcher struct {
+	prefix  string
+	matches func(sourceImageURL string) bool
+}
+
+func compileInvalidationPattern(pattern cacherepositories.InvalidationPattern) (sourceImageURLMatcher, error) {
+	switch pattern.Type {
+	case cacherepositories.ExactURLPattern:
+		return sourceImageURLMatcher{pattern.Pattern, func(sourceImageURL string) bool {
+			return sourceImageURL == pattern.Pattern
+		}}, nil
+
+	case cacherepositories.PrefixPattern:
+		return sourceImageURLMatcher{pattern.Pattern, func(sourceImageURL string) bool {
+			return strings.HasPrefix(sourceImageURL, pattern.Pattern)
+		}}, nil
+
+	case cacherepositories.GlobPattern:
+		prefix := strings.SplitN(pattern.Pattern, glob.GLOB, 2)[0]
+		return sourceImageURLMatcher{prefix, func(sourceImageURL string) bool {
+			return glob.Glob(pattern.Pattern, sourceImageURL)
+		}}, nil
+
+	case cacherepositories.RegexPattern:
+		unanchored, err := regexp.Compile(pattern.Pattern)
+		if err != nil {
+			return sourceImageURLMatcher{}, fmt.Errorf("%w: %s", ErrInvalidPattern, err)
+		}
+
+		// literal prefix of the unanchored expression has to start every url matching the anchored one
+		prefix, _ := unanchored.LiteralPrefix()
+		anchored := regexp.MustCompile("^(?:" + pattern.Pattern + ")$")
+		return sourceImageURLMatcher{prefix, anchored.MatchString}, nil
+	}
+
+	return sourceImageURLMatcher{}, fmt.Errorf("%w: unknown pattern type %q", ErrInvalidPattern, pattern.Type)
+}
+
+var ErrInvalidPattern = errors.New("invalid invalidation pattern")
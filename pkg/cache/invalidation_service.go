@@ -7,15 +7,22 @@ import (
 	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
 )
 
+type InvalidationServiceConfig struct {
+	// MaxPatternMatches limits number of entries invalidated by a single pattern
+	// other than exact url, unless the invalidation is confirmed, zero disables the limit
+	MaxPatternMatches int
+}
+
 type InvalidationServiceImplementation struct {
+	config                  InvalidationServiceConfig
 	invalidationsRepository cacherepositories.InvalidationsRepository
 	cacheService            CacheService
 }
 
 var _ InvalidationService = (*InvalidationServiceImplementation)(nil)
 
-func NewInvalidationService(invalidationsRepository cacherepositories.InvalidationsRepository, cacheService CacheService) InvalidationService {
-	return &InvalidationServiceImplementation{invalidationsRepository, cacheService}
+func NewInvalidationService(config InvalidationServiceConfig, invalidationsRepository cacherepositories.InvalidationsRepository, cacheService CacheService) InvalidationService {
+	return &InvalidationServiceImplementation{config, invalidationsRepository, cacheService}
 }
 
 func (s *InvalidationServiceImplementation) GetLastKnownInvalidation(ctx context.Context, projectName string) (cacherepositories.InvalidationModel, error) {
@@ -27,6 +34,15 @@ func (s *InvalidationServiceImplementation) GetLastKnownInvalidation(ctx context
 }
 
 func (s *InvalidationServiceImplementation) Invalidate(ctx context.Context, projectName, latestCommitHash string, urls []string) (cacherepositories.InvalidationModel, error) {
+	patterns := make([]cacherepositories.InvalidationPattern, len(urls))
+	for i, url := range urls {
+		patterns[i] = cacherepositories.InvalidationPattern{Type: cacherepositories.ExactURLPattern, Pattern: url}
+	}
+
+	return s.InvalidatePatterns(ctx, projectName, latestCommitHash, patterns, false)
+}
+
+func (s *InvalidationServiceImplementation) InvalidatePatterns(ctx context.Context, projectName, latestCommitHash string, patterns []cacherepositories.InvalidationPattern, confirmed bool) (cacherepositories.InvalidationModel, error) {
 	if projectName == "" {
 		return cacherepositories.InvalidationModel{}, cacherepositories.ErrProjectNameNotAllowed
 	}
@@ -35,19 +51,31 @@ func (s *InvalidationServiceImplementation) Invalidate(ctx context.Context, proj
 		return cacherepositories.InvalidationModel{}, cacherepositories.ErrCommitHashNotAllowed
 	}
 
+	// invalid patterns are rejected before anything is invalidated
+	requestedInvalidations := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		if _, err := compileInvalidationPattern(pattern); err != nil {
+			return cacherepositories.InvalidationModel{}, err
+		}
+
+		requestedInvalidations[i] = pattern.String()
+	}
+
 	invalidationInfo := cacherepositories.InvalidationModel{
 		ProjectName:            projectName,
 		CommitHash:             latestCommitHash,
-		RequestedInvalidations: urls,
+		RequestedInvalidations: requestedInvalidations,
 		DoneInvalidations:      []string{},
 		InvalidatedImages:      []cacherepositories.CachedImageModel{},
+		PatternMatches:         []cacherepositories.InvalidationPatternMatch{},
 	}
 
 	var invalidationError error
 
-	for _, url := range urls {
-		invalidatedEntries, err := s.cacheService.InvalidateAllEntriesForURL(ctx, url)
-		invalidationInfo.InvalidatedImages = append(invalidationInfo.InvalidatedImages, invalidatedEntries...)
+	for _, pattern := range patterns {
+		invalidatedEntries, err := s.invalidatePattern(ctx, pattern, confirmed)
+		recordInvalidatedImages(&invalidationInfo, invalidatedEntries)
+		invalidationInfo.PatternMatches = append(invalidationInfo.PatternMatches, newInvalidationPatternMatch(pattern, invalidatedEntries))
 
 		if err != nil {
 			invalidationError = err
@@ -56,7 +84,7 @@ func (s *InvalidationServiceImplementation) Invalidate(ctx context.Context, proj
 			break
 		}
 
-		invalidationInfo.DoneInvalidations = append(invalidationInfo.DoneInvalidations, url)
+		invalidationInfo.DoneInvalidations = append(invalidationInfo.DoneInvalidations, pattern.String())
 	}
 
 	invalidationInfo.InvalidationDate = time.Now()
@@ -66,3 +94,54 @@ func (s *InvalidationServiceImplementation) Invalidate(ctx context.Context, proj
 
 	return invalidationInfo, invalidationError
 }
+
+// exact urls have few variants, so they are not limited
+func (s *InvalidationServiceImplementation) invalidatePattern(ctx context.Context, pattern cacherepositories.InvalidationPattern, confirmed bool) ([]cacherepositories.CachedImageModel, error) {
+	if pattern.Type == cacherepositories.ExactURLPattern {
+		return s.cacheService.InvalidateAllEntriesForURL(ctx, pattern.Pattern)
+	}
+
+	maxEntries := s.config.MaxPatternMatches
+	if confirmed {
+		maxEntries = 0
+	}
+
+	return s.cacheService.InvalidateAllEntriesMatching(ctx, pattern, maxEntries)
+}
+
+// invalidations are saved as single documents, so only the first invalidated
+// images are recorded, which keeps confirmed invalidations of many images small
+const (
+	maxRecordedInvalidatedImages = 1000
+	maxRecordedPatternMatches    = 100
+)
+
+func recordInvalidatedImages(invalidationInfo *cacherepositories.InvalidationModel, invalidatedEntries []cacherepositories.CachedImageModel) {
+	invalidationInfo.InvalidatedImagesCount += len(invalidatedEntries)
+
+	if free := maxRecordedInvalidatedImages - len(invalidationInfo.InvalidatedImages); len(invalidatedEntries) > free {
+		invalidatedEntries = invalidatedEntries[:free]
+	}
+
+	invalidationInfo.InvalidatedImages = append(invalidationInfo.InvalidatedImages, invalidatedEntries...)
+}
+
+func newInvalidationPatternMatch(pattern cacherepositories.InvalidationPattern, invalidatedEntries []cacherepositories.CachedImageModel) cacherepositories.InvalidationPatternMatch {
+	recordedEntries := invalidatedEntries
+	if len(recordedEntries) > maxRecordedPatternMatches {
+		recordedEntries = recordedEntries[:maxRecordedPatternMatches]
+	}
+
+	match := cacherepositories.InvalidationPatternMatch{
+		Type:               pattern.Type,
+		Pattern:            pattern.Pattern,
+		MatchedImages:      make([]string, len(recordedEntries)),
+		MatchedImagesCount: len(invalidatedEntries),
+	}
+
+	for i, entry := range recordedEntries {
+		match.MatchedImages[i] = cacherepositories.StorageKey(entry.RequestSignature, entry.ProcessorType)
+	}
+
+	return match
+}
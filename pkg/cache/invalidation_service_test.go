@@ -41,6 +41,7 @@ func (m *invalidationEqMatcher) Matches(x interface{}) bool {
 		reflect.DeepEqual(m.expected.RequestedInvalidations, invalidation.RequestedInvalidations) &&
 		reflect.DeepEqual(m.expected.DoneInvalidations, invalidation.DoneInvalidations) &&
 		reflect.DeepEqual(m.expected.InvalidatedImages, invalidation.InvalidatedImages) &&
+		m.expected.InvalidatedImagesCount == invalidation.InvalidatedImagesCount &&
 		getSecureString(m.expected.InvalidationError) == getSecureString(invalidation.InvalidationError)
 }
 
@@ -69,6 +70,10 @@ func findDifferenceBetweenInvalidations(a cacherepositories.InvalidationModel, b
 		return fmt.Sprintf("InvalidatedImages: %v != %v", a.InvalidatedImages, b.InvalidatedImages)
 	}
 
+	if a.InvalidatedImagesCount != b.InvalidatedImagesCount {
+		return fmt.Sprintf("InvalidatedImagesCount: %d != %d", a.InvalidatedImagesCount, b.InvalidatedImagesCount)
+	}
+
 	if a.InvalidationError != b.InvalidationError {
 		return fmt.Sprintf("InvalidationError: %v != %v", a.InvalidationError, b.InvalidationError)
 	}
@@ -87,7 +92,7 @@ func TestInvalidationService_ShouldCorrectlyGetLastKnownInvalidationForGivenProj
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	invalidationService := cache.NewInvalidationService(mockInvalidationsRepository, mockCacheService)
+	invalidationService := cache.NewInvalidationService(cache.InvalidationServiceConfig{}, mockInvalidationsRepository, mockCacheService)
 	lastInvalidation, _ := invalidationService.GetLastKnownInvalidation(ctx, "project")
 
 	if !reflect.DeepEqual(lastInvalidation, invalidation) {
@@ -105,7 +110,7 @@ func TestInvalidationService_GetLastKnownInvalidationForGivenProjectShouldReturn
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	invalidationService := cache.NewInvalidationService(mockInvalidationsRepository, mockCacheService)
+	invalidationService := cache.NewInvalidationService(cache.InvalidationServiceConfig{}, mockInvalidationsRepository, mockCacheService)
 	_, err := invalidationService.GetLastKnownInvalidation(ctx, "project")
 
 	if err != cacherepositories.ErrProjectNameNotAllowed {
@@ -121,7 +126,7 @@ func TestInvalidationService_GetLastKnownInvalidationShouldReturnErrProjectNameN
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	invalidationService := cache.NewInvalidationService(mockInvalidationsRepository, mockCacheService)
+	invalidationService := cache.NewInvalidationService(cache.InvalidationServiceConfig{}, mockInvalidationsRepository, mockCacheService)
 	_, err := invalidationService.GetLastKnownInvalidation(ctx, "")
 
 	if err != cacherepositories.ErrProjectNameNotAllowed {
@@ -146,11 +151,12 @@ func TestInvalidationService_ShouldCorrectlyInvalidateImagesAndSaveResult(t *tes
 		RequestedInvalidations: []string{"image"},
 		DoneInvalidations:      []string{"image"},
 		InvalidatedImages:      invalidatedEntries,
+		InvalidatedImagesCount: len(invalidatedEntries),
 		InvalidationError:      nil,
 	}
 	mockInvalidationsRepository.EXPECT().CreateInvalidation(gomock.Any(), invalidationEq(invalidation)).Return(nil)
 
-	invalidationService := cache.NewInvalidationService(mockInvalidationsRepository, mockCacheService)
+	invalidationService := cache.NewInvalidationService(cache.InvalidationServiceConfig{}, mockInvalidationsRepository, mockCacheService)
 	result, err := invalidationService.Invalidate(context.Background(), "project", "hash", []string{"image"})
 
 	if err != nil {
@@ -185,11 +191,12 @@ func TestInvalidationService_ShouldCorrectlyInvalidateMultipleImagesAndSaveResul
 		RequestedInvalidations: []string{"image1", "image2"},
 		DoneInvalidations:      []string{"image1", "image2"},
 		InvalidatedImages:      append(invalidatedEntriesForImage1, invalidatedEntriesForImage2...),
+		InvalidatedImagesCount: len(invalidatedEntriesForImage1) + len(invalidatedEntriesForImage2),
 		InvalidationError:      nil,
 	}
 	mockInvalidationsRepository.EXPECT().CreateInvalidation(gomock.Any(), invalidationEq(invalidation)).Return(nil)
 
-	invalidationService := cache.NewInvalidationService(mockInvalidationsRepository, mockCacheService)
+	invalidationService := cache.NewInvalidationService(cache.InvalidationServiceConfig{}, mockInvalidationsRepository, mockCacheService)
 	invalidationService.Invalidate(context.Background(), "project", "hash", []string{"image1", "image2"})
 }
 
@@ -218,11 +225,12 @@ func TestInvalidationService_ShouldProvideCorrectInformationAboutDoneInvalidatio
 		RequestedInvalidations: []string{"image1", "image2"},
 		DoneInvalidations:      []string{"image1"},
 		InvalidatedImages:      append(invalidatedEntriesForImage1, invalidatedEntriesForImage2...),
+		InvalidatedImagesCount: len(invalidatedEntriesForImage1) + len(invalidatedEntriesForImage2),
 		InvalidationError:      &invalidationErrorText,
 	}
 	mockInvalidationsRepository.EXPECT().CreateInvalidation(gomock.Any(), invalidationEq(invalidation)).Return(nil)
 
-	invalidationService := cache.NewInvalidationService(mockInvalidationsRepository, mockCacheService)
+	invalidationService := cache.NewInvalidationService(cache.InvalidationServiceConfig{}, mockInvalidationsRepository, mockCacheService)
 	invalidationService.Invalidate(context.Background(), "project", "hash", []string{"image1", "image2"})
 }
 
@@ -246,11 +254,12 @@ func TestInvalidationService_ShouldSaveInvalidationResultWithErrorReturnedByCach
 		RequestedInvalidations: []string{"image"},
 		DoneInvalidations:      []string{},
 		InvalidatedImages:      invalidatedEntries,
+		InvalidatedImagesCount: len(invalidatedEntries),
 		InvalidationError:      &invalidationErrorText,
 	}
 	mockInvalidationsRepository.EXPECT().CreateInvalidation(gomock.Any(), invalidationEq(invalidation)).Return(nil)
 
-	invalidationService := cache.NewInvalidationService(mockInvalidationsRepository, mockCacheService)
+	invalidationService := cache.NewInvalidationService(cache.InvalidationServiceConfig{}, mockInvalidationsRepository, mockCacheService)
 	invalidationService.Invalidate(context.Background(), "project", "hash", []string{"image"})
 }
 
@@ -273,11 +282,12 @@ func TestInvalidationService_ShouldReturnErrorReturnedByCacheService(t *testing.
 		RequestedInvalidations: []string{"image"},
 		DoneInvalidations:      []string{},
 		InvalidatedImages:      invalidatedEntries,
+		InvalidatedImagesCount: len(invalidatedEntries),
 		InvalidationError:      &invalidationErrorText,
 	}
 	mockInvalidationsRepository.EXPECT().CreateInvalidation(gomock.Any(), invalidationEq(invalidation)).Return(nil)
 
-	invalidationService := cache.NewInvalidationService(mockInvalidationsRepository, mockCacheService)
+	invalidationService := cache.NewInvalidationService(cache.InvalidationServiceConfig{}, mockInvalidationsRepository, mockCacheService)
 	_, err := invalidationService.Invalidate(context.Background(), "project", "hash", []string{"image"})
 
 	if err != invalidationError {
@@ -304,12 +314,13 @@ func TestInvalidationService_ShouldReturnErrorReturnedByInvalidationsRepository(
 		RequestedInvalidations: []string{"image"},
 		DoneInvalidations:      []string{},
 		InvalidatedImages:      invalidatedEntries,
+		InvalidatedImagesCount: len(invalidatedEntries),
 		InvalidationError:      &invalidationErrorText,
 	}
 	creationError := errors.New("some error")
 	mockInvalidationsRepository.EXPECT().CreateInvalidation(gomock.Any(), invalidationEq(invalidation)).Return(creationError)
 
-	invalidationService := cache.NewInvalidationService(mockInvalidationsRepository, mockCacheService)
+	invalidationService := cache.NewInvalidationService(cache.InvalidationServiceConfig{}, mockInvalidationsRepository, mockCacheService)
 	_, err := invalidationService.Invalidate(context.Background(), "project", "hash", []string{"image"})
 
 	if err != creationError {
@@ -322,7 +333,7 @@ func TestInvalidationService_InvalidateShouldReturnErrProjectNameNotAllowedIfPro
 	mockInvalidationsRepository := mock_cacherepositories.NewMockInvalidationsRepository(mockCtrl)
 	mockCacheService := mock_cache.NewMockCacheService(mockCtrl)
 
-	invalidationService := cache.NewInvalidationService(mockInvalidationsRepository, mockCacheService)
+	invalidationService := cache.NewInvalidationService(cache.InvalidationServiceConfig{}, mockInvalidationsRepository, mockCacheService)
 	_, err := invalidationService.Invalidate(context.Background(), "", "hash", []string{"image"})
 
 	if err != cacherepositories.ErrProjectNameNotAllowed {
@@ -335,10 +346,120 @@ func TestInvalidationService_InvalidateShouldReturnErrCommitHashNotAllowedIfProv
 	mockInvalidationsRepository := mock_cacherepositories.NewMockInvalidationsRepository(mockCtrl)
 	mockCacheService := mock_cache.NewMockCacheService(mockCtrl)
 
-	invalidationService := cache.NewInvalidationService(mockInvalidationsRepository, mockCacheService)
+	invalidationService := cache.NewInvalidationService(cache.InvalidationServiceConfig{}, mockInvalidationsRepository, mockCacheService)
 	_, err := invalidationService.Invalidate(context.Background(), "project", "", []string{"image"})
 
 	if err != cacherepositories.ErrCommitHashNotAllowed {
 		t.Errorf("Expected to get ErrCommitHashNotAllowed error, but got: %v", err)
 	}
 }
+
+func TestInvalidationService_ShouldRecordEntriesMatchedByPatterns(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockInvalidationsRepository := mock_cacherepositories.NewMockInvalidationsRepository(mockCtrl)
+	mockCacheService := mock_cache.NewMockCacheService(mockCtrl)
+
+	pattern := cacherepositories.InvalidationPattern{Type: cacherepositories.PrefixPattern, Pattern: "https://example.com/products/"}
+	invalidatedEntries := []cacherepositories.CachedImageModel{
+		{RequestSignature: "signature1", ProcessorType: "imaginary"},
+		{RequestSignature: "signature2", ProcessorType: "imaginary"},
+	}
+	mockCacheService.EXPECT().InvalidateAllEntriesMatching(gomock.Any(), pattern, 100).Return(invalidatedEntries, nil)
+	mockCacheService.EXPECT().InvalidateAllEntriesForURL(gomock.Any(), "image").Return(nil, nil)
+
+	invalidation := cacherepositories.InvalidationModel{
+		ProjectName:            "project",
+		CommitHash:             "hash",
+		RequestedInvalidations: []string{"prefix:https://example.com/products/", "image"},
+		DoneInvalidations:      []string{"prefix:https://example.com/products/", "image"},
+		InvalidatedImages:      invalidatedEntries,
+		InvalidatedImagesCount: len(invalidatedEntries),
+	}
+	mockInvalidationsRepository.EXPECT().CreateInvalidation(gomock.Any(), invalidationEq(invalidation)).Return(nil)
+
+	invalidationService := cache.NewInvalidationService(cache.InvalidationServiceConfig{MaxPatternMatches: 100}, mockInvalidationsRepository, mockCacheService)
+	patterns := []cacherepositories.InvalidationPattern{pattern, {Type: cacherepositories.ExactURLPattern, Pattern: "image"}}
+	result, err := invalidationService.InvalidatePatterns(context.Background(), "project", "hash", patterns, false)
+
+	if err != nil {
+		t.Errorf("Expected no invalidation error, but got: %v", err)
+	}
+
+	expectedMatches := []cacherepositories.InvalidationPatternMatch{
+		{
+			Type:    cacherepositories.PrefixPattern,
+			Pattern: "https://example.com/products/",
+			MatchedImages: []string{
+				cacherepositories.StorageKey("signature1", "imaginary"),
+				cacherepositories.StorageKey("signature2", "imaginary"),
+			},
+			MatchedImagesCount: 2,
+		},
+		{Type: cacherepositories.ExactURLPattern, Pattern: "image", MatchedImages: []string{}},
+	}
+
+	if !reflect.DeepEqual(result.PatternMatches, expectedMatches) {
+		t.Errorf("Expected pattern matches %v, got: %v", expectedMatches, result.PatternMatches)
+	}
+}
+
+func TestInvalidationService_ShouldNotLimitConfirmedPatternInvalidation(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockInvalidationsRepository := mock_cacherepositories.NewMockInvalidationsRepository(mockCtrl)
+	mockCacheService := mock_cache.NewMockCacheService(mockCtrl)
+
+	pattern := cacherepositories.InvalidationPattern{Type: cacherepositories.GlobPattern, Pattern: "https://*.example.com/*"}
+	mockCacheService.EXPECT().InvalidateAllEntriesMatching(gomock.Any(), pattern, 0).Return(nil, nil)
+	mockInvalidationsRepository.EXPECT().CreateInvalidation(gomock.Any(), gomock.Any()).Return(nil)
+
+	invalidationService := cache.NewInvalidationService(cache.InvalidationServiceConfig{MaxPatternMatches: 100}, mockInvalidationsRepository, mockCacheService)
+	if _, err := invalidationService.InvalidatePatterns(context.Background(), "project", "hash", []cacherepositories.InvalidationPattern{pattern}, true); err != nil {
+		t.Errorf("Expected no invalidation error, but got: %v", err)
+	}
+}
+
+func TestInvalidationService_ShouldRecordOnlyFirstImagesOfLargeInvalidations(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockInvalidationsRepository := mock_cacherepositories.NewMockInvalidationsRepository(mockCtrl)
+	mockCacheService := mock_cache.NewMockCacheService(mockCtrl)
+
+	invalidatedEntries := make([]cacherepositories.CachedImageModel, 1500)
+	for i := range invalidatedEntries {
+		invalidatedEntries[i] = cacherepositories.CachedImageModel{RequestSignature: fmt.Sprintf("signature%d", i), ProcessorType: "imaginary"}
+	}
+
+	pattern := cacherepositories.InvalidationPattern{Type: cacherepositories.PrefixPattern, Pattern: "https://example.com/"}
+	mockCacheService.EXPECT().InvalidateAllEntriesMatching(gomock.Any(), pattern, 0).Return(invalidatedEntries, nil)
+	mockInvalidationsRepository.EXPECT().CreateInvalidation(gomock.Any(), gomock.Any()).Return(nil)
+
+	invalidationService := cache.NewInvalidationService(cache.InvalidationServiceConfig{MaxPatternMatches: 100}, mockInvalidationsRepository, mockCacheService)
+	result, err := invalidationService.InvalidatePatterns(context.Background(), "project", "hash", []cacherepositories.InvalidationPattern{pattern}, true)
+	if err != nil {
+		t.Fatalf("Expected no invalidation error, but got: %v", err)
+	}
+
+	if len(result.InvalidatedImages) != 1000 || result.InvalidatedImagesCount != 1500 {
+		t.Errorf("Expected 1000 of 1500 invalidated images to be recorded, got %d of %d", len(result.InvalidatedImages), result.InvalidatedImagesCount)
+	}
+
+	match := result.PatternMatches[0]
+	if len(match.MatchedImages) != 100 || match.MatchedImagesCount != 1500 || match.MatchedImages[0] != cacherepositories.StorageKey("signature0", "imaginary") {
+		t.Errorf("Expected first 100 of 1500 matched images to be recorded, got %d of %d", len(match.MatchedImages), match.MatchedImagesCount)
+	}
+}
+
+func TestInvalidationService_ShouldRejectInvalidPatternsBeforeInvalidatingAnything(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockInvalidationsRepository := mock_cacherepositories.NewMockInvalidationsRepository(mockCtrl)
+	mockCacheService := mock_cache.NewMockCacheService(mockCtrl)
+
+	patterns := []cacherepositories.InvalidationPattern{
+		{Type: cacherepositories.ExactURLPattern, Pattern: "image"},
+		{Type: cacherepositories.RegexPattern, Pattern: "https://example.com/(.jpg"},
+	}
+
+	invalidationService := cache.NewInvalidationService(cache.InvalidationServiceConfig{}, mockInvalidationsRepository, mockCacheService)
+	if _, err := invalidationService.InvalidatePatterns(context.Background(), "project", "hash", patterns, false); !errors.Is(err, cache.ErrInvalidPattern) {
+		t.Errorf("Expected ErrInvalidPattern, got: %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package cache
+
+import (
+	"container/list"
+	"io"
+	"sync"
+	"time"
+
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	"github.com/thebartekbanach/imcaxy/pkg/hub"
+	"github.com/thebartekbanach/imcaxy/pkg/metrics"
+)
+
+type MemoryTierConfig struct {
+	// MaxSize is total size of images kept in memory, zero disables the tier.
+	MaxSize int64
+
+	// MaxEntrySize is size of the biggest image admitted to the tier,
+	// so few big images do not push out many small hot ones.
+	MaxEntrySize int64
+}
+
+// MemoryTier is a byte-bounded LRU of hot images kept in front of the images storage,
+// images are kept together with the version of their entry, so an image of the removed
+// entry is never served for the entry saved again under the same key
+type MemoryTier struct {
+	config MemoryTierConfig
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	size    int64
+}
+
+type memoryTierEntry struct {
+	key     string
+	version string
+	data    []byte
+}
+
+func NewMemoryTier(config MemoryTierConfig) *MemoryTier {
+	return &MemoryTier{
+		config:  config,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Get returns the image only when it was added with the given version,
+// images of other versions are removed
+func (tier *MemoryTier) Get(requestSignature, processorType, version string) ([]byte, bool) {
+	if !tier.enabled() {
+		return nil, false
+	}
+
+	tier.lock.Lock()
+	defer tier.lock.Unlock()
+
+	key := tier.makeKey(requestSignature, processorType)
+	element, exists := tier.entries[key]
+	if exists && element.Value.(*memoryTierEntry).version != version {
+		tier.remove(key)
+		tier.reportUsage()
+		exists = false
+	}
+
+	if !exists {
+		metrics.Add("cache_memory_misses", 1)
+		return nil, false
+	}
+
+	tier.order.MoveToFront(element)
+	metrics.Add("cache_memory_hits", 1)
+	return element.Value.(*memoryTierEntry).data, true
+}
+
+func (tier *MemoryTier) Add(requestSignature, processorType, version string, data []byte) {
+	if !tier.admits(int64(len(data))) {
+		return
+	}
+
+	tier.lock.Lock()
+	defer tier.lock.Unlock()
+
+	key := tier.makeKey(requestSignature, processorType)
+	tier.remove(key)
+
+	tier.entries[key] = tier.order.PushFront(&memoryTierEntry{key, version, data})
+	tier.size += int64(len(data))
+
+	for tier.size > tier.config.MaxSize {
+		tier.remove(tier.order.Back().Value.(*memoryTierEntry).key)
+	}
+
+	tier.reportUsage()
+}
+
+func (tier *MemoryTier) Remove(requestSignature, processorType string) {
+	if !tier.enabled() {
+		return
+	}
+
+	tier.lock.Lock()
+	defer tier.lock.Unlock()
+
+	tier.remove(tier.makeKey(requestSignature, processorType))
+	tier.reportUsage()
+}
+
+func (tier *MemoryTier) remove(key string) {
+	element, exists := tier.entries[key]
+	if !exists {
+		return
+	}
+
+	tier.order.Remove(element)
+	delete(tier.entries, key)
+	tier.size -= int64(len(element.Value.(*memoryTierEntry).data))
+}
+
+func (tier *MemoryTier) reportUsage() {
+	metrics.Set("cache_memory_size_bytes", tier.size)
+	metrics.Set("cache_memory_entries", int64(len(tier.entries)))
+}
+
+func (tier *MemoryTier) enabled() bool {
+	return tier != nil && tier.config.MaxSize > 0
+}
+
+func (tier *MemoryTier) admits(size int64) bool {
+	if !tier.enabled() || size > tier.config.MaxSize {
+		return false
+	}
+
+	return tier.config.MaxEntrySize <= 0 || size <= tier.config.MaxEntrySize
+}
+
+func (tier *MemoryTier) makeKey(requestSignature, processorType string) string {
+	return processorType + "::" + requestSignature
+}
+
+// memoryTierVersion identifies the image of the entry by its checksum,
+// entries saved before checksums were introduced by their creation time
+func memoryTierVersion(info cacherepositories.CachedImageModel) string {
+	if info.Checksum != "" {
+		return info.Checksum
+	}
+
+	return info.CreatedAt.UTC().Format(time.RFC3339Nano)
+}
+
+// memoryTierInput copies the image written to the stream and adds
+// it to the tier once the whole image is written without errors
+type memoryTierInput struct {
+	hub.DataStreamInput
+
+	tier             *MemoryTier
+	requestSignature string
+	processorType    string
+	version          string
+
+	data     []byte
+	rejected bool
+}
+
+var _ hub.DataStreamInput = (*memoryTierInput)(nil)
+
+func (tier *MemoryTier) wrapInput(requestSignature, processorType, version string, input hub.DataStreamInput) hub.DataStreamInput {
+	if !tier.enabled() {
+		return input
+	}
+
+	return &memoryTierInput{
+		DataStreamInput:  input,
+		tier:             tier,
+		requestSignature: requestSignature,
+		processorType:    processorType,
+		version:          version,
+	}
+}
+
+func (s *memoryTierInput) Write(p []byte) (n int, err error) {
+	n, err = s.DataStreamInput.Write(p)
+	s.copy(p[:n])
+	return
+}
+
+func (s *memoryTierInput) ReadFrom(r io.Reader) (n int64, err error) {
+	return s.DataStreamInput.ReadFrom(io.TeeReader(r, writerFunc(s.copy)))
+}
+
+func (s *memoryTierInput) Close(errorToForward error) error {
+	if (errorToForward == nil || errorToForward == io.EOF) && !s.rejected {
+		s.tier.Add(s.requestSignature, s.processorType, s.version, s.data)
+	}
+
+	return s.DataStreamInput.Close(errorToForward)
+}
+
+func (s *memoryTierInput) copy(p []byte) (int, error) {
+	if s.rejected {
+		return len(p), nil
+	}
+
+	if !s.tier.admits(int64(len(s.data) + len(p))) {
+		s.rejected = true
+		s.data = nil
+		return len(p), nil
+	}
+
+	s.data = append(s.data, p...)
+	return len(p), nil
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
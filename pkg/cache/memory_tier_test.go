@@ -0,0 +1,189 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/thebartekbanach/imcaxy/pkg/cache"
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	mock_cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/mocks"
+	"github.com/thebartekbanach/imcaxy/pkg/hub"
+	mock_hub "github.com/thebartekbanach/imcaxy/pkg/hub/mocks"
+)
+
+func TestMemoryTier_ShouldEvictLeastRecentlyUsedEntriesAboveMaxSize(t *testing.T) {
+	tier := cache.NewMemoryTier(cache.MemoryTierConfig{MaxSize: 6})
+
+	tier.Add("first", "imaginary", "v1", []byte("abc"))
+	tier.Add("second", "imaginary", "v1", []byte("def"))
+	tier.Get("first", "imaginary", "v1")
+	tier.Add("third", "imaginary", "v1", []byte("ghi"))
+
+	if _, found := tier.Get("second", "imaginary", "v1"); found {
+		t.Errorf("Expected least recently used entry to be evicted")
+	}
+
+	for _, signature := range []string{"first", "third"} {
+		if _, found := tier.Get(signature, "imaginary", "v1"); !found {
+			t.Errorf("Expected %s entry to be kept", signature)
+		}
+	}
+}
+
+func TestMemoryTier_ShouldNotAdmitEntriesBiggerThanMaxEntrySize(t *testing.T) {
+	tier := cache.NewMemoryTier(cache.MemoryTierConfig{MaxSize: 100, MaxEntrySize: 3})
+
+	tier.Add("small", "imaginary", "v1", []byte("abc"))
+	tier.Add("big", "imaginary", "v1", []byte("abcd"))
+
+	if _, found := tier.Get("small", "imaginary", "v1"); !found {
+		t.Errorf("Expected small entry to be admitted")
+	}
+
+	if _, found := tier.Get("big", "imaginary", "v1"); found {
+		t.Errorf("Expected big entry not to be admitted")
+	}
+}
+
+func TestMemoryTier_DisabledTierShouldNotKeepEntries(t *testing.T) {
+	tier := cache.NewMemoryTier(cache.MemoryTierConfig{})
+
+	tier.Add("first", "imaginary", "v1", []byte("abc"))
+	if _, found := tier.Get("first", "imaginary", "v1"); found {
+		t.Errorf("Expected disabled tier not to keep entries")
+	}
+}
+
+func TestMemoryTier_CacheServiceShouldServeImagesReadFromStorageFromMemory(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+	tier := cache.NewMemoryTier(cache.MemoryTierConfig{MaxSize: 100})
+	testData := []byte("test data")
+
+	mockImagesStorage.InstantSave("test-signature", "imaginary", testData)
+	mockImagesRepo.EXPECT().GetCachedImageInfo(gomock.Any(), "test-signature", "imaginary").Return(cacherepositories.CachedImageModel{}, nil).Times(2)
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), tier, cache.IntegrityPolicy{})
+	firstInput := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+	if err := cacheService.Get(context.Background(), "test-signature", "imaginary", &firstInput); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	firstInput.Wait()
+
+	// image is removed only from the storage, so it has to be served from memory
+	mockImagesStorage.Delete(context.Background(), "test-signature", "imaginary")
+
+	secondInput := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+	if err := cacheService.Get(context.Background(), "test-signature", "imaginary", &secondInput); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	secondInput.Wait()
+
+	if !bytes.Equal(secondInput.GetWholeResponse(), testData) {
+		t.Errorf("Expected %v, got %v", testData, secondInput.GetWholeResponse())
+	}
+}
+
+func TestMemoryTier_ShouldNotReturnImageOfOtherVersion(t *testing.T) {
+	tier := cache.NewMemoryTier(cache.MemoryTierConfig{MaxSize: 100})
+
+	tier.Add("first", "imaginary", "v1", []byte("abc"))
+	if _, found := tier.Get("first", "imaginary", "v2"); found {
+		t.Errorf("Expected image of other version not to be returned")
+	}
+
+	if _, found := tier.Get("first", "imaginary", "v1"); found {
+		t.Errorf("Expected image of other version to be removed")
+	}
+}
+
+func TestMemoryTier_CacheServiceShouldNotServeImageOfReplacedEntryFromMemory(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+	tier := cache.NewMemoryTier(cache.MemoryTierConfig{MaxSize: 100})
+	oldData, newData := []byte("old data"), []byte("new data")
+
+	// entry was removed and saved again by other instance, which did not purge this memory tier
+	tier.Add("test-signature", "imaginary", fmt.Sprintf("%x", sha256.Sum256(oldData)), oldData)
+	mockImagesStorage.InstantSave("test-signature", "imaginary", newData)
+	info := cacherepositories.CachedImageModel{RequestSignature: "test-signature", ProcessorType: "imaginary", Checksum: fmt.Sprintf("%x", sha256.Sum256(newData))}
+	mockImagesRepo.EXPECT().GetCachedImageInfo(gomock.Any(), "test-signature", "imaginary").Return(info, nil)
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), tier, cache.IntegrityPolicy{})
+	input := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+	if err := cacheService.Get(context.Background(), "test-signature", "imaginary", &input); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	input.Wait()
+
+	if !bytes.Equal(input.GetWholeResponse(), newData) {
+		t.Errorf("Expected %s, got %s", newData, input.GetWholeResponse())
+	}
+}
+
+// closingImagesStorage closes saved stream, the same as the Minio storage
+type closingImagesStorage struct {
+	cacherepositories.CachedImagesStorage
+}
+
+func (s closingImagesStorage) Save(ctx context.Context, requestSignature, processorType, mimeType string, size int64, checksum string, reader hub.DataStreamOutput) error {
+	defer reader.Close()
+	return s.CachedImagesStorage.Save(ctx, requestSignature, processorType, mimeType, size, checksum, reader)
+}
+
+func TestMemoryTier_CacheServiceShouldAddSavedImagesToMemory(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+	tier := cache.NewMemoryTier(cache.MemoryTierConfig{MaxSize: 100})
+	testData := []byte("test data")
+	mockStreamOutput := mock_hub.NewMockTestingDataStreamOutputUsingSingleChunkOfData(t, testData, nil, nil)
+
+	imageInfo := cacherepositories.CachedImageModel{
+		RequestSignature: "test-signature",
+		ProcessorType:    "imaginary",
+		ImageSize:        int64(len(testData)),
+	}
+	mockImagesRepo.EXPECT().CreateCachedImageInfo(gomock.Any(), pendingImageInfo(imageInfo)).Return(nil)
+	mockImagesRepo.EXPECT().MarkCachedImageReady(gomock.Any(), "test-signature", "imaginary", int64(9), gomock.Any()).Return(nil)
+
+	imagesStorage := closingImagesStorage{mockImagesStorage}
+	cacheService := cache.NewCacheService(mockImagesRepo, imagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), tier, cache.IntegrityPolicy{})
+	if err := cacheService.Save(context.Background(), imageInfo, &mockStreamOutput); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	data, found := tier.Get("test-signature", "imaginary", fmt.Sprintf("%x", sha256.Sum256(testData)))
+	if !found || !bytes.Equal(data, testData) {
+		t.Errorf("Expected saved image to be added to memory, got %v", data)
+	}
+}
+
+func TestMemoryTier_InvalidationShouldPurgeMemory(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+	tier := cache.NewMemoryTier(cache.MemoryTierConfig{MaxSize: 100})
+
+	entry := cacherepositories.CachedImageModel{RequestSignature: "test-signature", ProcessorType: "imaginary"}
+	tier.Add(entry.RequestSignature, entry.ProcessorType, "v1", []byte("test data"))
+	mockImagesStorage.InstantSave(entry.RequestSignature, entry.ProcessorType, []byte("test data"))
+
+	mockImagesRepo.EXPECT().GetCachedImageInfosOfSource(gomock.Any(), "http://google.com/image.jpg").Return([]cacherepositories.CachedImageModel{entry}, nil)
+	mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), entry.RequestSignature, entry.ProcessorType).Return(nil)
+
+	cacheService := cache.NewCacheService(mockImagesRepo, mockImagesStorage, cache.ExpirationPolicy{}, cache.NewAccessRecorder(cache.AccessRecorderConfig{}, mockImagesRepo), tier, cache.IntegrityPolicy{})
+	if _, err := cacheService.InvalidateAllEntriesForURL(context.Background(), "http://google.com/image.jpg"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if _, found := tier.Get(entry.RequestSignature, entry.ProcessorType, "v1"); found {
+		t.Errorf("Expected invalidated entry to be removed from memory")
+	}
+}
@@ -36,6 +36,21 @@ func (m *MockCacheService) EXPECT() *MockCacheServiceMockRecorder {
 	return m.recorder
 }
 
+// Contains mocks base method.
+func (m *MockCacheService) Contains(arg0 context.Context, arg1, arg2 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Contains", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Contains indicates an expected call of Contains.
+func (mr *MockCacheServiceMockRecorder) Contains(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Contains", reflect.TypeOf((*MockCacheService)(nil).Contains), arg0, arg1, arg2)
+}
+
 // Get mocks base method.
 func (m *MockCacheService) Get(arg0 context.Context, arg1, arg2 string, arg3 hub.DataStreamInput) error {
 	m.ctrl.T.Helper()
@@ -65,6 +80,21 @@ func (mr *MockCacheServiceMockRecorder) InvalidateAllEntriesForURL(arg0, arg1 in
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InvalidateAllEntriesForURL", reflect.TypeOf((*MockCacheService)(nil).InvalidateAllEntriesForURL), arg0, arg1)
 }
 
+// InvalidateAllEntriesMatching mocks base method.
+func (m *MockCacheService) InvalidateAllEntriesMatching(arg0 context.Context, arg1 cacherepositories.InvalidationPattern, arg2 int) ([]cacherepositories.CachedImageModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InvalidateAllEntriesMatching", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]cacherepositories.CachedImageModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InvalidateAllEntriesMatching indicates an expected call of InvalidateAllEntriesMatching.
+func (mr *MockCacheServiceMockRecorder) InvalidateAllEntriesMatching(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InvalidateAllEntriesMatching", reflect.TypeOf((*MockCacheService)(nil).InvalidateAllEntriesMatching), arg0, arg1, arg2)
+}
+
 // Save mocks base method.
 func (m *MockCacheService) Save(arg0 context.Context, arg1 cacherepositories.CachedImageModel, arg2 hub.DataStreamOutput) error {
 	m.ctrl.T.Helper()
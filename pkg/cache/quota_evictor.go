@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	"github.com/thebartekbanach/imcaxy/pkg/metrics"
+)
+
+// Quota limits total size of images matching the source image url glob pattern,
+// empty pattern matches all images, so it is used as a global quota.
+type Quota struct {
+	Name           string
+	SourceImageURL string
+	MaxSize        int64
+}
+
+type QuotaEvictorConfig struct {
+	Quotas []Quota
+
+	// Eviction starts when usage crosses HighWaterMark fraction
+	// of the quota and stops when it drops to LowWaterMark fraction.
+	HighWaterMark float64
+	LowWaterMark  float64
+
+	Order cacherepositories.EvictionOrder
+
+	// Interval between usage checks, zero disables the evictor.
+	Interval  time.Duration
+	BatchSize int
+}
+
+// QuotaEvictor periodically removes least used entries of quotas exceeding their size
+type QuotaEvictor struct {
+	config           QuotaEvictorConfig
+	imagesRepository cacherepositories.CachedImagesRepository
+	imagesStorage    cacherepositories.CachedImagesStorage
+}
+
+func NewQuotaEvictor(
+	config QuotaEvictorConfig,
+	imagesRepository cacherepositories.CachedImagesRepository,
+	imagesStorage cacherepositories.CachedImagesStorage,
+) *QuotaEvictor {
+	return &QuotaEvictor{config, imagesRepository, imagesStorage}
+}
+
+func (e *QuotaEvictor) Start(ctx context.Context) {
+	if e.config.Interval <= 0 || len(e.config.Quotas) == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(e.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if evictedEntries, err := e.Evict(ctx); err != nil {
+					log.Printf("quota eviction failed after evicting %d entries: %s", evictedEntries, err)
+				}
+			}
+		}
+	}()
+}
+
+// Evict checks usage of all quotas and evicts entries of quotas above the high-water mark
+func (e *QuotaEvictor) Evict(ctx context.Context) (evictedEntries int, err error) {
+	for _, quota := range e.config.Quotas {
+		evicted, err := e.evictQuota(ctx, quota)
+		evictedEntries += evicted
+		if err != nil {
+			return evictedEntries, fmt.Errorf("quota %s: %w", quota.Name, err)
+		}
+	}
+
+	return evictedEntries, nil
+}
+
+func (e *QuotaEvictor) evictQuota(ctx context.Context, quota Quota) (evictedEntries int, err error) {
+	usage, err := e.imagesRepository.GetCachedImagesUsage(ctx, quota.SourceImageURL)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		metrics.Set("cache_usage_bytes_"+quota.Name, usage)
+	}()
+
+	if float64(usage) <= float64(quota.MaxSize)*e.config.HighWaterMark {
+		return 0, nil
+	}
+
+	target := int64(float64(quota.MaxSize) * e.config.LowWaterMark)
+	for usage > target {
+		entries, err := e.imagesRepository.GetLeastUsedCachedImageInfos(ctx, quota.SourceImageURL, e.config.Order, e.config.BatchSize)
+		if err != nil {
+			return evictedEntries, err
+		}
+
+		if len(entries) == 0 {
+			return evictedEntries, nil
+		}
+
+		for _, entry := range entries {
+			if usage <= target {
+				break
+			}
+
+			if err := removeEntryIfExists(ctx, e.imagesRepository, e.imagesStorage, entry); err != nil {
+				return evictedEntries, err
+			}
+
+			usage -= entry.ImageSize
+			evictedEntries++
+			metrics.Add("cache_evicted_entries", 1)
+			metrics.Add("cache_evicted_entries_"+quota.Name, 1)
+		}
+	}
+
+	return evictedEntries, nil
+}
+
+type quotaJSON struct {
+	Name           string `json:"name"`
+	SourceImageURL string `json:"sourceImageURL"`
+	MaxSize        int64  `json:"maxSize"`
+}
+
+// ParseQuotas parses JSON array of per project quotas with sizes in bytes
+func ParseQuotas(data []byte) ([]Quota, error) {
+	var rawQuotas []quotaJSON
+	if err := json.Unmarshal(data, &rawQuotas); err != nil {
+		return nil, err
+	}
+
+	quotas := make([]Quota, len(rawQuotas))
+	for i, rawQuota := range rawQuotas {
+		if rawQuota.Name == "" || rawQuota.SourceImageURL == "" {
+			return nil, fmt.Errorf("quota %d: %w", i, ErrInvalidQuota)
+		}
+
+		if rawQuota.MaxSize <= 0 {
+			return nil, fmt.Errorf("quota %s: %w: %d", rawQuota.Name, ErrInvalidQuota, rawQuota.MaxSize)
+		}
+
+		quotas[i] = Quota{
+			Name:           rawQuota.Name,
+			SourceImageURL: rawQuota.SourceImageURL,
+			MaxSize:        rawQuota.MaxSize,
+		}
+	}
+
+	return quotas, nil
+}
+
+var ErrInvalidQuota = errors.New("invalid quota")
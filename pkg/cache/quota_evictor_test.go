@@ -0,0 +1,137 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/thebartekbanach/imcaxy/pkg/cache"
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	mock_cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/mocks"
+)
+
+func newTestingQuotaEvictorConfig(quotas ...cache.Quota) cache.QuotaEvictorConfig {
+	return cache.QuotaEvictorConfig{
+		Quotas:        quotas,
+		HighWaterMark: 0.9,
+		LowWaterMark:  0.5,
+		Order:         cacherepositories.LeastRecentlyUsed,
+		BatchSize:     2,
+	}
+}
+
+func TestQuotaEvictor_EvictShouldNotEvictEntriesBelowHighWaterMark(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+
+	mockImagesRepo.EXPECT().GetCachedImagesUsage(gomock.Any(), "").Return(int64(90), nil)
+	mockImagesRepo.EXPECT().GetLeastUsedCachedImageInfos(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	config := newTestingQuotaEvictorConfig(cache.Quota{Name: "global", MaxSize: 100})
+	evictor := cache.NewQuotaEvictor(config, mockImagesRepo, mockImagesStorage)
+	evictedEntries, err := evictor.Evict(context.Background())
+
+	if err != nil || evictedEntries != 0 {
+		t.Errorf("Expected no entries to be evicted, got %d evicted entries and error: %v", evictedEntries, err)
+	}
+}
+
+func TestQuotaEvictor_EvictShouldEvictLeastUsedEntriesDownToLowWaterMark(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+
+	entries := expiredEntries(4)
+	for i := range entries {
+		entries[i].ImageSize = 20
+		mockImagesStorage.InstantSave(entries[i].RequestSignature, entries[i].ProcessorType, []byte("test data"))
+	}
+
+	pattern := "https://project.com/*"
+	mockImagesRepo.EXPECT().GetCachedImagesUsage(gomock.Any(), pattern).Return(int64(95), nil)
+	gomock.InOrder(
+		mockImagesRepo.EXPECT().GetLeastUsedCachedImageInfos(gomock.Any(), pattern, cacherepositories.LeastRecentlyUsed, 2).Return(entries[:2], nil),
+		mockImagesRepo.EXPECT().GetLeastUsedCachedImageInfos(gomock.Any(), pattern, cacherepositories.LeastRecentlyUsed, 2).Return(entries[2:], nil),
+	)
+
+	// 95 - 3 * 20 = 35, which is below the low-water mark of 50
+	for _, entry := range entries[:3] {
+		mockImagesRepo.EXPECT().DeleteCachedImageInfo(gomock.Any(), entry.RequestSignature, entry.ProcessorType).Return(nil)
+	}
+
+	config := newTestingQuotaEvictorConfig(cache.Quota{Name: "project", SourceImageURL: pattern, MaxSize: 100})
+	evictor := cache.NewQuotaEvictor(config, mockImagesRepo, mockImagesStorage)
+	evictedEntries, err := evictor.Evict(context.Background())
+
+	if err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+
+	if evictedEntries != 3 {
+		t.Errorf("Expected 3 evicted entries, got %d", evictedEntries)
+	}
+
+	if mockImagesStorage.Exists(entries[0].RequestSignature, entries[0].ProcessorType) {
+		t.Errorf("Expected evicted image to be removed from storage")
+	}
+
+	if !mockImagesStorage.Exists(entries[3].RequestSignature, entries[3].ProcessorType) {
+		t.Errorf("Expected image above the low-water mark to be kept in storage")
+	}
+}
+
+func TestQuotaEvictor_EvictShouldStopWhenThereAreNoEntriesLeft(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+
+	mockImagesRepo.EXPECT().GetCachedImagesUsage(gomock.Any(), "").Return(int64(200), nil)
+	mockImagesRepo.EXPECT().GetLeastUsedCachedImageInfos(gomock.Any(), "", gomock.Any(), gomock.Any()).Return(nil, nil)
+
+	config := newTestingQuotaEvictorConfig(cache.Quota{Name: "global", MaxSize: 100})
+	evictor := cache.NewQuotaEvictor(config, mockImagesRepo, mockImagesStorage)
+	if _, err := evictor.Evict(context.Background()); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+}
+
+func TestQuotaEvictor_EvictShouldReturnRepositoryError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	mockImagesStorage := mock_cacherepositories.NewMockCachedImagesStorage()
+
+	testError := errors.New("test error")
+	mockImagesRepo.EXPECT().GetCachedImagesUsage(gomock.Any(), "").Return(int64(0), testError)
+
+	config := newTestingQuotaEvictorConfig(cache.Quota{Name: "global", MaxSize: 100})
+	evictor := cache.NewQuotaEvictor(config, mockImagesRepo, mockImagesStorage)
+	if _, err := evictor.Evict(context.Background()); !errors.Is(err, testError) {
+		t.Errorf("Expected test error, got: %v", err)
+	}
+}
+
+func TestParseQuotas_ShouldParseQuotasAndRejectInvalidOnes(t *testing.T) {
+	quotas, err := cache.ParseQuotas([]byte(`[{"name": "project", "sourceImageURL": "https://project.com/*", "maxSize": 1024}]`))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expected := cache.Quota{Name: "project", SourceImageURL: "https://project.com/*", MaxSize: 1024}
+	if len(quotas) != 1 || quotas[0] != expected {
+		t.Errorf("Expected %v, got %v", expected, quotas)
+	}
+
+	invalid := []string{
+		`[{"sourceImageURL": "https://project.com/*", "maxSize": 1024}]`,
+		`[{"name": "project", "maxSize": 1024}]`,
+		`[{"name": "project", "sourceImageURL": "https://project.com/*", "maxSize": 0}]`,
+	}
+
+	for _, data := range invalid {
+		if _, err := cache.ParseQuotas([]byte(data)); !errors.Is(err, cache.ErrInvalidQuota) {
+			t.Errorf("Expected ErrInvalidQuota for %s, got: %v", data, err)
+		}
+	}
+}
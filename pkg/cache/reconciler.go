@@ -0,0 +1,241 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"time"
+
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	"github.com/thebartekbanach/imcaxy/pkg/metrics"
+)
+
+type ReconcilerConfig struct {
+	// Interval between reconciliations, zero disables scheduled reconciliations.
+	Interval time.Duration
+	// MinAge of checked entries, younger entries can be still saved.
+	MinAge    time.Duration
+	BatchSize int
+}
+
+// Reconciler walks both image metadata and images storage and repairs entries
+// which do not match, so they do not fail on every request.
+type Reconciler struct {
+	config           ReconcilerConfig
+	imagesRepository cacherepositories.CachedImagesRepository
+	imagesStorage    cacherepositories.CachedImagesStorage
+}
+
+type ReconciliationReport struct {
+	DryRun     bool      `json:"dryRun"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+
+	CheckedEntries int `json:"checkedEntries"`
+	CheckedImages  int `json:"checkedImages"`
+
+	// entries without images are removed, so images can be cached again
+	EntriesWithoutImages ReportedIssues `json:"entriesWithoutImages"`
+	// size of entries is set to the size of their images
+	EntriesWithWrongSize ReportedIssues `json:"entriesWithWrongSize"`
+	// images without entries are never served, so they are removed
+	ImagesWithoutEntries ReportedIssues `json:"imagesWithoutEntries"`
+}
+
+type ReportedIssues struct {
+	Count int `json:"count"`
+	// StorageKeys of the first found issues
+	StorageKeys []string `json:"storageKeys"`
+}
+
+const maxReportedStorageKeys = 100
+
+func (issues *ReportedIssues) add(storageKey string) {
+	issues.Count++
+	if len(issues.StorageKeys) < maxReportedStorageKeys {
+		issues.StorageKeys = append(issues.StorageKeys, storageKey)
+	}
+}
+
+func NewReconciler(
+	config ReconcilerConfig,
+	imagesRepository cacherepositories.CachedImagesRepository,
+	imagesStorage cacherepositories.CachedImagesStorage,
+) *Reconciler {
+	return &Reconciler{config, imagesRepository, imagesStorage}
+}
+
+func (r *Reconciler) Start(ctx context.Context) {
+	if r.config.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report, err := r.Reconcile(ctx, false)
+				if err != nil {
+					log.Printf("reconciliation failed: %s", err)
+				}
+
+				log.Printf(
+					"reconciliation checked %d entries and %d images, removed %d entries without images and %d images without entries, fixed size of %d entries",
+					report.CheckedEntries, report.CheckedImages, report.EntriesWithoutImages.Count, report.ImagesWithoutEntries.Count, report.EntriesWithWrongSize.Count,
+				)
+			}
+		}
+	}()
+}
+
+// Reconcile merges entries and images, which are both ordered by storage keys,
+// found issues are only reported when dryRun is set
+func (r *Reconciler) Reconcile(ctx context.Context, dryRun bool) (report ReconciliationReport, err error) {
+	report.DryRun = dryRun
+	report.StartedAt = time.Now()
+	defer func() { report.FinishedAt = time.Now() }()
+
+	entries := &orderedEntries{repository: r.imagesRepository, batchSize: r.config.BatchSize}
+	err = r.imagesStorage.WalkStorageKeys(ctx, func(storageKey string, size int64) error {
+		report.CheckedImages++
+
+		// entries with smaller storage keys have no images
+		for {
+			entry, found, err := entries.peek(ctx)
+			if err != nil {
+				return err
+			}
+
+			if !found || entry.StorageKey > storageKey {
+				return r.reconcileImageWithoutEntry(ctx, storageKey, dryRun, &report)
+			}
+
+			entries.next()
+			report.CheckedEntries++
+
+			if entry.StorageKey == storageKey {
+				return r.reconcileEntrySize(ctx, entry, size, dryRun, &report)
+			}
+
+			if err := r.reconcileEntryWithoutImage(ctx, entry, dryRun, &report); err != nil {
+				return err
+			}
+		}
+	})
+
+	if err != nil {
+		return report, err
+	}
+
+	for {
+		entry, found, err := entries.peek(ctx)
+		if err != nil || !found {
+			return report, err
+		}
+
+		entries.next()
+		report.CheckedEntries++
+
+		if err := r.reconcileEntryWithoutImage(ctx, entry, dryRun, &report); err != nil {
+			return report, err
+		}
+	}
+}
+
+func (r *Reconciler) reconcileEntryWithoutImage(ctx context.Context, entry cacherepositories.CachedImageModel, dryRun bool, report *ReconciliationReport) error {
+	if time.Since(entry.CreatedAt) < r.config.MinAge {
+		return nil
+	}
+
+	report.EntriesWithoutImages.add(entry.StorageKey)
+	if dryRun {
+		return nil
+	}
+
+	metrics.Add("cache_reconciled_entries_without_images", 1)
+	return removeEntryIfExists(ctx, r.imagesRepository, r.imagesStorage, entry)
+}
+
+func (r *Reconciler) reconcileEntrySize(ctx context.Context, entry cacherepositories.CachedImageModel, size int64, dryRun bool, report *ReconciliationReport) error {
+	if entry.ImageSize == size || time.Since(entry.CreatedAt) < r.config.MinAge {
+		return nil
+	}
+
+	report.EntriesWithWrongSize.add(entry.StorageKey)
+	if dryRun {
+		return nil
+	}
+
+	metrics.Add("cache_reconciled_entries_with_wrong_size", 1)
+	err := r.imagesRepository.UpdateCachedImageSize(ctx, entry.RequestSignature, entry.ProcessorType, size)
+	if err == cacherepositories.ErrCachedImageNotFound {
+		return nil
+	}
+
+	return err
+}
+
+func (r *Reconciler) reconcileImageWithoutEntry(ctx context.Context, storageKey string, dryRun bool, report *ReconciliationReport) error {
+	// entry could be created after the batch of entries was read
+	entries, err := r.imagesRepository.ListCachedImageInfos(ctx, storageKey, 1)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) > 0 && entries[0].StorageKey == storageKey {
+		return nil
+	}
+
+	report.ImagesWithoutEntries.add(storageKey)
+	if dryRun {
+		return nil
+	}
+
+	metrics.Add("cache_reconciled_images_without_entries", 1)
+	err = r.imagesStorage.DeleteStorageKey(ctx, storageKey)
+	if err == cacherepositories.ErrImageNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// orderedEntries reads entries ordered by storage keys in batches,
+// entries saved under legacy keys are skipped
+type orderedEntries struct {
+	repository cacherepositories.CachedImagesRepository
+	batchSize  int
+
+	batch    []cacherepositories.CachedImageModel
+	after    string
+	finished bool
+}
+
+func (e *orderedEntries) peek(ctx context.Context) (cacherepositories.CachedImageModel, bool, error) {
+	if len(e.batch) == 0 && !e.finished {
+		batch, err := e.repository.ListCachedImageInfosAfter(ctx, e.after, e.batchSize)
+		if err != nil {
+			return cacherepositories.CachedImageModel{}, false, err
+		}
+
+		e.batch = batch
+		e.finished = len(batch) < e.batchSize
+		if len(batch) > 0 {
+			e.after = batch[len(batch)-1].StorageKey
+		}
+	}
+
+	if len(e.batch) == 0 {
+		return cacherepositories.CachedImageModel{}, false, nil
+	}
+
+	return e.batch[0], true, nil
+}
+
+func (e *orderedEntries) next() {
+	e.batch = e.batch[1:]
+}
@@ -0,0 +1,118 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/thebartekbanach/imcaxy/pkg/cache"
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	mock_cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/mocks"
+)
+
+type testingReconciledImage struct {
+	signature string
+	entrySize int64
+	data      []byte
+
+	withoutEntry bool
+	withoutImage bool
+
+	// entries are created two hours ago, entries created just now can be still saved
+	createdJustNow bool
+}
+
+func newTestingReconciledCache(t *testing.T, images []testingReconciledImage) (cacherepositories.CachedImagesRepository, *mock_cacherepositories.MockCachedImagesStorage) {
+	repo, storage := newTestingCache(t)
+
+	for _, image := range images {
+		if !image.withoutEntry {
+			createdAt := time.Now().Add(-2 * time.Hour)
+			if image.createdJustNow {
+				createdAt = time.Now()
+			}
+
+			createTestingCacheEntry(t, repo, cacherepositories.CachedImageModel{RequestSignature: image.signature, ProcessorType: "imaginary", ImageSize: image.entrySize, CreatedAt: createdAt})
+		}
+
+		if !image.withoutImage {
+			storage.InstantSave(image.signature, "imaginary", image.data)
+		}
+	}
+
+	return repo, storage
+}
+
+func TestReconciler_ReconcileShouldRepairMismatchedEntriesAndImages(t *testing.T) {
+	repo, storage := newTestingReconciledCache(t, []testingReconciledImage{
+		{signature: "valid", entrySize: 4, data: []byte("1234")},
+		{signature: "wrong-size", entrySize: 4, data: []byte("123456")},
+		{signature: "without-image", entrySize: 4, withoutImage: true},
+		{signature: "young", entrySize: 4, withoutImage: true, createdJustNow: true},
+		{signature: "orphan", data: []byte("1234"), withoutEntry: true},
+	})
+
+	reconciler := cache.NewReconciler(cache.ReconcilerConfig{MinAge: time.Hour, BatchSize: 2}, repo, storage)
+	report, err := reconciler.Reconcile(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if report.CheckedEntries != 4 || report.CheckedImages != 3 {
+		t.Errorf("Expected 4 checked entries and 3 checked images, got %d and %d", report.CheckedEntries, report.CheckedImages)
+	}
+
+	if report.EntriesWithoutImages.Count != 1 || report.EntriesWithWrongSize.Count != 1 || report.ImagesWithoutEntries.Count != 1 {
+		t.Errorf("Expected one issue of every kind, got: %+v", report)
+	}
+
+	if _, err := repo.GetCachedImageInfo(context.Background(), "without-image", "imaginary"); err != cacherepositories.ErrCachedImageNotFound {
+		t.Errorf("Expected entry without image to be removed, got: %v", err)
+	}
+
+	if _, err := repo.GetCachedImageInfo(context.Background(), "young", "imaginary"); err != nil {
+		t.Errorf("Expected young entry without image to be kept, got: %v", err)
+	}
+
+	if info, err := repo.GetCachedImageInfo(context.Background(), "wrong-size", "imaginary"); err != nil || info.ImageSize != 6 {
+		t.Errorf("Expected size of entry to be fixed, got %d and error: %v", info.ImageSize, err)
+	}
+
+	if storage.Exists("orphan", "imaginary") {
+		t.Errorf("Expected image without entry to be removed")
+	}
+
+	if !storage.Exists("valid", "imaginary") {
+		t.Errorf("Expected valid image to be kept")
+	}
+}
+
+func TestReconciler_ReconcileShouldOnlyReportIssuesInDryRun(t *testing.T) {
+	repo, storage := newTestingReconciledCache(t, []testingReconciledImage{
+		{signature: "without-image", entrySize: 4, withoutImage: true},
+		{signature: "orphan", data: []byte("1234"), withoutEntry: true},
+	})
+
+	reconciler := cache.NewReconciler(cache.ReconcilerConfig{MinAge: time.Hour, BatchSize: 10}, repo, storage)
+	report, err := reconciler.Reconcile(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	orphanKey := cacherepositories.StorageKey("orphan", "imaginary")
+	if report.ImagesWithoutEntries.Count != 1 || report.ImagesWithoutEntries.StorageKeys[0] != orphanKey {
+		t.Errorf("Expected image without entry to be reported, got: %+v", report.ImagesWithoutEntries)
+	}
+
+	if report.EntriesWithoutImages.Count != 1 {
+		t.Errorf("Expected entry without image to be reported, got: %+v", report.EntriesWithoutImages)
+	}
+
+	if _, err := repo.GetCachedImageInfo(context.Background(), "without-image", "imaginary"); err != nil {
+		t.Errorf("Expected entry without image to be kept in dry run, got: %v", err)
+	}
+
+	if !storage.Exists("orphan", "imaginary") {
+		t.Errorf("Expected image without entry to be kept in dry run")
+	}
+}
@@ -0,0 +1,46 @@
+package cacherepositories
+
+import (
+	"encoding/binary"
+	"time"
+
+	dbconnections "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/connections"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	boltCachedImagesBucket             = []byte("cachedImages")
+	boltCachedImagesBySourceBucket     = []byte("cachedImagesBySource")
+	boltCachedImagesByExpirationBucket = []byte("cachedImagesByExpiration")
+	boltInvalidationsBucket            = []byte("invalidations")
+	boltImagesBucket                   = []byte("images")
+)
+
+// CreateBoltCacheDBBuckets creates buckets used by repositories and storage
+// working on the embedded database, it has to be called before they are used
+func CreateBoltCacheDBBuckets(conn dbconnections.BoltCacheDBConnection) error {
+	return conn.DB().Update(func(tx *bbolt.Tx) error {
+		buckets := [][]byte{
+			boltCachedImagesBucket,
+			boltCachedImagesBySourceBucket,
+			boltCachedImagesByExpirationBucket,
+			boltInvalidationsBucket,
+			boltImagesBucket,
+		}
+
+		for _, name := range buckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// boltTimeKey encodes time, so keys starting with it are ordered by time
+func boltTimeKey(t time.Time, suffix []byte) []byte {
+	key := make([]byte, 8, 8+len(suffix))
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return append(key, suffix...)
+}
@@ -0,0 +1,444 @@
+package cacherepositories
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/ryanuber/go-glob"
+	dbconnections "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/connections"
+	"go.etcd.io/bbolt"
+)
+
+// boltCachedImagesRepository keeps entries under their storage keys, entries are indexed
+// by source image url and expiration time, usage queries scan all entries
+type boltCachedImagesRepository struct {
+	conn dbconnections.BoltCacheDBConnection
+}
+
+var _ CachedImagesRepository = (*boltCachedImagesRepository)(nil)
+
+func (repo *boltCachedImagesRepository) CreateCachedImageInfo(ctx context.Context, info CachedImageModel) error {
+	info.StorageKey = StorageKey(info.RequestSignature, info.ProcessorType)
+	if info.CreatedAt.IsZero() {
+		info.CreatedAt = time.Now()
+	}
+	info.LastAccessedAt = info.CreatedAt
+
+	return repo.conn.DB().Update(func(tx *bbolt.Tx) error {
+		key := boltCachedImageKey(info.RequestSignature, info.ProcessorType)
+		if tx.Bucket(boltCachedImagesBucket).Get(key) != nil {
+			return ErrCachedImageAlreadyExists
+		}
+
+		if err := putBoltCachedImage(tx, key, info); err != nil {
+			return err
+		}
+
+		return putBoltCachedImageIndexes(tx, key, info)
+	})
+}
+
+func (repo *boltCachedImagesRepository) DeleteCachedImageInfo(ctx context.Context, requestSignature, processorType string) error {
+	return repo.conn.DB().Update(func(tx *bbolt.Tx) error {
+		key := boltCachedImageKey(requestSignature, processorType)
+		info, err := getBoltCachedImage(tx, key)
+		if err != nil {
+			return err
+		}
+
+		if err := deleteBoltCachedImageIndexes(tx, key, info); err != nil {
+			return err
+		}
+
+		return tx.Bucket(boltCachedImagesBucket).Delete(key)
+	})
+}
+
+func (repo *boltCachedImagesRepository) GetCachedImageInfo(ctx context.Context, requestSignature, processorType string) (info CachedImageModel, err error) {
+	err = repo.conn.DB().View(func(tx *bbolt.Tx) error {
+		info, err = getBoltCachedImage(tx, boltCachedImageKey(requestSignature, processorType))
+		if err == nil && info.IsPending() {
+			return ErrCachedImageNotFound
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return CachedImageModel{}, err
+	}
+
+	return info, nil
+}
+
+func (repo *boltCachedImagesRepository) GetCachedImageInfosOfSource(ctx context.Context, sourceImageURL string) (infos []CachedImageModel, err error) {
+	err = repo.conn.DB().View(func(tx *bbolt.Tx) error {
+		prefix := append([]byte(sourceImageURL), 0)
+		cursor := tx.Bucket(boltCachedImagesBySourceBucket).Cursor()
+
+		for indexKey, _ := cursor.Seek(prefix); indexKey != nil && bytes.HasPrefix(indexKey, prefix); indexKey, _ = cursor.Next() {
+			info, err := getBoltCachedImage(tx, indexKey[len(prefix):])
+			if err != nil {
+				return err
+			}
+
+			infos = append(infos, info)
+		}
+
+		return nil
+	})
+
+	return infos, err
+}
+
+func (repo *boltCachedImagesRepository) WalkCachedImageInfosOfSourcePrefix(ctx context.Context, sourceImageURLPrefix string, walkFn func(info CachedImageModel) error) error {
+	return repo.conn.DB().View(func(tx *bbolt.Tx) error {
+		prefix := []byte(sourceImageURLPrefix)
+		cursor := tx.Bucket(boltCachedImagesBySourceBucket).Cursor()
+
+		// index keys are source image urls followed by zero byte and the key of the entry
+		for indexKey, _ := cursor.Seek(prefix); indexKey != nil && bytes.HasPrefix(indexKey, prefix); indexKey, _ = cursor.Next() {
+			info, err := getBoltCachedImage(tx, indexKey[bytes.LastIndexByte(indexKey, 0)+1:])
+			if err != nil {
+				return err
+			}
+
+			if err := walkFn(info); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (repo *boltCachedImagesRepository) MarkCachedImageReady(ctx context.Context, requestSignature, processorType string, size int64, checksum string) error {
+	return repo.update(requestSignature, processorType, func(info *CachedImageModel) {
+		info.ImageSize = size
+		info.Checksum = checksum
+		info.State = CachedImageReady
+	})
+}
+
+func (repo *boltCachedImagesRepository) UpdateCachedImageSize(ctx context.Context, requestSignature, processorType string, size int64) error {
+	return repo.update(requestSignature, processorType, func(info *CachedImageModel) {
+		info.ImageSize = size
+	})
+}
+
+func (repo *boltCachedImagesRepository) UpdateCachedImageStorageKey(ctx context.Context, requestSignature, processorType, storageKey string) error {
+	return repo.update(requestSignature, processorType, func(info *CachedImageModel) {
+		info.StorageKey = storageKey
+	})
+}
+
+func (repo *boltCachedImagesRepository) RecordCachedImageAccesses(ctx context.Context, accesses []CachedImageAccess) error {
+	if len(accesses) == 0 {
+		return nil
+	}
+
+	return repo.conn.DB().Update(func(tx *bbolt.Tx) error {
+		for _, access := range accesses {
+			key := boltCachedImageKey(access.RequestSignature, access.ProcessorType)
+			info, err := getBoltCachedImage(tx, key)
+			if err == ErrCachedImageNotFound {
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if info.LastAccessedAt.Before(access.LastAccessedAt) {
+				info.LastAccessedAt = access.LastAccessedAt
+			}
+			info.AccessCount += access.Count
+
+			if err := putBoltCachedImage(tx, key, info); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (repo *boltCachedImagesRepository) GetExpiredCachedImageInfos(ctx context.Context, now time.Time, limit int) (infos []CachedImageModel, err error) {
+	err = repo.conn.DB().View(func(tx *bbolt.Tx) error {
+		// entries which never expire are not indexed
+		end := boltTimeKey(now, nil)
+		cursor := tx.Bucket(boltCachedImagesByExpirationBucket).Cursor()
+
+		for indexKey, _ := cursor.First(); indexKey != nil && len(infos) < limit; indexKey, _ = cursor.Next() {
+			if bytes.Compare(indexKey[:len(end)], end) > 0 {
+				break
+			}
+
+			info, err := getBoltCachedImage(tx, indexKey[len(end):])
+			if err != nil {
+				return err
+			}
+
+			infos = append(infos, info)
+		}
+
+		return nil
+	})
+
+	return infos, err
+}
+
+// pending entries are not indexed, as there are only few of them
+func (repo *boltCachedImagesRepository) GetPendingCachedImageInfos(ctx context.Context, createdBefore time.Time, limit int) (infos []CachedImageModel, err error) {
+	err = repo.forEachImage(func(info CachedImageModel) bool {
+		if info.IsPending() && info.CreatedAt.Before(createdBefore) {
+			infos = append(infos, info)
+		}
+
+		return len(infos) < limit
+	})
+
+	return infos, err
+}
+
+func (repo *boltCachedImagesRepository) GetCachedImagesUsage(ctx context.Context, sourceImageURLPattern string) (usage int64, err error) {
+	err = repo.forEachSavedImage(sourceImageURLPattern, func(info CachedImageModel) {
+		usage += info.ImageSize
+	})
+
+	return usage, err
+}
+
+func (repo *boltCachedImagesRepository) GetLeastUsedCachedImageInfos(ctx context.Context, sourceImageURLPattern string, order EvictionOrder, limit int) ([]CachedImageModel, error) {
+	var infos []CachedImageModel
+	err := repo.forEachSavedImage(sourceImageURLPattern, func(info CachedImageModel) {
+		infos = append(infos, info)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		if order == LeastFrequentlyUsed && infos[i].AccessCount != infos[j].AccessCount {
+			return infos[i].AccessCount < infos[j].AccessCount
+		}
+
+		return infos[i].LastAccessedAt.Before(infos[j].LastAccessedAt)
+	})
+
+	if len(infos) > limit {
+		infos = infos[:limit]
+	}
+
+	return infos, nil
+}
+
+// entries are kept under their storage keys, so they are already ordered by them
+func (repo *boltCachedImagesRepository) ListCachedImageInfos(ctx context.Context, fromStorageKey string, limit int) (infos []CachedImageModel, err error) {
+	err = repo.conn.DB().View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket(boltCachedImagesBucket).Cursor()
+		for key, value := cursor.Seek([]byte(fromStorageKey)); key != nil && len(infos) < limit; key, value = cursor.Next() {
+			var info CachedImageModel
+			if err := json.Unmarshal(value, &info); err != nil {
+				return err
+			}
+
+			infos = append(infos, info)
+		}
+
+		return nil
+	})
+
+	return infos, err
+}
+
+func (repo *boltCachedImagesRepository) ListCachedImageInfosAfter(ctx context.Context, afterStorageKey string, limit int) (infos []CachedImageModel, err error) {
+	err = repo.conn.DB().View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket(boltCachedImagesBucket).Cursor()
+		key, value := cursor.Seek([]byte(afterStorageKey))
+		if key != nil && string(key) == afterStorageKey {
+			key, value = cursor.Next()
+		}
+
+		for ; key != nil && len(infos) < limit; key, value = cursor.Next() {
+			var info CachedImageModel
+			if err := json.Unmarshal(value, &info); err != nil {
+				return err
+			}
+
+			infos = append(infos, info)
+		}
+
+		return nil
+	})
+
+	return infos, err
+}
+
+// entries are not indexed by searched fields, so all of them are read and sorted in memory
+func (repo *boltCachedImagesRepository) SearchCachedImageInfos(ctx context.Context, query CachedImagesQuery, page CachedImagesPage) ([]CachedImageModel, error) {
+	compare := func(a, b CachedImageModel) int {
+		if page.Descending {
+			return page.SortBy.compare(b, a)
+		}
+
+		return page.SortBy.compare(a, b)
+	}
+
+	var infos []CachedImageModel
+	err := repo.forEachSavedImage("", func(info CachedImageModel) {
+		if query.matches(info) && (page.After == nil || compare(info, *page.After) > 0) {
+			infos = append(infos, info)
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return compare(infos[i], infos[j]) < 0
+	})
+
+	if len(infos) > page.Limit {
+		infos = infos[:page.Limit]
+	}
+
+	return infos, nil
+}
+
+func (repo *boltCachedImagesRepository) GetCachedImageSourcesStats(ctx context.Context, query CachedImagesQuery, afterSourceImageURL string, limit int) ([]CachedImageSourceStats, error) {
+	sources := map[string]*CachedImageSourceStats{}
+	err := repo.forEachSavedImage("", func(info CachedImageModel) {
+		if !query.matches(info) || (afterSourceImageURL != "" && info.SourceImageURL <= afterSourceImageURL) {
+			return
+		}
+
+		source, found := sources[info.SourceImageURL]
+		if !found {
+			source = &CachedImageSourceStats{SourceImageURL: info.SourceImageURL}
+			sources[info.SourceImageURL] = source
+		}
+
+		source.Images++
+		source.Bytes += info.ImageSize
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]CachedImageSourceStats, 0, len(sources))
+	for _, source := range sources {
+		stats = append(stats, *source)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].SourceImageURL < stats[j].SourceImageURL
+	})
+
+	if len(stats) > limit {
+		stats = stats[:limit]
+	}
+
+	return stats, nil
+}
+
+// images which are still being saved are pending, images of
+// legacy entries which are still being saved have negative size
+func (repo *boltCachedImagesRepository) forEachSavedImage(sourceImageURLPattern string, fn func(info CachedImageModel)) error {
+	return repo.forEachImage(func(info CachedImageModel) bool {
+		if info.ImageSize >= 0 && !info.IsPending() && (sourceImageURLPattern == "" || glob.Glob(sourceImageURLPattern, info.SourceImageURL)) {
+			fn(info)
+		}
+
+		return true
+	})
+}
+
+// forEachImage calls fn with all entries until it returns false
+func (repo *boltCachedImagesRepository) forEachImage(fn func(info CachedImageModel) bool) error {
+	return repo.conn.DB().View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket(boltCachedImagesBucket).Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var info CachedImageModel
+			if err := json.Unmarshal(value, &info); err != nil {
+				return err
+			}
+
+			if !fn(info) {
+				return nil
+			}
+		}
+
+		return nil
+	})
+}
+
+// update changes fields of the entry, which are not indexed
+func (repo *boltCachedImagesRepository) update(requestSignature, processorType string, change func(info *CachedImageModel)) error {
+	return repo.conn.DB().Update(func(tx *bbolt.Tx) error {
+		key := boltCachedImageKey(requestSignature, processorType)
+		info, err := getBoltCachedImage(tx, key)
+		if err != nil {
+			return err
+		}
+
+		change(&info)
+		return putBoltCachedImage(tx, key, info)
+	})
+}
+
+func boltCachedImageKey(requestSignature, processorType string) []byte {
+	return []byte(StorageKey(requestSignature, processorType))
+}
+
+func getBoltCachedImage(tx *bbolt.Tx, key []byte) (CachedImageModel, error) {
+	value := tx.Bucket(boltCachedImagesBucket).Get(key)
+	if value == nil {
+		return CachedImageModel{}, ErrCachedImageNotFound
+	}
+
+	var info CachedImageModel
+	err := json.Unmarshal(value, &info)
+	return info, err
+}
+
+func putBoltCachedImage(tx *bbolt.Tx, key []byte, info CachedImageModel) error {
+	value, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(boltCachedImagesBucket).Put(key, value)
+}
+
+func putBoltCachedImageIndexes(tx *bbolt.Tx, key []byte, info CachedImageModel) error {
+	bySourceKey := append(append([]byte(info.SourceImageURL), 0), key...)
+	if err := tx.Bucket(boltCachedImagesBySourceBucket).Put(bySourceKey, nil); err != nil {
+		return err
+	}
+
+	if info.ExpiresAt.IsZero() {
+		return nil
+	}
+
+	return tx.Bucket(boltCachedImagesByExpirationBucket).Put(boltTimeKey(info.ExpiresAt, key), nil)
+}
+
+func deleteBoltCachedImageIndexes(tx *bbolt.Tx, key []byte, info CachedImageModel) error {
+	bySourceKey := append(append([]byte(info.SourceImageURL), 0), key...)
+	if err := tx.Bucket(boltCachedImagesBySourceBucket).Delete(bySourceKey); err != nil {
+		return err
+	}
+
+	if info.ExpiresAt.IsZero() {
+		return nil
+	}
+
+	return tx.Bucket(boltCachedImagesByExpirationBucket).Delete(boltTimeKey(info.ExpiresAt, key))
+}
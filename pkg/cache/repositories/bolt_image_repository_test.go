@@ -0,0 +1,699 @@
+package cacherepositories
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestBoltCachedImagesRepository_CreatesCachedImage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	info := CachedImageModel{
+		RawRequest:       "/crop?width=500&height=500&url=http://google.com/image.jpg",
+		RequestSignature: "|/crop|http://google.com/image.jpg|height=500&width=500|",
+
+		ProcessorType:     "imaginary",
+		ProcessorEndpoint: "/crop",
+
+		MimeType:       "image/jpeg",
+		SourceImageURL: "http://google.com/image.jpg",
+		ProcessingParams: map[string][]string{
+			"width":  {"500"},
+			"height": {"500"},
+		},
+	}
+
+	conn := newTestingBoltConnection(t)
+	repo := NewCachedImagesRepository(conn)
+
+	if err := repo.CreateCachedImageInfo(ctx, info); err != nil {
+		t.Errorf("Error creating cached image info: %s", err)
+	}
+
+	infoFromDB, err := repo.GetCachedImageInfo(ctx, info.RequestSignature, info.ProcessorType)
+	if err != nil {
+		t.Errorf("Error getting cached image info: %s", err)
+	}
+
+	if infoFromDB.CreatedAt.IsZero() || !infoFromDB.LastAccessedAt.Equal(infoFromDB.CreatedAt) {
+		t.Errorf("Expected creation and last access time to be set, got %v and %v", infoFromDB.CreatedAt, infoFromDB.LastAccessedAt)
+	}
+
+	info.StorageKey = StorageKey(info.RequestSignature, info.ProcessorType)
+	info.CreatedAt = infoFromDB.CreatedAt
+	info.LastAccessedAt = infoFromDB.LastAccessedAt
+	if !reflect.DeepEqual(infoFromDB, info) {
+		t.Errorf("Cached image info from DB does not match the created one")
+	}
+}
+
+func TestBoltCachedImagesRepository_ReturnsErrorWhenCachedImageAlreadyExists(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	info := CachedImageModel{
+		RawRequest:       "/crop?width=500&height=500&url=http://google.com/image.jpg",
+		RequestSignature: "|/crop|http://google.com/image.jpg|height=500&width=500|",
+
+		ProcessorType:     "imaginary",
+		ProcessorEndpoint: "/crop",
+
+		MimeType:       "image/jpeg",
+		SourceImageURL: "http://google.com/image.jpg",
+		ProcessingParams: map[string][]string{
+			"width":  {"500"},
+			"height": {"500"},
+		},
+	}
+
+	conn := newTestingBoltConnection(t)
+	repo := NewCachedImagesRepository(conn)
+
+	if err := repo.CreateCachedImageInfo(ctx, info); err != nil {
+		t.Errorf("Error creating cached image info: %s", err)
+	}
+
+	if err := repo.CreateCachedImageInfo(ctx, info); err != ErrCachedImageAlreadyExists {
+		t.Errorf("Expected error ErrCachedImageAlreadyExists when creating cached image info that already exists, got: %s", err)
+	}
+}
+
+func TestBoltCachedImagesRepository_ReturnsErrorWhenCachedImageDoesNotExist(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn := newTestingBoltConnection(t)
+	repo := NewCachedImagesRepository(conn)
+
+	if _, err := repo.GetCachedImageInfo(ctx, "some-random-signature", "imaginary"); err != ErrCachedImageNotFound {
+		t.Errorf("Expected error ErrCachedImageNotFound when getting cached image info that does not exist, got: %s", err)
+	}
+}
+
+func TestBoltCachedImagesRepository_DeletesCachedImage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	info := CachedImageModel{
+		RawRequest:       "/crop?width=500&height=500&url=http://google.com/image.jpg",
+		RequestSignature: "|/crop|http://google.com/image.jpg|height=500&width=500|",
+
+		ProcessorType:     "imaginary",
+		ProcessorEndpoint: "/crop",
+
+		MimeType:       "image/jpeg",
+		SourceImageURL: "http://google.com/image.jpg",
+		ProcessingParams: map[string][]string{
+			"width":  {"500"},
+			"height": {"500"},
+		},
+	}
+
+	conn := newTestingBoltConnection(t)
+	repo := NewCachedImagesRepository(conn)
+
+	if err := repo.CreateCachedImageInfo(ctx, info); err != nil {
+		t.Errorf("Error creating cached image info: %s", err)
+	}
+
+	if _, err := repo.GetCachedImageInfo(ctx, info.RequestSignature, info.ProcessorType); err != nil {
+		t.Errorf("Cached image was not created correctly: %s", err)
+	}
+
+	if err := repo.DeleteCachedImageInfo(ctx, info.RequestSignature, info.ProcessorType); err != nil {
+		t.Errorf("Error deleting cached image info: %s", err)
+	}
+
+	if _, err := repo.GetCachedImageInfo(ctx, info.RequestSignature, info.ProcessorType); err != ErrCachedImageNotFound {
+		t.Errorf("Cached image was not deleted correctly: %s", err)
+	}
+}
+
+func TestBoltCachedImagesRepository_UpdatesSizeOfCachedImage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	info := CachedImageModel{
+		RawRequest:       "/crop?width=500&height=500&url=http://google.com/image.jpg",
+		RequestSignature: "|/crop|http://google.com/image.jpg|height=500&width=500|",
+
+		ProcessorType:     "imaginary",
+		ProcessorEndpoint: "/crop",
+
+		MimeType:       "image/jpeg",
+		ImageSize:      -1,
+		SourceImageURL: "http://google.com/image.jpg",
+	}
+
+	conn := newTestingBoltConnection(t)
+	repo := NewCachedImagesRepository(conn)
+
+	if err := repo.CreateCachedImageInfo(ctx, info); err != nil {
+		t.Errorf("Error creating cached image info: %s", err)
+	}
+
+	if err := repo.UpdateCachedImageSize(ctx, info.RequestSignature, info.ProcessorType, 1024); err != nil {
+		t.Errorf("Error updating cached image size: %s", err)
+	}
+
+	infoFromDB, err := repo.GetCachedImageInfo(ctx, info.RequestSignature, info.ProcessorType)
+	if err != nil {
+		t.Errorf("Error getting cached image info: %s", err)
+	}
+
+	if infoFromDB.ImageSize != 1024 {
+		t.Errorf("Expected image size to be 1024, got %d", infoFromDB.ImageSize)
+	}
+
+	if err := repo.UpdateCachedImageSize(ctx, "unknown", info.ProcessorType, 1024); err != ErrCachedImageNotFound {
+		t.Errorf("Expected ErrCachedImageNotFound error, got: %v", err)
+	}
+}
+
+func TestBoltCachedImagesRepository_ReturnsAllCachedImageInfosOfGivenURL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// those two image infos differ in width and height of requested crop
+	info1 := CachedImageModel{
+		RawRequest:       "/crop?width=400&height=400&url=http://google.com/image.jpg",
+		RequestSignature: "|/crop|http://google.com/image.jpg|height=400&width=400|",
+
+		ProcessorType:     "imaginary",
+		ProcessorEndpoint: "/crop",
+
+		MimeType:       "image/jpeg",
+		SourceImageURL: "http://google.com/image.jpg",
+		ProcessingParams: map[string][]string{
+			"width":  {"400"},
+			"height": {"400"},
+		},
+	}
+
+	info2 := CachedImageModel{
+		RawRequest:       "/crop?width=500&height=500&url=http://google.com/image.jpg",
+		RequestSignature: "|/crop|http://google.com/image.jpg|height=500&width=500|",
+
+		ProcessorType:     "imaginary",
+		ProcessorEndpoint: "/crop",
+
+		MimeType:       "image/jpeg",
+		SourceImageURL: "http://google.com/image.jpg",
+		ProcessingParams: map[string][]string{
+			"width":  {"500"},
+			"height": {"500"},
+		},
+	}
+
+	conn := newTestingBoltConnection(t)
+	repo := NewCachedImagesRepository(conn)
+	repo.CreateCachedImageInfo(ctx, info1)
+	repo.CreateCachedImageInfo(ctx, info2)
+	infos, err := repo.GetCachedImageInfosOfSource(ctx, "http://google.com/image.jpg")
+
+	if err != nil {
+		t.Errorf("Error getting cached image infos of source image: %s", err)
+	}
+
+	if len(infos) != 2 {
+		t.Errorf("Expected 2 cached image infos of source image, got: %d", len(infos))
+	}
+
+	info1.StorageKey = StorageKey(info1.RequestSignature, info1.ProcessorType)
+	info2.StorageKey = StorageKey(info2.RequestSignature, info2.ProcessorType)
+	for _, info := range infos {
+		info.CreatedAt = time.Time{}
+		info.LastAccessedAt = time.Time{}
+		if reflect.DeepEqual(info, info1) || reflect.DeepEqual(info, info2) {
+			continue
+		}
+
+		t.Errorf("Expected cached image info to be one of the two, got: %v", info)
+	}
+}
+
+func TestBoltCachedImagesRepository_RecordsCachedImageAccesses(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	info := CachedImageModel{
+		RequestSignature: "|/crop|http://google.com/image.jpg|height=500&width=500|",
+		ProcessorType:    "imaginary",
+		SourceImageURL:   "http://google.com/image.jpg",
+	}
+
+	conn := newTestingBoltConnection(t)
+	repo := NewCachedImagesRepository(conn)
+
+	if err := repo.CreateCachedImageInfo(ctx, info); err != nil {
+		t.Errorf("Error creating cached image info: %s", err)
+	}
+
+	accessedAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	accesses := []CachedImageAccess{
+		{RequestSignature: info.RequestSignature, ProcessorType: info.ProcessorType, LastAccessedAt: accessedAt, Count: 3},
+		{RequestSignature: "unknown", ProcessorType: info.ProcessorType, LastAccessedAt: accessedAt, Count: 1},
+	}
+
+	if err := repo.RecordCachedImageAccesses(ctx, accesses); err != nil {
+		t.Errorf("Error recording cached image accesses: %s", err)
+	}
+
+	// older access time must not overwrite the newer one
+	accesses = []CachedImageAccess{
+		{RequestSignature: info.RequestSignature, ProcessorType: info.ProcessorType, LastAccessedAt: accessedAt.Add(-time.Minute), Count: 2},
+	}
+
+	if err := repo.RecordCachedImageAccesses(ctx, accesses); err != nil {
+		t.Errorf("Error recording cached image accesses: %s", err)
+	}
+
+	infoFromDB, err := repo.GetCachedImageInfo(ctx, info.RequestSignature, info.ProcessorType)
+	if err != nil {
+		t.Errorf("Error getting cached image info: %s", err)
+	}
+
+	if !infoFromDB.LastAccessedAt.Equal(accessedAt) {
+		t.Errorf("Expected last access time to be %v, got %v", accessedAt, infoFromDB.LastAccessedAt)
+	}
+
+	if infoFromDB.AccessCount != 5 {
+		t.Errorf("Expected access count to be 5, got %d", infoFromDB.AccessCount)
+	}
+}
+
+func TestBoltCachedImagesRepository_ReturnsUsageOfMatchingCachedImages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	infos := []CachedImageModel{
+		{RequestSignature: "a", ProcessorType: "imaginary", SourceImageURL: "https://a.example.com/1.jpg", ImageSize: 100},
+		{RequestSignature: "b", ProcessorType: "imaginary", SourceImageURL: "https://a.example.com/2.jpg", ImageSize: 200},
+		{RequestSignature: "c", ProcessorType: "imaginary", SourceImageURL: "https://b.example.com/1.jpg", ImageSize: 400},
+		{RequestSignature: "d", ProcessorType: "imaginary", SourceImageURL: "https://a.example.com/3.jpg", ImageSize: -1},
+	}
+
+	conn := newTestingBoltConnection(t)
+	repo := NewCachedImagesRepository(conn)
+	for _, info := range infos {
+		if err := repo.CreateCachedImageInfo(ctx, info); err != nil {
+			t.Errorf("Error creating cached image info: %s", err)
+		}
+	}
+
+	usages := map[string]int64{
+		"":                            700,
+		"https://a.example.com/*":     300,
+		"https://*.example.com/1.jpg": 500,
+		"https://c.example.com/*":     0,
+	}
+
+	for pattern, expectedUsage := range usages {
+		usage, err := repo.GetCachedImagesUsage(ctx, pattern)
+		if err != nil {
+			t.Errorf("Error getting cached images usage: %s", err)
+		}
+
+		if usage != expectedUsage {
+			t.Errorf("Expected usage of %q to be %d, got %d", pattern, expectedUsage, usage)
+		}
+	}
+}
+
+func TestBoltCachedImagesRepository_ReturnsLeastUsedCachedImages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Now()
+	infos := []CachedImageModel{
+		{RequestSignature: "recent-rare", ProcessorType: "imaginary", CreatedAt: now},
+		{RequestSignature: "old-frequent", ProcessorType: "imaginary", CreatedAt: now.Add(-time.Hour)},
+		{RequestSignature: "older-rare", ProcessorType: "imaginary", CreatedAt: now.Add(-2 * time.Hour)},
+	}
+
+	conn := newTestingBoltConnection(t)
+	repo := NewCachedImagesRepository(conn)
+	for _, info := range infos {
+		if err := repo.CreateCachedImageInfo(ctx, info); err != nil {
+			t.Errorf("Error creating cached image info: %s", err)
+		}
+	}
+
+	accesses := []CachedImageAccess{
+		{RequestSignature: "old-frequent", ProcessorType: "imaginary", LastAccessedAt: now.Add(-time.Hour), Count: 10},
+		{RequestSignature: "recent-rare", ProcessorType: "imaginary", LastAccessedAt: now, Count: 1},
+		{RequestSignature: "older-rare", ProcessorType: "imaginary", LastAccessedAt: now.Add(-2 * time.Hour), Count: 1},
+	}
+
+	if err := repo.RecordCachedImageAccesses(ctx, accesses); err != nil {
+		t.Errorf("Error recording cached image accesses: %s", err)
+	}
+
+	orders := map[EvictionOrder][]string{
+		LeastRecentlyUsed:   {"older-rare", "old-frequent", "recent-rare"},
+		LeastFrequentlyUsed: {"older-rare", "recent-rare", "old-frequent"},
+	}
+
+	for order, expectedSignatures := range orders {
+		infos, err := repo.GetLeastUsedCachedImageInfos(ctx, "", order, 10)
+		if err != nil {
+			t.Errorf("Error getting least used cached image infos: %s", err)
+		}
+
+		signatures := []string{}
+		for _, info := range infos {
+			signatures = append(signatures, info.RequestSignature)
+		}
+
+		if !reflect.DeepEqual(signatures, expectedSignatures) {
+			t.Errorf("Expected %s order to be %v, got %v", order, expectedSignatures, signatures)
+		}
+	}
+}
+
+func TestBoltCachedImagesRepository_ReturnsOnlyExpiredCachedImages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Now()
+	expiresAt := map[string]time.Time{
+		"expired":       now.Add(-time.Minute),
+		"not-expired":   now.Add(time.Minute),
+		"never-expires": {},
+	}
+
+	conn := newTestingBoltConnection(t)
+	repo := NewCachedImagesRepository(conn)
+	for signature, expirationTime := range expiresAt {
+		info := CachedImageModel{RequestSignature: signature, ProcessorType: "imaginary", ExpiresAt: expirationTime}
+		if err := repo.CreateCachedImageInfo(ctx, info); err != nil {
+			t.Errorf("Error creating cached image info: %s", err)
+		}
+	}
+
+	infos, err := repo.GetExpiredCachedImageInfos(ctx, now, 10)
+	if err != nil {
+		t.Errorf("Error getting expired cached image infos: %s", err)
+	}
+
+	if len(infos) != 1 || infos[0].RequestSignature != "expired" {
+		t.Errorf("Expected only expired cached image info to be returned, got: %v", infos)
+	}
+}
+
+func TestBoltCachedImagesRepository_RemovesDeletedCachedImagesFromIndexes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Now()
+	repo := NewCachedImagesRepository(newTestingBoltConnection(t))
+	for _, signature := range []string{"deleted", "kept"} {
+		info := CachedImageModel{RequestSignature: signature, ProcessorType: "imaginary", SourceImageURL: "http://google.com/image.jpg", ExpiresAt: now.Add(-time.Minute)}
+		if err := repo.CreateCachedImageInfo(ctx, info); err != nil {
+			t.Errorf("Error creating cached image info: %s", err)
+		}
+	}
+
+	if err := repo.DeleteCachedImageInfo(ctx, "deleted", "imaginary"); err != nil {
+		t.Errorf("Error deleting cached image info: %s", err)
+	}
+
+	infosOfSource, err := repo.GetCachedImageInfosOfSource(ctx, "http://google.com/image.jpg")
+	if err != nil || len(infosOfSource) != 1 || infosOfSource[0].RequestSignature != "kept" {
+		t.Errorf("Expected only kept cached image info to be returned by source, got: %v, error: %v", infosOfSource, err)
+	}
+
+	expiredInfos, err := repo.GetExpiredCachedImageInfos(ctx, now, 10)
+	if err != nil || len(expiredInfos) != 1 || expiredInfos[0].RequestSignature != "kept" {
+		t.Errorf("Expected only kept cached image info to be returned as expired, got: %v, error: %v", expiredInfos, err)
+	}
+}
+
+func TestBoltCachedImagesRepository_ListsCachedImagesOrderedByStorageKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn := newTestingBoltConnection(t)
+	repo := NewCachedImagesRepository(conn)
+
+	storageKeys := []string{}
+	for _, signature := range []string{"a", "b", "c", "d"} {
+		if err := repo.CreateCachedImageInfo(ctx, CachedImageModel{RequestSignature: signature, ProcessorType: "imaginary"}); err != nil {
+			t.Errorf("Error creating cached image info: %s", err)
+		}
+
+		storageKeys = append(storageKeys, StorageKey(signature, "imaginary"))
+	}
+	sort.Strings(storageKeys)
+
+	infos, err := repo.ListCachedImageInfos(ctx, storageKeys[1], 2)
+	if err != nil {
+		t.Errorf("Error listing cached image infos: %s", err)
+	}
+
+	listedKeys := []string{}
+	for _, info := range infos {
+		listedKeys = append(listedKeys, info.StorageKey)
+	}
+
+	if !reflect.DeepEqual(listedKeys, storageKeys[1:3]) {
+		t.Errorf("Expected listed storage keys to be %v, got %v", storageKeys[1:3], listedKeys)
+	}
+}
+
+func TestBoltCachedImagesRepository_ListsCachedImagesAfterStorageKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn := newTestingBoltConnection(t)
+	repo := NewCachedImagesRepository(conn)
+
+	storageKeys := []string{}
+	for _, signature := range []string{"a", "b", "c", "d"} {
+		if err := repo.CreateCachedImageInfo(ctx, CachedImageModel{RequestSignature: signature, ProcessorType: "imaginary"}); err != nil {
+			t.Errorf("Error creating cached image info: %s", err)
+		}
+
+		storageKeys = append(storageKeys, StorageKey(signature, "imaginary"))
+	}
+	sort.Strings(storageKeys)
+
+	infos, err := repo.ListCachedImageInfosAfter(ctx, storageKeys[1], 2)
+	if err != nil {
+		t.Errorf("Error listing cached image infos: %s", err)
+	}
+
+	listedKeys := []string{}
+	for _, info := range infos {
+		listedKeys = append(listedKeys, info.StorageKey)
+	}
+
+	if !reflect.DeepEqual(listedKeys, storageKeys[2:4]) {
+		t.Errorf("Expected listed storage keys to be %v, got %v", storageKeys[2:4], listedKeys)
+	}
+}
+
+func TestBoltCachedImagesRepository_HidesPendingCachedImageUntilItIsReady(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn := newTestingBoltConnection(t)
+	repo := NewCachedImagesRepository(conn)
+
+	info := CachedImageModel{RequestSignature: "signature", ProcessorType: "imaginary", ImageSize: -1, State: CachedImagePending}
+	if err := repo.CreateCachedImageInfo(ctx, info); err != nil {
+		t.Errorf("Error creating cached image info: %s", err)
+	}
+
+	if _, err := repo.GetCachedImageInfo(ctx, "signature", "imaginary"); err != ErrCachedImageNotFound {
+		t.Errorf("Expected ErrCachedImageNotFound error for pending entry, got: %v", err)
+	}
+
+	if err := repo.CreateCachedImageInfo(ctx, info); err != ErrCachedImageAlreadyExists {
+		t.Errorf("Expected ErrCachedImageAlreadyExists error for pending entry, got: %v", err)
+	}
+
+	if err := repo.MarkCachedImageReady(ctx, "signature", "imaginary", 5, "checksum"); err != nil {
+		t.Errorf("Error marking cached image ready: %s", err)
+	}
+
+	infoFromDB, err := repo.GetCachedImageInfo(ctx, "signature", "imaginary")
+	if err != nil || infoFromDB.State != CachedImageReady || infoFromDB.ImageSize != 5 || infoFromDB.Checksum != "checksum" {
+		t.Errorf("Expected ready entry of size 5 with checksum, got %+v, error: %v", infoFromDB, err)
+	}
+
+	if err := repo.MarkCachedImageReady(ctx, "unknown", "imaginary", 5, "checksum"); err != ErrCachedImageNotFound {
+		t.Errorf("Expected ErrCachedImageNotFound error, got: %v", err)
+	}
+}
+
+func TestBoltCachedImagesRepository_GetsAbandonedPendingCachedImages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn := newTestingBoltConnection(t)
+	repo := NewCachedImagesRepository(conn)
+
+	now := time.Now()
+	infos := []CachedImageModel{
+		{RequestSignature: "abandoned", ProcessorType: "imaginary", ImageSize: 1, State: CachedImagePending, CreatedAt: now.Add(-2 * time.Hour)},
+		{RequestSignature: "pending", ProcessorType: "imaginary", ImageSize: 1, State: CachedImagePending, CreatedAt: now},
+		{RequestSignature: "ready", ProcessorType: "imaginary", ImageSize: 1, State: CachedImageReady, CreatedAt: now.Add(-2 * time.Hour)},
+	}
+
+	for _, info := range infos {
+		if err := repo.CreateCachedImageInfo(ctx, info); err != nil {
+			t.Errorf("Error creating cached image info: %s", err)
+		}
+	}
+
+	abandoned, err := repo.GetPendingCachedImageInfos(ctx, now.Add(-time.Hour), 10)
+	if err != nil || len(abandoned) != 1 || abandoned[0].RequestSignature != "abandoned" {
+		t.Errorf("Expected only abandoned entry, got %v, error: %v", abandoned, err)
+	}
+
+	// images of pending entries are not saved yet
+	usage, err := repo.GetCachedImagesUsage(ctx, "")
+	if err != nil || usage != 1 {
+		t.Errorf("Expected usage of only ready entry, got %d, error: %v", usage, err)
+	}
+}
+
+func TestBoltCachedImagesRepository_SearchesCachedImagesPageByPage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	infos := []CachedImageModel{
+		{RequestSignature: "a", ProcessorType: "imaginary", SourceImageURL: "https://a.example.com/1.jpg", ImageSize: 300},
+		{RequestSignature: "b", ProcessorType: "imaginary", SourceImageURL: "https://a.example.com/2.jpg", ImageSize: 100},
+		{RequestSignature: "c", ProcessorType: "imaginary", SourceImageURL: "https://a.example.com/2.jpg", ImageSize: 300},
+		{RequestSignature: "d", ProcessorType: "imaginary", SourceImageURL: "https://b.example.com/1.jpg", ImageSize: 500},
+		{RequestSignature: "e", ProcessorType: "imaginary", SourceImageURL: "https://a.example.com/3.jpg", ImageSize: 50},
+		{RequestSignature: "f", ProcessorType: "imaginary", SourceImageURL: "https://a.example.com/4.jpg", ImageSize: 400, State: CachedImagePending},
+	}
+
+	conn := newTestingBoltConnection(t)
+	repo := NewCachedImagesRepository(conn)
+	for _, info := range infos {
+		if err := repo.CreateCachedImageInfo(ctx, info); err != nil {
+			t.Errorf("Error creating cached image info: %s", err)
+		}
+	}
+
+	query := CachedImagesQuery{SourceImageURLPrefix: "https://a.example.com/", MinImageSize: 100}
+	page := CachedImagesPage{SortBy: SortByImageSize, Descending: true, Limit: 2}
+
+	var signatures []string
+	for i := 0; i < 3; i++ {
+		found, err := repo.SearchCachedImageInfos(ctx, query, page)
+		if err != nil {
+			t.Fatalf("Error searching cached images: %s", err)
+		}
+
+		for _, info := range found {
+			signatures = append(signatures, info.RequestSignature)
+		}
+
+		if len(found) < page.Limit {
+			break
+		}
+
+		page.After = &found[len(found)-1]
+	}
+
+	if !reflect.DeepEqual(signatures, []string{"c", "a", "b"}) {
+		t.Errorf("Expected entries c, a and b, got %v", signatures)
+	}
+
+	found, err := repo.SearchCachedImageInfos(ctx, CachedImagesQuery{SourceImageURLPattern: "https://*.example.com/1.jpg"}, CachedImagesPage{Limit: 10})
+	if err != nil || len(found) != 2 || found[0].RequestSignature != "a" || found[1].RequestSignature != "d" {
+		t.Errorf("Expected entries a and d matching the pattern, got %v, error: %v", found, err)
+	}
+}
+
+func TestBoltCachedImagesRepository_ReturnsStatsOfCachedImageSources(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	infos := []CachedImageModel{
+		{RequestSignature: "a", ProcessorType: "imaginary", SourceImageURL: "https://a.example.com/1.jpg", ImageSize: 300},
+		{RequestSignature: "b", ProcessorType: "imaginary", SourceImageURL: "https://a.example.com/2.jpg", ImageSize: 100},
+		{RequestSignature: "c", ProcessorType: "imaginary", SourceImageURL: "https://a.example.com/2.jpg", ImageSize: 300},
+		{RequestSignature: "d", ProcessorType: "imaginary", SourceImageURL: "https://a.example.com/3.jpg", ImageSize: 50},
+		{RequestSignature: "e", ProcessorType: "imaginary", SourceImageURL: "https://b.example.com/1.jpg", ImageSize: 500},
+		{RequestSignature: "f", ProcessorType: "imaginary", SourceImageURL: "https://a.example.com/3.jpg", ImageSize: -1},
+	}
+
+	conn := newTestingBoltConnection(t)
+	repo := NewCachedImagesRepository(conn)
+	for _, info := range infos {
+		if err := repo.CreateCachedImageInfo(ctx, info); err != nil {
+			t.Errorf("Error creating cached image info: %s", err)
+		}
+	}
+
+	stats, err := repo.GetCachedImageSourcesStats(ctx, CachedImagesQuery{}, "https://a.example.com/1.jpg", 2)
+	if err != nil {
+		t.Fatalf("Error getting stats of cached image sources: %s", err)
+	}
+
+	expectedStats := []CachedImageSourceStats{
+		{SourceImageURL: "https://a.example.com/2.jpg", Images: 2, Bytes: 400},
+		{SourceImageURL: "https://a.example.com/3.jpg", Images: 1, Bytes: 50},
+	}
+
+	if !reflect.DeepEqual(stats, expectedStats) {
+		t.Errorf("Expected stats %v, got %v", expectedStats, stats)
+	}
+}
+
+func TestBoltCachedImagesRepository_ReturnsAllCachedImageInfosOfGivenURLPrefix(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	infos := []CachedImageModel{
+		{RequestSignature: "a", ProcessorType: "imaginary", SourceImageURL: "https://example.com/products_2021/a.jpg"},
+		{RequestSignature: "b", ProcessorType: "imaginary", SourceImageURL: "https://example.com/products_2021/b.jpg", State: CachedImagePending},
+		{RequestSignature: "c", ProcessorType: "imaginary", SourceImageURL: "https://example.com/productsX2021/c.jpg"},
+		{RequestSignature: "d", ProcessorType: "imaginary", SourceImageURL: "https://example.com/d.jpg"},
+	}
+
+	conn := newTestingBoltConnection(t)
+	repo := NewCachedImagesRepository(conn)
+	for _, info := range infos {
+		if err := repo.CreateCachedImageInfo(ctx, info); err != nil {
+			t.Errorf("Error creating cached image info: %s", err)
+		}
+	}
+
+	signatures := []string{}
+	err := repo.WalkCachedImageInfosOfSourcePrefix(ctx, "https://example.com/products_2021/", func(info CachedImageModel) error {
+		signatures = append(signatures, info.RequestSignature)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Error walking cached image infos: %s", err)
+	}
+
+	sort.Strings(signatures)
+	if !reflect.DeepEqual(signatures, []string{"a", "b"}) {
+		t.Errorf("Expected entries a and b, got %v", signatures)
+	}
+
+	errStop := errors.New("stop")
+	walked := 0
+	err = repo.WalkCachedImageInfosOfSourcePrefix(ctx, "", func(info CachedImageModel) error {
+		walked++
+		return errStop
+	})
+
+	if err != errStop || walked != 1 {
+		t.Errorf("Expected walk to stop on the first error, got: %v after %d entries", err, walked)
+	}
+}
@@ -0,0 +1,136 @@
+package cacherepositories
+
+import (
+	"context"
+	"io/ioutil"
+
+	dbconnections "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/connections"
+	"github.com/thebartekbanach/imcaxy/pkg/hub"
+	"go.etcd.io/bbolt"
+)
+
+// boltImagesStorage keeps data of images in the embedded database under their storage keys,
+// mime type is not kept, because it is always read from the image metadata
+type boltImagesStorage struct {
+	conn dbconnections.BoltCacheDBConnection
+}
+
+var _ CachedImagesStorage = (*boltImagesStorage)(nil)
+
+const boltWalkBatchSize = 1000
+
+func NewBoltImagesStorage(conn dbconnections.BoltCacheDBConnection) CachedImagesStorage {
+	return &boltImagesStorage{conn}
+}
+
+func (s *boltImagesStorage) Save(ctx context.Context, requestSignature, processorType, mimeType string, size int64, checksum string, reader hub.DataStreamOutput) error {
+	defer reader.Close()
+
+	key := []byte(StorageKey(requestSignature, processorType))
+	exists := false
+	s.conn.DB().View(func(tx *bbolt.Tx) error {
+		exists = tx.Bucket(boltImagesBucket).Get(key) != nil
+		return nil
+	})
+
+	if exists {
+		return ErrImageAlreadyExists
+	}
+
+	// whole image is read before the write transaction, which blocks other writers
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	return s.conn.DB().Update(func(tx *bbolt.Tx) error {
+		images := tx.Bucket(boltImagesBucket)
+		if images.Get(key) != nil {
+			return ErrImageAlreadyExists
+		}
+
+		return images.Put(key, data)
+	})
+}
+
+func (s *boltImagesStorage) Get(ctx context.Context, requestSignature, processorType, checksum string, writer hub.DataStreamInput) error {
+	var data []byte
+	err := s.conn.DB().View(func(tx *bbolt.Tx) error {
+		value := tx.Bucket(boltImagesBucket).Get([]byte(StorageKey(requestSignature, processorType)))
+		if value == nil {
+			return ErrImageNotFound
+		}
+
+		// value is valid only until the end of the transaction
+		data = append([]byte(nil), value...)
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		_, err := writer.Write(data)
+		writer.Close(err)
+	}()
+
+	return nil
+}
+
+// SetChecksum does nothing, because checksums are kept only in entries of the embedded database
+func (s *boltImagesStorage) SetChecksum(ctx context.Context, requestSignature, processorType, checksum string) error {
+	return nil
+}
+
+func (s *boltImagesStorage) Delete(ctx context.Context, requestSignature, processorType string) error {
+	return s.DeleteStorageKey(ctx, StorageKey(requestSignature, processorType))
+}
+
+// WalkStorageKeys reads keys in batches, so walkFn can use the database
+// without waiting for the read transaction to end
+func (s *boltImagesStorage) WalkStorageKeys(ctx context.Context, walkFn func(storageKey string, size int64) error) error {
+	from := []byte{}
+	for {
+		var keys []string
+		var sizes []int64
+		s.conn.DB().View(func(tx *bbolt.Tx) error {
+			cursor := tx.Bucket(boltImagesBucket).Cursor()
+			for key, value := cursor.Seek(from); key != nil && len(keys) < boltWalkBatchSize; key, value = cursor.Next() {
+				keys = append(keys, string(key))
+				sizes = append(sizes, int64(len(value)))
+			}
+
+			return nil
+		})
+
+		for i, key := range keys {
+			if err := walkFn(key, sizes[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(keys) < boltWalkBatchSize {
+			return nil
+		}
+
+		// the smallest key greater than the last walked one
+		from = append([]byte(keys[len(keys)-1]), 0)
+	}
+}
+
+func (s *boltImagesStorage) DeleteStorageKey(ctx context.Context, storageKey string) error {
+	return s.conn.DB().Update(func(tx *bbolt.Tx) error {
+		images := tx.Bucket(boltImagesBucket)
+		if images.Get([]byte(storageKey)) == nil {
+			return ErrImageNotFound
+		}
+
+		return images.Delete([]byte(storageKey))
+	})
+}
+
+// MigrateLegacyObjects does nothing, because images were never saved under legacy keys in the embedded database
+func (s *boltImagesStorage) MigrateLegacyObjects(ctx context.Context, onMigrated func(requestSignature, processorType, storageKey string) error) (int, error) {
+	return 0, nil
+}
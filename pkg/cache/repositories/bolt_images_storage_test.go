@@ -0,0 +1,97 @@
+package cacherepositories
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	dbconnections "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/connections"
+	mock_hub "github.com/thebartekbanach/imcaxy/pkg/hub/mocks"
+)
+
+func newTestingBoltConnection(t *testing.T) dbconnections.BoltCacheDBConnection {
+	conn := dbconnections.NewBoltCacheDBTestingConnection(t)
+	if err := CreateBoltCacheDBBuckets(conn); err != nil {
+		t.Fatalf("Error creating buckets of testing database: %s", err)
+	}
+
+	return conn
+}
+
+func TestBoltImagesStorage_SavesAndGetsImage(t *testing.T) {
+	storage := NewBoltImagesStorage(newTestingBoltConnection(t))
+
+	saveInStorage(t, storage, "saved", []byte("saved data"))
+	if data := getFromStorage(t, storage, "saved"); !bytes.Equal(data, []byte("saved data")) {
+		t.Errorf("Expected saved image, got %s", data)
+	}
+}
+
+func TestBoltImagesStorage_SavesImageOfUnknownSize(t *testing.T) {
+	storage := NewBoltImagesStorage(newTestingBoltConnection(t))
+
+	output := mock_hub.NewMockTestingDataStreamOutput(t, [][]byte{{0x1, 0x2}, {0x3}}, nil, nil)
+	if err := storage.Save(context.Background(), "unknown-size", "imaginary", "image/png", -1, "", &output); err != nil {
+		t.Fatal(err)
+	}
+
+	if data := getFromStorage(t, storage, "unknown-size"); !bytes.Equal(data, []byte{0x1, 0x2, 0x3}) {
+		t.Errorf("Expected saved image, got %v", data)
+	}
+}
+
+func TestBoltImagesStorage_ReturnsErrorWhenImageAlreadyExists(t *testing.T) {
+	storage := NewBoltImagesStorage(newTestingBoltConnection(t))
+
+	saveInStorage(t, storage, "saved", []byte("saved data"))
+
+	output := mock_hub.NewMockTestingDataStreamOutputUsingSingleChunkOfData(t, []byte("other data"), nil, nil)
+	if err := storage.Save(context.Background(), "saved", "imaginary", "image/jpeg", 10, "", &output); err != ErrImageAlreadyExists {
+		t.Errorf("Expected ErrImageAlreadyExists error, got: %v", err)
+	}
+
+	if data := getFromStorage(t, storage, "saved"); !bytes.Equal(data, []byte("saved data")) {
+		t.Errorf("Expected the first saved image, got %s", data)
+	}
+}
+
+func TestBoltImagesStorage_DeletesImage(t *testing.T) {
+	storage := NewBoltImagesStorage(newTestingBoltConnection(t))
+
+	saveInStorage(t, storage, "deleted", []byte("deleted data"))
+	if err := storage.Delete(context.Background(), "deleted", "imaginary"); err != nil {
+		t.Fatal(err)
+	}
+
+	input := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+	if err := storage.Get(context.Background(), "deleted", "imaginary", "", &input); err != ErrImageNotFound {
+		t.Errorf("Expected ErrImageNotFound error, got: %v", err)
+	}
+
+	if err := storage.Delete(context.Background(), "deleted", "imaginary"); err != ErrImageNotFound {
+		t.Errorf("Expected ErrImageNotFound error, got: %v", err)
+	}
+}
+
+func TestBoltImagesStorage_WalksStorageKeysInOrder(t *testing.T) {
+	storage := NewBoltImagesStorage(newTestingBoltConnection(t))
+
+	storageKeys := []string{}
+	for _, signature := range []string{"first", "second", "third"} {
+		saveInStorage(t, storage, signature, []byte(signature))
+		storageKeys = append(storageKeys, StorageKey(signature, "imaginary"))
+	}
+	sort.Strings(storageKeys)
+
+	walkedKeys := []string{}
+	err := storage.WalkStorageKeys(context.Background(), func(storageKey string, size int64) error {
+		walkedKeys = append(walkedKeys, storageKey)
+		return nil
+	})
+
+	if err != nil || !reflect.DeepEqual(walkedKeys, storageKeys) {
+		t.Errorf("Expected walked storage keys to be %v, got %v, error: %v", storageKeys, walkedKeys, err)
+	}
+}
@@ -0,0 +1,77 @@
+package cacherepositories
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+
+	dbconnections "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/connections"
+	"go.etcd.io/bbolt"
+)
+
+// boltInvalidationsRepository keeps invalidations of every project in its own
+// bucket, ordered by invalidation date and then by order of creation
+type boltInvalidationsRepository struct {
+	conn dbconnections.BoltCacheDBConnection
+}
+
+var _ InvalidationsRepository = (*boltInvalidationsRepository)(nil)
+
+func (r *boltInvalidationsRepository) CreateInvalidation(ctx context.Context, invalidation InvalidationModel) error {
+	if invalidation.ProjectName == "" {
+		return ErrProjectNameNotAllowed
+	}
+
+	if invalidation.CommitHash == "" {
+		return ErrCommitHashNotAllowed
+	}
+
+	value, err := json.Marshal(invalidation)
+	if err != nil {
+		return err
+	}
+
+	return r.conn.DB().Update(func(tx *bbolt.Tx) error {
+		project, err := tx.Bucket(boltInvalidationsBucket).CreateBucketIfNotExists([]byte(invalidation.ProjectName))
+		if err != nil {
+			return err
+		}
+
+		sequence, err := project.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		var sequenceKey [8]byte
+		binary.BigEndian.PutUint64(sequenceKey[:], sequence)
+
+		return project.Put(boltTimeKey(invalidation.InvalidationDate, sequenceKey[:]), value)
+	})
+}
+
+func (r *boltInvalidationsRepository) GetLatestInvalidation(ctx context.Context, projectName string) (InvalidationModel, error) {
+	if projectName == "" {
+		return InvalidationModel{}, ErrProjectNameNotAllowed
+	}
+
+	var invalidation InvalidationModel
+	err := r.conn.DB().View(func(tx *bbolt.Tx) error {
+		project := tx.Bucket(boltInvalidationsBucket).Bucket([]byte(projectName))
+		if project == nil {
+			return ErrProjectNotFound
+		}
+
+		_, value := project.Cursor().Last()
+		if value == nil {
+			return ErrProjectNotFound
+		}
+
+		return json.Unmarshal(value, &invalidation)
+	})
+
+	if err != nil {
+		return InvalidationModel{}, err
+	}
+
+	return invalidation, nil
+}
@@ -0,0 +1,77 @@
+package cacherepositories
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBoltInvalidationsRepository_ReturnsLatestInvalidationWithAllFields(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Now().Truncate(time.Microsecond)
+	info1 := createSuccessfullInvalidationModel("project", "abcdef", now, []string{
+		"http://google.com/image1.jpg",
+	})
+
+	invalidationError := "cannot invalidate image3.jpg"
+	info2 := createInvalidationModel("project", "ghijkl", now.Add(time.Minute), []string{
+		"http://google.com/image2.jpg",
+		"http://google.com/image3.jpg",
+	}, []string{
+		"http://google.com/image2.jpg",
+	})
+	info2.DoneInvalidations = []string{"http://google.com/image2.jpg"}
+	info2.InvalidationError = &invalidationError
+	info2.PatternMatches = []InvalidationPatternMatch{
+		{Type: ExactURLPattern, Pattern: "http://google.com/image2.jpg", MatchedImages: []string{StorageKey("image2", "imaginary")}, MatchedImagesCount: 1},
+	}
+
+	otherProjectInfo := createSuccessfullInvalidationModel("other-project", "mnopqr", now.Add(time.Hour), nil)
+
+	repo := NewInvalidationsRepository(newTestingBoltConnection(t))
+	for _, info := range []InvalidationModel{info1, info2, otherProjectInfo} {
+		if err := repo.CreateInvalidation(ctx, info); err != nil {
+			t.Errorf("Unexpected error when creating invalidation entry: %v", err)
+		}
+	}
+
+	invalidation, err := repo.GetLatestInvalidation(ctx, "project")
+	if err != nil {
+		t.Errorf("Unexpected error when getting latest invalidation: %v", err)
+	}
+
+	if !invalidation.InvalidationDate.Equal(info2.InvalidationDate) {
+		t.Errorf("Expected invalidation date to be %v, got %v", info2.InvalidationDate, invalidation.InvalidationDate)
+	}
+
+	invalidation.InvalidationDate = info2.InvalidationDate
+	if !reflect.DeepEqual(invalidation, info2) {
+		t.Errorf("Invalidation is not the same as the last one created: \n%+v \n!= \n%+v", info2, invalidation)
+	}
+}
+
+func TestBoltInvalidationsRepository_ReturnsErrorsOfInvalidProjects(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo := NewInvalidationsRepository(newTestingBoltConnection(t))
+
+	if err := repo.CreateInvalidation(ctx, createSuccessfullInvalidationModel("project", "", time.Now(), nil)); err != ErrCommitHashNotAllowed {
+		t.Errorf("Expected to return ErrCommitHashNotAllowed, got: %v", err)
+	}
+
+	if err := repo.CreateInvalidation(ctx, createSuccessfullInvalidationModel("", "abcdef", time.Now(), nil)); err != ErrProjectNameNotAllowed {
+		t.Errorf("Expected to return ErrProjectNameNotAllowed, got: %v", err)
+	}
+
+	if _, err := repo.GetLatestInvalidation(ctx, ""); err != ErrProjectNameNotAllowed {
+		t.Errorf("Expected to return ErrProjectNameNotAllowed, got: %v", err)
+	}
+
+	if _, err := repo.GetLatestInvalidation(ctx, "project"); err != ErrProjectNotFound {
+		t.Errorf("Expected ErrProjectNotFound to be returned, got: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package cacherepositories
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ryanuber/go-glob"
+)
+
+// CachedImagesQuery selects ready entries, its empty fields match all entries
+type CachedImagesQuery struct {
+	SourceImageURL       string
+	SourceImageURLPrefix string
+	// SourceImageURLPattern is glob pattern, where * matches any sequence of characters
+	SourceImageURLPattern string
+	ProcessorType         string
+	ProcessorEndpoint     string
+	MimeType              string
+
+	MinImageSize int64
+	// MaxImageSize of zero does not limit the size
+	MaxImageSize int64
+
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+func (q CachedImagesQuery) matches(info CachedImageModel) bool {
+	return (q.SourceImageURL == "" || info.SourceImageURL == q.SourceImageURL) &&
+		strings.HasPrefix(info.SourceImageURL, q.SourceImageURLPrefix) &&
+		(q.SourceImageURLPattern == "" || glob.Glob(q.SourceImageURLPattern, info.SourceImageURL)) &&
+		(q.ProcessorType == "" || info.ProcessorType == q.ProcessorType) &&
+		(q.ProcessorEndpoint == "" || info.ProcessorEndpoint == q.ProcessorEndpoint) &&
+		(q.MimeType == "" || info.MimeType == q.MimeType) &&
+		info.ImageSize >= q.MinImageSize &&
+		(q.MaxImageSize == 0 || info.ImageSize <= q.MaxImageSize) &&
+		(q.CreatedAfter.IsZero() || !info.CreatedAt.Before(q.CreatedAfter)) &&
+		(q.CreatedBefore.IsZero() || info.CreatedAt.Before(q.CreatedBefore))
+}
+
+type CachedImagesSortField string
+
+const (
+	SortByCreatedAt      CachedImagesSortField = "createdAt"
+	SortByImageSize      CachedImagesSortField = "imageSize"
+	SortBySourceImageURL CachedImagesSortField = "sourceImageURL"
+)
+
+// CachedImagesPage selects the page of entries, which are ordered by the sort field
+// and then by request signature and processor type, so entries of the same value
+// of the sort field are never skipped between pages
+type CachedImagesPage struct {
+	// SortBy defaults to SortByCreatedAt
+	SortBy     CachedImagesSortField
+	Descending bool
+	// After is the last entry of the previous page, nil for the first page
+	After *CachedImageModel
+	Limit int
+}
+
+// sortValue returns value of the sort field of the entry
+func (f CachedImagesSortField) sortValue(info CachedImageModel) interface{} {
+	switch f {
+	case SortByImageSize:
+		return info.ImageSize
+	case SortBySourceImageURL:
+		return info.SourceImageURL
+	}
+
+	return info.CreatedAt
+}
+
+// compare orders entries by the sort field, request signature and processor type
+func (f CachedImagesSortField) compare(a, b CachedImageModel) int {
+	result := 0
+	switch f {
+	case SortByImageSize:
+		result = compareInt64(a.ImageSize, b.ImageSize)
+	case SortBySourceImageURL:
+		result = strings.Compare(a.SourceImageURL, b.SourceImageURL)
+	default:
+		result = compareInt64(a.CreatedAt.UnixNano(), b.CreatedAt.UnixNano())
+	}
+
+	if result == 0 {
+		result = strings.Compare(a.RequestSignature, b.RequestSignature)
+	}
+
+	if result == 0 {
+		result = strings.Compare(a.ProcessorType, b.ProcessorType)
+	}
+
+	return result
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+// CachedImageSourceStats sums ready images of the source image
+type CachedImageSourceStats struct {
+	SourceImageURL string `json:"sourceImageURL" bson:"_id"`
+	Images         int64  `json:"images" bson:"images"`
+	Bytes          int64  `json:"bytes" bson:"bytes"`
+}
@@ -0,0 +1,48 @@
+package dbconnections
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+type BoltCacheDBConfig struct {
+	Path string
+}
+
+type BoltCacheDBProductionConnection struct {
+	config BoltCacheDBConfig
+	db     *bbolt.DB
+}
+
+var _ BoltCacheDBConnection = (*BoltCacheDBProductionConnection)(nil)
+
+// NewBoltCacheDBProductionConnection opens the database file, which can be
+// opened only once at a time, so the connection has to be shared by all users
+func NewBoltCacheDBProductionConnection(config BoltCacheDBConfig) (BoltCacheDBConnection, error) {
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0755); err != nil {
+		return nil, err
+	}
+
+	// opening the file used by other process fails instead of waiting forever
+	db, err := bbolt.Open(config.Path, 0644, &bbolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	return &BoltCacheDBProductionConnection{
+		config: config,
+		db:     db,
+	}, nil
+}
+
+func (c *BoltCacheDBProductionConnection) DB() *bbolt.DB {
+	return c.db
+}
+
+func (c *BoltCacheDBProductionConnection) Close(ctx context.Context) error {
+	return c.db.Close()
+}
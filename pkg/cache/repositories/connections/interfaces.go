@@ -2,19 +2,51 @@ package dbconnections
 
 import (
 	"context"
+	"database/sql"
 	"io"
 
 	"github.com/minio/minio-go/v7"
+	"go.etcd.io/bbolt"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// CacheDBConnection is a connection to the database keeping metadata of cached images,
+// repositories choose their implementation by the kind of the connection
 type CacheDBConnection interface {
+	Close(ctx context.Context) error
+}
+
+type MongoCacheDBConnection interface {
+	CacheDBConnection
 	Collection(collectionName string) *mongo.Collection
 }
 
+type SQLCacheDBConnection interface {
+	CacheDBConnection
+	DB() *sql.DB
+	Dialect() SQLDialect
+}
+
+// BoltCacheDBConnection is a connection to the embedded database,
+// which keeps both metadata and data of cached images
+type BoltCacheDBConnection interface {
+	CacheDBConnection
+	DB() *bbolt.DB
+}
+
 type MinioBlockStorageConnection interface {
 	GetObject(ctx context.Context, objectName string) (*minio.Object, error)
-	PutObject(ctx context.Context, objectName string, objectSize int64, mimeType string, reader io.Reader) error
+	// PutObject uploads object in multiple parts when objectSize is negative,
+	// non-empty checksum is saved in object metadata under ChecksumMetadataKey
+	PutObject(ctx context.Context, objectName string, objectSize int64, mimeType, checksum string, reader io.Reader) error
 	DeleteObject(ctx context.Context, objectName string) error
 	ObjectExists(ctx context.Context, objectName string) (exists bool, err error)
+	CopyObject(ctx context.Context, sourceObjectName, destinationObjectName string) error
+	// SetObjectChecksum saves checksum in metadata of already uploaded object under ChecksumMetadataKey
+	SetObjectChecksum(ctx context.Context, objectName, checksum string) error
+	// WalkObjects calls walkFn with names of objects placed directly under the prefix,
+	// objects placed under nested prefixes are skipped
+	WalkObjects(ctx context.Context, prefix string, walkFn func(objectName string) error) error
+	// WalkAllObjects calls walkFn with names and sizes of all objects in order of their names
+	WalkAllObjects(ctx context.Context, walkFn func(objectName string, size int64) error) error
 }
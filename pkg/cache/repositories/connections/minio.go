@@ -3,11 +3,18 @@ package dbconnections
 import (
 	"context"
 	"io"
+	"strings"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
+const minimalMultipartPartSize = 5 * 1024 * 1024
+
+// ChecksumMetadataKey is the user metadata key of the SHA-256 checksum of the object,
+// it is returned in X-Amz-Meta-Sha256 header, so objects can be verified by other tools too
+const ChecksumMetadataKey = "Sha256"
+
 type MinioBlockStorageProductionConnectionConfig struct {
 	Endpoint  string
 	AccessKey string
@@ -60,15 +67,27 @@ func (c *MinioBlockStorageProductionConnection) PutObject(
 	objectName string,
 	objectSize int64,
 	mimeType string,
+	checksum string,
 	reader io.Reader,
 ) error {
+	options := minio.PutObjectOptions{ContentType: mimeType}
+	if checksum != "" {
+		options.UserMetadata = map[string]string{ChecksumMetadataKey: checksum}
+	}
+
+	if objectSize < 0 {
+		// objects of unknown size are uploaded in multiple parts,
+		// every part is buffered in memory, so use the smallest allowed one
+		options.PartSize = minimalMultipartPartSize
+	}
+
 	_, err := c.client.PutObject(
 		ctx,
 		c.config.Bucket,
 		objectName,
 		reader,
 		objectSize,
-		minio.PutObjectOptions{ContentType: mimeType},
+		options,
 	)
 	return err
 }
@@ -87,3 +106,75 @@ func (c *MinioBlockStorageProductionConnection) ObjectExists(ctx context.Context
 	}
 	return true, nil
 }
+
+func (c *MinioBlockStorageProductionConnection) CopyObject(ctx context.Context, sourceObjectName, destinationObjectName string) error {
+	_, err := c.client.CopyObject(
+		ctx,
+		minio.CopyDestOptions{Bucket: c.config.Bucket, Object: destinationObjectName},
+		minio.CopySrcOptions{Bucket: c.config.Bucket, Object: sourceObjectName},
+	)
+	return err
+}
+
+// metadata of the object can be changed only by copying the object onto itself,
+// replaced metadata includes content type, so it is copied from the object
+func (c *MinioBlockStorageProductionConnection) SetObjectChecksum(ctx context.Context, objectName, checksum string) error {
+	info, err := c.client.StatObject(ctx, c.config.Bucket, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		return err
+	}
+
+	userMetadata := map[string]string{"Content-Type": info.ContentType}
+	for key, value := range info.UserMetadata {
+		userMetadata[key] = value
+	}
+	userMetadata[ChecksumMetadataKey] = checksum
+
+	_, err = c.client.CopyObject(
+		ctx,
+		minio.CopyDestOptions{Bucket: c.config.Bucket, Object: objectName, UserMetadata: userMetadata, ReplaceMetadata: true},
+		minio.CopySrcOptions{Bucket: c.config.Bucket, Object: objectName},
+	)
+	return err
+}
+
+func (c *MinioBlockStorageProductionConnection) WalkObjects(ctx context.Context, prefix string, walkFn func(objectName string) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	objects := c.client.ListObjects(ctx, c.config.Bucket, minio.ListObjectsOptions{Prefix: prefix})
+	for object := range objects {
+		if object.Err != nil {
+			return object.Err
+		}
+
+		// nested prefixes are listed as objects with trailing slash
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+
+		if err := walkFn(object.Key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *MinioBlockStorageProductionConnection) WalkAllObjects(ctx context.Context, walkFn func(objectName string, size int64) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	objects := c.client.ListObjects(ctx, c.config.Bucket, minio.ListObjectsOptions{Recursive: true})
+	for object := range objects {
+		if object.Err != nil {
+			return object.Err
+		}
+
+		if err := walkFn(object.Key, object.Size); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
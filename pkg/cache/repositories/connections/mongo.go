@@ -16,9 +16,9 @@ type CacheDBProductionConnection struct {
 	client *mongo.Client
 }
 
-var _ CacheDBConnection = (*CacheDBProductionConnection)(nil)
+var _ MongoCacheDBConnection = (*CacheDBProductionConnection)(nil)
 
-func NewCacheDBProductionConnection(ctx context.Context, config CacheDBConfig) (CacheDBConnection, error) {
+func NewCacheDBProductionConnection(ctx context.Context, config CacheDBConfig) (MongoCacheDBConnection, error) {
 	client, err := mongo.NewClient(options.Client().ApplyURI(config.ConnectionString))
 	if err != nil {
 		return nil, err
@@ -38,3 +38,7 @@ func NewCacheDBProductionConnection(ctx context.Context, config CacheDBConfig) (
 func (c *CacheDBProductionConnection) Collection(collectionName string) *mongo.Collection {
 	return c.client.Database("imcaxy").Collection(collectionName)
 }
+
+func (c *CacheDBProductionConnection) Close(ctx context.Context) error {
+	return c.client.Disconnect(ctx)
+}
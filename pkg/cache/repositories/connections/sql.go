@@ -0,0 +1,64 @@
+package dbconnections
+
+import (
+	"context"
+	"database/sql"
+
+	// drivers are registered under names of the dialects
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type SQLDialect string
+
+const (
+	PostgresDialect SQLDialect = "postgres"
+	SQLiteDialect   SQLDialect = "sqlite3"
+)
+
+type SQLCacheDBConfig struct {
+	Dialect          SQLDialect
+	ConnectionString string
+}
+
+type SQLCacheDBProductionConnection struct {
+	config SQLCacheDBConfig
+	db     *sql.DB
+}
+
+var _ SQLCacheDBConnection = (*SQLCacheDBProductionConnection)(nil)
+
+func NewSQLCacheDBProductionConnection(ctx context.Context, config SQLCacheDBConfig) (SQLCacheDBConnection, error) {
+	db, err := sql.Open(string(config.Dialect), config.ConnectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows only one writer at a time, so concurrent
+	// writes on many connections would fail with locked database
+	if config.Dialect == SQLiteDialect {
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLCacheDBProductionConnection{
+		config: config,
+		db:     db,
+	}, nil
+}
+
+func (c *SQLCacheDBProductionConnection) DB() *sql.DB {
+	return c.db
+}
+
+func (c *SQLCacheDBProductionConnection) Dialect() SQLDialect {
+	return c.config.Dialect
+}
+
+func (c *SQLCacheDBProductionConnection) Close(ctx context.Context) error {
+	return c.db.Close()
+}
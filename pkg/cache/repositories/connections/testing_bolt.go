@@ -0,0 +1,21 @@
+package dbconnections
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// NewBoltCacheDBTestingConnection opens the database placed
+// in the temporary directory removed after the test
+func NewBoltCacheDBTestingConnection(t *testing.T) BoltCacheDBConnection {
+	conn, err := NewBoltCacheDBProductionConnection(BoltCacheDBConfig{
+		Path: filepath.Join(t.TempDir(), "cache.db"),
+	})
+	if err != nil {
+		panic("Cannot open bolt database: " + err.Error())
+	}
+
+	t.Cleanup(func() { conn.Close(context.Background()) })
+	return conn
+}
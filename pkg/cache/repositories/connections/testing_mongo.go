@@ -16,7 +16,7 @@ type CacheDBTestingConnection struct {
 	client     *mongo.Client
 }
 
-var _ CacheDBConnection = (*CacheDBTestingConnection)(nil)
+var _ MongoCacheDBConnection = (*CacheDBTestingConnection)(nil)
 
 func NewCacheDBTestingConnection(t *testing.T) *CacheDBTestingConnection {
 	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(os.Getenv("IMCAXY_MONGO_CONNECTION_STRING")))
@@ -35,6 +35,10 @@ func (c *CacheDBTestingConnection) Collection(name string) *mongo.Collection {
 	return c.client.Database(c.testDBName).Collection(name)
 }
 
+func (c *CacheDBTestingConnection) Close(ctx context.Context) error {
+	return c.client.Disconnect(ctx)
+}
+
 func (c *CacheDBTestingConnection) Cleanup() {
 	ctx := context.Background()
 	err := c.client.Database(c.testDBName).Drop(ctx)
@@ -0,0 +1,22 @@
+package dbconnections
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// NewSQLCacheDBTestingConnection connects to the SQLite database
+// placed in the temporary directory removed after the test
+func NewSQLCacheDBTestingConnection(t *testing.T) SQLCacheDBConnection {
+	conn, err := NewSQLCacheDBProductionConnection(context.Background(), SQLCacheDBConfig{
+		Dialect:          SQLiteDialect,
+		ConnectionString: filepath.Join(t.TempDir(), "cache.db"),
+	})
+	if err != nil {
+		panic("Cannot connect to sqlite database: " + err.Error())
+	}
+
+	t.Cleanup(func() { conn.Close(context.Background()) })
+	return conn
+}
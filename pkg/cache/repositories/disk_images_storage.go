@@ -0,0 +1,531 @@
+package cacherepositories
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thebartekbanach/imcaxy/pkg/hub"
+	"github.com/thebartekbanach/imcaxy/pkg/metrics"
+)
+
+type DiskImagesStorageConfig struct {
+	// Directory in which images are kept, empty directory disables the disk tier.
+	Directory string
+
+	// MaxSize is total size of files kept in the directory.
+	MaxSize int64
+}
+
+// diskImagesStorage keeps recently used images on the local disk
+// in front of other storage, which remains the source of truth
+type diskImagesStorage struct {
+	config DiskImagesStorageConfig
+	next   CachedImagesStorage
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	size    int64
+}
+
+type diskEntry struct {
+	key  string
+	size int64
+}
+
+var _ CachedImagesStorage = (*diskImagesStorage)(nil)
+
+// every file starts with the magic followed by sha256 checksum of the image
+var diskEntryMagic = []byte("IMCAXY01")
+
+const diskEntryHeaderSize = 8 + sha256.Size
+
+// NewDiskImagesStorage scans the directory to rebuild the index of saved images,
+// so images saved before restart are served from the disk too
+func NewDiskImagesStorage(config DiskImagesStorageConfig, next CachedImagesStorage) (CachedImagesStorage, error) {
+	s := &diskImagesStorage{
+		config:  config,
+		next:    next,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+
+	if err := os.MkdirAll(config.Directory, 0755); err != nil {
+		return nil, err
+	}
+
+	if err := s.scan(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *diskImagesStorage) Save(ctx context.Context, requestSignature, processorType, mimeType string, size int64, checksum string, reader hub.DataStreamOutput) error {
+	defer reader.Close()
+
+	// saved image is read again from the stream, so it can not be closed by next storage
+	if err := s.next.Save(ctx, requestSignature, processorType, mimeType, size, checksum, unclosableStreamOutput{reader}); err != nil {
+		return err
+	}
+
+	if size > s.config.MaxSize {
+		return nil
+	}
+
+	writer, err := s.createEntryWriter(StorageKey(requestSignature, processorType))
+	if err != nil {
+		log.Printf("failed to create disk cache entry: %s", err)
+		return nil
+	}
+
+	if _, err := io.Copy(writer, io.NewSectionReader(reader, 0, math.MaxInt64)); err != nil {
+		writer.abort()
+		return nil
+	}
+
+	if err := writer.commit(); err != nil {
+		log.Printf("failed to save disk cache entry: %s", err)
+	}
+
+	return nil
+}
+
+func (s *diskImagesStorage) Get(ctx context.Context, requestSignature, processorType, checksum string, writer hub.DataStreamInput) error {
+	key := StorageKey(requestSignature, processorType)
+	if s.getFromDisk(key, checksum, writer) {
+		metrics.Add("cache_disk_hits", 1)
+		return nil
+	}
+
+	metrics.Add("cache_disk_misses", 1)
+
+	entryWriter, err := s.createEntryWriter(key)
+	if err != nil {
+		log.Printf("failed to create disk cache entry: %s", err)
+		return s.next.Get(ctx, requestSignature, processorType, checksum, writer)
+	}
+
+	err = s.next.Get(ctx, requestSignature, processorType, checksum, &diskTierInput{writer, entryWriter})
+	if err != nil && err != io.EOF {
+		entryWriter.abort()
+	}
+
+	return err
+}
+
+// SetChecksum sets checksum only in the next storage, disk
+// entries keep checksums computed when they are written
+func (s *diskImagesStorage) SetChecksum(ctx context.Context, requestSignature, processorType, checksum string) error {
+	return s.next.SetChecksum(ctx, requestSignature, processorType, checksum)
+}
+
+func (s *diskImagesStorage) Delete(ctx context.Context, requestSignature, processorType string) error {
+	s.lock.Lock()
+	s.remove(StorageKey(requestSignature, processorType))
+	s.reportUsage()
+	s.lock.Unlock()
+
+	return s.next.Delete(ctx, requestSignature, processorType)
+}
+
+// WalkStorageKeys walks the next storage, disk keeps only some of its images
+func (s *diskImagesStorage) WalkStorageKeys(ctx context.Context, walkFn func(storageKey string, size int64) error) error {
+	return s.next.WalkStorageKeys(ctx, walkFn)
+}
+
+func (s *diskImagesStorage) DeleteStorageKey(ctx context.Context, storageKey string) error {
+	s.lock.Lock()
+	s.remove(storageKey)
+	s.reportUsage()
+	s.lock.Unlock()
+
+	return s.next.DeleteStorageKey(ctx, storageKey)
+}
+
+// MigrateLegacyObjects migrates only the next storage, disk always uses hashed keys
+func (s *diskImagesStorage) MigrateLegacyObjects(ctx context.Context, onMigrated func(requestSignature, processorType, storageKey string) error) (int, error) {
+	return s.next.MigrateLegacyObjects(ctx, onMigrated)
+}
+
+// returns: image found and written to the stream
+func (s *diskImagesStorage) getFromDisk(key, checksum string, writer hub.DataStreamInput) bool {
+	s.lock.Lock()
+	_, exists := s.entries[key]
+	s.lock.Unlock()
+
+	if !exists {
+		return false
+	}
+
+	file, err := os.Open(s.makePath(key))
+	if err != nil {
+		s.forget(key)
+		return false
+	}
+
+	// checksum is verified before anything is written to the stream,
+	// so corrupted image can still be served from the next storage
+	if err := s.verify(file, checksum); err != nil {
+		file.Close()
+		s.forget(key)
+
+		// image of the entry saved again, for example after restart, is read from the next storage
+		if err == errStaleDiskEntry {
+			metrics.Add("cache_disk_stale_entries", 1)
+			return false
+		}
+
+		log.Printf("removing corrupted disk cache entry %s: %s", key, err)
+		metrics.Add("cache_disk_corrupted_entries", 1)
+		return false
+	}
+
+	if _, err := file.Seek(diskEntryHeaderSize, io.SeekStart); err != nil {
+		file.Close()
+		return false
+	}
+
+	s.touch(key)
+
+	go func() {
+		_, err := writer.ReadFrom(file)
+		writer.Close(err)
+		file.Close()
+	}()
+
+	return true
+}
+
+// verify checks the image against the checksum of its header, which has to be the expected one
+func (s *diskImagesStorage) verify(file *os.File, expectedChecksum string) error {
+	header := make([]byte, diskEntryHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return ErrCorruptedDiskEntry
+	}
+
+	if !bytes.Equal(header[:len(diskEntryMagic)], diskEntryMagic) {
+		return ErrCorruptedDiskEntry
+	}
+
+	if expectedChecksum != "" && hex.EncodeToString(header[len(diskEntryMagic):]) != expectedChecksum {
+		return errStaleDiskEntry
+	}
+
+	checksum := sha256.New()
+	if _, err := io.Copy(checksum, file); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(checksum.Sum(nil), header[len(diskEntryMagic):]) {
+		return ErrCorruptedDiskEntry
+	}
+
+	return nil
+}
+
+func (s *diskImagesStorage) touch(key string) {
+	s.lock.Lock()
+	if element, exists := s.entries[key]; exists {
+		s.order.MoveToFront(element)
+	}
+	s.lock.Unlock()
+
+	// modification time keeps the order of entries between restarts
+	now := time.Now()
+	os.Chtimes(s.makePath(key), now, now)
+}
+
+func (s *diskImagesStorage) forget(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.remove(key)
+	s.reportUsage()
+}
+
+func (s *diskImagesStorage) add(key string, size int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if element, exists := s.entries[key]; exists {
+		s.size -= element.Value.(*diskEntry).size
+		s.order.Remove(element)
+	}
+
+	s.entries[key] = s.order.PushFront(&diskEntry{key, size})
+	s.size += size
+	s.evict()
+	s.reportUsage()
+}
+
+func (s *diskImagesStorage) evict() {
+	for s.size > s.config.MaxSize && s.order.Len() > 0 {
+		s.remove(s.order.Back().Value.(*diskEntry).key)
+		metrics.Add("cache_disk_evicted_entries", 1)
+	}
+}
+
+func (s *diskImagesStorage) remove(key string) {
+	element, exists := s.entries[key]
+	if !exists {
+		return
+	}
+
+	s.order.Remove(element)
+	delete(s.entries, key)
+	s.size -= element.Value.(*diskEntry).size
+	os.Remove(s.makePath(key))
+}
+
+func (s *diskImagesStorage) reportUsage() {
+	metrics.Set("cache_disk_size_bytes", s.size)
+	metrics.Set("cache_disk_entries", int64(len(s.entries)))
+}
+
+func (s *diskImagesStorage) makePath(key string) string {
+	return filepath.Join(s.config.Directory, filepath.FromSlash(key))
+}
+
+// scan removes unfinished writes and adds saved images
+// to the index, starting from the least recently used
+func (s *diskImagesStorage) scan() error {
+	type scannedEntry struct {
+		diskEntry
+		modTime time.Time
+	}
+
+	var scanned []scannedEntry
+	err := filepath.Walk(s.config.Directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(s.config.Directory, path)
+		if err != nil {
+			return err
+		}
+
+		// files not created by the storage are left untouched
+		key := filepath.ToSlash(relativePath)
+		if isDiskEntryTempFile(key) {
+			return os.Remove(path)
+		}
+
+		if !isStorageKey(key) {
+			return nil
+		}
+
+		if info.Size() < diskEntryHeaderSize {
+			return os.Remove(path)
+		}
+
+		scanned = append(scanned, scannedEntry{diskEntry{key, info.Size()}, info.ModTime()})
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(scanned, func(i, j int) bool {
+		return scanned[i].modTime.Before(scanned[j].modTime)
+	})
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, entry := range scanned {
+		s.entries[entry.key] = s.order.PushFront(&diskEntry{entry.key, entry.size})
+		s.size += entry.size
+	}
+
+	s.evict()
+	s.reportUsage()
+	return nil
+}
+
+func isDiskEntryTempFile(key string) bool {
+	parts := strings.Split(key, "/")
+	return len(parts) == 3 &&
+		len(parts[0]) == 2 && len(parts[1]) == 2 &&
+		strings.HasSuffix(parts[2], diskEntryTempFileSuffix)
+}
+
+const diskEntryTempFileSuffix = ".tmp"
+
+// diskEntryWriter writes image to the temporary file, which is renamed
+// to the entry file only when the whole image is written, so readers
+// never see partially written images
+type diskEntryWriter struct {
+	storage *diskImagesStorage
+	key     string
+	file    *os.File
+
+	lock     sync.Mutex
+	checksum hash.Hash
+	size     int64
+	failed   bool
+	done     bool
+}
+
+func (s *diskImagesStorage) createEntryWriter(key string) (*diskEntryWriter, error) {
+	directory := filepath.Dir(s.makePath(key))
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+
+	file, err := ioutil.TempFile(directory, "*"+diskEntryTempFileSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	// header is written when checksum is known
+	if _, err := file.Write(make([]byte, diskEntryHeaderSize)); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	return &diskEntryWriter{storage: s, key: key, file: file, checksum: sha256.New()}, nil
+}
+
+// Write never fails, so writing to the disk does not break streams it is copied from
+func (w *diskEntryWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.failed || w.done {
+		return len(p), nil
+	}
+
+	if w.size+int64(len(p))+diskEntryHeaderSize > w.storage.config.MaxSize {
+		w.failed = true
+		return len(p), nil
+	}
+
+	if _, err := w.file.Write(p); err != nil {
+		w.failed = true
+		return len(p), nil
+	}
+
+	w.checksum.Write(p)
+	w.size += int64(len(p))
+	return len(p), nil
+}
+
+func (w *diskEntryWriter) commit() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.done {
+		return nil
+	}
+	w.done = true
+
+	if w.failed {
+		w.cleanUp()
+		return nil
+	}
+
+	header := append(append([]byte{}, diskEntryMagic...), w.checksum.Sum(nil)...)
+	if _, err := w.file.WriteAt(header, 0); err != nil {
+		w.cleanUp()
+		return err
+	}
+
+	if err := w.file.Sync(); err != nil {
+		w.cleanUp()
+		return err
+	}
+
+	if err := w.file.Close(); err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+
+	if err := os.Rename(w.file.Name(), w.storage.makePath(w.key)); err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+
+	w.storage.add(w.key, w.size+diskEntryHeaderSize)
+	return nil
+}
+
+func (w *diskEntryWriter) abort() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.done {
+		return
+	}
+
+	w.done = true
+	w.cleanUp()
+}
+
+func (w *diskEntryWriter) cleanUp() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+// diskTierInput copies the image read from the next storage to the disk
+type diskTierInput struct {
+	hub.DataStreamInput
+
+	entryWriter *diskEntryWriter
+}
+
+var _ hub.DataStreamInput = (*diskTierInput)(nil)
+
+func (s *diskTierInput) Write(p []byte) (n int, err error) {
+	n, err = s.DataStreamInput.Write(p)
+	s.entryWriter.Write(p[:n])
+	return
+}
+
+func (s *diskTierInput) ReadFrom(r io.Reader) (n int64, err error) {
+	return s.DataStreamInput.ReadFrom(io.TeeReader(r, s.entryWriter))
+}
+
+func (s *diskTierInput) Close(errorToForward error) error {
+	if errorToForward == nil || errorToForward == io.EOF {
+		if err := s.entryWriter.commit(); err != nil {
+			log.Printf("failed to save disk cache entry: %s", err)
+		}
+	} else {
+		s.entryWriter.abort()
+	}
+
+	return s.DataStreamInput.Close(errorToForward)
+}
+
+// unclosableStreamOutput lets the stream to be read again after it is saved
+type unclosableStreamOutput struct {
+	hub.DataStreamOutput
+}
+
+func (s unclosableStreamOutput) Close() error {
+	return nil
+}
+
+var (
+	ErrCorruptedDiskEntry = errors.New("corrupted disk cache entry")
+	errStaleDiskEntry     = errors.New("disk cache entry of other image")
+)
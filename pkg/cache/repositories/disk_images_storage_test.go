@@ -0,0 +1,207 @@
+package cacherepositories
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mock_hub "github.com/thebartekbanach/imcaxy/pkg/hub/mocks"
+)
+
+func getFromStorage(t *testing.T, storage CachedImagesStorage, requestSignature string) []byte {
+	input := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+	if err := storage.Get(context.Background(), requestSignature, "imaginary", "", &input); err != nil {
+		t.Fatalf("Unexpected error when getting %s: %s", requestSignature, err)
+	}
+
+	input.Wait()
+	return input.GetWholeResponse()
+}
+
+func saveInStorage(t *testing.T, storage CachedImagesStorage, requestSignature string, data []byte) {
+	output := mock_hub.NewMockTestingDataStreamOutputUsingSingleChunkOfData(t, data, nil, nil)
+	if err := storage.Save(context.Background(), requestSignature, "imaginary", "image/jpeg", int64(len(data)), "", &output); err != nil {
+		t.Fatalf("Unexpected error when saving %s: %s", requestSignature, err)
+	}
+}
+
+func TestDiskImagesStorage_ServesSavedImagesFromDisk(t *testing.T) {
+	next, _ := newTestingFileImagesStorage(t)
+	storage, err := NewDiskImagesStorage(DiskImagesStorageConfig{Directory: t.TempDir(), MaxSize: 1024}, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveInStorage(t, storage, "saved", []byte("saved data"))
+	if data := getFromStorage(t, next, "saved"); !bytes.Equal(data, []byte("saved data")) {
+		t.Errorf("Expected image to be saved in the next storage, got %s", data)
+	}
+
+	// image removed only from the next storage has to be served from the disk
+	next.Delete(context.Background(), "saved", "imaginary")
+	if data := getFromStorage(t, storage, "saved"); !bytes.Equal(data, []byte("saved data")) {
+		t.Errorf("Expected image to be served from the disk, got %s", data)
+	}
+}
+
+func TestDiskImagesStorage_SavesImagesReadFromNextStorageOnDisk(t *testing.T) {
+	next, _ := newTestingFileImagesStorage(t)
+	saveInStorage(t, next, "read", []byte("read data"))
+	storage, err := NewDiskImagesStorage(DiskImagesStorageConfig{Directory: t.TempDir(), MaxSize: 1024}, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data := getFromStorage(t, storage, "read"); !bytes.Equal(data, []byte("read data")) {
+		t.Errorf("Expected image to be served from the next storage, got %s", data)
+	}
+
+	next.Delete(context.Background(), "read", "imaginary")
+	if data := getFromStorage(t, storage, "read"); !bytes.Equal(data, []byte("read data")) {
+		t.Errorf("Expected image to be served from the disk, got %s", data)
+	}
+}
+
+func TestDiskImagesStorage_FallsBackToNextStorageWhenImageIsCorrupted(t *testing.T) {
+	directory := t.TempDir()
+	next, _ := newTestingFileImagesStorage(t)
+	storage, err := NewDiskImagesStorage(DiskImagesStorageConfig{Directory: directory, MaxSize: 1024}, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveInStorage(t, storage, "corrupted", []byte("original data"))
+
+	path := filepath.Join(directory, filepath.FromSlash(StorageKey("corrupted", "imaginary")))
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteAt([]byte("X"), diskEntryHeaderSize)
+	file.Close()
+
+	if data := getFromStorage(t, storage, "corrupted"); !bytes.Equal(data, []byte("original data")) {
+		t.Errorf("Expected image to be served from the next storage, got %s", data)
+	}
+
+	// corrupted file is replaced by the image read from the next storage
+	next.Delete(context.Background(), "corrupted", "imaginary")
+	if data := getFromStorage(t, storage, "corrupted"); !bytes.Equal(data, []byte("original data")) {
+		t.Errorf("Expected image to be served from the disk, got %s", data)
+	}
+}
+
+func TestDiskImagesStorage_EvictsLeastRecentlyUsedImagesAboveMaxSize(t *testing.T) {
+	directory := t.TempDir()
+	next, _ := newTestingFileImagesStorage(t)
+	storage, err := NewDiskImagesStorage(DiskImagesStorageConfig{Directory: directory, MaxSize: 2 * (diskEntryHeaderSize + 4)}, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveInStorage(t, storage, "first", []byte("1111"))
+	saveInStorage(t, storage, "second", []byte("2222"))
+	getFromStorage(t, storage, "first")
+	saveInStorage(t, storage, "third", []byte("3333"))
+
+	if _, err := os.Stat(filepath.Join(directory, filepath.FromSlash(StorageKey("second", "imaginary")))); !os.IsNotExist(err) {
+		t.Errorf("Expected least recently used image to be removed from the disk, got: %v", err)
+	}
+
+	for _, signature := range []string{"first", "third"} {
+		if _, err := os.Stat(filepath.Join(directory, filepath.FromSlash(StorageKey(signature, "imaginary")))); err != nil {
+			t.Errorf("Expected %s image to be kept on the disk, got: %v", signature, err)
+		}
+	}
+}
+
+func TestDiskImagesStorage_RebuildsIndexFromDiskOnStartup(t *testing.T) {
+	directory := t.TempDir()
+	next, _ := newTestingFileImagesStorage(t)
+	storage, err := NewDiskImagesStorage(DiskImagesStorageConfig{Directory: directory, MaxSize: 1024}, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveInStorage(t, storage, "saved", []byte("saved data"))
+
+	key := StorageKey("saved", "imaginary")
+	tempFile := filepath.Join(directory, filepath.FromSlash(key[:5]), "unfinished"+diskEntryTempFileSuffix)
+	if err := ioutil.WriteFile(tempFile, []byte("unfinished"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// next storage is empty, so the image can be served only from the disk
+	emptyNext, _ := newTestingFileImagesStorage(t)
+	restarted, err := NewDiskImagesStorage(DiskImagesStorageConfig{Directory: directory, MaxSize: 1024}, emptyNext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data := getFromStorage(t, restarted, "saved"); !bytes.Equal(data, []byte("saved data")) {
+		t.Errorf("Expected image saved before restart to be served from the disk, got %s", data)
+	}
+
+	if _, err := os.Stat(tempFile); !os.IsNotExist(err) {
+		t.Errorf("Expected unfinished write to be removed, got: %v", err)
+	}
+}
+
+func TestDiskImagesStorage_DeleteRemovesImageFromDisk(t *testing.T) {
+	directory := t.TempDir()
+	next, _ := newTestingFileImagesStorage(t)
+	storage, err := NewDiskImagesStorage(DiskImagesStorageConfig{Directory: directory, MaxSize: 1024}, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveInStorage(t, storage, "deleted", []byte("deleted data"))
+	if err := storage.Delete(context.Background(), "deleted", "imaginary"); err != nil {
+		t.Fatal(err)
+	}
+
+	input := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+	if err := storage.Get(context.Background(), "deleted", "imaginary", "", &input); err != ErrImageNotFound {
+		t.Errorf("Expected ErrImageNotFound error, got: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(directory, filepath.FromSlash(StorageKey("deleted", "imaginary")))); !os.IsNotExist(err) {
+		t.Errorf("Expected image to be removed from the disk, got: %v", err)
+	}
+}
+
+func TestDiskImagesStorage_DoesNotServeImageOfOtherChecksumAfterRestart(t *testing.T) {
+	next, _ := newTestingFileImagesStorage(t)
+	directory := t.TempDir()
+	storage, err := NewDiskImagesStorage(DiskImagesStorageConfig{Directory: directory, MaxSize: 1024}, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveInStorage(t, storage, "replaced", []byte("old data"))
+
+	// entry was removed and saved again by other instance while this one was stopped
+	next.Delete(context.Background(), "replaced", "imaginary")
+	saveInStorage(t, next, "replaced", []byte("new data"))
+
+	restarted, err := NewDiskImagesStorage(DiskImagesStorageConfig{Directory: directory, MaxSize: 1024}, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checksum := fmt.Sprintf("%x", sha256.Sum256([]byte("new data")))
+	input := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+	if err := restarted.Get(context.Background(), "replaced", "imaginary", checksum, &input); err != nil {
+		t.Fatal(err)
+	}
+
+	input.Wait()
+	if data := input.GetWholeResponse(); !bytes.Equal(data, []byte("new data")) {
+		t.Errorf("Expected image of the entry checksum to be served, got %s", data)
+	}
+}
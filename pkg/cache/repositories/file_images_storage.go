@@ -0,0 +1,165 @@
+package cacherepositories
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/thebartekbanach/imcaxy/pkg/hub"
+)
+
+// fileImagesStorage keeps images in the directory, every image is saved
+// under its storage key with the mime type saved in the sidecar file
+type fileImagesStorage struct {
+	directory string
+}
+
+var _ CachedImagesStorage = (*fileImagesStorage)(nil)
+
+const mimeTypeSidecarSuffix = ".type"
+
+func NewFileImagesStorage(directory string) (CachedImagesStorage, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+
+	return &fileImagesStorage{directory}, nil
+}
+
+func (s *fileImagesStorage) Save(ctx context.Context, requestSignature, processorType, mimeType string, size int64, checksum string, reader hub.DataStreamOutput) error {
+	defer reader.Close()
+
+	path := s.makePath(StorageKey(requestSignature, processorType))
+	if _, err := os.Stat(path); err == nil {
+		return ErrImageAlreadyExists
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// sidecar is written first, so every saved image has its mime type
+	if err := s.writeFile(path+mimeTypeSidecarSuffix, func(file *os.File) error {
+		_, err := io.WriteString(file, mimeType)
+		return err
+	}, os.Rename); err != nil {
+		return err
+	}
+
+	// link fails if the image was saved in the meantime
+	err := s.writeFile(path, func(file *os.File) error {
+		// stream WriteTo reports the end of stream with io.EOF, so only Read is used
+		_, err := io.Copy(file, struct{ io.Reader }{reader})
+		return err
+	}, os.Link)
+
+	if os.IsExist(err) {
+		return ErrImageAlreadyExists
+	}
+
+	return err
+}
+
+func (s *fileImagesStorage) Get(ctx context.Context, requestSignature, processorType, checksum string, writer hub.DataStreamInput) error {
+	file, err := os.Open(s.makePath(StorageKey(requestSignature, processorType)))
+	if os.IsNotExist(err) {
+		return ErrImageNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		_, err := writer.ReadFrom(file)
+		writer.Close(err)
+		file.Close()
+	}()
+
+	return nil
+}
+
+// SetChecksum does nothing, because files keep only images and their mime types
+func (s *fileImagesStorage) SetChecksum(ctx context.Context, requestSignature, processorType, checksum string) error {
+	return nil
+}
+
+func (s *fileImagesStorage) Delete(ctx context.Context, requestSignature, processorType string) error {
+	return s.DeleteStorageKey(ctx, StorageKey(requestSignature, processorType))
+}
+
+// WalkStorageKeys relies on the walk visiting files in lexical order, which is also
+// the order of storage keys, because all their parts have fixed length
+func (s *fileImagesStorage) WalkStorageKeys(ctx context.Context, walkFn func(storageKey string, size int64) error) error {
+	return filepath.Walk(s.directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(s.directory, path)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(relativePath)
+		if !info.Mode().IsRegular() || !isStorageKey(key) {
+			return nil
+		}
+
+		return walkFn(key, info.Size())
+	})
+}
+
+func (s *fileImagesStorage) DeleteStorageKey(ctx context.Context, storageKey string) error {
+	path := s.makePath(storageKey)
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return ErrImageNotFound
+		}
+
+		return err
+	}
+
+	if err := os.Remove(path + mimeTypeSidecarSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// MigrateLegacyObjects does nothing, because images were never saved under legacy keys in the directory
+func (s *fileImagesStorage) MigrateLegacyObjects(ctx context.Context, onMigrated func(requestSignature, processorType, storageKey string) error) (int, error) {
+	return 0, nil
+}
+
+// writeFile writes the temporary file, which is published under the path
+// only when it is complete, so readers never see partially written files
+func (s *fileImagesStorage) writeFile(path string, write func(file *os.File) error, publish func(tempPath, path string) error) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return publish(file.Name(), path)
+}
+
+func (s *fileImagesStorage) makePath(key string) string {
+	return filepath.Join(s.directory, filepath.FromSlash(key))
+}
@@ -0,0 +1,129 @@
+package cacherepositories
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	mock_hub "github.com/thebartekbanach/imcaxy/pkg/hub/mocks"
+)
+
+func newTestingFileImagesStorage(t *testing.T) (CachedImagesStorage, string) {
+	directory := t.TempDir()
+	storage, err := NewFileImagesStorage(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return storage, directory
+}
+
+func TestFileImagesStorage_SavesAndGetsImage(t *testing.T) {
+	storage, directory := newTestingFileImagesStorage(t)
+
+	saveInStorage(t, storage, "saved", []byte("saved data"))
+	if data := getFromStorage(t, storage, "saved"); !bytes.Equal(data, []byte("saved data")) {
+		t.Errorf("Expected saved image, got %s", data)
+	}
+
+	mimeType, err := ioutil.ReadFile(filepath.Join(directory, filepath.FromSlash(StorageKey("saved", "imaginary"))+mimeTypeSidecarSuffix))
+	if err != nil || string(mimeType) != "image/jpeg" {
+		t.Errorf("Expected mime type to be saved in the sidecar file, got %s, error: %v", mimeType, err)
+	}
+}
+
+func TestFileImagesStorage_SavesImageOfUnknownSize(t *testing.T) {
+	storage, _ := newTestingFileImagesStorage(t)
+
+	output := mock_hub.NewMockTestingDataStreamOutput(t, [][]byte{{0x1, 0x2}, {0x3}}, nil, nil)
+	if err := storage.Save(context.Background(), "unknown-size", "imaginary", "image/png", -1, "", &output); err != nil {
+		t.Fatal(err)
+	}
+
+	if data := getFromStorage(t, storage, "unknown-size"); !bytes.Equal(data, []byte{0x1, 0x2, 0x3}) {
+		t.Errorf("Expected saved image, got %v", data)
+	}
+}
+
+func TestFileImagesStorage_ReturnsErrorWhenImageAlreadyExists(t *testing.T) {
+	storage, _ := newTestingFileImagesStorage(t)
+
+	saveInStorage(t, storage, "saved", []byte("saved data"))
+
+	output := mock_hub.NewMockTestingDataStreamOutputUsingSingleChunkOfData(t, []byte("other data"), nil, nil)
+	if err := storage.Save(context.Background(), "saved", "imaginary", "image/jpeg", 10, "", &output); err != ErrImageAlreadyExists {
+		t.Errorf("Expected ErrImageAlreadyExists error, got: %v", err)
+	}
+
+	if data := getFromStorage(t, storage, "saved"); !bytes.Equal(data, []byte("saved data")) {
+		t.Errorf("Expected the first saved image, got %s", data)
+	}
+}
+
+func TestFileImagesStorage_ReturnsErrorWhenImageIsNotFound(t *testing.T) {
+	storage, _ := newTestingFileImagesStorage(t)
+
+	input := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+	if err := storage.Get(context.Background(), "unknown", "imaginary", "", &input); err != ErrImageNotFound {
+		t.Errorf("Expected ErrImageNotFound error, got: %v", err)
+	}
+
+	if err := storage.Delete(context.Background(), "unknown", "imaginary"); err != ErrImageNotFound {
+		t.Errorf("Expected ErrImageNotFound error, got: %v", err)
+	}
+}
+
+func TestFileImagesStorage_DeletesImageAndItsSidecar(t *testing.T) {
+	storage, directory := newTestingFileImagesStorage(t)
+
+	saveInStorage(t, storage, "deleted", []byte("deleted data"))
+	if err := storage.Delete(context.Background(), "deleted", "imaginary"); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(directory, filepath.FromSlash(StorageKey("deleted", "imaginary")))
+	for _, path := range []string{path, path + mimeTypeSidecarSuffix} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed, got: %v", path, err)
+		}
+	}
+}
+
+func TestFileImagesStorage_WalksStorageKeysInOrder(t *testing.T) {
+	storage, directory := newTestingFileImagesStorage(t)
+
+	storageKeys := []string{}
+	for _, signature := range []string{"first", "second", "third"} {
+		saveInStorage(t, storage, signature, []byte(signature))
+		storageKeys = append(storageKeys, StorageKey(signature, "imaginary"))
+	}
+	sort.Strings(storageKeys)
+
+	// files which are not images are skipped
+	if err := ioutil.WriteFile(filepath.Join(directory, "unknown"), []byte("unknown"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	walkedKeys := []string{}
+	err := storage.WalkStorageKeys(context.Background(), func(storageKey string, size int64) error {
+		walkedKeys = append(walkedKeys, storageKey)
+		return nil
+	})
+
+	if err != nil || !reflect.DeepEqual(walkedKeys, storageKeys) {
+		t.Errorf("Expected walked storage keys to be %v, got %v, error: %v", storageKeys, walkedKeys, err)
+	}
+
+	if err := storage.DeleteStorageKey(context.Background(), storageKeys[0]); err != nil {
+		t.Errorf("Expected no error when deleting by storage key, got: %v", err)
+	}
+
+	if err := storage.DeleteStorageKey(context.Background(), storageKeys[0]); err != ErrImageNotFound {
+		t.Errorf("Expected ErrImageNotFound error, got: %v", err)
+	}
+}
@@ -3,36 +3,60 @@ package cacherepositories
 import (
 	"context"
 	"errors"
+	"regexp"
+	"strings"
+	"time"
 
 	dbconnections "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/connections"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type cachedImagesRepository struct {
-	conn dbconnections.CacheDBConnection
+	conn dbconnections.MongoCacheDBConnection
 }
 
 var _ CachedImagesRepository = (*cachedImagesRepository)(nil)
 
+// NewCachedImagesRepository returns repository working on the database behind the connection
 func NewCachedImagesRepository(conn dbconnections.CacheDBConnection) CachedImagesRepository {
-	return &cachedImagesRepository{conn}
+	switch conn := conn.(type) {
+	case dbconnections.SQLCacheDBConnection:
+		return &sqlCachedImagesRepository{conn}
+	case dbconnections.BoltCacheDBConnection:
+		return &boltCachedImagesRepository{conn}
+	}
+
+	return &cachedImagesRepository{conn.(dbconnections.MongoCacheDBConnection)}
 }
 
 func (repo *cachedImagesRepository) CreateCachedImageInfo(ctx context.Context, info CachedImageModel) error {
 	collection := repo.conn.Collection("cachedImages")
 
-	result := collection.FindOne(ctx, bson.M{"requestSignature": info.RequestSignature, "processorType": info.ProcessorType})
-	if result.Err() != mongo.ErrNoDocuments {
-		if result.Err() != nil {
-			return result.Err()
-		}
+	info.StorageKey = StorageKey(info.RequestSignature, info.ProcessorType)
+	if info.CreatedAt.IsZero() {
+		info.CreatedAt = time.Now()
+	}
+	info.LastAccessedAt = info.CreatedAt
 
+	// concurrent upserts of the same entry can both miss it, then
+	// the unique index lets only one of them insert the entry
+	filter := bson.M{"requestSignature": info.RequestSignature, "processorType": info.ProcessorType}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$setOnInsert": info}, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
 		return ErrCachedImageAlreadyExists
 	}
 
-	_, err := collection.InsertOne(ctx, info)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if result.UpsertedCount == 0 {
+		return ErrCachedImageAlreadyExists
+	}
+
+	return nil
 }
 
 func (repo *cachedImagesRepository) DeleteCachedImageInfo(ctx context.Context, requestSignature, processorType string) error {
@@ -54,7 +78,7 @@ func (repo *cachedImagesRepository) GetCachedImageInfo(ctx context.Context, requ
 	collection := repo.conn.Collection("cachedImages")
 
 	var info CachedImageModel
-	filter := bson.M{"requestSignature": requestSignature, "processorType": processorType}
+	filter := bson.M{"requestSignature": requestSignature, "processorType": processorType, "state": bson.M{"$ne": CachedImagePending}}
 	if err := collection.FindOne(ctx, filter).Decode(&info); err != nil {
 		if err == mongo.ErrNoDocuments {
 			return info, ErrCachedImageNotFound
@@ -80,6 +104,354 @@ func (repo *cachedImagesRepository) GetCachedImageInfosOfSource(ctx context.Cont
 	return infos, err
 }
 
+func (repo *cachedImagesRepository) WalkCachedImageInfosOfSourcePrefix(ctx context.Context, sourceImageURLPrefix string, walkFn func(info CachedImageModel) error) error {
+	collection := repo.conn.Collection("cachedImages")
+
+	filter := bson.M{"sourceImageURL": bson.M{"$regex": "^" + regexp.QuoteMeta(sourceImageURLPrefix)}}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var info CachedImageModel
+		if err := cursor.Decode(&info); err != nil {
+			return err
+		}
+
+		if err := walkFn(info); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+func (repo *cachedImagesRepository) MarkCachedImageReady(ctx context.Context, requestSignature, processorType string, size int64, checksum string) error {
+	collection := repo.conn.Collection("cachedImages")
+
+	filter := bson.M{"requestSignature": requestSignature, "processorType": processorType}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"imageSize": size, "checksum": checksum, "state": CachedImageReady}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrCachedImageNotFound
+	}
+
+	return nil
+}
+
+func (repo *cachedImagesRepository) UpdateCachedImageSize(ctx context.Context, requestSignature, processorType string, size int64) error {
+	collection := repo.conn.Collection("cachedImages")
+
+	filter := bson.M{"requestSignature": requestSignature, "processorType": processorType}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"imageSize": size}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrCachedImageNotFound
+	}
+
+	return nil
+}
+
+func (repo *cachedImagesRepository) UpdateCachedImageStorageKey(ctx context.Context, requestSignature, processorType, storageKey string) error {
+	collection := repo.conn.Collection("cachedImages")
+
+	filter := bson.M{"requestSignature": requestSignature, "processorType": processorType}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"storageKey": storageKey}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrCachedImageNotFound
+	}
+
+	return nil
+}
+
+func (repo *cachedImagesRepository) RecordCachedImageAccesses(ctx context.Context, accesses []CachedImageAccess) error {
+	if len(accesses) == 0 {
+		return nil
+	}
+
+	collection := repo.conn.Collection("cachedImages")
+
+	models := make([]mongo.WriteModel, 0, len(accesses))
+	for _, access := range accesses {
+		filter := bson.M{"requestSignature": access.RequestSignature, "processorType": access.ProcessorType}
+		update := bson.M{
+			"$max": bson.M{"lastAccessedAt": access.LastAccessedAt},
+			"$inc": bson.M{"accessCount": access.Count},
+		}
+
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update))
+	}
+
+	_, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (repo *cachedImagesRepository) GetExpiredCachedImageInfos(ctx context.Context, now time.Time, limit int) ([]CachedImageModel, error) {
+	collection := repo.conn.Collection("cachedImages")
+
+	// entries which never expire have zero expiration time
+	filter := bson.M{"expiresAt": bson.M{"$gt": time.Time{}, "$lte": now}}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []CachedImageModel
+	err = cursor.All(ctx, &infos)
+	return infos, err
+}
+
+func (repo *cachedImagesRepository) GetPendingCachedImageInfos(ctx context.Context, createdBefore time.Time, limit int) ([]CachedImageModel, error) {
+	collection := repo.conn.Collection("cachedImages")
+
+	filter := bson.M{"state": CachedImagePending, "createdAt": bson.M{"$lt": createdBefore}}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []CachedImageModel
+	err = cursor.All(ctx, &infos)
+	return infos, err
+}
+
+func (repo *cachedImagesRepository) GetCachedImagesUsage(ctx context.Context, sourceImageURLPattern string) (int64, error) {
+	collection := repo.conn.Collection("cachedImages")
+
+	pipeline := []bson.M{
+		{"$match": repo.makeSavedImagesFilter(sourceImageURLPattern)},
+		{"$group": bson.M{"_id": nil, "usage": bson.M{"$sum": "$imageSize"}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+
+	var results []struct {
+		Usage int64 `bson:"usage"`
+	}
+
+	if err := cursor.All(ctx, &results); err != nil {
+		return 0, err
+	}
+
+	if len(results) == 0 {
+		return 0, nil
+	}
+
+	return results[0].Usage, nil
+}
+
+func (repo *cachedImagesRepository) GetLeastUsedCachedImageInfos(ctx context.Context, sourceImageURLPattern string, order EvictionOrder, limit int) ([]CachedImageModel, error) {
+	collection := repo.conn.Collection("cachedImages")
+
+	sort := bson.D{{Key: "lastAccessedAt", Value: 1}}
+	if order == LeastFrequentlyUsed {
+		sort = bson.D{{Key: "accessCount", Value: 1}, {Key: "lastAccessedAt", Value: 1}}
+	}
+
+	opts := options.Find().SetSort(sort).SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, repo.makeSavedImagesFilter(sourceImageURLPattern), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []CachedImageModel
+	err = cursor.All(ctx, &infos)
+	return infos, err
+}
+
+func (repo *cachedImagesRepository) ListCachedImageInfos(ctx context.Context, fromStorageKey string, limit int) ([]CachedImageModel, error) {
+	collection := repo.conn.Collection("cachedImages")
+
+	// entries saved under legacy keys have empty storage key
+	filter := bson.M{"storageKey": bson.M{"$gte": fromStorageKey, "$gt": ""}}
+	opts := options.Find().SetSort(bson.D{{Key: "storageKey", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []CachedImageModel
+	err = cursor.All(ctx, &infos)
+	return infos, err
+}
+
+func (repo *cachedImagesRepository) ListCachedImageInfosAfter(ctx context.Context, afterStorageKey string, limit int) ([]CachedImageModel, error) {
+	collection := repo.conn.Collection("cachedImages")
+
+	// legacy entries are skipped also when the key is empty
+	filter := bson.M{"storageKey": bson.M{"$gt": afterStorageKey}}
+	opts := options.Find().SetSort(bson.D{{Key: "storageKey", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []CachedImageModel
+	err = cursor.All(ctx, &infos)
+	return infos, err
+}
+
+func (repo *cachedImagesRepository) SearchCachedImageInfos(ctx context.Context, query CachedImagesQuery, page CachedImagesPage) ([]CachedImageModel, error) {
+	collection := repo.conn.Collection("cachedImages")
+
+	sortField := page.SortBy
+	if sortField == "" {
+		sortField = SortByCreatedAt
+	}
+
+	direction, operator := 1, "$gt"
+	if page.Descending {
+		direction, operator = -1, "$lt"
+	}
+
+	filter := repo.makeQueryFilter(query, "")
+	if page.After != nil {
+		after := *page.After
+		value := sortField.sortValue(after)
+		filter["$or"] = []bson.M{
+			{string(sortField): bson.M{operator: value}},
+			{string(sortField): value, "requestSignature": bson.M{operator: after.RequestSignature}},
+			{string(sortField): value, "requestSignature": after.RequestSignature, "processorType": bson.M{operator: after.ProcessorType}},
+		}
+	}
+
+	sort := bson.D{
+		{Key: string(sortField), Value: direction},
+		{Key: "requestSignature", Value: direction},
+		{Key: "processorType", Value: direction},
+	}
+
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(sort).SetLimit(int64(page.Limit)))
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []CachedImageModel
+	err = cursor.All(ctx, &infos)
+	return infos, err
+}
+
+func (repo *cachedImagesRepository) GetCachedImageSourcesStats(ctx context.Context, query CachedImagesQuery, afterSourceImageURL string, limit int) ([]CachedImageSourceStats, error) {
+	collection := repo.conn.Collection("cachedImages")
+
+	pipeline := []bson.M{
+		{"$match": repo.makeQueryFilter(query, afterSourceImageURL)},
+		{"$group": bson.M{"_id": "$sourceImageURL", "images": bson.M{"$sum": 1}, "bytes": bson.M{"$sum": "$imageSize"}}},
+		{"$sort": bson.M{"_id": 1}},
+		{"$limit": limit},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []CachedImageSourceStats
+	err = cursor.All(ctx, &stats)
+	return stats, err
+}
+
+// makeQueryFilter matches saved images selected by the query,
+// which have source image url greater than the given one
+func (repo *cachedImagesRepository) makeQueryFilter(query CachedImagesQuery, afterSourceImageURL string) bson.M {
+	filter := repo.makeSavedImagesFilter("")
+
+	size := filter["imageSize"].(bson.M)
+	if query.MinImageSize > 0 {
+		size["$gte"] = query.MinImageSize
+	}
+
+	if query.MaxImageSize > 0 {
+		size["$lte"] = query.MaxImageSize
+	}
+
+	source := bson.M{}
+	if query.SourceImageURL != "" {
+		source["$eq"] = query.SourceImageURL
+	}
+
+	if query.SourceImageURLPrefix != "" {
+		source["$regex"] = "^" + regexp.QuoteMeta(query.SourceImageURLPrefix)
+	}
+
+	if afterSourceImageURL != "" {
+		source["$gt"] = afterSourceImageURL
+	}
+
+	if len(source) > 0 {
+		filter["sourceImageURL"] = source
+	}
+
+	// source image url can have only one regular expression, so the pattern is matched separately
+	if query.SourceImageURLPattern != "" {
+		filter["$and"] = []bson.M{{"sourceImageURL": bson.M{"$regex": globToRegex(query.SourceImageURLPattern)}}}
+	}
+
+	fields := map[string]string{
+		"processorType":     query.ProcessorType,
+		"processorEndpoint": query.ProcessorEndpoint,
+		"mimeType":          query.MimeType,
+	}
+
+	for field, value := range fields {
+		if value != "" {
+			filter[field] = value
+		}
+	}
+
+	created := bson.M{}
+	if !query.CreatedAfter.IsZero() {
+		created["$gte"] = query.CreatedAfter
+	}
+
+	if !query.CreatedBefore.IsZero() {
+		created["$lt"] = query.CreatedBefore
+	}
+
+	if len(created) > 0 {
+		filter["createdAt"] = created
+	}
+
+	return filter
+}
+
+// images which are still being saved are pending, images of
+// legacy entries which are still being saved have negative size
+func (repo *cachedImagesRepository) makeSavedImagesFilter(sourceImageURLPattern string) bson.M {
+	filter := bson.M{"imageSize": bson.M{"$gte": 0}, "state": bson.M{"$ne": CachedImagePending}}
+	if sourceImageURLPattern != "" {
+		filter["sourceImageURL"] = bson.M{"$regex": globToRegex(sourceImageURLPattern)}
+	}
+
+	return filter
+}
+
+// globToRegex translates glob pattern, where * matches any
+// sequence of characters, to the anchored regular expression
+func globToRegex(pattern string) string {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+
+	return "^" + strings.Join(parts, ".*") + "$"
+}
+
 var (
 	ErrCachedImageNotFound      = errors.New("cached image not found")
 	ErrCachedImageAlreadyExists = errors.New("cached image already exists")
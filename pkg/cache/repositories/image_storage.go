@@ -2,8 +2,11 @@ package cacherepositories
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"net/url"
+	"strings"
 
 	"github.com/minio/minio-go/v7"
 	dbconnections "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/connections"
@@ -20,8 +23,8 @@ func NewCachedImagesStorage(conn dbconnections.MinioBlockStorageConnection) Cach
 	return &cachedImagesStorage{conn}
 }
 
-func (s *cachedImagesStorage) Save(ctx context.Context, requestSignature, processorType, mimeType string, size int64, reader hub.DataStreamOutput) error {
-	resourceID := s.makeResourceID(requestSignature, processorType)
+func (s *cachedImagesStorage) Save(ctx context.Context, requestSignature, processorType, mimeType string, size int64, checksum string, reader hub.DataStreamOutput) error {
+	resourceID := StorageKey(requestSignature, processorType)
 	exists, err := s.conn.ObjectExists(ctx, resourceID)
 	if err != nil {
 		return err
@@ -31,17 +34,31 @@ func (s *cachedImagesStorage) Save(ctx context.Context, requestSignature, proces
 	}
 
 	defer reader.Close()
-	return s.conn.PutObject(ctx, resourceID, size, mimeType, reader)
+	return s.conn.PutObject(ctx, resourceID, size, mimeType, checksum, reader)
 }
 
-func (s *cachedImagesStorage) Get(ctx context.Context, requestSignature, processorType string, writer hub.DataStreamInput) error {
-	resourceID := s.makeResourceID(requestSignature, processorType)
+func (s *cachedImagesStorage) Get(ctx context.Context, requestSignature, processorType, checksum string, writer hub.DataStreamInput) error {
+	err := s.get(ctx, StorageKey(requestSignature, processorType), writer)
+	if err == ErrImageNotFound {
+		// image may be not migrated yet
+		return s.get(ctx, s.makeLegacyResourceID(requestSignature, processorType), writer)
+	}
+
+	return err
+}
+
+func (s *cachedImagesStorage) SetChecksum(ctx context.Context, requestSignature, processorType, checksum string) error {
+	return s.convertToKnownError(s.conn.SetObjectChecksum(ctx, StorageKey(requestSignature, processorType), checksum))
+}
+
+func (s *cachedImagesStorage) get(ctx context.Context, resourceID string, writer hub.DataStreamInput) error {
 	reader, err := s.conn.GetObject(ctx, resourceID)
 	if err != nil {
 		return s.convertToKnownError(err)
 	}
 
 	if _, err := reader.Stat(); err != nil {
+		reader.Close()
 		return s.convertToKnownError(err)
 	}
 
@@ -55,16 +72,91 @@ func (s *cachedImagesStorage) Get(ctx context.Context, requestSignature, process
 }
 
 func (s *cachedImagesStorage) Delete(ctx context.Context, requestSignature, processorType string) error {
-	resourceID := s.makeResourceID(requestSignature, processorType)
-	exists, err := s.conn.ObjectExists(ctx, resourceID)
+	deleted := false
+	for _, resourceID := range []string{
+		StorageKey(requestSignature, processorType),
+		s.makeLegacyResourceID(requestSignature, processorType),
+	} {
+		exists, err := s.conn.ObjectExists(ctx, resourceID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		if err := s.conn.DeleteObject(ctx, resourceID); err != nil {
+			return err
+		}
+		deleted = true
+	}
+
+	if !deleted {
+		return ErrImageNotFound
+	}
+
+	return nil
+}
+
+func (s *cachedImagesStorage) WalkStorageKeys(ctx context.Context, walkFn func(storageKey string, size int64) error) error {
+	return s.conn.WalkAllObjects(ctx, func(objectName string, size int64) error {
+		if !isStorageKey(objectName) {
+			return nil
+		}
+
+		return walkFn(objectName, size)
+	})
+}
+
+func (s *cachedImagesStorage) DeleteStorageKey(ctx context.Context, storageKey string) error {
+	exists, err := s.conn.ObjectExists(ctx, storageKey)
 	if err != nil {
 		return err
 	}
+
 	if !exists {
 		return ErrImageNotFound
 	}
 
-	return s.conn.DeleteObject(ctx, resourceID)
+	return s.conn.DeleteObject(ctx, storageKey)
+}
+
+func (s *cachedImagesStorage) MigrateLegacyObjects(ctx context.Context, onMigrated func(requestSignature, processorType, storageKey string) error) (migratedObjects int, err error) {
+	// hashed keys are always placed under nested prefixes,
+	// so all objects placed directly in the bucket are legacy ones
+	err = s.conn.WalkObjects(ctx, "", func(objectName string) error {
+		requestSignature, processorType, isLegacy := s.parseLegacyResourceID(objectName)
+		if !isLegacy {
+			return nil
+		}
+
+		storageKey := StorageKey(requestSignature, processorType)
+		if err := s.migrateObject(ctx, objectName, storageKey); err != nil {
+			return err
+		}
+
+		migratedObjects++
+		return onMigrated(requestSignature, processorType, storageKey)
+	})
+
+	return
+}
+
+// object is copied before the legacy one is removed,
+// so it is always available for readers during migration
+func (s *cachedImagesStorage) migrateObject(ctx context.Context, legacyResourceID, resourceID string) error {
+	exists, err := s.conn.ObjectExists(ctx, resourceID)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		if err := s.conn.CopyObject(ctx, legacyResourceID, resourceID); err != nil {
+			return err
+		}
+	}
+
+	return s.conn.DeleteObject(ctx, legacyResourceID)
 }
 
 func (s *cachedImagesStorage) convertToKnownError(err error) error {
@@ -75,10 +167,44 @@ func (s *cachedImagesStorage) convertToKnownError(err error) error {
 	return err
 }
 
-func (s *cachedImagesStorage) makeResourceID(requestSignature, processorType string) string {
+// StorageKey returns name of the object holding the image, it has fixed length
+// and is sharded by two levels of prefixes to keep bucket listings fast
+func StorageKey(requestSignature, processorType string) string {
+	hash := sha256.Sum256([]byte(processorType + "::" + requestSignature))
+	hexHash := hex.EncodeToString(hash[:])
+	return hexHash[0:2] + "/" + hexHash[2:4] + "/" + hexHash
+}
+
+func isStorageKey(key string) bool {
+	parts := strings.Split(key, "/")
+	return len(parts) == 3 &&
+		len(parts[2]) == 2*sha256.Size &&
+		strings.HasPrefix(parts[2], parts[0]+parts[1])
+}
+
+func (s *cachedImagesStorage) makeLegacyResourceID(requestSignature, processorType string) string {
 	return url.PathEscape(requestSignature) + "::" + url.PathEscape(processorType)
 }
 
+func (s *cachedImagesStorage) parseLegacyResourceID(resourceID string) (requestSignature, processorType string, ok bool) {
+	separatorIndex := strings.LastIndex(resourceID, "::")
+	if separatorIndex < 0 {
+		return "", "", false
+	}
+
+	requestSignature, err := url.PathUnescape(resourceID[:separatorIndex])
+	if err != nil {
+		return "", "", false
+	}
+
+	processorType, err = url.PathUnescape(resourceID[separatorIndex+2:])
+	if err != nil {
+		return "", "", false
+	}
+
+	return requestSignature, processorType, true
+}
+
 var (
 	ErrImageAlreadyExists = errors.New("image already exists")
 	ErrImageNotFound      = errors.New("image not found")
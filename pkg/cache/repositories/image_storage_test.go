@@ -5,6 +5,7 @@ import (
 	"context"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
 	dbconnections "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/connections"
@@ -41,7 +42,7 @@ func TestCachedImagesStorageIntegration_ShouldCorrectlyUploadImage(t *testing.T)
 	conn := dbconnections.NewMinioBlockStorageTestingConnection(t)
 	storage := NewCachedImagesStorage(conn)
 
-	err := storage.Save(ctx, "test-signature", "imaginary", "image/jpeg", int64(len(testData)), mockDataStreamOutput)
+	err := storage.Save(ctx, "test-signature", "imaginary", "image/jpeg", int64(len(testData)), "", mockDataStreamOutput)
 	if err != nil {
 		t.Fatalf("Error ocurred while saving image to block storage: %s", err)
 	}
@@ -49,7 +50,7 @@ func TestCachedImagesStorageIntegration_ShouldCorrectlyUploadImage(t *testing.T)
 	// make sure stream output was closed
 	mockDataStreamOutput.Wait()
 
-	err = storage.Get(ctx, "test-signature", "imaginary", &mockDataStreamInput)
+	err = storage.Get(ctx, "test-signature", "imaginary", "", &mockDataStreamInput)
 	if err != nil {
 		t.Fatalf("Error ocurred while getting image from block storage: %s", err)
 	}
@@ -80,12 +81,12 @@ func TestCachedImagesStorageIntegration_ShouldReturnSaveErrorWhenTryingToUploadI
 	conn := dbconnections.NewMinioBlockStorageTestingConnection(t)
 	storage := NewCachedImagesStorage(conn)
 
-	err := storage.Save(ctx, "test-signature", "imaginary", "image/jpeg", int64(len(testData)), mockDataStreamFirstOutput)
+	err := storage.Save(ctx, "test-signature", "imaginary", "image/jpeg", int64(len(testData)), "", mockDataStreamFirstOutput)
 	if err != nil {
 		t.Fatalf("Error ocurred while saving image to block storage: %s", err)
 	}
 
-	err = storage.Save(ctx, "test-signature", "imaginary", "image/jpeg", int64(len(testData)), mockDataStreamSecondOutput)
+	err = storage.Save(ctx, "test-signature", "imaginary", "image/jpeg", int64(len(testData)), "", mockDataStreamSecondOutput)
 	if err != ErrImageAlreadyExists {
 		t.Fatalf("Error was not returned when trying to save image that already exists, got: %v", err)
 	}
@@ -104,7 +105,7 @@ func TestCachedImagesStorageIntegration_ShouldReturnGetErrorIfImageDoesNotExist(
 	conn := dbconnections.NewMinioBlockStorageTestingConnection(t)
 	storage := NewCachedImagesStorage(conn)
 
-	err := storage.Get(ctx, "unknown-signature", "imaginary", &mockDataStreamInput)
+	err := storage.Get(ctx, "unknown-signature", "imaginary", "", &mockDataStreamInput)
 	if err != ErrImageNotFound {
 		t.Fatalf("Error was not returned when trying to get image that does not exist, got %v", err)
 	}
@@ -126,12 +127,12 @@ func TestCachedImagesStorageIntegration_ShouldCorrectlyDeleteImage(t *testing.T)
 	conn := dbconnections.NewMinioBlockStorageTestingConnection(t)
 	storage := NewCachedImagesStorage(conn)
 
-	err := storage.Save(ctx, "test-signature", "imaginary", "image/jpeg", int64(len(testData)), mockDataStreamOutput)
+	err := storage.Save(ctx, "test-signature", "imaginary", "image/jpeg", int64(len(testData)), "", mockDataStreamOutput)
 	if err != nil {
 		t.Fatalf("Error ocurred while saving image to block storage: %s", err)
 	}
 
-	err = storage.Get(ctx, "test-signature", "imaginary", &mockDataStreamInput)
+	err = storage.Get(ctx, "test-signature", "imaginary", "", &mockDataStreamInput)
 	if err != nil {
 		t.Fatalf("Error ocurred while getting image from block storage: %s", err)
 	}
@@ -149,7 +150,7 @@ func TestCachedImagesStorageIntegration_ShouldCorrectlyDeleteImage(t *testing.T)
 		t.Fatalf("Error ocurred while deleting image from block storage: %s", err)
 	}
 
-	err = storage.Get(ctx, "test-signature", "imaginary", &mockDataStreamResultInput)
+	err = storage.Get(ctx, "test-signature", "imaginary", "", &mockDataStreamResultInput)
 	if err == nil {
 		t.Fatalf("Image was not deleted")
 	}
@@ -171,3 +172,67 @@ func TestCachedImagesStorageIntegration_ShouldReturnDeleteErrorIfImageDoesNotExi
 		t.Fatalf("Error was not returned when trying to delete image that does not exist, got %v", err)
 	}
 }
+
+func TestStorageKey_ShouldReturnShardedKeyOfFixedLength(t *testing.T) {
+	shortKey := StorageKey("|/resize|http://a.com/a.jpg|width=100|", "imaginary")
+	longKey := StorageKey("|/pipeline|http://a.com/"+strings.Repeat("a", 2048)+".jpg|", "imaginary")
+
+	if len(shortKey) != len(longKey) || len(shortKey) != 70 {
+		t.Errorf("Expected keys to be 70 characters long, got %d and %d", len(shortKey), len(longKey))
+	}
+
+	if shortKey[2] != '/' || shortKey[5] != '/' || shortKey[6:8] != shortKey[0:2] {
+		t.Errorf("Expected key to be sharded by two prefixes, got %s", shortKey)
+	}
+
+	if StorageKey("|/resize|http://a.com/a.jpg|width=100|", "native") == shortKey {
+		t.Errorf("Expected keys of different processors to be different")
+	}
+}
+
+func TestCachedImagesStorageIntegration_ShouldMigrateImageSavedUnderLegacyKey(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping cachedImagesRepository integration tests")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testData := loadTestFile(t)
+	conn := dbconnections.NewMinioBlockStorageTestingConnection(t)
+	storage := &cachedImagesStorage{conn}
+
+	legacyResourceID := storage.makeLegacyResourceID("test-signature", "imaginary")
+	if err := conn.PutObject(ctx, legacyResourceID, int64(len(testData)), "image/jpeg", "", bytes.NewReader(testData)); err != nil {
+		t.Fatalf("Error ocurred while saving image under legacy key: %s", err)
+	}
+
+	// not migrated images are still available
+	mockDataStreamInput := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+	if err := storage.Get(ctx, "test-signature", "imaginary", "", &mockDataStreamInput); err != nil {
+		t.Fatalf("Error ocurred while getting image saved under legacy key: %s", err)
+	}
+	mockDataStreamInput.Wait()
+
+	migratedKeys := []string{}
+	migratedObjects, err := storage.MigrateLegacyObjects(ctx, func(requestSignature, processorType, storageKey string) error {
+		migratedKeys = append(migratedKeys, requestSignature+"|"+processorType+"|"+storageKey)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error ocurred while migrating images: %s", err)
+	}
+
+	expectedKey := "test-signature|imaginary|" + StorageKey("test-signature", "imaginary")
+	if migratedObjects != 1 || len(migratedKeys) != 1 || migratedKeys[0] != expectedKey {
+		t.Fatalf("Expected single image to be migrated to %s, got %v", expectedKey, migratedKeys)
+	}
+
+	if exists, _ := conn.ObjectExists(ctx, legacyResourceID); exists {
+		t.Errorf("Expected image saved under legacy key to be removed")
+	}
+
+	if exists, _ := conn.ObjectExists(ctx, StorageKey("test-signature", "imaginary")); !exists {
+		t.Errorf("Expected image to be saved under hashed key")
+	}
+}
@@ -14,34 +14,166 @@ type CachedImageModel struct {
 	ProcessorType     string `json:"processorType" bson:"processorType"`
 	ProcessorEndpoint string `json:"processorEndpoint" bson:"processorEndpoint"`
 
-	MimeType         string              `json:"mimeType" bson:"mimeType"`
-	ImageSize        int64               `json:"imageSize" bson:"imageSize"`
+	MimeType  string `json:"mimeType" bson:"mimeType"`
+	ImageSize int64  `json:"imageSize" bson:"imageSize"` // -1 until image of unknown size is saved
+	// Checksum is hex encoded SHA-256 of the image, it is set when the image is
+	// saved and it is empty for images saved before checksums were introduced
+	Checksum         string              `json:"checksum" bson:"checksum"`
 	SourceImageURL   string              `json:"sourceImageURL" bson:"sourceImageURL"`
 	ProcessingParams map[string][]string `json:"processingParams" bson:"processingParams"`
+
+	// StorageKey is name of the object holding the image in block storage,
+	// it is empty for entries saved under legacy keys and not migrated yet
+	StorageKey string `json:"storageKey" bson:"storageKey"`
+	// State is pending until the image is saved, entries saved
+	// before states were introduced have empty state and are ready
+	State CachedImageState `json:"state" bson:"state"`
+
+	CreatedAt      time.Time `json:"createdAt" bson:"createdAt"`
+	ExpiresAt      time.Time `json:"expiresAt" bson:"expiresAt"` // zero if entry never expires
+	LastAccessedAt time.Time `json:"lastAccessedAt" bson:"lastAccessedAt"`
+	AccessCount    int64     `json:"accessCount" bson:"accessCount"`
+}
+
+func (info CachedImageModel) IsExpired(now time.Time) bool {
+	return !info.ExpiresAt.IsZero() && !now.Before(info.ExpiresAt)
+}
+
+func (info CachedImageModel) IsPending() bool {
+	return info.State == CachedImagePending
 }
 
+type CachedImageState string
+
+const (
+	// CachedImagePending entries are not returned by GetCachedImageInfo
+	CachedImagePending CachedImageState = "pending"
+	CachedImageReady   CachedImageState = "ready"
+)
+
 type CachedImagesRepository interface {
+	// CreateCachedImageInfo returns ErrCachedImageAlreadyExists when entry
+	// of the same request signature and processor type already exists
 	CreateCachedImageInfo(ctx context.Context, info CachedImageModel) error
 	DeleteCachedImageInfo(ctx context.Context, requestSignature, processorType string) error
+	// GetCachedImageInfo returns ErrCachedImageNotFound also for pending entries
 	GetCachedImageInfo(ctx context.Context, requestSignature, processorType string) (CachedImageModel, error)
+	// GetCachedImageInfosOfSource returns also pending entries
 	GetCachedImageInfosOfSource(ctx context.Context, sourceImageURL string) ([]CachedImageModel, error)
+	// WalkCachedImageInfosOfSourcePrefix calls walkFn with entries of source image urls starting with the prefix,
+	// also pending ones, until walkFn returns an error, which is returned, empty prefix matches all entries,
+	// walkFn must not use the repository, as the entries are read while it is called
+	WalkCachedImageInfosOfSourcePrefix(ctx context.Context, sourceImageURLPrefix string, walkFn func(info CachedImageModel) error) error
+	// MarkCachedImageReady sets size and checksum of the saved image and makes the entry visible
+	MarkCachedImageReady(ctx context.Context, requestSignature, processorType string, size int64, checksum string) error
+	UpdateCachedImageSize(ctx context.Context, requestSignature, processorType string, size int64) error
+	UpdateCachedImageStorageKey(ctx context.Context, requestSignature, processorType, storageKey string) error
+	// RecordCachedImageAccesses updates access statistics of many entries at once,
+	// accesses of entries which do not exist anymore are ignored
+	RecordCachedImageAccesses(ctx context.Context, accesses []CachedImageAccess) error
+	GetExpiredCachedImageInfos(ctx context.Context, now time.Time, limit int) ([]CachedImageModel, error)
+	// GetPendingCachedImageInfos returns pending entries created before the given time
+	GetPendingCachedImageInfos(ctx context.Context, createdBefore time.Time, limit int) ([]CachedImageModel, error)
+	// GetCachedImagesUsage returns total size of ready images matching
+	// the source image url glob pattern, empty pattern matches all images
+	GetCachedImagesUsage(ctx context.Context, sourceImageURLPattern string) (int64, error)
+	GetLeastUsedCachedImageInfos(ctx context.Context, sourceImageURLPattern string, order EvictionOrder, limit int) ([]CachedImageModel, error)
+	// ListCachedImageInfos returns entries ordered by storage key, starting from the given
+	// storage key, entries of images saved under legacy keys are skipped
+	ListCachedImageInfos(ctx context.Context, fromStorageKey string, limit int) ([]CachedImageModel, error)
+	// ListCachedImageInfosAfter returns entries the same as ListCachedImageInfos,
+	// starting from the storage key following the given one
+	ListCachedImageInfosAfter(ctx context.Context, afterStorageKey string, limit int) ([]CachedImageModel, error)
+	// SearchCachedImageInfos returns the page of ready entries matching the query
+	SearchCachedImageInfos(ctx context.Context, query CachedImagesQuery, page CachedImagesPage) ([]CachedImageModel, error)
+	// GetCachedImageSourcesStats returns number and total size of ready images matching the query
+	// per source image url, ordered by source image urls, starting after the given source image url
+	GetCachedImageSourcesStats(ctx context.Context, query CachedImagesQuery, afterSourceImageURL string, limit int) ([]CachedImageSourceStats, error)
 }
 
+type CachedImageAccess struct {
+	RequestSignature string
+	ProcessorType    string
+	LastAccessedAt   time.Time
+	Count            int64
+}
+
+type EvictionOrder string
+
+const (
+	// LeastRecentlyUsed orders entries by last access time
+	LeastRecentlyUsed EvictionOrder = "lru"
+	// LeastFrequentlyUsed orders entries by access count, then by last access time
+	LeastFrequentlyUsed EvictionOrder = "lfu"
+)
+
 type CachedImagesStorage interface {
-	Save(ctx context.Context, requestSignature, processorType, mimeType string, size int64, reader hub.DataStreamOutput) error
-	Get(ctx context.Context, requestSignature, processorType string, writer hub.DataStreamInput) error
+	// Save accepts negative size when size of the image is not known upfront,
+	// checksum is kept together with the image when the storage supports it
+	Save(ctx context.Context, requestSignature, processorType, mimeType string, size int64, checksum string, reader hub.DataStreamOutput) error
+	// Get does not return copies of images of other checksums, when the storage keeps
+	// copies of images, empty checksum of images saved before checksums matches all copies
+	Get(ctx context.Context, requestSignature, processorType, checksum string, writer hub.DataStreamInput) error
+	// SetChecksum keeps checksum of already saved image together with it when the storage
+	// supports it, checksum of cached images is known only after they are saved
+	SetChecksum(ctx context.Context, requestSignature, processorType, checksum string) error
 	Delete(ctx context.Context, requestSignature, processorType string) error
+	// WalkStorageKeys calls walkFn with storage keys and sizes of saved images in order
+	// of storage keys, images saved under legacy keys are skipped
+	WalkStorageKeys(ctx context.Context, walkFn func(storageKey string, size int64) error) error
+	// DeleteStorageKey removes image saved under the storage key, when its request signature is not known
+	DeleteStorageKey(ctx context.Context, storageKey string) error
+	// MigrateLegacyObjects moves objects saved under legacy keys to hashed keys
+	MigrateLegacyObjects(ctx context.Context, onMigrated func(requestSignature, processorType, storageKey string) error) (migratedObjects int, err error)
 }
 
 type InvalidationModel struct {
 	ProjectName string `json:"projectName" bson:"projectName"`
 	CommitHash  string `json:"commitHash" bson:"commitHash"`
 
-	InvalidationDate       time.Time          `json:"invalidationDate" bson:"invalidationDate"`
-	RequestedInvalidations []string           `json:"requestedInvalidations" bson:"requestedInvalidations"`
-	DoneInvalidations      []string           `json:"doneInvalidations" bson:"doneInvalidations"`
+	InvalidationDate       time.Time `json:"invalidationDate" bson:"invalidationDate"`
+	RequestedInvalidations []string  `json:"requestedInvalidations" bson:"requestedInvalidations"`
+	DoneInvalidations      []string  `json:"doneInvalidations" bson:"doneInvalidations"`
+	// InvalidatedImages are the first invalidated images, so the invalidation fits in a single document
 	InvalidatedImages      []CachedImageModel `json:"invalidatedImages" bson:"invalidatedImages"`
+	InvalidatedImagesCount int                `json:"invalidatedImagesCount" bson:"invalidatedImagesCount"`
 	InvalidationError      *string            `json:"invalidationError" bson:"invalidationError"`
+	// PatternMatches lists entries matched by every done invalidation
+	PatternMatches []InvalidationPatternMatch `json:"patternMatches" bson:"patternMatches"`
+}
+
+type InvalidationPatternType string
+
+const (
+	// ExactURLPattern matches the source image url equal to the pattern
+	ExactURLPattern InvalidationPatternType = "url"
+	PrefixPattern   InvalidationPatternType = "prefix"
+	// GlobPattern matches source image urls the same way as allowed domains, * matches any sequence of characters
+	GlobPattern InvalidationPatternType = "glob"
+	// RegexPattern is a regular expression which has to match the whole source image url
+	RegexPattern InvalidationPatternType = "regex"
+)
+
+type InvalidationPattern struct {
+	Type    InvalidationPatternType `json:"type" bson:"type"`
+	Pattern string                  `json:"pattern" bson:"pattern"`
+}
+
+// String returns the pattern prefixed with its type, exact urls are returned as they are
+func (p InvalidationPattern) String() string {
+	if p.Type == ExactURLPattern {
+		return p.Pattern
+	}
+
+	return string(p.Type) + ":" + p.Pattern
+}
+
+type InvalidationPatternMatch struct {
+	Type    InvalidationPatternType `json:"type" bson:"type"`
+	Pattern string                  `json:"pattern" bson:"pattern"`
+	// MatchedImages are storage keys of the first invalidated entries
+	MatchedImages      []string `json:"matchedImages" bson:"matchedImages"`
+	MatchedImagesCount int      `json:"matchedImagesCount" bson:"matchedImagesCount"`
 }
 
 type InvalidationsRepository interface {
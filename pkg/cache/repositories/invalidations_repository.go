@@ -11,13 +11,21 @@ import (
 )
 
 type invalidationRepository struct {
-	conn dbconnections.CacheDBConnection
+	conn dbconnections.MongoCacheDBConnection
 }
 
 var _ InvalidationsRepository = (*invalidationRepository)(nil)
 
+// NewInvalidationsRepository returns repository working on the database behind the connection
 func NewInvalidationsRepository(conn dbconnections.CacheDBConnection) InvalidationsRepository {
-	return &invalidationRepository{conn}
+	switch conn := conn.(type) {
+	case dbconnections.SQLCacheDBConnection:
+		return &sqlInvalidationsRepository{conn}
+	case dbconnections.BoltCacheDBConnection:
+		return &boltInvalidationsRepository{conn}
+	}
+
+	return &invalidationRepository{conn.(dbconnections.MongoCacheDBConnection)}
 }
 
 func (r *invalidationRepository) CreateInvalidation(ctx context.Context, invalidation InvalidationModel) error {
@@ -40,6 +40,7 @@ func createInvalidationModel(projectName, commitHash string, creationTime time.T
 		InvalidationDate:       creationTime,
 		RequestedInvalidations: requestedInvalidations,
 		InvalidatedImages:      invalidatedImagesResult,
+		InvalidatedImagesCount: len(invalidatedImagesResult),
 	}
 }
 
@@ -7,6 +7,7 @@ package mock_cacherepositories
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
@@ -92,3 +93,193 @@ func (mr *MockCachedImagesRepositoryMockRecorder) GetCachedImageInfosOfSource(ar
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCachedImageInfosOfSource", reflect.TypeOf((*MockCachedImagesRepository)(nil).GetCachedImageInfosOfSource), arg0, arg1)
 }
+
+// WalkCachedImageInfosOfSourcePrefix mocks base method.
+func (m *MockCachedImagesRepository) WalkCachedImageInfosOfSourcePrefix(arg0 context.Context, arg1 string, arg2 func(cacherepositories.CachedImageModel) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WalkCachedImageInfosOfSourcePrefix", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WalkCachedImageInfosOfSourcePrefix indicates an expected call of WalkCachedImageInfosOfSourcePrefix.
+func (mr *MockCachedImagesRepositoryMockRecorder) WalkCachedImageInfosOfSourcePrefix(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WalkCachedImageInfosOfSourcePrefix", reflect.TypeOf((*MockCachedImagesRepository)(nil).WalkCachedImageInfosOfSourcePrefix), arg0, arg1, arg2)
+}
+
+// MarkCachedImageReady mocks base method.
+func (m *MockCachedImagesRepository) MarkCachedImageReady(arg0 context.Context, arg1, arg2 string, arg3 int64, arg4 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkCachedImageReady", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkCachedImageReady indicates an expected call of MarkCachedImageReady.
+func (mr *MockCachedImagesRepositoryMockRecorder) MarkCachedImageReady(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkCachedImageReady", reflect.TypeOf((*MockCachedImagesRepository)(nil).MarkCachedImageReady), arg0, arg1, arg2, arg3, arg4)
+}
+
+// UpdateCachedImageSize mocks base method.
+func (m *MockCachedImagesRepository) UpdateCachedImageSize(arg0 context.Context, arg1, arg2 string, arg3 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateCachedImageSize", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateCachedImageSize indicates an expected call of UpdateCachedImageSize.
+func (mr *MockCachedImagesRepositoryMockRecorder) UpdateCachedImageSize(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCachedImageSize", reflect.TypeOf((*MockCachedImagesRepository)(nil).UpdateCachedImageSize), arg0, arg1, arg2, arg3)
+}
+
+// UpdateCachedImageStorageKey mocks base method.
+func (m *MockCachedImagesRepository) UpdateCachedImageStorageKey(arg0 context.Context, arg1, arg2, arg3 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateCachedImageStorageKey", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateCachedImageStorageKey indicates an expected call of UpdateCachedImageStorageKey.
+func (mr *MockCachedImagesRepositoryMockRecorder) UpdateCachedImageStorageKey(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCachedImageStorageKey", reflect.TypeOf((*MockCachedImagesRepository)(nil).UpdateCachedImageStorageKey), arg0, arg1, arg2, arg3)
+}
+
+// RecordCachedImageAccesses mocks base method.
+func (m *MockCachedImagesRepository) RecordCachedImageAccesses(arg0 context.Context, arg1 []cacherepositories.CachedImageAccess) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordCachedImageAccesses", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordCachedImageAccesses indicates an expected call of RecordCachedImageAccesses.
+func (mr *MockCachedImagesRepositoryMockRecorder) RecordCachedImageAccesses(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordCachedImageAccesses", reflect.TypeOf((*MockCachedImagesRepository)(nil).RecordCachedImageAccesses), arg0, arg1)
+}
+
+// GetExpiredCachedImageInfos mocks base method.
+func (m *MockCachedImagesRepository) GetExpiredCachedImageInfos(arg0 context.Context, arg1 time.Time, arg2 int) ([]cacherepositories.CachedImageModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExpiredCachedImageInfos", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]cacherepositories.CachedImageModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExpiredCachedImageInfos indicates an expected call of GetExpiredCachedImageInfos.
+func (mr *MockCachedImagesRepositoryMockRecorder) GetExpiredCachedImageInfos(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExpiredCachedImageInfos", reflect.TypeOf((*MockCachedImagesRepository)(nil).GetExpiredCachedImageInfos), arg0, arg1, arg2)
+}
+
+// GetPendingCachedImageInfos mocks base method.
+func (m *MockCachedImagesRepository) GetPendingCachedImageInfos(arg0 context.Context, arg1 time.Time, arg2 int) ([]cacherepositories.CachedImageModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPendingCachedImageInfos", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]cacherepositories.CachedImageModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPendingCachedImageInfos indicates an expected call of GetPendingCachedImageInfos.
+func (mr *MockCachedImagesRepositoryMockRecorder) GetPendingCachedImageInfos(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPendingCachedImageInfos", reflect.TypeOf((*MockCachedImagesRepository)(nil).GetPendingCachedImageInfos), arg0, arg1, arg2)
+}
+
+// GetCachedImagesUsage mocks base method.
+func (m *MockCachedImagesRepository) GetCachedImagesUsage(arg0 context.Context, arg1 string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCachedImagesUsage", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCachedImagesUsage indicates an expected call of GetCachedImagesUsage.
+func (mr *MockCachedImagesRepositoryMockRecorder) GetCachedImagesUsage(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCachedImagesUsage", reflect.TypeOf((*MockCachedImagesRepository)(nil).GetCachedImagesUsage), arg0, arg1)
+}
+
+// GetLeastUsedCachedImageInfos mocks base method.
+func (m *MockCachedImagesRepository) GetLeastUsedCachedImageInfos(arg0 context.Context, arg1 string, arg2 cacherepositories.EvictionOrder, arg3 int) ([]cacherepositories.CachedImageModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLeastUsedCachedImageInfos", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]cacherepositories.CachedImageModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLeastUsedCachedImageInfos indicates an expected call of GetLeastUsedCachedImageInfos.
+func (mr *MockCachedImagesRepositoryMockRecorder) GetLeastUsedCachedImageInfos(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLeastUsedCachedImageInfos", reflect.TypeOf((*MockCachedImagesRepository)(nil).GetLeastUsedCachedImageInfos), arg0, arg1, arg2, arg3)
+}
+
+// ListCachedImageInfos mocks base method.
+func (m *MockCachedImagesRepository) ListCachedImageInfos(arg0 context.Context, arg1 string, arg2 int) ([]cacherepositories.CachedImageModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListCachedImageInfos", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]cacherepositories.CachedImageModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListCachedImageInfos indicates an expected call of ListCachedImageInfos.
+func (mr *MockCachedImagesRepositoryMockRecorder) ListCachedImageInfos(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListCachedImageInfos", reflect.TypeOf((*MockCachedImagesRepository)(nil).ListCachedImageInfos), arg0, arg1, arg2)
+}
+
+// ListCachedImageInfosAfter mocks base method.
+func (m *MockCachedImagesRepository) ListCachedImageInfosAfter(arg0 context.Context, arg1 string, arg2 int) ([]cacherepositories.CachedImageModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListCachedImageInfosAfter", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]cacherepositories.CachedImageModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListCachedImageInfosAfter indicates an expected call of ListCachedImageInfosAfter.
+func (mr *MockCachedImagesRepositoryMockRecorder) ListCachedImageInfosAfter(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListCachedImageInfosAfter", reflect.TypeOf((*MockCachedImagesRepository)(nil).ListCachedImageInfosAfter), arg0, arg1, arg2)
+}
+
+// SearchCachedImageInfos mocks base method.
+func (m *MockCachedImagesRepository) SearchCachedImageInfos(arg0 context.Context, arg1 cacherepositories.CachedImagesQuery, arg2 cacherepositories.CachedImagesPage) ([]cacherepositories.CachedImageModel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchCachedImageInfos", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]cacherepositories.CachedImageModel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchCachedImageInfos indicates an expected call of SearchCachedImageInfos.
+func (mr *MockCachedImagesRepositoryMockRecorder) SearchCachedImageInfos(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchCachedImageInfos", reflect.TypeOf((*MockCachedImagesRepository)(nil).SearchCachedImageInfos), arg0, arg1, arg2)
+}
+
+// GetCachedImageSourcesStats mocks base method.
+func (m *MockCachedImagesRepository) GetCachedImageSourcesStats(arg0 context.Context, arg1 cacherepositories.CachedImagesQuery, arg2 string, arg3 int) ([]cacherepositories.CachedImageSourceStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCachedImageSourcesStats", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]cacherepositories.CachedImageSourceStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCachedImageSourcesStats indicates an expected call of GetCachedImageSourcesStats.
+func (mr *MockCachedImagesRepositoryMockRecorder) GetCachedImageSourcesStats(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCachedImageSourcesStats", reflect.TypeOf((*MockCachedImagesRepository)(nil).GetCachedImageSourcesStats), arg0, arg1, arg2, arg3)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	context "context"
 	"io"
+	"sort"
 	"sync"
 
 	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
@@ -11,15 +12,17 @@ import (
 )
 
 type MockCachedImagesStorage struct {
-	images map[string][]byte
-	lock   sync.Mutex
-	err    error
+	images    map[string][]byte
+	checksums map[string]string
+	lock      sync.Mutex
+	err       error
 }
 
 func NewMockCachedImagesStorage() *MockCachedImagesStorage {
 	return &MockCachedImagesStorage{
-		images: make(map[string][]byte),
-		lock:   sync.Mutex{},
+		images:    make(map[string][]byte),
+		checksums: make(map[string]string),
+		lock:      sync.Mutex{},
 	}
 }
 
@@ -38,7 +41,7 @@ func (s *MockCachedImagesStorage) ReturnError(err error) {
 	s.err = err
 }
 
-func (s *MockCachedImagesStorage) Save(ctx context.Context, requestSignature, processorType, mimeType string, size int64, reader hub.DataStreamOutput) error {
+func (s *MockCachedImagesStorage) Save(ctx context.Context, requestSignature, processorType, mimeType string, size int64, checksum string, reader hub.DataStreamOutput) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
@@ -60,7 +63,7 @@ func (s *MockCachedImagesStorage) Save(ctx context.Context, requestSignature, pr
 	return nil
 }
 
-func (s *MockCachedImagesStorage) Get(ctx context.Context, requestSignature, processorType string, writer hub.DataStreamInput) error {
+func (s *MockCachedImagesStorage) Get(ctx context.Context, requestSignature, processorType, checksum string, writer hub.DataStreamInput) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
@@ -79,6 +82,31 @@ func (s *MockCachedImagesStorage) Get(ctx context.Context, requestSignature, pro
 	return cacherepositories.ErrImageNotFound
 }
 
+func (s *MockCachedImagesStorage) SetChecksum(ctx context.Context, requestSignature, processorType, checksum string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	resourceID := s.generateResourceID(requestSignature, processorType)
+	if _, ok := s.images[resourceID]; !ok {
+		return cacherepositories.ErrImageNotFound
+	}
+
+	s.checksums[resourceID] = checksum
+	return nil
+}
+
+// Checksum returns checksum set using SetChecksum
+func (s *MockCachedImagesStorage) Checksum(requestSignature, processorType string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.checksums[s.generateResourceID(requestSignature, processorType)]
+}
+
 func (s *MockCachedImagesStorage) Delete(ctx context.Context, requestSignature, processorType string) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -90,6 +118,58 @@ func (s *MockCachedImagesStorage) Delete(ctx context.Context, requestSignature,
 	resourceID := s.generateResourceID(requestSignature, processorType)
 	if _, ok := s.images[resourceID]; ok {
 		delete(s.images, resourceID)
+		delete(s.checksums, resourceID)
+		return nil
+	}
+
+	return cacherepositories.ErrImageNotFound
+}
+
+// MigrateLegacyObjects does nothing, because all images are saved in memory under the same keys
+func (s *MockCachedImagesStorage) MigrateLegacyObjects(ctx context.Context, onMigrated func(requestSignature, processorType, storageKey string) error) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return 0, s.err
+}
+
+func (s *MockCachedImagesStorage) WalkStorageKeys(ctx context.Context, walkFn func(storageKey string, size int64) error) error {
+	s.lock.Lock()
+	if s.err != nil {
+		s.lock.Unlock()
+		return s.err
+	}
+
+	keys := make([]string, 0, len(s.images))
+	sizes := make(map[string]int64, len(s.images))
+	for key, data := range s.images {
+		keys = append(keys, key)
+		sizes[key] = int64(len(data))
+	}
+	s.lock.Unlock()
+
+	// lock is released, so walkFn can use the storage
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := walkFn(key, sizes[key]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *MockCachedImagesStorage) DeleteStorageKey(ctx context.Context, storageKey string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	if _, ok := s.images[storageKey]; ok {
+		delete(s.images, storageKey)
+		delete(s.checksums, storageKey)
 		return nil
 	}
 
@@ -106,5 +186,5 @@ func (s *MockCachedImagesStorage) Exists(requestSignature, processorType string)
 }
 
 func (s *MockCachedImagesStorage) generateResourceID(requestSignature, processorType string) string {
-	return requestSignature + "::" + processorType
+	return cacherepositories.StorageKey(requestSignature, processorType)
 }
@@ -0,0 +1,92 @@
+package cacherepositories
+
+import (
+	"context"
+	"time"
+
+	dbconnections "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/connections"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateMongoCacheDBIndexes creates indexes used by repositories working on MongoDB and migrates
+// entries saved by older versions, it has to be called before repositories are used,
+// existing indexes are left untouched
+func CreateMongoCacheDBIndexes(ctx context.Context, conn dbconnections.MongoCacheDBConnection) error {
+	collection := conn.Collection("cachedImages")
+	if err := backfillMongoCachedImagesCreationTimes(ctx, collection); err != nil {
+		return err
+	}
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "requestSignature", Value: 1}, {Key: "processorType", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "state", Value: 1}, {Key: "createdAt", Value: 1}}},
+		{Keys: bson.D{{Key: "storageKey", Value: 1}}},
+		// indexes of entries browsed by the admin api, ordered by sort fields
+		{Keys: browsedCachedImagesIndexKeys("sourceImageURL")},
+		{Keys: browsedCachedImagesIndexKeys("createdAt")},
+		{Keys: browsedCachedImagesIndexKeys("imageSize")},
+	}
+
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	// entries could be duplicated by concurrent saves before the unique index was created
+	if err := removeDuplicatedMongoCachedImages(ctx, collection); err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// entries saved before creation times were kept have no creation time, missing fields are sorted
+// before all dates, but read as the zero time, so they could not be paged by creation time
+// using the last read entry, the zero time is set, so they are sorted the same way as they are read
+func backfillMongoCachedImagesCreationTimes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.UpdateMany(ctx, bson.M{"createdAt": nil}, bson.M{"$set": bson.M{"createdAt": time.Time{}}})
+	return err
+}
+
+func browsedCachedImagesIndexKeys(sortField string) bson.D {
+	return bson.D{{Key: sortField, Value: 1}, {Key: "requestSignature", Value: 1}, {Key: "processorType", Value: 1}}
+}
+
+// duplicated entries share the same image, so only entries are removed
+func removeDuplicatedMongoCachedImages(ctx context.Context, collection *mongo.Collection) error {
+	pipeline := []bson.M{
+		{"$group": bson.M{
+			"_id":   bson.M{"requestSignature": "$requestSignature", "processorType": "$processorType"},
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+
+	var duplicates []struct {
+		IDs []interface{} `bson:"ids"`
+	}
+
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+
+	for _, duplicate := range duplicates {
+		if _, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": duplicate.IDs[1:]}}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,383 @@
+package cacherepositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	dbconnections "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/connections"
+)
+
+type sqlCachedImagesRepository struct {
+	conn dbconnections.SQLCacheDBConnection
+}
+
+var _ CachedImagesRepository = (*sqlCachedImagesRepository)(nil)
+
+const sqlCachedImageColumns = `raw_request, request_signature, processor_type, processor_endpoint,
+	mime_type, image_size, source_image_url, processing_params, storage_key,
+	created_at, expires_at, last_accessed_at, access_count, state, checksum`
+
+func (repo *sqlCachedImagesRepository) CreateCachedImageInfo(ctx context.Context, info CachedImageModel) error {
+	info.StorageKey = StorageKey(info.RequestSignature, info.ProcessorType)
+	if info.CreatedAt.IsZero() {
+		info.CreatedAt = time.Now()
+	}
+	info.LastAccessedAt = info.CreatedAt
+
+	processingParams, err := json.Marshal(info.ProcessingParams)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO cached_images (` + sqlCachedImageColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (request_signature, processor_type) DO NOTHING`
+
+	result, err := repo.conn.DB().ExecContext(ctx, repo.rebind(query),
+		info.RawRequest, info.RequestSignature, info.ProcessorType, info.ProcessorEndpoint,
+		info.MimeType, info.ImageSize, info.SourceImageURL, string(processingParams), info.StorageKey,
+		sqlTime(info.CreatedAt), sqlTime(info.ExpiresAt), sqlTime(info.LastAccessedAt), info.AccessCount, info.State, info.Checksum,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if inserted == 0 {
+		return ErrCachedImageAlreadyExists
+	}
+
+	return nil
+}
+
+func (repo *sqlCachedImagesRepository) DeleteCachedImageInfo(ctx context.Context, requestSignature, processorType string) error {
+	query := "DELETE FROM cached_images WHERE request_signature = ? AND processor_type = ?"
+	return repo.execOnExistingImage(ctx, query, requestSignature, processorType)
+}
+
+func (repo *sqlCachedImagesRepository) GetCachedImageInfo(ctx context.Context, requestSignature, processorType string) (CachedImageModel, error) {
+	query := "SELECT " + sqlCachedImageColumns + " FROM cached_images WHERE request_signature = ? AND processor_type = ? AND state <> ?"
+	row := repo.conn.DB().QueryRowContext(ctx, repo.rebind(query), requestSignature, processorType, CachedImagePending)
+
+	info, err := scanSQLCachedImage(row)
+	if err == sql.ErrNoRows {
+		return CachedImageModel{}, ErrCachedImageNotFound
+	}
+
+	return info, err
+}
+
+func (repo *sqlCachedImagesRepository) GetCachedImageInfosOfSource(ctx context.Context, sourceImageURL string) ([]CachedImageModel, error) {
+	query := "SELECT " + sqlCachedImageColumns + " FROM cached_images WHERE source_image_url = ?"
+	return repo.query(ctx, query, sourceImageURL)
+}
+
+func (repo *sqlCachedImagesRepository) WalkCachedImageInfosOfSourcePrefix(ctx context.Context, sourceImageURLPrefix string, walkFn func(info CachedImageModel) error) error {
+	dialect := repo.conn.Dialect()
+	query := "SELECT " + sqlCachedImageColumns + " FROM cached_images WHERE " + sqlGlobCondition(dialect, "source_image_url")
+	return repo.walk(ctx, walkFn, query, sqlPrefixPattern(dialect, sourceImageURLPrefix))
+}
+
+func (repo *sqlCachedImagesRepository) MarkCachedImageReady(ctx context.Context, requestSignature, processorType string, size int64, checksum string) error {
+	query := "UPDATE cached_images SET image_size = ?, checksum = ?, state = ? WHERE request_signature = ? AND processor_type = ?"
+	return repo.execOnExistingImage(ctx, query, size, checksum, CachedImageReady, requestSignature, processorType)
+}
+
+func (repo *sqlCachedImagesRepository) UpdateCachedImageSize(ctx context.Context, requestSignature, processorType string, size int64) error {
+	query := "UPDATE cached_images SET image_size = ? WHERE request_signature = ? AND processor_type = ?"
+	return repo.execOnExistingImage(ctx, query, size, requestSignature, processorType)
+}
+
+func (repo *sqlCachedImagesRepository) UpdateCachedImageStorageKey(ctx context.Context, requestSignature, processorType, storageKey string) error {
+	query := "UPDATE cached_images SET storage_key = ? WHERE request_signature = ? AND processor_type = ?"
+	return repo.execOnExistingImage(ctx, query, storageKey, requestSignature, processorType)
+}
+
+func (repo *sqlCachedImagesRepository) RecordCachedImageAccesses(ctx context.Context, accesses []CachedImageAccess) error {
+	if len(accesses) == 0 {
+		return nil
+	}
+
+	tx, err := repo.conn.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE cached_images SET
+		last_accessed_at = CASE WHEN last_accessed_at < ? THEN ? ELSE last_accessed_at END,
+		access_count = access_count + ?
+		WHERE request_signature = ? AND processor_type = ?`
+
+	statement, err := tx.PrepareContext(ctx, repo.rebind(query))
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	for _, access := range accesses {
+		lastAccessedAt := sqlTime(access.LastAccessedAt)
+		if _, err := statement.ExecContext(ctx, lastAccessedAt, lastAccessedAt, access.Count, access.RequestSignature, access.ProcessorType); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (repo *sqlCachedImagesRepository) GetExpiredCachedImageInfos(ctx context.Context, now time.Time, limit int) ([]CachedImageModel, error) {
+	// entries which never expire have no expiration time
+	query := "SELECT " + sqlCachedImageColumns + " FROM cached_images WHERE expires_at IS NOT NULL AND expires_at <= ? LIMIT ?"
+	return repo.query(ctx, query, sqlTime(now), limit)
+}
+
+func (repo *sqlCachedImagesRepository) GetPendingCachedImageInfos(ctx context.Context, createdBefore time.Time, limit int) ([]CachedImageModel, error) {
+	query := "SELECT " + sqlCachedImageColumns + " FROM cached_images WHERE state = ? AND created_at < ? LIMIT ?"
+	return repo.query(ctx, query, CachedImagePending, sqlTime(createdBefore), limit)
+}
+
+func (repo *sqlCachedImagesRepository) GetCachedImagesUsage(ctx context.Context, sourceImageURLPattern string) (int64, error) {
+	condition, args := repo.makeSavedImagesCondition(sourceImageURLPattern)
+	query := "SELECT COALESCE(SUM(image_size), 0) FROM cached_images WHERE " + condition
+
+	var usage int64
+	err := repo.conn.DB().QueryRowContext(ctx, repo.rebind(query), args...).Scan(&usage)
+	return usage, err
+}
+
+func (repo *sqlCachedImagesRepository) GetLeastUsedCachedImageInfos(ctx context.Context, sourceImageURLPattern string, order EvictionOrder, limit int) ([]CachedImageModel, error) {
+	sort := "last_accessed_at"
+	if order == LeastFrequentlyUsed {
+		sort = "access_count, last_accessed_at"
+	}
+
+	condition, args := repo.makeSavedImagesCondition(sourceImageURLPattern)
+	query := "SELECT " + sqlCachedImageColumns + " FROM cached_images WHERE " + condition + " ORDER BY " + sort + " LIMIT ?"
+	return repo.query(ctx, query, append(args, limit)...)
+}
+
+func (repo *sqlCachedImagesRepository) ListCachedImageInfos(ctx context.Context, fromStorageKey string, limit int) ([]CachedImageModel, error) {
+	// entries saved under legacy keys have empty storage key
+	storageKey := sqlByteOrderColumn(repo.conn.Dialect(), "storage_key")
+	query := "SELECT " + sqlCachedImageColumns + " FROM cached_images WHERE " + storageKey + " >= ? AND storage_key <> '' ORDER BY " + storageKey + " LIMIT ?"
+	return repo.query(ctx, query, fromStorageKey, limit)
+}
+
+func (repo *sqlCachedImagesRepository) ListCachedImageInfosAfter(ctx context.Context, afterStorageKey string, limit int) ([]CachedImageModel, error) {
+	// legacy entries are skipped also when the key is empty
+	storageKey := sqlByteOrderColumn(repo.conn.Dialect(), "storage_key")
+	query := "SELECT " + sqlCachedImageColumns + " FROM cached_images WHERE " + storageKey + " > ? ORDER BY " + storageKey + " LIMIT ?"
+	return repo.query(ctx, query, afterStorageKey, limit)
+}
+
+func (repo *sqlCachedImagesRepository) SearchCachedImageInfos(ctx context.Context, query CachedImagesQuery, page CachedImagesPage) ([]CachedImageModel, error) {
+	sortColumn, sortValue := "created_at", func(info CachedImageModel) interface{} { return sqlTime(info.CreatedAt) }
+	switch page.SortBy {
+	case SortByImageSize:
+		sortColumn, sortValue = "image_size", func(info CachedImageModel) interface{} { return info.ImageSize }
+	case SortBySourceImageURL:
+		sortColumn, sortValue = "source_image_url", func(info CachedImageModel) interface{} { return info.SourceImageURL }
+	}
+
+	direction, operator := "ASC", ">"
+	if page.Descending {
+		direction, operator = "DESC", "<"
+	}
+
+	condition, args := repo.makeQueryCondition(query, "")
+	if page.After != nil {
+		condition += " AND (" + sortColumn + ", request_signature, processor_type) " + operator + " (?, ?, ?)"
+		args = append(args, sortValue(*page.After), page.After.RequestSignature, page.After.ProcessorType)
+	}
+
+	order := sortColumn + " " + direction + ", request_signature " + direction + ", processor_type " + direction
+	selectQuery := "SELECT " + sqlCachedImageColumns + " FROM cached_images WHERE " + condition + " ORDER BY " + order + " LIMIT ?"
+	return repo.query(ctx, selectQuery, append(args, page.Limit)...)
+}
+
+func (repo *sqlCachedImagesRepository) GetCachedImageSourcesStats(ctx context.Context, query CachedImagesQuery, afterSourceImageURL string, limit int) ([]CachedImageSourceStats, error) {
+	condition, args := repo.makeQueryCondition(query, afterSourceImageURL)
+	selectQuery := "SELECT source_image_url, COUNT(*), COALESCE(SUM(image_size), 0) FROM cached_images WHERE " + condition +
+		" GROUP BY source_image_url ORDER BY source_image_url LIMIT ?"
+
+	rows, err := repo.conn.DB().QueryContext(ctx, repo.rebind(selectQuery), append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []CachedImageSourceStats
+	for rows.Next() {
+		var source CachedImageSourceStats
+		if err := rows.Scan(&source.SourceImageURL, &source.Images, &source.Bytes); err != nil {
+			return nil, err
+		}
+
+		stats = append(stats, source)
+	}
+
+	return stats, rows.Err()
+}
+
+// makeQueryCondition matches saved images selected by the query,
+// which have source image url greater than the given one
+func (repo *sqlCachedImagesRepository) makeQueryCondition(query CachedImagesQuery, afterSourceImageURL string) (string, []interface{}) {
+	dialect := repo.conn.Dialect()
+	conditions, args := repo.makeSavedImagesCondition("")
+
+	add := func(condition string, arg interface{}) {
+		conditions += " AND " + condition
+		args = append(args, arg)
+	}
+
+	if query.SourceImageURL != "" {
+		add("source_image_url = ?", query.SourceImageURL)
+	}
+
+	if query.SourceImageURLPrefix != "" {
+		add(sqlGlobCondition(dialect, "source_image_url"), sqlPrefixPattern(dialect, query.SourceImageURLPrefix))
+	}
+
+	if query.SourceImageURLPattern != "" {
+		add(sqlGlobCondition(dialect, "source_image_url"), sqlGlobPattern(dialect, query.SourceImageURLPattern))
+	}
+
+	if afterSourceImageURL != "" {
+		add("source_image_url > ?", afterSourceImageURL)
+	}
+
+	if query.ProcessorType != "" {
+		add("processor_type = ?", query.ProcessorType)
+	}
+
+	if query.ProcessorEndpoint != "" {
+		add("processor_endpoint = ?", query.ProcessorEndpoint)
+	}
+
+	if query.MimeType != "" {
+		add("mime_type = ?", query.MimeType)
+	}
+
+	if query.MinImageSize > 0 {
+		add("image_size >= ?", query.MinImageSize)
+	}
+
+	if query.MaxImageSize > 0 {
+		add("image_size <= ?", query.MaxImageSize)
+	}
+
+	if !query.CreatedAfter.IsZero() {
+		add("created_at >= ?", sqlTime(query.CreatedAfter))
+	}
+
+	if !query.CreatedBefore.IsZero() {
+		add("created_at < ?", sqlTime(query.CreatedBefore))
+	}
+
+	return conditions, args
+}
+
+// images which are still being saved are pending, images of
+// legacy entries which are still being saved have negative size
+func (repo *sqlCachedImagesRepository) makeSavedImagesCondition(sourceImageURLPattern string) (string, []interface{}) {
+	condition, args := "image_size >= 0 AND state <> ?", []interface{}{CachedImagePending}
+	if sourceImageURLPattern == "" {
+		return condition, args
+	}
+
+	dialect := repo.conn.Dialect()
+	condition += " AND " + sqlGlobCondition(dialect, "source_image_url")
+	return condition, append(args, sqlGlobPattern(dialect, sourceImageURLPattern))
+}
+
+func (repo *sqlCachedImagesRepository) execOnExistingImage(ctx context.Context, query string, args ...interface{}) error {
+	result, err := repo.conn.DB().ExecContext(ctx, repo.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrCachedImageNotFound
+	}
+
+	return nil
+}
+
+func (repo *sqlCachedImagesRepository) query(ctx context.Context, query string, args ...interface{}) ([]CachedImageModel, error) {
+	var infos []CachedImageModel
+	err := repo.walk(ctx, func(info CachedImageModel) error {
+		infos = append(infos, info)
+		return nil
+	}, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return infos, nil
+}
+
+func (repo *sqlCachedImagesRepository) walk(ctx context.Context, walkFn func(info CachedImageModel) error, query string, args ...interface{}) error {
+	rows, err := repo.conn.DB().QueryContext(ctx, repo.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		info, err := scanSQLCachedImage(rows)
+		if err != nil {
+			return err
+		}
+
+		if err := walkFn(info); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (repo *sqlCachedImagesRepository) rebind(query string) string {
+	return rebindSQLQuery(repo.conn.Dialect(), query)
+}
+
+// sqlRowScanner is implemented by both sql.Row and sql.Rows
+type sqlRowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSQLCachedImage(row sqlRowScanner) (CachedImageModel, error) {
+	var info CachedImageModel
+	var processingParams string
+	var expiresAt sql.NullTime
+
+	err := row.Scan(
+		&info.RawRequest, &info.RequestSignature, &info.ProcessorType, &info.ProcessorEndpoint,
+		&info.MimeType, &info.ImageSize, &info.SourceImageURL, &processingParams, &info.StorageKey,
+		&info.CreatedAt, &expiresAt, &info.LastAccessedAt, &info.AccessCount, &info.State, &info.Checksum,
+	)
+
+	if err != nil {
+		return CachedImageModel{}, err
+	}
+
+	if expiresAt.Valid {
+		info.ExpiresAt = expiresAt.Time
+	}
+
+	err = json.Unmarshal([]byte(processingParams), &info.ProcessingParams)
+	return info, err
+}
@@ -0,0 +1,96 @@
+package cacherepositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	dbconnections "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/connections"
+)
+
+type sqlInvalidationsRepository struct {
+	conn dbconnections.SQLCacheDBConnection
+}
+
+var _ InvalidationsRepository = (*sqlInvalidationsRepository)(nil)
+
+func (r *sqlInvalidationsRepository) CreateInvalidation(ctx context.Context, invalidation InvalidationModel) error {
+	if invalidation.ProjectName == "" {
+		return ErrProjectNameNotAllowed
+	}
+
+	if invalidation.CommitHash == "" {
+		return ErrCommitHashNotAllowed
+	}
+
+	// lists are kept as json, because they are always read together with the invalidation
+	var lists [4][]byte
+	for i, list := range []interface{}{invalidation.RequestedInvalidations, invalidation.DoneInvalidations, invalidation.InvalidatedImages, invalidation.PatternMatches} {
+		encoded, err := json.Marshal(list)
+		if err != nil {
+			return err
+		}
+
+		lists[i] = encoded
+	}
+
+	query := `INSERT INTO invalidations (project_name, commit_hash, invalidation_date,
+		requested_invalidations, done_invalidations, invalidated_images, invalidated_images_count, invalidation_error, pattern_matches)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := r.conn.DB().ExecContext(ctx, rebindSQLQuery(r.conn.Dialect(), query),
+		invalidation.ProjectName, invalidation.CommitHash, sqlTime(invalidation.InvalidationDate),
+		string(lists[0]), string(lists[1]), string(lists[2]), invalidation.InvalidatedImagesCount, invalidation.InvalidationError, string(lists[3]),
+	)
+
+	return err
+}
+
+func (r *sqlInvalidationsRepository) GetLatestInvalidation(ctx context.Context, projectName string) (InvalidationModel, error) {
+	if projectName == "" {
+		return InvalidationModel{}, ErrProjectNameNotAllowed
+	}
+
+	query := `SELECT project_name, commit_hash, invalidation_date,
+		requested_invalidations, done_invalidations, invalidated_images, invalidated_images_count, invalidation_error, pattern_matches
+		FROM invalidations WHERE project_name = ? ORDER BY invalidation_date DESC LIMIT 1`
+
+	var invalidation InvalidationModel
+	var requestedInvalidations, doneInvalidations, invalidatedImages, patternMatches string
+	var invalidationError sql.NullString
+
+	err := r.conn.DB().QueryRowContext(ctx, rebindSQLQuery(r.conn.Dialect(), query), projectName).Scan(
+		&invalidation.ProjectName, &invalidation.CommitHash, &invalidation.InvalidationDate,
+		&requestedInvalidations, &doneInvalidations, &invalidatedImages, &invalidation.InvalidatedImagesCount, &invalidationError, &patternMatches,
+	)
+
+	if err == sql.ErrNoRows {
+		return InvalidationModel{}, ErrProjectNotFound
+	}
+
+	if err != nil {
+		return InvalidationModel{}, err
+	}
+
+	if invalidationError.Valid {
+		invalidation.InvalidationError = &invalidationError.String
+	}
+
+	lists := []struct {
+		encoded string
+		decoded interface{}
+	}{
+		{requestedInvalidations, &invalidation.RequestedInvalidations},
+		{doneInvalidations, &invalidation.DoneInvalidations},
+		{invalidatedImages, &invalidation.InvalidatedImages},
+		{patternMatches, &invalidation.PatternMatches},
+	}
+
+	for _, list := range lists {
+		if err := json.Unmarshal([]byte(list.encoded), list.decoded); err != nil {
+			return InvalidationModel{}, err
+		}
+	}
+
+	return invalidation, nil
+}
@@ -0,0 +1,229 @@
+package cacherepositories
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	dbconnections "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/connections"
+)
+
+// sqlMigrations are applied in order, the version of the migration is its
+// position in the list, so already released migrations must never be changed
+var sqlMigrations = []func(dialect dbconnections.SQLDialect) []string{
+	func(dialect dbconnections.SQLDialect) []string {
+		timestamp := sqlTimestampType(dialect)
+		return []string{
+			`CREATE TABLE cached_images (
+				request_signature TEXT NOT NULL,
+				processor_type TEXT NOT NULL,
+				raw_request TEXT NOT NULL,
+				processor_endpoint TEXT NOT NULL,
+				mime_type TEXT NOT NULL,
+				image_size BIGINT NOT NULL,
+				source_image_url TEXT NOT NULL,
+				processing_params TEXT NOT NULL,
+				storage_key TEXT NOT NULL,
+				created_at ` + timestamp + ` NOT NULL,
+				expires_at ` + timestamp + `,
+				last_accessed_at ` + timestamp + ` NOT NULL,
+				access_count BIGINT NOT NULL DEFAULT 0,
+				PRIMARY KEY (request_signature, processor_type)
+			)`,
+			`CREATE INDEX cached_images_source_image_url ON cached_images (source_image_url)`,
+			`CREATE INDEX cached_images_expires_at ON cached_images (expires_at)`,
+			`CREATE INDEX cached_images_last_accessed_at ON cached_images (last_accessed_at)`,
+			`CREATE TABLE invalidations (
+				project_name TEXT NOT NULL,
+				commit_hash TEXT NOT NULL,
+				invalidation_date ` + timestamp + ` NOT NULL,
+				requested_invalidations TEXT NOT NULL,
+				done_invalidations TEXT NOT NULL,
+				invalidated_images TEXT NOT NULL,
+				invalidation_error TEXT
+			)`,
+			`CREATE INDEX invalidations_project_name_invalidation_date ON invalidations (project_name, invalidation_date)`,
+		}
+	},
+	func(dialect dbconnections.SQLDialect) []string {
+		return []string{
+			`CREATE INDEX cached_images_storage_key ON cached_images (storage_key)`,
+		}
+	},
+	func(dialect dbconnections.SQLDialect) []string {
+		return []string{
+			`ALTER TABLE cached_images ADD COLUMN state TEXT NOT NULL DEFAULT 'ready'`,
+			`CREATE INDEX cached_images_state_created_at ON cached_images (state, created_at)`,
+		}
+	},
+	func(dialect dbconnections.SQLDialect) []string {
+		return []string{
+			`ALTER TABLE cached_images ADD COLUMN checksum TEXT NOT NULL DEFAULT ''`,
+		}
+	},
+	func(dialect dbconnections.SQLDialect) []string {
+		return []string{
+			`DROP INDEX cached_images_source_image_url`,
+			`CREATE INDEX cached_images_source_image_url ON cached_images (source_image_url, request_signature, processor_type)`,
+			`CREATE INDEX cached_images_created_at ON cached_images (created_at, request_signature, processor_type)`,
+			`CREATE INDEX cached_images_image_size ON cached_images (image_size, request_signature, processor_type)`,
+		}
+	},
+	func(dialect dbconnections.SQLDialect) []string {
+		return []string{
+			`ALTER TABLE invalidations ADD COLUMN pattern_matches TEXT NOT NULL DEFAULT '[]'`,
+		}
+	},
+	func(dialect dbconnections.SQLDialect) []string {
+		// SQLite compares texts byte by byte by default
+		if dialect != dbconnections.PostgresDialect {
+			return nil
+		}
+
+		return []string{
+			`CREATE INDEX cached_images_storage_key_bytes ON cached_images (storage_key COLLATE "C")`,
+		}
+	},
+	func(dialect dbconnections.SQLDialect) []string {
+		return []string{
+			`ALTER TABLE invalidations ADD COLUMN invalidated_images_count BIGINT NOT NULL DEFAULT 0`,
+		}
+	},
+}
+
+// MigrateSQLCacheDB creates and updates tables used by SQL repositories,
+// every applied migration is recorded in the schema_migrations table
+func MigrateSQLCacheDB(ctx context.Context, conn dbconnections.SQLCacheDBConnection) (appliedMigrations int, err error) {
+	db, dialect := conn.DB(), conn.Dialect()
+
+	createMigrationsTable := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at ` + sqlTimestampType(dialect) + ` NOT NULL
+	)`
+
+	if _, err := db.ExecContext(ctx, createMigrationsTable); err != nil {
+		return 0, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// other instances started at the same time wait until migrations are applied
+	if dialect == dbconnections.PostgresDialect {
+		if _, err := tx.ExecContext(ctx, "LOCK TABLE schema_migrations IN EXCLUSIVE MODE"); err != nil {
+			return 0, err
+		}
+	}
+
+	var version int
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, err
+	}
+
+	if version > len(sqlMigrations) {
+		return 0, ErrUnknownSchemaVersion
+	}
+
+	for ; version < len(sqlMigrations); version++ {
+		for _, statement := range sqlMigrations[version](dialect) {
+			if _, err := tx.ExecContext(ctx, statement); err != nil {
+				return 0, err
+			}
+		}
+
+		query := rebindSQLQuery(dialect, "INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)")
+		if _, err := tx.ExecContext(ctx, query, version+1, time.Now().UTC()); err != nil {
+			return 0, err
+		}
+
+		appliedMigrations++
+	}
+
+	return appliedMigrations, tx.Commit()
+}
+
+func sqlTimestampType(dialect dbconnections.SQLDialect) string {
+	// SQLite driver parses only columns declared as date, datetime or timestamp
+	if dialect == dbconnections.SQLiteDialect {
+		return "DATETIME"
+	}
+
+	return "TIMESTAMP WITH TIME ZONE"
+}
+
+// rebindSQLQuery replaces ? placeholders with numbered ones when the dialect requires them
+func rebindSQLQuery(dialect dbconnections.SQLDialect, query string) string {
+	if dialect != dbconnections.PostgresDialect {
+		return query
+	}
+
+	var result strings.Builder
+	parameter := 0
+	for _, char := range query {
+		if char != '?' {
+			result.WriteRune(char)
+			continue
+		}
+
+		parameter++
+		result.WriteString("$" + strconv.Itoa(parameter))
+	}
+
+	return result.String()
+}
+
+// sqlGlobCondition returns condition matching the column against the pattern
+// made by sqlGlobPattern, both are case sensitive in every dialect
+func sqlGlobCondition(dialect dbconnections.SQLDialect, column string) string {
+	if dialect == dbconnections.SQLiteDialect {
+		return column + " GLOB ?"
+	}
+
+	return column + ` LIKE ? ESCAPE '\'`
+}
+
+// sqlGlobPattern translates glob pattern, where * matches any sequence of characters,
+// to the pattern of the dialect, in which all other characters match only themselves
+func sqlGlobPattern(dialect dbconnections.SQLDialect, pattern string) string {
+	if dialect == dbconnections.SQLiteDialect {
+		return strings.NewReplacer("[", "[[]", "?", "[?]").Replace(pattern)
+	}
+
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`, "*", "%").Replace(pattern)
+}
+
+// sqlByteOrderColumn compares and orders values of the column byte by byte,
+// the same as storages list their keys, regardless of the database collation
+func sqlByteOrderColumn(dialect dbconnections.SQLDialect, column string) string {
+	if dialect == dbconnections.PostgresDialect {
+		return column + ` COLLATE "C"`
+	}
+
+	return column
+}
+
+// sqlPrefixPattern returns pattern for sqlGlobCondition matching values starting with the prefix
+func sqlPrefixPattern(dialect dbconnections.SQLDialect, prefix string) string {
+	if dialect == dbconnections.SQLiteDialect {
+		return strings.NewReplacer("[", "[[]", "?", "[?]", "*", "[*]").Replace(prefix) + "*"
+	}
+
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
+}
+
+// sqlTime converts time to UTC, so times saved as text by SQLite are ordered correctly,
+// zero time is saved as NULL
+func sqlTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t.UTC()
+}
+
+var ErrUnknownSchemaVersion = errors.New("cache database schema is newer than supported by this version")
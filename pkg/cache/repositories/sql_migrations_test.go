@@ -0,0 +1,77 @@
+package cacherepositories
+
+import (
+	"context"
+	"testing"
+
+	dbconnections "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/connections"
+)
+
+func newTestingSQLConnection(t *testing.T) dbconnections.SQLCacheDBConnection {
+	conn := dbconnections.NewSQLCacheDBTestingConnection(t)
+	if _, err := MigrateSQLCacheDB(context.Background(), conn); err != nil {
+		t.Fatalf("Error migrating testing database: %s", err)
+	}
+
+	return conn
+}
+
+func TestMigrateSQLCacheDB_AppliesEveryMigrationOnlyOnce(t *testing.T) {
+	ctx := context.Background()
+	conn := dbconnections.NewSQLCacheDBTestingConnection(t)
+
+	applied, err := MigrateSQLCacheDB(ctx, conn)
+	if err != nil {
+		t.Fatalf("Error migrating database: %s", err)
+	}
+
+	if applied != len(sqlMigrations) {
+		t.Errorf("Expected %d migrations to be applied, got %d", len(sqlMigrations), applied)
+	}
+
+	applied, err = MigrateSQLCacheDB(ctx, conn)
+	if err != nil {
+		t.Fatalf("Error migrating already migrated database: %s", err)
+	}
+
+	if applied != 0 {
+		t.Errorf("Expected no migrations to be applied again, got %d", applied)
+	}
+}
+
+func TestMigrateSQLCacheDB_ReturnsErrorWhenSchemaIsNewerThanSupported(t *testing.T) {
+	ctx := context.Background()
+	conn := newTestingSQLConnection(t)
+
+	if _, err := conn.DB().ExecContext(ctx, "INSERT INTO schema_migrations (version, applied_at) VALUES (?, CURRENT_TIMESTAMP)", len(sqlMigrations)+1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := MigrateSQLCacheDB(ctx, conn); err != ErrUnknownSchemaVersion {
+		t.Errorf("Expected ErrUnknownSchemaVersion error, got: %v", err)
+	}
+}
+
+func TestRebindSQLQuery_NumbersPlaceholdersOnlyForPostgres(t *testing.T) {
+	query := "SELECT * FROM cached_images WHERE request_signature = ? AND processor_type = ?"
+
+	if result := rebindSQLQuery(dbconnections.PostgresDialect, query); result != "SELECT * FROM cached_images WHERE request_signature = $1 AND processor_type = $2" {
+		t.Errorf("Unexpected postgres query: %s", result)
+	}
+
+	if result := rebindSQLQuery(dbconnections.SQLiteDialect, query); result != query {
+		t.Errorf("Unexpected sqlite query: %s", result)
+	}
+}
+
+func TestSQLGlobPattern_EscapesSpecialCharactersOfDialect(t *testing.T) {
+	pattern := `https://*.example.com/100%_[a]?\`
+
+	if result := sqlGlobPattern(dbconnections.PostgresDialect, pattern); result != `https://%.example.com/100\%\_[a]?\\` {
+		t.Errorf("Unexpected postgres pattern: %s", result)
+	}
+
+	if result := sqlGlobPattern(dbconnections.SQLiteDialect, pattern); result != `https://*.example.com/100%_[[]a][?]\` {
+		t.Errorf("Unexpected sqlite pattern: %s", result)
+	}
+}
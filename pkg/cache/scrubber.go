@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"time"
+
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	"github.com/thebartekbanach/imcaxy/pkg/metrics"
+)
+
+type ScrubberConfig struct {
+	BatchSize int
+}
+
+// Scrubber verifies checksums of all saved images, corrupted images are removed
+// together with their entries, so they are processed again when requested.
+type Scrubber struct {
+	config           ScrubberConfig
+	imagesRepository cacherepositories.CachedImagesRepository
+	imagesStorage    cacherepositories.CachedImagesStorage
+}
+
+type ScrubReport struct {
+	DryRun     bool      `json:"dryRun"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+
+	CheckedImages int `json:"checkedImages"`
+	// images which are pending, not saved or were saved
+	// before checksums were introduced can not be verified
+	SkippedImages int `json:"skippedImages"`
+
+	CorruptedImages ReportedIssues `json:"corruptedImages"`
+}
+
+func NewScrubber(
+	config ScrubberConfig,
+	imagesRepository cacherepositories.CachedImagesRepository,
+	imagesStorage cacherepositories.CachedImagesStorage,
+) *Scrubber {
+	return &Scrubber{config, imagesRepository, imagesStorage}
+}
+
+// Scrub reads all images one by one, found corrupted images are only reported when dryRun is set
+func (s *Scrubber) Scrub(ctx context.Context, dryRun bool) (report ScrubReport, err error) {
+	report.DryRun = dryRun
+	report.StartedAt = time.Now()
+	defer func() { report.FinishedAt = time.Now() }()
+
+	entries := &orderedEntries{repository: s.imagesRepository, batchSize: s.config.BatchSize}
+	for {
+		entry, found, err := entries.peek(ctx)
+		if err != nil || !found {
+			return report, err
+		}
+
+		entries.next()
+		if err := s.scrubEntry(ctx, entry, dryRun, &report); err != nil {
+			return report, err
+		}
+	}
+}
+
+func (s *Scrubber) scrubEntry(ctx context.Context, entry cacherepositories.CachedImageModel, dryRun bool, report *ScrubReport) error {
+	if entry.IsPending() || entry.Checksum == "" {
+		report.SkippedImages++
+		return nil
+	}
+
+	data, err := s.readImage(ctx, entry)
+	if err == cacherepositories.ErrImageNotFound {
+		report.SkippedImages++
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	report.CheckedImages++
+	if checksum(data) == entry.Checksum {
+		return nil
+	}
+
+	// image could be invalidated and saved again after the entry was read
+	current, err := s.imagesRepository.GetCachedImageInfo(ctx, entry.RequestSignature, entry.ProcessorType)
+	if err == cacherepositories.ErrCachedImageNotFound || (err == nil && current.Checksum != entry.Checksum) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	report.CorruptedImages.add(entry.StorageKey)
+	if dryRun {
+		return nil
+	}
+
+	metrics.Add("cache_scrubbed_corrupted_entries", 1)
+	return removeEntryIfExists(ctx, s.imagesRepository, s.imagesStorage, entry)
+}
+
+func (s *Scrubber) readImage(ctx context.Context, entry cacherepositories.CachedImageModel) ([]byte, error) {
+	buffer := newBufferedStreamInput()
+	if err := s.imagesStorage.Get(ctx, entry.RequestSignature, entry.ProcessorType, entry.Checksum, buffer); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return buffer.wait(ctx)
+}
@@ -0,0 +1,76 @@
+package cache_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/thebartekbanach/imcaxy/pkg/cache"
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	mock_cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/mocks"
+)
+
+// newTestingScrubbedCache saves images with checksums of the given data, so the saved image is corrupted
+// when its data differ, images saved before checksums were introduced have empty saved data
+func newTestingScrubbedCache(t *testing.T, images map[string][2]string) (cacherepositories.CachedImagesRepository, *mock_cacherepositories.MockCachedImagesStorage) {
+	repo, storage := newTestingCache(t)
+
+	for signature, data := range images {
+		info := cacherepositories.CachedImageModel{RequestSignature: signature, ProcessorType: "imaginary", ImageSize: int64(len(data[1]))}
+		if data[0] != "" {
+			info.Checksum = fmt.Sprintf("%x", sha256.Sum256([]byte(data[0])))
+		}
+
+		createTestingCacheEntry(t, repo, info)
+		storage.InstantSave(signature, "imaginary", []byte(data[1]))
+	}
+
+	return repo, storage
+}
+
+func TestScrubber_ScrubShouldRemoveCorruptedImages(t *testing.T) {
+	repo, storage := newTestingScrubbedCache(t, map[string][2]string{
+		"valid":     {"data", "data"},
+		"corrupted": {"data", "dat4"},
+		"legacy":    {"", "data"},
+	})
+
+	scrubber := cache.NewScrubber(cache.ScrubberConfig{BatchSize: 2}, repo, storage)
+	report, err := scrubber.Scrub(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if report.CheckedImages != 2 || report.SkippedImages != 1 || report.CorruptedImages.Count != 1 {
+		t.Errorf("Expected 2 checked images, one skipped and one corrupted, got: %+v", report)
+	}
+
+	if _, err := repo.GetCachedImageInfo(context.Background(), "corrupted", "imaginary"); err != cacherepositories.ErrCachedImageNotFound {
+		t.Errorf("Expected entry of corrupted image to be removed, got: %v", err)
+	}
+
+	if storage.Exists("corrupted", "imaginary") {
+		t.Errorf("Expected corrupted image to be removed")
+	}
+
+	if !storage.Exists("valid", "imaginary") || !storage.Exists("legacy", "imaginary") {
+		t.Errorf("Expected valid images to be kept")
+	}
+}
+
+func TestScrubber_ScrubShouldOnlyReportCorruptedImagesInDryRun(t *testing.T) {
+	repo, storage := newTestingScrubbedCache(t, map[string][2]string{
+		"corrupted": {"data", "dat4"},
+	})
+
+	scrubber := cache.NewScrubber(cache.ScrubberConfig{BatchSize: 2}, repo, storage)
+	report, err := scrubber.Scrub(context.Background(), true)
+	if err != nil || report.CorruptedImages.Count != 1 {
+		t.Errorf("Expected one corrupted image, got %+v, error: %v", report, err)
+	}
+
+	if !storage.Exists("corrupted", "imaginary") {
+		t.Errorf("Expected corrupted image to be kept in dry run")
+	}
+}
@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"context"
+
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+)
+
+type StorageKeysMigrationServiceImplementation struct {
+	imagesRepository cacherepositories.CachedImagesRepository
+	imagesStorage    cacherepositories.CachedImagesStorage
+}
+
+var _ StorageKeysMigrationService = (*StorageKeysMigrationServiceImplementation)(nil)
+
+func NewStorageKeysMigrationService(
+	imagesRepository cacherepositories.CachedImagesRepository,
+	imagesStorage cacherepositories.CachedImagesStorage,
+) StorageKeysMigrationService {
+	return &StorageKeysMigrationServiceImplementation{imagesRepository, imagesStorage}
+}
+
+// Migrate can be run while the server is serving requests,
+// because storage reads images from legacy keys until they are migrated
+func (s *StorageKeysMigrationServiceImplementation) Migrate(ctx context.Context) (migratedImages int, err error) {
+	return s.imagesStorage.MigrateLegacyObjects(ctx, func(requestSignature, processorType, storageKey string) error {
+		err := s.imagesRepository.UpdateCachedImageStorageKey(ctx, requestSignature, processorType, storageKey)
+		if err == cacherepositories.ErrCachedImageNotFound {
+			// object is orphaned, there is no mapping to keep
+			return nil
+		}
+
+		return err
+	})
+}
@@ -0,0 +1,61 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/thebartekbanach/imcaxy/pkg/cache"
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	mock_cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/mocks"
+)
+
+type legacyObject struct {
+	requestSignature, processorType string
+}
+
+type migratingImagesStorage struct {
+	*mock_cacherepositories.MockCachedImagesStorage
+	legacyObjects []legacyObject
+}
+
+func (s *migratingImagesStorage) MigrateLegacyObjects(ctx context.Context, onMigrated func(requestSignature, processorType, storageKey string) error) (int, error) {
+	for i, object := range s.legacyObjects {
+		storageKey := cacherepositories.StorageKey(object.requestSignature, object.processorType)
+		if err := onMigrated(object.requestSignature, object.processorType, storageKey); err != nil {
+			return i + 1, err
+		}
+	}
+
+	return len(s.legacyObjects), nil
+}
+
+func TestStorageKeysMigrationService_MigrateShouldSaveStorageKeysOfMigratedImages(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockImagesRepo := mock_cacherepositories.NewMockCachedImagesRepository(mockCtrl)
+	imagesStorage := &migratingImagesStorage{
+		mock_cacherepositories.NewMockCachedImagesStorage(),
+		[]legacyObject{{"first-signature", "imaginary"}, {"orphaned-signature", "imaginary"}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockImagesRepo.EXPECT().
+		UpdateCachedImageStorageKey(ctx, "first-signature", "imaginary", cacherepositories.StorageKey("first-signature", "imaginary")).
+		Return(nil)
+	mockImagesRepo.EXPECT().
+		UpdateCachedImageStorageKey(ctx, "orphaned-signature", "imaginary", gomock.Any()).
+		Return(cacherepositories.ErrCachedImageNotFound)
+
+	migrationService := cache.NewStorageKeysMigrationService(mockImagesRepo, imagesStorage)
+	migratedImages, err := migrationService.Migrate(ctx)
+
+	if err != nil {
+		t.Errorf("Expected error to be nil, got %v", err)
+	}
+
+	if migratedImages != 2 {
+		t.Errorf("Expected 2 migrated images, got %d", migratedImages)
+	}
+}
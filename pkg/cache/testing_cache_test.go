@@ -0,0 +1,27 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+
+	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	dbconnections "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/connections"
+	mock_cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories/mocks"
+)
+
+// newTestingCache creates empty images repository using the embedded database
+// together with images storage keeping images in memory
+func newTestingCache(t *testing.T) (cacherepositories.CachedImagesRepository, *mock_cacherepositories.MockCachedImagesStorage) {
+	conn := dbconnections.NewBoltCacheDBTestingConnection(t)
+	if err := cacherepositories.CreateBoltCacheDBBuckets(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	return cacherepositories.NewCachedImagesRepository(conn), mock_cacherepositories.NewMockCachedImagesStorage()
+}
+
+func createTestingCacheEntry(t *testing.T, repo cacherepositories.CachedImagesRepository, info cacherepositories.CachedImageModel) {
+	if err := repo.CreateCachedImageInfo(context.Background(), info); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,208 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/thebartekbanach/imcaxy/pkg/metrics"
+)
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+type Config struct {
+	// FailureThreshold is the number of consecutive failures after which
+	// the breaker opens, zero disables the breaker.
+	FailureThreshold int
+
+	// OpenDuration is the time after which open breaker lets
+	// trial requests through in half-open state.
+	OpenDuration time.Duration
+
+	// HalfOpenMaxRequests is the number of concurrent trial requests
+	// allowed in half-open state.
+	HalfOpenMaxRequests int
+}
+
+func (c Config) Enabled() bool {
+	return c.FailureThreshold > 0
+}
+
+type Breaker struct {
+	name   string
+	config Config
+
+	state               State
+	consecutiveFailures int
+	openedAt            time.Time
+	halfOpenInFlight    int
+
+	now  func() time.Time
+	lock sync.Mutex
+}
+
+func NewBreaker(name string, config Config) *Breaker {
+	if config.HalfOpenMaxRequests < 1 {
+		config.HalfOpenMaxRequests = 1
+	}
+
+	breaker := &Breaker{
+		name:   name,
+		config: config,
+		state:  Closed,
+		now:    time.Now,
+	}
+
+	metrics.SetString(breaker.metricName("state"), Closed.String())
+	return breaker
+}
+
+// Allow returns ErrCircuitOpen if request should not be executed.
+// Every allowed request must be followed by Report or Ignore call.
+func (b *Breaker) Allow() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.state == Open {
+		if b.now().Sub(b.openedAt) < b.config.OpenDuration {
+			metrics.Add(b.metricName("rejected_requests"), 1)
+			return ErrCircuitOpen
+		}
+
+		b.changeState(HalfOpen)
+	}
+
+	if b.state == HalfOpen {
+		if b.halfOpenInFlight >= b.config.HalfOpenMaxRequests {
+			metrics.Add(b.metricName("rejected_requests"), 1)
+			return ErrCircuitOpen
+		}
+
+		b.halfOpenInFlight++
+	}
+
+	return nil
+}
+
+// Report records the result of request allowed by Allow call.
+func (b *Breaker) Report(success bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.state == HalfOpen {
+		b.halfOpenInFlight--
+
+		if success {
+			b.consecutiveFailures = 0
+			b.changeState(Closed)
+		} else {
+			b.open()
+		}
+
+		return
+	}
+
+	if success {
+		b.consecutiveFailures = 0
+		return
+	}
+
+	b.consecutiveFailures++
+	if b.state == Closed && b.consecutiveFailures >= b.config.FailureThreshold {
+		b.open()
+	}
+}
+
+// Ignore releases request allowed by Allow call without recording its result,
+// it is used when the result does not tell anything about the service health.
+func (b *Breaker) Ignore() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.state == HalfOpen && b.halfOpenInFlight > 0 {
+		b.halfOpenInFlight--
+	}
+}
+
+func (b *Breaker) State() State {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.state
+}
+
+// RetryAfter returns the time after which open breaker
+// lets trial requests through.
+func (b *Breaker) RetryAfter() time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.state != Open {
+		return 0
+	}
+
+	retryAfter := b.config.OpenDuration - b.now().Sub(b.openedAt)
+	if retryAfter < 0 {
+		return 0
+	}
+
+	return retryAfter
+}
+
+func (b *Breaker) open() {
+	b.openedAt = b.now()
+	b.consecutiveFailures = 0
+	b.halfOpenInFlight = 0
+	b.changeState(Open)
+	metrics.Add(b.metricName("opened"), 1)
+}
+
+func (b *Breaker) changeState(state State) {
+	if b.state == state {
+		return
+	}
+
+	log.Printf("circuit breaker of %s changed state from %s to %s", b.name, b.state, state)
+	b.state = state
+	metrics.SetString(b.metricName("state"), state.String())
+}
+
+func (b *Breaker) metricName(name string) string {
+	return "circuit_breaker_" + b.name + "_" + name
+}
+
+// OpenError is returned by services keeping separate breakers
+// of their backends, when breakers of all backends are open.
+type OpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return ErrCircuitOpen.Error()
+}
+
+func (e *OpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
@@ -0,0 +1,119 @@
+package circuitbreaker
+
+import (
+	"testing"
+	"time"
+)
+
+func createTestingBreaker(config Config) (*Breaker, *time.Time) {
+	now := time.Now()
+	breaker := NewBreaker("testing", config)
+	breaker.now = func() time.Time { return now }
+	return breaker, &now
+}
+
+func TestBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	breaker, _ := createTestingBreaker(Config{FailureThreshold: 3, OpenDuration: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		if err := breaker.Allow(); err != nil {
+			t.Fatalf("Expected request %d to be allowed, got: %v", i, err)
+		}
+
+		breaker.Report(false)
+	}
+
+	if breaker.State() != Open {
+		t.Fatalf("Expected breaker to be open, got: %s", breaker.State())
+	}
+
+	if err := breaker.Allow(); err != ErrCircuitOpen {
+		t.Errorf("Expected ErrCircuitOpen, got: %v", err)
+	}
+}
+
+func TestBreaker_SuccessResetsConsecutiveFailures(t *testing.T) {
+	breaker, _ := createTestingBreaker(Config{FailureThreshold: 2, OpenDuration: time.Minute})
+
+	breaker.Allow()
+	breaker.Report(false)
+	breaker.Allow()
+	breaker.Report(true)
+	breaker.Allow()
+	breaker.Report(false)
+
+	if breaker.State() != Closed {
+		t.Errorf("Expected breaker to be closed, got: %s", breaker.State())
+	}
+}
+
+func TestBreaker_LetsTrialRequestThroughAfterOpenDuration(t *testing.T) {
+	breaker, now := createTestingBreaker(Config{FailureThreshold: 1, OpenDuration: time.Minute, HalfOpenMaxRequests: 1})
+
+	breaker.Allow()
+	breaker.Report(false)
+
+	*now = now.Add(30 * time.Second)
+	if retryAfter := breaker.RetryAfter(); retryAfter != 30*time.Second {
+		t.Errorf("Expected retry after to be 30s, got: %s", retryAfter)
+	}
+
+	*now = now.Add(31 * time.Second)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Expected trial request to be allowed, got: %v", err)
+	}
+
+	if breaker.State() != HalfOpen {
+		t.Errorf("Expected breaker to be half-open, got: %s", breaker.State())
+	}
+
+	if err := breaker.Allow(); err != ErrCircuitOpen {
+		t.Errorf("Expected concurrent trial request to be rejected, got: %v", err)
+	}
+
+	breaker.Report(true)
+
+	if breaker.State() != Closed {
+		t.Errorf("Expected breaker to be closed after successful trial request, got: %s", breaker.State())
+	}
+}
+
+func TestBreaker_OpensAgainWhenTrialRequestFails(t *testing.T) {
+	breaker, now := createTestingBreaker(Config{FailureThreshold: 1, OpenDuration: time.Minute})
+
+	breaker.Allow()
+	breaker.Report(false)
+
+	*now = now.Add(2 * time.Minute)
+	breaker.Allow()
+	breaker.Report(false)
+
+	if breaker.State() != Open {
+		t.Errorf("Expected breaker to be open after failed trial request, got: %s", breaker.State())
+	}
+
+	if retryAfter := breaker.RetryAfter(); retryAfter != time.Minute {
+		t.Errorf("Expected open duration to start again, got retry after: %s", retryAfter)
+	}
+}
+
+func TestBreaker_IgnoredTrialRequestLetsNextTrialRequestThrough(t *testing.T) {
+	breaker, now := createTestingBreaker(Config{FailureThreshold: 1, OpenDuration: time.Minute, HalfOpenMaxRequests: 1})
+
+	breaker.Allow()
+	breaker.Report(false)
+
+	*now = now.Add(time.Minute)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Expected trial request to be allowed, got: %v", err)
+	}
+
+	breaker.Ignore()
+	if err := breaker.Allow(); err != nil {
+		t.Errorf("Expected next trial request to be allowed, got: %v", err)
+	}
+
+	if breaker.State() != HalfOpen {
+		t.Errorf("Expected breaker to be half-open, got: %s", breaker.State())
+	}
+}
@@ -3,20 +3,24 @@ package filefetcher
 import (
 	"context"
 	"errors"
+	"log"
 	"net/http"
 
 	"github.com/thebartekbanach/imcaxy/pkg/hub"
+	"github.com/thebartekbanach/imcaxy/pkg/metrics"
+	"github.com/thebartekbanach/imcaxy/pkg/retry"
 )
 
 type httpGetFunc func(ctx context.Context, url string) (resp *http.Response, err error)
 
 type DataHubFetcher struct {
-	getter httpGetFunc
+	getter      httpGetFunc
+	retryPolicy retry.Policy
 }
 
 var _ Fetcher = (*DataHubFetcher)(nil)
 
-func NewDataHubFetcher() Fetcher {
+func NewDataHubFetcher(retryPolicy retry.Policy) Fetcher {
 	getFunc := func(ctx context.Context, url string) (resp *http.Response, err error) {
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 		if err != nil {
@@ -26,35 +30,67 @@ func NewDataHubFetcher() Fetcher {
 		return http.DefaultClient.Do(req)
 	}
 
-	return &DataHubFetcher{getFunc}
+	return &DataHubFetcher{getFunc, retryPolicy}
 }
 
 func (fetcher *DataHubFetcher) Fetch(ctx context.Context, url string, input hub.DataStreamInput) error {
-	response, err := fetcher.getter(ctx, url)
-	if err != nil {
+	if _, err := fetcher.FetchWithResponseInfo(ctx, url, input); err != nil {
 		input.Close(err)
 		return err
 	}
-	defer response.Body.Close()
 
-	err = nil
-	if response.StatusCode == http.StatusNotFound {
-		err = ErrResponseStatus404
-	} else if response.StatusCode != http.StatusOK {
-		err = ErrResponseStatusNotOK
+	return nil
+}
+
+func (fetcher *DataHubFetcher) FetchWithResponseInfo(ctx context.Context, url string, input hub.DataStreamInput) (ResponseInfo, error) {
+	// request is retried only until the response is accepted,
+	// nothing is written to the stream input before that
+	var response *http.Response
+	attempts, err := fetcher.retryPolicy.Do(ctx, func(attempt int) (bool, error) {
+		res, err := fetcher.getter(ctx, url)
+		if err != nil {
+			return true, err
+		}
+
+		if res.StatusCode == http.StatusNotFound {
+			res.Body.Close()
+			return false, ErrResponseStatus404
+		}
+
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return fetcher.retryPolicy.IsRetryableStatus(res.StatusCode), ErrResponseStatusNotOK
+		}
+
+		response = res
+		return false, nil
+	})
+
+	if attempts > 1 {
+		metrics.Add("source_fetch_retries", int64(attempts-1))
+		log.Printf("source fetch of %s finished after %d attempts, error: %v", url, attempts, err)
 	}
 
 	if err != nil {
-		input.Close(err)
-		return err
+		return ResponseInfo{}, err
+	}
+
+	info := ResponseInfo{
+		ContentType: response.Header.Get("Content-Type"),
+		Size:        response.ContentLength,
+	}
+
+	if info.ContentType == "" {
+		info.ContentType = "application/octet-stream"
 	}
 
 	go func() {
 		_, err := input.ReadFrom(response.Body)
 		input.Close(err)
+		response.Body.Close()
 	}()
 
-	return nil
+	return info, nil
 }
 
 var (
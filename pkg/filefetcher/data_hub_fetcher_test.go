@@ -6,9 +6,11 @@ import (
 	"io"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	mock_hub "github.com/thebartekbanach/imcaxy/pkg/hub/mocks"
+	"github.com/thebartekbanach/imcaxy/pkg/retry"
 	mock_globals "github.com/thebartekbanach/imcaxy/test/mocks"
 )
 
@@ -68,7 +70,7 @@ func TestDataHubFetcher_ShouldPassRequestBodyCorrectlyToDataStreamInput(t *testi
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	fetcher := DataHubFetcher{getter}
+	fetcher := DataHubFetcher{getter, retry.Policy{}}
 	fetcher.Fetch(ctx, "http://google.com/image.jpg", &mockStreamInput)
 
 	mockStreamInput.Wait()
@@ -81,7 +83,7 @@ func TestDataHubFetcher_ShouldReturn404ErrorIf404IsReturnedByRequest(t *testing.
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	fetcher := DataHubFetcher{getter}
+	fetcher := DataHubFetcher{getter, retry.Policy{}}
 	err := fetcher.Fetch(ctx, "http://google.com/image.jpg", &mockStreamInput)
 
 	if err != ErrResponseStatus404 {
@@ -100,7 +102,7 @@ func TestDataHubFetcher_ShouldReturnErrorIfErrorReturnedByRequestIsNot200(t *tes
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	fetcher := DataHubFetcher{getter}
+	fetcher := DataHubFetcher{getter, retry.Policy{}}
 	err := fetcher.Fetch(ctx, "http://google.com/image.jpg", &mockStreamInput)
 
 	if err != ErrResponseStatusNotOK {
@@ -115,7 +117,7 @@ func TestDataHubFetcher_ShouldCloseInputWithErrorReturnedByStreamRead(t *testing
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	fetcher := DataHubFetcher{getter}
+	fetcher := DataHubFetcher{getter, retry.Policy{}}
 	fetcher.Fetch(ctx, "http://google.com/image.jpg", &mockStreamInput)
 
 	mockStreamInput.Wait()
@@ -124,3 +126,151 @@ func TestDataHubFetcher_ShouldCloseInputWithErrorReturnedByStreamRead(t *testing
 		t.Errorf("Expected stream close frowarded error to be %v, got %v", io.ErrUnexpectedEOF, mockStreamInput.ForwardedError)
 	}
 }
+
+func statusSequenceGetter(data []byte, statusCodes []int, calls *int) httpGetFunc {
+	return func(_ context.Context, url string) (*http.Response, error) {
+		statusCode := statusCodes[*calls]
+		*calls++
+
+		return &http.Response{
+			Body:       &httpResponseBody{bytes.NewReader(data)},
+			StatusCode: statusCode,
+		}, nil
+	}
+}
+
+func testingRetryPolicy() retry.Policy {
+	return retry.Policy{
+		MaxAttempts:          3,
+		InitialBackoff:       time.Millisecond,
+		Multiplier:           2,
+		RetryableStatusCodes: []int{503},
+	}
+}
+
+func TestDataHubFetcher_ShouldRetryRetryableResponseStatus(t *testing.T) {
+	testData := []byte{0x1, 0x2, 0x3}
+	calls := 0
+	getter := statusSequenceGetter(testData, []int{503, 503, 200}, &calls)
+	mockStreamInput := mock_hub.NewMockTestingDataStreamInput(t, [][]byte{testData}, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fetcher := DataHubFetcher{getter, testingRetryPolicy()}
+	if err := fetcher.Fetch(ctx, "http://google.com/image.jpg", &mockStreamInput); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	mockStreamInput.Wait()
+
+	if calls != 3 {
+		t.Errorf("Expected 3 requests, got %d", calls)
+	}
+}
+
+func TestDataHubFetcher_ShouldNotRetryNonRetryableResponseStatus(t *testing.T) {
+	calls := 0
+	getter := statusSequenceGetter(nil, []int{404, 200}, &calls)
+	mockStreamInput := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fetcher := DataHubFetcher{getter, testingRetryPolicy()}
+	err := fetcher.Fetch(ctx, "http://google.com/image.jpg", &mockStreamInput)
+
+	if err != ErrResponseStatus404 {
+		t.Errorf("Expected fetch error to be %v, got %v", ErrResponseStatus404, err)
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected 1 request, got %d", calls)
+	}
+}
+
+func TestDataHubFetcher_ShouldCloseInputOnlyOnceWhenAllAttemptsFail(t *testing.T) {
+	calls := 0
+	getter := statusSequenceGetter(nil, []int{503, 503, 503}, &calls)
+	mockCtrl := gomock.NewController(t)
+	mockStreamInput := mock_hub.NewMockDataStreamInput(mockCtrl)
+	mockStreamInput.EXPECT().Close(ErrResponseStatusNotOK).Times(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fetcher := DataHubFetcher{getter, testingRetryPolicy()}
+	err := fetcher.Fetch(ctx, "http://google.com/image.jpg", mockStreamInput)
+
+	if err != ErrResponseStatusNotOK {
+		t.Errorf("Expected fetch error to be %v, got %v", ErrResponseStatusNotOK, err)
+	}
+
+	if calls != 3 {
+		t.Errorf("Expected 3 requests, got %d", calls)
+	}
+}
+
+func TestDataHubFetcher_FetchWithResponseInfoShouldReturnContentTypeAndSizeOfResponse(t *testing.T) {
+	data := []byte{0x1, 0x2, 0x3}
+	getter := func(_ context.Context, url string) (*http.Response, error) {
+		resp := http.Response{
+			Body:          &httpResponseBody{bytes.NewReader(data)},
+			StatusCode:    200,
+			ContentLength: int64(len(data)),
+			Header:        http.Header{"Content-Type": []string{"image/png"}},
+		}
+
+		return &resp, nil
+	}
+	mockStreamInput := mock_hub.NewMockTestingDataStreamInput(t, [][]byte{data}, nil, nil)
+
+	fetcher := DataHubFetcher{getter, retry.Policy{}}
+	info, err := fetcher.FetchWithResponseInfo(context.Background(), "http://google.com/image.png", &mockStreamInput)
+	mockStreamInput.Wait()
+
+	if err != nil {
+		t.Errorf("Expected error to be nil, got %v", err)
+	}
+
+	if info.ContentType != "image/png" || info.Size != 3 {
+		t.Errorf("Expected response info to be %v, got %v", ResponseInfo{"image/png", 3}, info)
+	}
+}
+
+func TestDataHubFetcher_FetchWithResponseInfoShouldReturnUnknownSizeAndDefaultContentType(t *testing.T) {
+	getter := func(_ context.Context, url string) (*http.Response, error) {
+		resp := http.Response{
+			Body:          &httpResponseBody{bytes.NewReader([]byte{0x1})},
+			StatusCode:    200,
+			ContentLength: -1,
+		}
+
+		return &resp, nil
+	}
+	mockStreamInput := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+
+	fetcher := DataHubFetcher{getter, retry.Policy{}}
+	info, _ := fetcher.FetchWithResponseInfo(context.Background(), "http://google.com/file", &mockStreamInput)
+	mockStreamInput.Wait()
+
+	if info.ContentType != "application/octet-stream" || info.Size != -1 {
+		t.Errorf("Expected response info to be %v, got %v", ResponseInfo{"application/octet-stream", -1}, info)
+	}
+}
+
+func TestDataHubFetcher_FetchWithResponseInfoShouldNotCloseInputOnRequestError(t *testing.T) {
+	getter, _ := testDataFetchFuncFactory(404, nil)
+	mockStreamInput := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+
+	fetcher := DataHubFetcher{getter, retry.Policy{}}
+	_, err := fetcher.FetchWithResponseInfo(context.Background(), "http://google.com/image.jpg", &mockStreamInput)
+
+	if err != ErrResponseStatus404 {
+		t.Errorf("Expected fetch error to be %v, got %v", ErrResponseStatus404, err)
+	}
+
+	if mockStreamInput.ForwardedError != nil {
+		t.Errorf("Expected input not to be closed, but was closed with %v", mockStreamInput.ForwardedError)
+	}
+}
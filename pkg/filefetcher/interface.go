@@ -6,6 +6,17 @@ import (
 	"github.com/thebartekbanach/imcaxy/pkg/hub"
 )
 
+type ResponseInfo struct {
+	ContentType string
+
+	// Size is -1 when response does not include Content-Length header
+	Size int64
+}
+
 type Fetcher interface {
 	Fetch(ctx context.Context, url string, input hub.DataStreamInput) error
+
+	// FetchWithResponseInfo works like Fetch, but returns content type and size
+	// of the response and does not close the input if the request fails
+	FetchWithResponseInfo(ctx context.Context, url string, input hub.DataStreamInput) (ResponseInfo, error)
 }
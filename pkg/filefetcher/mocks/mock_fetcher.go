@@ -9,6 +9,7 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	filefetcher "github.com/thebartekbanach/imcaxy/pkg/filefetcher"
 	hub "github.com/thebartekbanach/imcaxy/pkg/hub"
 )
 
@@ -49,3 +50,18 @@ func (mr *MockFetcherMockRecorder) Fetch(arg0, arg1, arg2 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockFetcher)(nil).Fetch),
 		arg0, arg1, arg2)
 }
+
+// FetchWithResponseInfo mocks base method.
+func (m *MockFetcher) FetchWithResponseInfo(arg0 context.Context, arg1 string, arg2 hub.DataStreamInput) (filefetcher.ResponseInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchWithResponseInfo", arg0, arg1, arg2)
+	ret0, _ := ret[0].(filefetcher.ResponseInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchWithResponseInfo indicates an expected call of FetchWithResponseInfo.
+func (mr *MockFetcherMockRecorder) FetchWithResponseInfo(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchWithResponseInfo", reflect.TypeOf((*MockFetcher)(nil).FetchWithResponseInfo), arg0, arg1, arg2)
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"expvar"
+	"sync"
+)
+
+// All service metrics are published under single "imcaxy" expvar map,
+// which is exposed by the server on /debug/vars endpoint.
+var (
+	registry     = expvar.NewMap("imcaxy")
+	registryLock = sync.Mutex{}
+)
+
+func Add(name string, delta int64) {
+	registry.Add(name, delta)
+}
+
+func Set(name string, value int64) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if v, ok := registry.Get(name).(*expvar.Int); ok {
+		v.Set(value)
+		return
+	}
+
+	v := new(expvar.Int)
+	v.Set(value)
+	registry.Set(name, v)
+}
+
+func SetString(name string, value string) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if v, ok := registry.Get(name).(*expvar.String); ok {
+		v.Set(value)
+		return
+	}
+
+	v := new(expvar.String)
+	v.Set(value)
+	registry.Set(name, v)
+}
+
+func Get(name string) int64 {
+	if v, ok := registry.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+
+	return 0
+}
@@ -0,0 +1,27 @@
+package metrics
+
+import "testing"
+
+func TestMetrics_AddIncrementsCounter(t *testing.T) {
+	Add("test_add_counter", 2)
+	Add("test_add_counter", 3)
+
+	if value := Get("test_add_counter"); value != 5 {
+		t.Errorf("Expected counter value to be 5, got %d", value)
+	}
+}
+
+func TestMetrics_SetOverridesValue(t *testing.T) {
+	Set("test_set_gauge", 10)
+	Set("test_set_gauge", 4)
+
+	if value := Get("test_set_gauge"); value != 4 {
+		t.Errorf("Expected gauge value to be 4, got %d", value)
+	}
+}
+
+func TestMetrics_GetReturnsZeroForUnknownMetric(t *testing.T) {
+	if value := Get("test_unknown_metric"); value != 0 {
+		t.Errorf("Expected unknown metric value to be 0, got %d", value)
+	}
+}
@@ -0,0 +1,115 @@
+package canonicalprocessor
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func canonicalizeQuery(rules Rules, query url.Values) url.Values {
+	canonical := url.Values{}
+	for name, values := range query {
+		if alias, isAlias := rules.ParamAliases[name]; isAlias {
+			name = alias
+		}
+
+		if contains(rules.IgnoredParams, name) {
+			continue
+		}
+
+		for _, value := range values {
+			canonical[name] = append(canonical[name], canonicalizeValue(rules, name, value))
+		}
+	}
+
+	for name, rule := range rules.Params {
+		values := canonical[name]
+		if rule.Default != "" && len(values) == 1 && values[0] == rule.Default {
+			delete(canonical, name)
+		}
+	}
+
+	return canonical
+}
+
+func canonicalizeValue(rules Rules, name, value string) string {
+	if contains(rules.URLParams, name) {
+		return normalizeURL(value)
+	}
+
+	rule, hasRule := rules.Params[name]
+	if !hasRule {
+		return value
+	}
+
+	// values which can not be coerced are left as they are,
+	// processor rejects them later
+	switch rule.Type {
+	case IntParam:
+		if number, err := strconv.Atoi(value); err == nil {
+			value = strconv.Itoa(number)
+		}
+	case FloatParam:
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			value = strconv.FormatFloat(number, 'f', -1, 64)
+		}
+	case BoolParam:
+		if boolean, err := strconv.ParseBool(value); err == nil {
+			value = strconv.FormatBool(boolean)
+		}
+	case EnumParam:
+		value = strings.ToLower(value)
+	}
+
+	if alias, isAlias := rule.Aliases[value]; isAlias {
+		value = alias
+	}
+
+	return value
+}
+
+// normalizeURL lowercases scheme and host, removes default port and fragment
+// and sorts query params by name, keeping order of values of the same param
+func normalizeURL(rawURL string) string {
+	info, err := url.Parse(rawURL)
+	if err != nil || info.Scheme == "" || info.Host == "" {
+		return rawURL
+	}
+
+	info.Scheme = strings.ToLower(info.Scheme)
+	info.Host = strings.ToLower(info.Host)
+	if port := info.Port(); port == "80" && info.Scheme == "http" || port == "443" && info.Scheme == "https" {
+		info.Host = info.Hostname()
+	}
+
+	if info.Path == "" {
+		info.Path = "/"
+	}
+
+	if info.RawQuery != "" {
+		segments := strings.Split(info.RawQuery, "&")
+		sort.SliceStable(segments, func(i, j int) bool {
+			return paramName(segments[i]) < paramName(segments[j])
+		})
+		info.RawQuery = strings.Join(segments, "&")
+	}
+
+	info.Fragment = ""
+	info.RawFragment = ""
+	return info.String()
+}
+
+func paramName(segment string) string {
+	return strings.SplitN(segment, "=", 2)[0]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
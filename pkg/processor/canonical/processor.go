@@ -0,0 +1,61 @@
+package canonicalprocessor
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+
+	"github.com/thebartekbanach/imcaxy/pkg/hub"
+	"github.com/thebartekbanach/imcaxy/pkg/processor"
+)
+
+// Processor rewrites requests to their canonical form before they
+// are parsed by the wrapped processor, so equivalent requests
+// have the same signature and share the cache entry.
+type Processor struct {
+	rules Rules
+	inner processor.ProcessingService
+}
+
+var _ processor.ProcessingService = (*Processor)(nil)
+var _ processor.CircuitBreaking = (*Processor)(nil)
+var _ processor.Canonicalizer = (*Processor)(nil)
+
+func NewProcessor(rules Rules, inner processor.ProcessingService) Processor {
+	return Processor{rules, inner}
+}
+
+func (proc *Processor) ParseRequest(requestPath string) (processor.ParsedRequest, error) {
+	canonicalPath, _, err := proc.CanonicalRequestPath(requestPath)
+	if err != nil {
+		return processor.ParsedRequest{}, err
+	}
+
+	return proc.inner.ParseRequest(canonicalPath)
+}
+
+func (proc *Processor) ProcessImage(
+	ctx context.Context,
+	request processor.ParsedRequest,
+	streamInput hub.DataStreamInput,
+) (responseContentType string, responseSize int64, err error) {
+	return proc.inner.ProcessImage(ctx, request, streamInput)
+}
+
+func (proc *Processor) BreaksCircuit() bool {
+	return processor.BreaksCircuit(proc.inner)
+}
+
+func (proc *Processor) CanonicalRequestPath(requestPath string) (canonicalPath string, changed bool, err error) {
+	info, err := url.Parse(requestPath)
+	if err != nil {
+		return "", false, err
+	}
+
+	query := info.Query()
+	canonicalQuery := canonicalizeQuery(proc.rules, query)
+
+	canonicalPath = info.Path + "?" + canonicalQuery.Encode()
+	changed = !reflect.DeepEqual(query, canonicalQuery)
+	return
+}
@@ -0,0 +1,65 @@
+package canonicalprocessor
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/thebartekbanach/imcaxy/pkg/processor"
+	mock_processor "github.com/thebartekbanach/imcaxy/pkg/processor/mocks"
+)
+
+func TestProcessor_CanonicalRequestPathShouldCanonicalizeParams(t *testing.T) {
+	proc := NewProcessor(ImaginaryRules().WithIgnoredParams("v"), nil)
+	cases := map[string]string{
+		"/resize?width=0300&url=http://example.com/img.jpg":                         "/resize?url=http%3A%2F%2Fexample.com%2Fimg.jpg&width=300",
+		"/convert?type=JPG&url=http://example.com/img.png":                          "/convert?type=jpeg&url=http%3A%2F%2Fexample.com%2Fimg.png",
+		"/crop?width=100&gravity=center&force=0&url=http://example.com/img.jpg":     "/crop?url=http%3A%2F%2Fexample.com%2Fimg.jpg&width=100",
+		"/blur?sigma=1.50&v=123&url=http://example.com/img.jpg":                     "/blur?sigma=1.5&url=http%3A%2F%2Fexample.com%2Fimg.jpg",
+		"/resize?width=100&url=HTTP://Example.COM:80/img.jpg%3Fb%3D1%26a%3D2%23top": "/resize?url=http%3A%2F%2Fexample.com%2Fimg.jpg%3Fa%3D2%26b%3D1&width=100",
+	}
+
+	for requestPath, expectedPath := range cases {
+		canonicalPath, changed, err := proc.CanonicalRequestPath(requestPath)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", requestPath, err)
+		}
+
+		if canonicalPath != expectedPath || !changed {
+			t.Errorf("Expected %s to be canonicalized to %s, got %s (changed: %v)", requestPath, expectedPath, canonicalPath, changed)
+		}
+	}
+}
+
+func TestProcessor_CanonicalRequestPathShouldNotReportChangeOfCanonicalRequest(t *testing.T) {
+	proc := NewProcessor(ImaginaryRules(), nil)
+
+	// encoding and order of params do not matter
+	_, changed, err := proc.CanonicalRequestPath("/resize?width=300&url=http://example.com/img.jpg")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if changed {
+		t.Errorf("Expected canonical request not to be reported as changed")
+	}
+}
+
+func TestProcessor_CanonicalRequestPathShouldLeaveInvalidValuesUnchanged(t *testing.T) {
+	proc := NewProcessor(ImaginaryRules(), nil)
+
+	canonicalPath, changed, _ := proc.CanonicalRequestPath("/resize?width=abc&url=not-a-url")
+	if canonicalPath != "/resize?url=not-a-url&width=abc" || changed {
+		t.Errorf("Expected invalid values to be left unchanged, got %s (changed: %v)", canonicalPath, changed)
+	}
+}
+
+func TestProcessor_ParseRequestShouldPassCanonicalRequestToWrappedProcessor(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	inner := mock_processor.NewMockProcessingService(mockCtrl)
+	inner.EXPECT().ParseRequest("/resize?url=http%3A%2F%2Fexample.com%2Fimg.jpg&width=300").Return(processor.ParsedRequest{}, nil)
+
+	proc := NewProcessor(ImaginaryRules(), inner)
+	proc.ParseRequest("/resize?width=00300&url=http://example.com/img.jpg")
+}
@@ -0,0 +1,90 @@
+package canonicalprocessor
+
+type ParamType string
+
+const (
+	StringParam ParamType = ""
+	IntParam    ParamType = "int"
+	FloatParam  ParamType = "float"
+	BoolParam   ParamType = "bool"
+	// EnumParam values are case insensitive, so they are lowercased
+	EnumParam ParamType = "enum"
+)
+
+type ParamRule struct {
+	Type ParamType
+
+	// Aliases map alternative values to the canonical one,
+	// they are applied after value is coerced to its type.
+	Aliases map[string]string
+
+	// Default value is removed from the request,
+	// because it does not change the result.
+	Default string
+}
+
+type Rules struct {
+	Params map[string]ParamRule
+
+	// ParamAliases map alternative param names to the canonical ones.
+	ParamAliases map[string]string
+
+	// IgnoredParams are removed from the request, for example cache busters.
+	IgnoredParams []string
+
+	// URLParams hold URLs which are normalized.
+	URLParams []string
+}
+
+// WithIgnoredParams returns copy of the rules with additional ignored params
+func (r Rules) WithIgnoredParams(params ...string) Rules {
+	r.IgnoredParams = append(append([]string{}, r.IgnoredParams...), params...)
+	return r
+}
+
+// ImaginaryRules describe params of imaginary service
+func ImaginaryRules() Rules {
+	rules := Rules{
+		Params:    map[string]ParamRule{},
+		URLParams: []string{"url"},
+	}
+
+	for _, param := range []string{
+		"width", "height", "areawidth", "areaheight", "top", "left",
+		"quality", "compression", "rotate", "factor", "margin", "dpi", "textwidth",
+	} {
+		rules.Params[param] = ParamRule{Type: IntParam}
+	}
+
+	for _, param := range []string{"sigma", "minampl", "opacity"} {
+		rules.Params[param] = ParamRule{Type: FloatParam}
+	}
+
+	for _, param := range []string{
+		"force", "noprofile", "stripmeta", "flip", "flop", "embed",
+		"norotation", "noreplicate", "lossless", "interlace", "palette",
+	} {
+		rules.Params[param] = ParamRule{Type: BoolParam, Default: "false"}
+	}
+
+	rules.Params["type"] = ParamRule{Type: EnumParam, Aliases: map[string]string{"jpg": "jpeg"}}
+	rules.Params["gravity"] = ParamRule{Type: EnumParam, Aliases: map[string]string{"center": "centre"}, Default: "centre"}
+	rules.Params["extend"] = ParamRule{Type: EnumParam}
+	rules.Params["colorspace"] = ParamRule{Type: EnumParam}
+
+	return rules
+}
+
+// NativeRules describe params of native processor, which are the same
+// as imaginary params, but with native processor defaults
+func NativeRules() Rules {
+	rules := ImaginaryRules()
+	rules.Params["quality"] = ParamRule{Type: IntParam, Default: "80"}
+	rules.Params["rotate"] = ParamRule{Type: IntParam, Default: "0"}
+	return rules
+}
+
+// SourceURLRules only normalize the source url param
+func SourceURLRules(sourceURLParam string) Rules {
+	return Rules{URLParams: []string{sourceURLParam}}
+}
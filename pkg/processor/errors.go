@@ -0,0 +1,36 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// StatusError is returned by processing services when
+// the processing backend responds with unexpected status
+type StatusError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %d", e.Err, e.StatusCode)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// IsServiceFailure reports whether processing error tells that the processing
+// backend is unavailable, which are transport errors, timeouts and 5xx statuses,
+// other errors are caused by the request itself, like not existing source image
+func IsServiceFailure(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
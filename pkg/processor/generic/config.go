@@ -0,0 +1,107 @@
+package genericprocessor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/thebartekbanach/imcaxy/pkg/retry"
+)
+
+type Config struct {
+	// Name is the processor type the processor is registered under.
+	Name string `json:"name"`
+
+	// BaseURL of the processing service, for example http://cropper:8080.
+	BaseURL   string   `json:"baseURL"`
+	Endpoints []string `json:"endpoints"`
+
+	// SourceURLParam is the query param holding the source image url,
+	// defaults to "url".
+	SourceURLParam string `json:"sourceURLParam"`
+
+	// AllowedParams lists params accepted in requests,
+	// all params are accepted if it is empty.
+	AllowedParams []string `json:"allowedParams"`
+
+	// SignatureParams lists params taking part in request signature,
+	// all accepted params take part in it if it is empty.
+	// Endpoint and source url always take part in the signature.
+	SignatureParams []string `json:"signatureParams"`
+
+	// ContentTypeHeader defaults to Content-Type. Responses without it are
+	// rejected, unless DefaultContentType is set.
+	ContentTypeHeader  string `json:"contentTypeHeader"`
+	DefaultContentType string `json:"defaultContentType"`
+
+	// SizeHeader defaults to Content-Length, response size
+	// is unknown if the response does not include it.
+	SizeHeader string `json:"sizeHeader"`
+
+	RetryPolicy retry.Policy `json:"-"`
+}
+
+// ParseConfigs parses JSON array of processor configs
+// and fills not set optional fields with defaults.
+func ParseConfigs(data []byte) ([]Config, error) {
+	var configs []Config
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for i := range configs {
+		config := &configs[i]
+		if err := config.validate(); err != nil {
+			return nil, fmt.Errorf("processor %d: %w", i, err)
+		}
+
+		if names[config.Name] {
+			return nil, fmt.Errorf("processor %d: %w: %s", i, ErrDuplicatedName, config.Name)
+		}
+		names[config.Name] = true
+
+		config.setDefaults()
+	}
+
+	return configs, nil
+}
+
+func (c Config) validate() error {
+	if c.Name == "" {
+		return ErrNameNotSet
+	}
+
+	baseURL, err := url.Parse(c.BaseURL)
+	if err != nil || baseURL.Scheme == "" || baseURL.Host == "" {
+		return ErrInvalidBaseURL
+	}
+
+	if len(c.Endpoints) == 0 {
+		return ErrEndpointsNotSet
+	}
+
+	return nil
+}
+
+func (c *Config) setDefaults() {
+	if c.SourceURLParam == "" {
+		c.SourceURLParam = "url"
+	}
+
+	if c.ContentTypeHeader == "" {
+		c.ContentTypeHeader = "Content-Type"
+	}
+
+	if c.SizeHeader == "" {
+		c.SizeHeader = "Content-Length"
+	}
+}
+
+var (
+	ErrNameNotSet      = errors.New("processor name not set")
+	ErrDuplicatedName  = errors.New("duplicated processor name")
+	ErrInvalidBaseURL  = errors.New("invalid processor base url")
+	ErrEndpointsNotSet = errors.New("processor endpoints not set")
+)
@@ -0,0 +1,206 @@
+package genericprocessor
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thebartekbanach/imcaxy/pkg/hub"
+	"github.com/thebartekbanach/imcaxy/pkg/metrics"
+	"github.com/thebartekbanach/imcaxy/pkg/processor"
+)
+
+type httpRequestFunc func(req *http.Request) (*http.Response, error)
+
+// Processor forwards requests to HTTP processing service described
+// by the config, so new backends can be added without writing code.
+type Processor struct {
+	config      Config
+	makeRequest httpRequestFunc
+}
+
+var _ processor.ProcessingService = (*Processor)(nil)
+
+// NewProcessor expects config with defaults already set, see ParseConfigs
+func NewProcessor(config Config) Processor {
+	return newProcessor(config, http.DefaultClient.Do)
+}
+
+func newProcessor(config Config, makeRequest httpRequestFunc) Processor {
+	return Processor{config, makeRequest}
+}
+
+func (proc *Processor) Name() string {
+	return proc.config.Name
+}
+
+func (proc *Processor) SourceURLParam() string {
+	return proc.config.SourceURLParam
+}
+
+func (proc *Processor) ParseRequest(requestPath string) (processor.ParsedRequest, error) {
+	info, err := url.Parse(requestPath)
+	if err != nil {
+		return processor.ParsedRequest{}, err
+	}
+
+	query := info.Query()
+	source := query.Get(proc.config.SourceURLParam)
+	if source == "" {
+		return processor.ParsedRequest{}, ErrURLParamNotIncluded
+	}
+
+	if !contains(proc.config.Endpoints, info.Path) {
+		return processor.ParsedRequest{}, ErrOperationNotSupported
+	}
+
+	for param := range query {
+		if !proc.isParamAllowed(param) {
+			return processor.ParsedRequest{}, ErrParamNotAllowed
+		}
+	}
+
+	request := processor.ParsedRequest{
+		ProcessorEndpoint: info.Path,
+		SourceImageURL:    source,
+		ProcessingParams:  query,
+		Signature:         proc.generateSignature(info.Path, source, query),
+	}
+
+	return request, nil
+}
+
+func (proc *Processor) ProcessImage(
+	ctx context.Context,
+	request processor.ParsedRequest,
+	streamInput hub.DataStreamInput,
+) (responseContentType string, responseSize int64, err error) {
+	req, err := proc.buildRequest(request)
+	if err != nil {
+		return
+	}
+
+	// nothing is written to the stream input until the response is accepted
+	var response *http.Response
+	attempts, err := proc.config.RetryPolicy.Do(ctx, func(attempt int) (bool, error) {
+		res, err := proc.makeRequest(req.WithContext(ctx))
+		if err != nil {
+			return true, err
+		}
+
+		if res.StatusCode != 200 {
+			res.Body.Close()
+			return proc.config.RetryPolicy.IsRetryableStatus(res.StatusCode), &processor.StatusError{StatusCode: res.StatusCode, Err: ErrResponseStatusNotOK}
+		}
+
+		response = res
+		return false, nil
+	})
+
+	if attempts > 1 {
+		metrics.Add("generic_processing_retries", int64(attempts-1))
+		log.Printf("%s request for %s finished after %d attempts, error: %v", proc.config.Name, request.Signature, attempts, err)
+	}
+
+	if err != nil {
+		return
+	}
+
+	responseContentType = response.Header.Get(proc.config.ContentTypeHeader)
+	if responseContentType == "" {
+		responseContentType = proc.config.DefaultContentType
+	}
+
+	if responseContentType == "" {
+		response.Body.Close()
+		return "", 0, ErrUnknownContentType
+	}
+
+	responseSize = -1
+	if sizeHeader := response.Header.Get(proc.config.SizeHeader); sizeHeader != "" {
+		size, err := strconv.ParseInt(sizeHeader, 10, 64)
+		if err != nil || size <= 0 {
+			response.Body.Close()
+			return "", 0, ErrUnknownContentLength
+		}
+
+		responseSize = size
+	}
+
+	go func() {
+		_, err := streamInput.ReadFrom(response.Body)
+		streamInput.Close(err)
+		response.Body.Close()
+	}()
+
+	return
+}
+
+func (proc *Processor) buildRequest(request processor.ParsedRequest) (*http.Request, error) {
+	requestURL, err := url.Parse(proc.config.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	requestURL.Path = strings.TrimRight(requestURL.Path, "/") + request.ProcessorEndpoint
+	requestURL.RawQuery = url.Values(request.ProcessingParams).Encode()
+
+	return http.NewRequest(http.MethodGet, requestURL.String(), nil)
+}
+
+func (proc *Processor) generateSignature(path, source string, params map[string][]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if proc.isParamSigned(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	signature := "|" + path + "|" + source + "|"
+	for _, key := range keys {
+		signature += key + "=" + strings.Join(params[key], ",") + "|"
+	}
+
+	return signature
+}
+
+func (proc *Processor) isParamAllowed(param string) bool {
+	if len(proc.config.AllowedParams) == 0 || param == proc.config.SourceURLParam {
+		return true
+	}
+
+	return contains(proc.config.AllowedParams, param)
+}
+
+func (proc *Processor) isParamSigned(param string) bool {
+	if len(proc.config.SignatureParams) == 0 || param == proc.config.SourceURLParam {
+		return true
+	}
+
+	return contains(proc.config.SignatureParams, param)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	ErrURLParamNotIncluded   = errors.New("url param not included")
+	ErrOperationNotSupported = errors.New("operation not supported")
+	ErrParamNotAllowed       = errors.New("param not allowed")
+	ErrResponseStatusNotOK   = errors.New("response status not OK")
+	ErrUnknownContentType    = errors.New("unknown response content type")
+	ErrUnknownContentLength  = errors.New("invalid response content length")
+)
@@ -0,0 +1,167 @@
+package genericprocessor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	mock_hub "github.com/thebartekbanach/imcaxy/pkg/hub/mocks"
+)
+
+func testingConfig() Config {
+	config := Config{
+		Name:            "cropper",
+		BaseURL:         "http://cropper:8080/api/",
+		Endpoints:       []string{"/crop"},
+		SourceURLParam:  "src",
+		AllowedParams:   []string{"width", "height", "debug"},
+		SignatureParams: []string{"width", "height"},
+		SizeHeader:      "X-Image-Size",
+	}
+	config.setDefaults()
+	return config
+}
+
+func responseFunc(statusCode int, headers http.Header, body []byte, onRequest func(req *http.Request)) httpRequestFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		onRequest(req)
+
+		return &http.Response{
+			StatusCode: statusCode,
+			Header:     headers,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	}
+}
+
+func TestParseConfigs_ShouldSetDefaults(t *testing.T) {
+	configs, err := ParseConfigs([]byte(`[{"name": "second-imaginary", "baseURL": "http://imaginary-2:9000", "endpoints": ["/resize"]}]`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	config := configs[0]
+	if config.SourceURLParam != "url" || config.ContentTypeHeader != "Content-Type" || config.SizeHeader != "Content-Length" {
+		t.Errorf("Expected defaults to be set, got %+v", config)
+	}
+}
+
+func TestParseConfigs_ShouldRejectInvalidConfigs(t *testing.T) {
+	cases := map[string]error{
+		`[{"baseURL": "http://a", "endpoints": ["/a"]}]`:                                                                         ErrNameNotSet,
+		`[{"name": "a", "baseURL": "a:8080", "endpoints": ["/a"]}]`:                                                              ErrInvalidBaseURL,
+		`[{"name": "a", "baseURL": "http://a"}]`:                                                                                 ErrEndpointsNotSet,
+		`[{"name": "a", "baseURL": "http://a", "endpoints": ["/a"]}, {"name": "a", "baseURL": "http://b", "endpoints": ["/a"]}]`: ErrDuplicatedName,
+	}
+
+	for data, expectedErr := range cases {
+		if _, err := ParseConfigs([]byte(data)); !errors.Is(err, expectedErr) {
+			t.Errorf("Expected error of %s to be %v, got %v", data, expectedErr, err)
+		}
+	}
+}
+
+func TestProcessor_ParseRequestShouldIncludeOnlySignatureParamsInSignature(t *testing.T) {
+	proc := newProcessor(testingConfig(), nil)
+
+	first, err := proc.ParseRequest("/crop?src=http://example.com/img.jpg&width=100&debug=1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	second, _ := proc.ParseRequest("/crop?width=100&src=http://example.com/img.jpg")
+	if first.Signature != second.Signature {
+		t.Errorf("Expected signatures to be equal, got %s and %s", first.Signature, second.Signature)
+	}
+
+	expectedSignature := "|/crop|http://example.com/img.jpg|src=http://example.com/img.jpg|width=100|"
+	if first.Signature != expectedSignature {
+		t.Errorf("Expected signature to be %s, got %s", expectedSignature, first.Signature)
+	}
+}
+
+func TestProcessor_ParseRequestShouldRejectInvalidRequests(t *testing.T) {
+	proc := newProcessor(testingConfig(), nil)
+	cases := map[string]error{
+		"/crop?width=100":                             ErrURLParamNotIncluded,
+		"/resize?src=http://example.com/img.jpg":      ErrOperationNotSupported,
+		"/crop?src=http://example.com/img.jpg&blur=5": ErrParamNotAllowed,
+	}
+
+	for requestPath, expectedErr := range cases {
+		if _, err := proc.ParseRequest(requestPath); err != expectedErr {
+			t.Errorf("Expected error of %s to be %v, got %v", requestPath, expectedErr, err)
+		}
+	}
+}
+
+func TestProcessor_ProcessImageShouldForwardRequestAndMapResponse(t *testing.T) {
+	var requestedURL string
+	headers := http.Header{"Content-Type": {"image/webp"}, "X-Image-Size": {"3"}}
+	makeRequest := responseFunc(200, headers, []byte{1, 2, 3}, func(req *http.Request) {
+		requestedURL = req.URL.String()
+	})
+
+	proc := newProcessor(testingConfig(), makeRequest)
+	request, _ := proc.ParseRequest("/crop?src=http://example.com/img.jpg&width=100")
+	input := mock_hub.NewMockTestingDataStreamInput(t, [][]byte{{1, 2, 3}}, nil, nil)
+
+	contentType, size, err := proc.ProcessImage(context.Background(), request, &input)
+	input.Wait()
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedURL := "http://cropper:8080/api/crop?src=http%3A%2F%2Fexample.com%2Fimg.jpg&width=100"
+	if requestedURL != expectedURL {
+		t.Errorf("Expected requested url to be %s, got %s", expectedURL, requestedURL)
+	}
+
+	if contentType != "image/webp" || size != 3 {
+		t.Errorf("Expected image/webp of size 3, got %s of size %d", contentType, size)
+	}
+}
+
+func TestProcessor_ProcessImageShouldUseDefaultContentTypeAndUnknownSize(t *testing.T) {
+	config := testingConfig()
+	config.DefaultContentType = "image/jpeg"
+
+	proc := newProcessor(config, responseFunc(200, http.Header{}, []byte{1}, func(req *http.Request) {}))
+	request, _ := proc.ParseRequest("/crop?src=http://example.com/img.jpg")
+	input := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+
+	contentType, size, err := proc.ProcessImage(context.Background(), request, &input)
+	input.Wait()
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if contentType != "image/jpeg" || size != -1 {
+		t.Errorf("Expected image/jpeg of size -1, got %s of size %d", contentType, size)
+	}
+}
+
+func TestProcessor_ProcessImageShouldRejectResponseWithoutContentType(t *testing.T) {
+	proc := newProcessor(testingConfig(), responseFunc(200, http.Header{}, []byte{1}, func(req *http.Request) {}))
+	request, _ := proc.ParseRequest("/crop?src=http://example.com/img.jpg")
+	input := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+
+	if _, _, err := proc.ProcessImage(context.Background(), request, &input); err != ErrUnknownContentType {
+		t.Errorf("Expected error to be %v, got %v", ErrUnknownContentType, err)
+	}
+}
+
+func TestProcessor_ProcessImageShouldReturnErrorOnNotOKStatus(t *testing.T) {
+	proc := newProcessor(testingConfig(), responseFunc(500, http.Header{}, nil, func(req *http.Request) {}))
+	request, _ := proc.ParseRequest("/crop?src=http://example.com/img.jpg")
+	input := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+
+	if _, _, err := proc.ProcessImage(context.Background(), request, &input); !errors.Is(err, ErrResponseStatusNotOK) {
+		t.Errorf("Expected error to be %v, got %v", ErrResponseStatusNotOK, err)
+	}
+}
@@ -0,0 +1,280 @@
+package imaginaryprocessor
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/thebartekbanach/imcaxy/pkg/circuitbreaker"
+)
+
+type BackendStatus struct {
+	URL                 string     `json:"url"`
+	Weight              int        `json:"weight"`
+	Healthy             bool       `json:"healthy"`
+	EjectedUntil        *time.Time `json:"ejectedUntil"`
+	OutstandingRequests int        `json:"outstandingRequests"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	TotalRequests       int64      `json:"totalRequests"`
+	TotalFailures       int64      `json:"totalFailures"`
+	CircuitState        string     `json:"circuitState,omitempty"`
+}
+
+type backend struct {
+	url    string
+	weight int
+
+	healthy             bool
+	ejectedUntil        time.Time
+	outstanding         int
+	consecutiveFailures int
+	currentWeight       int
+	totalRequests       int64
+	totalFailures       int64
+
+	// breaker is nil when circuit breaking is disabled
+	breaker *circuitbreaker.Breaker
+}
+
+type backendPool struct {
+	backends               []*backend
+	strategy               BalancingStrategy
+	maxConsecutiveFailures int
+	ejectionDuration       time.Duration
+	next                   int
+	now                    func() time.Time
+	lock                   sync.Mutex
+}
+
+func newBackendPool(config Config) *backendPool {
+	pool := &backendPool{
+		strategy:               config.BalancingStrategy,
+		maxConsecutiveFailures: config.MaxConsecutiveFailures,
+		ejectionDuration:       config.EjectionDuration,
+		now:                    time.Now,
+	}
+
+	for _, backendConfig := range config.backends() {
+		weight := backendConfig.Weight
+		if weight < 1 {
+			weight = 1
+		}
+
+		b := &backend{
+			url:     backendConfig.URL,
+			weight:  weight,
+			healthy: true,
+		}
+
+		if config.CircuitBreaker.Enabled() {
+			b.breaker = circuitbreaker.NewBreaker("imaginary_"+backendConfig.URL, config.CircuitBreaker)
+		}
+
+		pool.backends = append(pool.backends, b)
+	}
+
+	return pool
+}
+
+// acquire picks the backend that should handle next request
+// and marks the request as outstanding on it, backends with open
+// circuit are skipped and *circuitbreaker.OpenError is returned
+// when circuits of all otherwise selectable backends are open
+func (p *backendPool) acquire() (*backend, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := p.now()
+	available := func(b *backend) bool {
+		return p.isAvailable(b, now)
+	}
+
+	// when all backends are out of rotation, requests are sent to all of them,
+	// so the last backend is never taken out of rotation and requests do not
+	// fail when all backends were marked unhealthy by a network hiccup
+	if !p.anyAvailable(now) {
+		available = func(b *backend) bool { return true }
+	}
+
+	rejected := map[*backend]bool{}
+	selectable := func(b *backend) bool {
+		return available(b) && !rejected[b]
+	}
+
+	for {
+		var selected *backend
+		if p.strategy == WeightedRoundRobin {
+			selected = p.selectUsingWeightedRoundRobin(selectable)
+		} else {
+			selected = p.selectUsingLeastOutstandingRequests(selectable)
+		}
+
+		if selected == nil {
+			break
+		}
+
+		if selected.breaker != nil && selected.breaker.Allow() != nil {
+			rejected[selected] = true
+			continue
+		}
+
+		selected.outstanding++
+		selected.totalRequests++
+		return selected, nil
+	}
+
+	if len(rejected) > 0 {
+		return nil, &circuitbreaker.OpenError{RetryAfter: p.earliestRetryAfter(rejected)}
+	}
+
+	return nil, ErrNoBackendAvailable
+}
+
+// release finishes outstanding request and records its result,
+// backend is ejected after too many consecutive failures
+func (p *backendPool) release(b *backend, success bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	b.outstanding--
+
+	if b.breaker != nil {
+		b.breaker.Report(success)
+	}
+
+	if success {
+		b.consecutiveFailures = 0
+		return
+	}
+
+	b.totalFailures++
+	b.consecutiveFailures++
+	if p.maxConsecutiveFailures > 0 && b.consecutiveFailures >= p.maxConsecutiveFailures {
+		b.ejectedUntil = p.now().Add(p.ejectionDuration)
+		b.consecutiveFailures = 0
+	}
+}
+
+// cancel finishes outstanding request without recording its result,
+// it is used for requests cancelled by the caller, which do not
+// tell anything about backend health
+func (p *backendPool) cancel(b *backend) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	b.outstanding--
+
+	if b.breaker != nil {
+		b.breaker.Ignore()
+	}
+}
+
+// setHealth returns true if health of the backend has changed
+func (p *backendPool) setHealth(b *backend, healthy bool) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	changed := b.healthy != healthy
+	b.healthy = healthy
+	return changed
+}
+
+func (p *backendPool) status() []BackendStatus {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := p.now()
+	result := make([]BackendStatus, len(p.backends))
+	for i, b := range p.backends {
+		result[i] = BackendStatus{
+			URL:                 b.url,
+			Weight:              b.weight,
+			Healthy:             b.healthy,
+			OutstandingRequests: b.outstanding,
+			ConsecutiveFailures: b.consecutiveFailures,
+			TotalRequests:       b.totalRequests,
+			TotalFailures:       b.totalFailures,
+		}
+
+		if b.breaker != nil {
+			result[i].CircuitState = b.breaker.State().String()
+		}
+
+		if b.ejectedUntil.After(now) {
+			ejectedUntil := b.ejectedUntil
+			result[i].EjectedUntil = &ejectedUntil
+		}
+	}
+
+	return result
+}
+
+func (p *backendPool) isAvailable(b *backend, now time.Time) bool {
+	return b.healthy && !b.ejectedUntil.After(now)
+}
+
+func (p *backendPool) anyAvailable(now time.Time) bool {
+	for _, b := range p.backends {
+		if p.isAvailable(b, now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *backendPool) earliestRetryAfter(backends map[*backend]bool) time.Duration {
+	earliest := time.Duration(-1)
+	for b := range backends {
+		if retryAfter := b.breaker.RetryAfter(); earliest < 0 || retryAfter < earliest {
+			earliest = retryAfter
+		}
+	}
+
+	return earliest
+}
+
+func (p *backendPool) selectUsingLeastOutstandingRequests(available func(b *backend) bool) *backend {
+	var selected *backend
+	for i := range p.backends {
+		// start from different backend every time, so backends with
+		// equal number of outstanding requests are used in turns
+		b := p.backends[(p.next+i)%len(p.backends)]
+		if !available(b) {
+			continue
+		}
+
+		if selected == nil || b.outstanding*selected.weight < selected.outstanding*b.weight {
+			selected = b
+		}
+	}
+
+	p.next = (p.next + 1) % len(p.backends)
+	return selected
+}
+
+// smooth weighted round robin, the same as used by nginx
+func (p *backendPool) selectUsingWeightedRoundRobin(available func(b *backend) bool) *backend {
+	var selected *backend
+	totalWeight := 0
+	for _, b := range p.backends {
+		if !available(b) {
+			continue
+		}
+
+		b.currentWeight += b.weight
+		totalWeight += b.weight
+
+		if selected == nil || b.currentWeight > selected.currentWeight {
+			selected = b
+		}
+	}
+
+	if selected != nil {
+		selected.currentWeight -= totalWeight
+	}
+
+	return selected
+}
+
+var ErrNoBackendAvailable = errors.New("no imaginary backend available")
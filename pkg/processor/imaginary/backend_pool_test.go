@@ -0,0 +1,357 @@
+package imaginaryprocessor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/thebartekbanach/imcaxy/pkg/circuitbreaker"
+	mock_hub "github.com/thebartekbanach/imcaxy/pkg/hub/mocks"
+	"github.com/thebartekbanach/imcaxy/pkg/processor"
+)
+
+func TestBackendPool_WeightedRoundRobinDistributesRequestsAccordingToWeights(t *testing.T) {
+	pool := newBackendPool(Config{
+		Backends: []BackendConfig{
+			{URL: "first:8080", Weight: 3},
+			{URL: "second:8080", Weight: 1},
+		},
+		BalancingStrategy: WeightedRoundRobin,
+	})
+
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		b, err := pool.acquire()
+		if err != nil {
+			t.Fatalf("Unexpected error when acquiring backend: %v", err)
+		}
+
+		counts[b.url]++
+		pool.release(b, true)
+	}
+
+	if counts["first:8080"] != 6 || counts["second:8080"] != 2 {
+		t.Errorf("Expected requests to be distributed 6:2, got %v", counts)
+	}
+}
+
+func TestBackendPool_LeastOutstandingRequestsPicksLeastBusyBackend(t *testing.T) {
+	pool := newBackendPool(Config{
+		Backends: []BackendConfig{
+			{URL: "first:8080"},
+			{URL: "second:8080"},
+		},
+		BalancingStrategy: LeastOutstandingRequests,
+	})
+
+	first, _ := pool.acquire()
+	second, _ := pool.acquire()
+	if first == second {
+		t.Fatalf("Expected second request to be sent to idle backend")
+	}
+
+	pool.release(first, true)
+
+	third, _ := pool.acquire()
+	if third != first {
+		t.Errorf("Expected third request to be sent to %s, got %s", first.url, third.url)
+	}
+}
+
+func TestBackendPool_EjectsBackendAfterConsecutiveFailures(t *testing.T) {
+	now := time.Now()
+	pool := newBackendPool(Config{
+		Backends: []BackendConfig{
+			{URL: "first:8080"},
+			{URL: "second:8080"},
+		},
+		MaxConsecutiveFailures: 2,
+		EjectionDuration:       time.Minute,
+	})
+	pool.now = func() time.Time { return now }
+
+	failing := pool.backends[0]
+	for i := 0; i < 2; i++ {
+		failing.outstanding++
+		pool.release(failing, false)
+	}
+
+	for i := 0; i < 4; i++ {
+		b, err := pool.acquire()
+		if err != nil {
+			t.Fatalf("Unexpected error when acquiring backend: %v", err)
+		}
+
+		if b == failing {
+			t.Fatalf("Expected ejected backend to be out of rotation")
+		}
+
+		pool.release(b, true)
+	}
+
+	if pool.status()[0].EjectedUntil == nil {
+		t.Errorf("Expected status to contain ejection time of failing backend")
+	}
+
+	now = now.Add(2 * time.Minute)
+
+	used := false
+	for i := 0; i < 2; i++ {
+		b, _ := pool.acquire()
+		used = used || b == failing
+		pool.release(b, true)
+	}
+
+	if !used {
+		t.Errorf("Expected backend to return to rotation after ejection duration")
+	}
+}
+
+func TestBackendPool_SuccessResetsConsecutiveFailures(t *testing.T) {
+	pool := newBackendPool(Config{
+		ImaginaryServiceURL:    "first:8080",
+		MaxConsecutiveFailures: 2,
+		EjectionDuration:       time.Minute,
+	})
+
+	b, _ := pool.acquire()
+	pool.release(b, false)
+	b, _ = pool.acquire()
+	pool.release(b, true)
+	b, _ = pool.acquire()
+	pool.release(b, false)
+
+	if _, err := pool.acquire(); err != nil {
+		t.Errorf("Expected backend not to be ejected, got error: %v", err)
+	}
+}
+
+func TestBackendPool_UsesUnhealthyBackendWhenNoBackendIsAvailable(t *testing.T) {
+	pool := newBackendPool(Config{ImaginaryServiceURL: "first:8080"})
+	pool.setHealth(pool.backends[0], false)
+
+	if b, err := pool.acquire(); err != nil || b != pool.backends[0] {
+		t.Errorf("Expected the only backend to be used, got: %v, %v", b, err)
+	}
+}
+
+func TestBackendPool_UsesAllBackendsWhenAllOfThemAreEjected(t *testing.T) {
+	now := time.Now()
+	pool := newBackendPool(Config{
+		Backends: []BackendConfig{
+			{URL: "first:8080"},
+			{URL: "second:8080"},
+		},
+		MaxConsecutiveFailures: 1,
+		EjectionDuration:       time.Minute,
+	})
+	pool.now = func() time.Time { return now }
+
+	for _, b := range pool.backends {
+		b.outstanding++
+		pool.release(b, false)
+	}
+
+	used := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		b, err := pool.acquire()
+		if err != nil {
+			t.Fatalf("Unexpected error when acquiring backend: %v", err)
+		}
+
+		used[b.url] = true
+		pool.release(b, true)
+	}
+
+	if len(used) != 2 {
+		t.Errorf("Expected requests to be sent to all ejected backends, got %v", used)
+	}
+}
+
+func TestBackendPool_SkipsBackendWithOpenCircuit(t *testing.T) {
+	pool := newBackendPool(Config{
+		Backends: []BackendConfig{
+			{URL: "first:8080"},
+			{URL: "second:8080"},
+		},
+		CircuitBreaker: circuitbreaker.Config{FailureThreshold: 1, OpenDuration: time.Minute},
+	})
+
+	failing := pool.backends[0]
+	failing.outstanding++
+	pool.release(failing, false)
+
+	for i := 0; i < 4; i++ {
+		b, err := pool.acquire()
+		if err != nil {
+			t.Fatalf("Unexpected error when acquiring backend: %v", err)
+		}
+
+		if b == failing {
+			t.Fatalf("Expected backend with open circuit to be skipped")
+		}
+
+		pool.release(b, true)
+	}
+
+	if state := pool.status()[0].CircuitState; state != circuitbreaker.Open.String() {
+		t.Errorf("Expected status to contain open circuit of failing backend, got: %s", state)
+	}
+}
+
+func TestBackendPool_ReturnsOpenErrorWhenCircuitsOfAllBackendsAreOpen(t *testing.T) {
+	pool := newBackendPool(Config{
+		Backends: []BackendConfig{
+			{URL: "first:8080"},
+			{URL: "second:8080"},
+		},
+		CircuitBreaker: circuitbreaker.Config{FailureThreshold: 1, OpenDuration: time.Minute},
+	})
+
+	for _, b := range pool.backends {
+		b.outstanding++
+		pool.release(b, false)
+	}
+
+	_, err := pool.acquire()
+
+	var openErr *circuitbreaker.OpenError
+	if !errors.As(err, &openErr) || !errors.Is(err, circuitbreaker.ErrCircuitOpen) {
+		t.Fatalf("Expected open circuit error, got: %v", err)
+	}
+
+	if openErr.RetryAfter <= 0 || openErr.RetryAfter > time.Minute {
+		t.Errorf("Expected retry after to be within open duration, got: %s", openErr.RetryAfter)
+	}
+}
+
+func TestProcessor_CountsRequestsExceedingDeadlineAsBackendFailures(t *testing.T) {
+	config := Config{
+		ImaginaryServiceURL: "first:8080",
+		CircuitBreaker:      circuitbreaker.Config{FailureThreshold: 1, OpenDuration: time.Minute},
+		RetryPolicy:         testingRetryPolicy(1),
+	}
+
+	proc := newProcessor(config, func(req *http.Request) (*http.Response, error) {
+		return nil, req.Context().Err()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	inputStream := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+	proc.ProcessImage(ctx, processor.ParsedRequest{ProcessorEndpoint: "/crop"}, &inputStream)
+
+	status := proc.BackendsStatus()[0]
+	if status.TotalFailures != 1 || status.CircuitState != circuitbreaker.Open.String() {
+		t.Errorf("Expected request exceeding deadline to open the circuit, got status: %+v", status)
+	}
+}
+
+func TestProcessor_DoesNotCountRequestsCancelledByCallerAsBackendFailures(t *testing.T) {
+	config := Config{
+		ImaginaryServiceURL: "first:8080",
+		CircuitBreaker:      circuitbreaker.Config{FailureThreshold: 1, OpenDuration: time.Minute},
+		RetryPolicy:         testingRetryPolicy(1),
+	}
+
+	proc := newProcessor(config, func(req *http.Request) (*http.Response, error) {
+		return nil, req.Context().Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	inputStream := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+	proc.ProcessImage(ctx, processor.ParsedRequest{ProcessorEndpoint: "/crop"}, &inputStream)
+
+	status := proc.BackendsStatus()[0]
+	if status.TotalFailures != 0 || status.OutstandingRequests != 0 || status.CircuitState != circuitbreaker.Closed.String() {
+		t.Errorf("Expected cancelled request not to be counted, got status: %+v", status)
+	}
+}
+
+func TestProcessor_HealthProbesTakeUnhealthyBackendsOutOfRotation(t *testing.T) {
+	config := Config{
+		Backends: []BackendConfig{
+			{URL: "healthy:8080"},
+			{URL: "unhealthy:8080"},
+		},
+	}
+
+	proc := newProcessor(config, func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/health" {
+			t.Errorf("Expected health probe to be sent to /health, got %s", req.URL.Path)
+		}
+
+		if req.URL.Host == "unhealthy:8080" {
+			return nil, errors.New("connection refused")
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+		}, nil
+	})
+
+	proc.probeBackends(context.Background())
+
+	for _, status := range proc.BackendsStatus() {
+		if status.Healthy != (status.URL == "healthy:8080") {
+			t.Errorf("Unexpected health of backend %s: %v", status.URL, status.Healthy)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		b, _ := proc.backends.acquire()
+		if b.url != "healthy:8080" {
+			t.Errorf("Expected request to be sent to healthy backend, got %s", b.url)
+		}
+		proc.backends.release(b, true)
+	}
+}
+
+func TestProcessor_RetriesFailedRequestOnAnotherBackend(t *testing.T) {
+	config := Config{
+		Backends: []BackendConfig{
+			{URL: "first:8080"},
+			{URL: "second:8080"},
+		},
+		BalancingStrategy: WeightedRoundRobin,
+		RetryPolicy:       testingRetryPolicy(2),
+	}
+
+	requestedHosts := []string{}
+	proc := newProcessor(config, func(req *http.Request) (*http.Response, error) {
+		requestedHosts = append(requestedHosts, req.URL.Host)
+		if req.URL.Host == "first:8080" {
+			return nil, errors.New("connection reset by peer")
+		}
+
+		headers := http.Header{}
+		headers.Add("Content-Type", "image/png")
+		headers.Add("Content-Length", "1")
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     headers,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte{0x1})),
+		}, nil
+	})
+
+	inputStream := mock_hub.NewMockTestingDataStreamInput(t, [][]byte{{0x1}}, nil, nil)
+	_, _, err := proc.ProcessImage(context.Background(), processor.ParsedRequest{ProcessorEndpoint: "/crop"}, &inputStream)
+	inputStream.Wait()
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(requestedHosts) != 2 || requestedHosts[0] == requestedHosts[1] {
+		t.Errorf("Expected request to be retried on another backend, got requests to: %v", requestedHosts)
+	}
+}
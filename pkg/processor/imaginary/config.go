@@ -1,5 +1,54 @@
 package imaginaryprocessor
 
+import (
+	"time"
+
+	"github.com/thebartekbanach/imcaxy/pkg/circuitbreaker"
+	"github.com/thebartekbanach/imcaxy/pkg/retry"
+)
+
+type BalancingStrategy string
+
+const (
+	LeastOutstandingRequests BalancingStrategy = "least-outstanding"
+	WeightedRoundRobin       BalancingStrategy = "weighted-round-robin"
+)
+
+type BackendConfig struct {
+	URL    string
+	Weight int
+}
+
+type HealthCheckConfig struct {
+	// Interval of active health probes, zero disables active probing.
+	Interval time.Duration
+	Timeout  time.Duration
+	Path     string
+}
+
 type Config struct {
+	// ImaginaryServiceURL is used as the only backend if Backends are not set.
 	ImaginaryServiceURL string
+	Backends            []BackendConfig
+	BalancingStrategy   BalancingStrategy
+	HealthCheck         HealthCheckConfig
+
+	// Backend is taken out of rotation for EjectionDuration after
+	// MaxConsecutiveFailures failed requests, zero disables ejection.
+	MaxConsecutiveFailures int
+	EjectionDuration       time.Duration
+
+	// CircuitBreaker is applied to every backend separately,
+	// see circuitbreaker.Config for disabling it.
+	CircuitBreaker circuitbreaker.Config
+
+	RetryPolicy retry.Policy
+}
+
+func (c Config) backends() []BackendConfig {
+	if len(c.Backends) > 0 {
+		return c.Backends
+	}
+
+	return []BackendConfig{{URL: c.ImaginaryServiceURL, Weight: 1}}
 }
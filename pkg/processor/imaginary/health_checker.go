@@ -0,0 +1,82 @@
+package imaginaryprocessor
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/thebartekbanach/imcaxy/pkg/metrics"
+)
+
+// StartHealthChecks starts active health probing of all backends,
+// which lasts until given context is done.
+func (proc *Processor) StartHealthChecks(ctx context.Context) {
+	if proc.config.HealthCheck.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(proc.config.HealthCheck.Interval)
+		defer ticker.Stop()
+
+		for {
+			proc.probeBackends(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (proc *Processor) probeBackends(ctx context.Context) {
+	healthyBackends := 0
+	for _, b := range proc.backends.backends {
+		healthy := proc.probeBackend(ctx, b)
+		if changed := proc.backends.setHealth(b, healthy); changed {
+			log.Printf("imaginary backend %s health changed, healthy: %v", b.url, healthy)
+		}
+
+		if healthy {
+			healthyBackends++
+		}
+	}
+
+	metrics.Set("imaginary_healthy_backends", int64(healthyBackends))
+}
+
+func (proc *Processor) probeBackend(ctx context.Context, b *backend) bool {
+	timeout := proc.config.HealthCheck.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	path := proc.config.HealthCheck.Path
+	if path == "" {
+		path = "/health"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req := http.Request{
+		Method: http.MethodGet,
+		URL: &url.URL{
+			Scheme: "http",
+			Host:   b.url,
+			Path:   path,
+		},
+	}
+
+	response, err := proc.makeRequest(req.WithContext(ctx))
+	if err != nil {
+		return false
+	}
+
+	response.Body.Close()
+	return response.StatusCode == http.StatusOK
+}
@@ -3,6 +3,8 @@ package imaginaryprocessor
 import (
 	"context"
 	"errors"
+	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"sort"
@@ -10,6 +12,7 @@ import (
 	"strings"
 
 	"github.com/thebartekbanach/imcaxy/pkg/hub"
+	"github.com/thebartekbanach/imcaxy/pkg/metrics"
 	"github.com/thebartekbanach/imcaxy/pkg/processor"
 )
 
@@ -18,12 +21,18 @@ type httpRequestFunc func(req *http.Request) (*http.Response, error)
 type Processor struct {
 	config      Config
 	makeRequest httpRequestFunc
+	backends    *backendPool
 }
 
 var _ processor.ProcessingService = (*Processor)(nil)
+var _ processor.CircuitBreaking = (*Processor)(nil)
 
 func NewProcessor(config Config) Processor {
-	return Processor{config, http.DefaultClient.Do}
+	return newProcessor(config, http.DefaultClient.Do)
+}
+
+func newProcessor(config Config, makeRequest httpRequestFunc) Processor {
+	return Processor{config, makeRequest, newBackendPool(config)}
 }
 
 func (proc *Processor) ParseRequest(requestPath string) (processor.ParsedRequest, error) {
@@ -58,57 +67,106 @@ func (proc *Processor) ProcessImage(
 	request processor.ParsedRequest,
 	streamInput hub.DataStreamInput,
 ) (responseContentType string, responseSize int64, err error) {
-	req := proc.buildRequest(request)
+	// request is retried only until the response is accepted,
+	// nothing is written to the stream input before that
+	var response *http.Response
+	var selectedBackend *backend
+	attempts, err := proc.config.RetryPolicy.Do(ctx, func(attempt int) (bool, error) {
+		b, err := proc.backends.acquire()
+		if err != nil {
+			return false, err
+		}
 
-	response, err := proc.makeRequest(req.WithContext(ctx))
-	if err != nil {
-		return
+		req := proc.buildRequest(b.url, request)
+
+		res, err := proc.makeRequest(req.WithContext(ctx))
+		if err != nil {
+			proc.releaseBackend(ctx, b, false)
+			return true, err
+		}
+
+		if res.StatusCode != 200 {
+			res.Body.Close()
+			proc.backends.release(b, res.StatusCode < 500)
+			return proc.config.RetryPolicy.IsRetryableStatus(res.StatusCode), &processor.StatusError{StatusCode: res.StatusCode, Err: ErrResponseStatusNotOK}
+		}
+
+		response = res
+		selectedBackend = b
+		return false, nil
+	})
+
+	if attempts > 1 {
+		metrics.Add("imaginary_processing_retries", int64(attempts-1))
+		log.Printf("imaginary request for %s finished after %d attempts, error: %v", request.Signature, attempts, err)
 	}
 
-	if response.StatusCode != 200 {
-		response.Body.Close()
-		err = ErrResponseStatusNotOK
+	if err != nil {
 		return
 	}
 
 	contentType, exists := response.Header["Content-Type"]
 	if !exists || len(contentType) == 0 {
 		response.Body.Close()
+		proc.backends.release(selectedBackend, true)
 		err = ErrUnknownContentType
 		return
 	}
 
+	// chunked responses do not include Content-Length header,
+	// their size is known only after the whole body is read
+	responseSize = -1
 	responseSizeHeader, exists := response.Header["Content-Length"]
-	if !exists || len(responseSizeHeader) == 0 {
-		response.Body.Close()
-		err = ErrUnknownContentLength
-		return
-	}
+	if exists && len(responseSizeHeader) > 0 {
+		responseSizeHeaderValue, err := strconv.Atoi(responseSizeHeader[0])
+		if err != nil || responseSizeHeaderValue <= 0 {
+			response.Body.Close()
+			proc.backends.release(selectedBackend, true)
+			return "", 0, ErrUnknownContentLength
+		}
 
-	responseSizeHeaderValue, err := strconv.Atoi(responseSizeHeader[0])
-	if err != nil || responseSizeHeaderValue <= 0 {
-		response.Body.Close()
-		err = ErrUnknownContentLength
-		return
+		responseSize = int64(responseSizeHeaderValue)
 	}
 
 	go func() {
 		_, err := streamInput.ReadFrom(response.Body)
 		streamInput.Close(err)
 		response.Body.Close()
+		proc.releaseBackend(ctx, selectedBackend, err == nil || err == io.EOF)
 	}()
 
 	responseContentType = contentType[0]
-	responseSize = int64(responseSizeHeaderValue)
 	return
 }
 
-func (proc *Processor) buildRequest(request processor.ParsedRequest) *http.Request {
+// BreaksCircuit reports whether every backend has its own circuit breaker
+func (proc *Processor) BreaksCircuit() bool {
+	return proc.config.CircuitBreaker.Enabled()
+}
+
+// BackendsStatus returns current state of all imaginary backends
+func (proc *Processor) BackendsStatus() []BackendStatus {
+	return proc.backends.status()
+}
+
+// releaseBackend does not count failures of requests cancelled by the caller,
+// which do not tell anything about backend health, but requests which
+// exceeded their deadline are failures of the backend
+func (proc *Processor) releaseBackend(ctx context.Context, b *backend, success bool) {
+	if !success && errors.Is(ctx.Err(), context.Canceled) {
+		proc.backends.cancel(b)
+		return
+	}
+
+	proc.backends.release(b, success)
+}
+
+func (proc *Processor) buildRequest(backendURL string, request processor.ParsedRequest) *http.Request {
 	req := http.Request{
 		Method: http.MethodGet,
 		URL: &url.URL{
 			Scheme: "http",
-			Host:   proc.config.ImaginaryServiceURL,
+			Host:   backendURL,
 			Path:   request.ProcessorEndpoint,
 		},
 	}
@@ -165,9 +223,10 @@ func (proc *Processor) isOperationSupported(endpoint string) bool {
 var (
 	ErrResponseStatusNotOK   = errors.New("response status not OK")
 	ErrUnknownContentType    = errors.New("unknown response content type")
-	ErrUnknownContentLength  = errors.New("unknown response content length")
+	ErrUnknownContentLength  = errors.New("invalid response content length")
 	ErrURLParamNotIncluded   = errors.New("url param not included")
 	ErrOperationNotSupported = errors.New("operation not supported")
+	ErrNoOperations          = errors.New("no operations to execute")
 )
 
 var supportedImaginaryEndpoints = []string{
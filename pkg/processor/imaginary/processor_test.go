@@ -3,6 +3,7 @@ package imaginaryprocessor
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -10,6 +11,7 @@ import (
 	"os"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/franela/goblin"
 	"github.com/golang/mock/gomock"
@@ -17,6 +19,7 @@ import (
 	mock_hub "github.com/thebartekbanach/imcaxy/pkg/hub/mocks"
 	datahubstorage "github.com/thebartekbanach/imcaxy/pkg/hub/storage"
 	"github.com/thebartekbanach/imcaxy/pkg/processor"
+	"github.com/thebartekbanach/imcaxy/pkg/retry"
 	testutils "github.com/thebartekbanach/imcaxy/test/utils"
 )
 
@@ -86,6 +89,15 @@ func stringResponseSize(responseString string) func(response []byte) string {
 	}
 }
 
+func testingRetryPolicy(maxAttempts int) retry.Policy {
+	return retry.Policy{
+		MaxAttempts:          maxAttempts,
+		InitialBackoff:       time.Millisecond,
+		Multiplier:           2,
+		RetryableStatusCodes: []int{502, 503, 504},
+	}
+}
+
 func TestImaginaryProcessor(t *testing.T) {
 	g := goblin.Goblin(t)
 
@@ -161,7 +173,7 @@ func TestImaginaryProcessor(t *testing.T) {
 				ctx, cancel := context.WithCancel(context.Background())
 				defer cancel()
 
-				proc := Processor{config, requestMaker}
+				proc := newProcessor(config, requestMaker)
 				contentType, _, _ := proc.ProcessImage(ctx, parsedRequest, &inputStream)
 
 				g.Assert(contentType).Equal("image/png")
@@ -185,7 +197,7 @@ func TestImaginaryProcessor(t *testing.T) {
 				ctx, cancel := context.WithCancel(context.Background())
 				defer cancel()
 
-				proc := Processor{config, requestMaker}
+				proc := newProcessor(config, requestMaker)
 				proc.ProcessImage(ctx, parsedRequest, &inputStream)
 
 				inputStream.Wait()
@@ -210,7 +222,7 @@ func TestImaginaryProcessor(t *testing.T) {
 				ctx, cancel := context.WithCancel(context.Background())
 				defer cancel()
 
-				proc := Processor{config, requestMaker}
+				proc := newProcessor(config, requestMaker)
 				_, _, err := proc.ProcessImage(ctx, parsedRequest, &inputStream)
 
 				g.Assert(err).Equal(io.ErrUnexpectedEOF)
@@ -234,10 +246,10 @@ func TestImaginaryProcessor(t *testing.T) {
 				ctx, cancel := context.WithCancel(context.Background())
 				defer cancel()
 
-				proc := Processor{config, requestMaker}
+				proc := newProcessor(config, requestMaker)
 				_, _, err := proc.ProcessImage(ctx, parsedRequest, &inputStream)
 
-				g.Assert(err).Equal(ErrResponseStatusNotOK)
+				g.Assert(errors.Is(err, ErrResponseStatusNotOK)).IsTrue()
 			})
 
 			g.It("Should return error if imaginary service response does not include Content-Type header", func() {
@@ -258,13 +270,13 @@ func TestImaginaryProcessor(t *testing.T) {
 				ctx, cancel := context.WithCancel(context.Background())
 				defer cancel()
 
-				proc := Processor{config, requestMaker}
+				proc := newProcessor(config, requestMaker)
 				_, _, err := proc.ProcessImage(ctx, parsedRequest, &inputStream)
 
 				g.Assert(err).Equal(ErrUnknownContentType)
 			})
 
-			g.It("Should return error if imaginary service response does not include Content-Length header", func() {
+			g.It("Should stream response of unknown size if imaginary service response does not include Content-Length header", func() {
 				config := Config{ImaginaryServiceURL: "http://localhost:3000"}
 				testData := []byte{0x1, 0x2, 0x3, 0x4, 0x5, 0x6}
 				inputStream := mock_hub.NewMockTestingDataStreamInput(g, [][]byte{testData}, nil, nil)
@@ -282,10 +294,13 @@ func TestImaginaryProcessor(t *testing.T) {
 				ctx, cancel := context.WithCancel(context.Background())
 				defer cancel()
 
-				proc := Processor{config, requestMaker}
-				_, _, err := proc.ProcessImage(ctx, parsedRequest, &inputStream)
+				proc := newProcessor(config, requestMaker)
+				_, size, err := proc.ProcessImage(ctx, parsedRequest, &inputStream)
 
-				g.Assert(err).Equal(ErrUnknownContentLength)
+				inputStream.Wait()
+				g.Assert(err).IsNil()
+				g.Assert(size).Equal(int64(-1))
+				g.Assert(inputStream.SafelyGetDataSegment(0)).Equal(testData)
 			})
 
 			g.It("Should return error if responses Content-Length header is zero", func() {
@@ -306,7 +321,7 @@ func TestImaginaryProcessor(t *testing.T) {
 				ctx, cancel := context.WithCancel(context.Background())
 				defer cancel()
 
-				proc := Processor{config, requestMaker}
+				proc := newProcessor(config, requestMaker)
 				_, _, err := proc.ProcessImage(ctx, parsedRequest, &inputStream)
 
 				g.Assert(err).Equal(ErrUnknownContentLength)
@@ -330,7 +345,7 @@ func TestImaginaryProcessor(t *testing.T) {
 				ctx, cancel := context.WithCancel(context.Background())
 				defer cancel()
 
-				proc := Processor{config, requestMaker}
+				proc := newProcessor(config, requestMaker)
 				_, _, err := proc.ProcessImage(ctx, parsedRequest, &inputStream)
 
 				g.Assert(err).Equal(ErrUnknownContentLength)
@@ -354,12 +369,103 @@ func TestImaginaryProcessor(t *testing.T) {
 				ctx, cancel := context.WithCancel(context.Background())
 				defer cancel()
 
-				proc := Processor{config, requestMaker}
+				proc := newProcessor(config, requestMaker)
 				proc.ProcessImage(ctx, parsedRequest, &inputStream)
 
 				inputStream.Wait()
 				g.Assert(inputStream.ForwardedError).Equal(io.ErrUnexpectedEOF)
 			})
+
+			g.It("Should retry request when imaginary service responds with retryable status code", func() {
+				config := Config{
+					ImaginaryServiceURL: "http://localhost:3000",
+					RetryPolicy:         testingRetryPolicy(3),
+				}
+				testData := []byte{0x1, 0x2, 0x3, 0x4, 0x5, 0x6}
+				inputStream := mock_hub.NewMockTestingDataStreamInput(g, [][]byte{testData}, nil, nil)
+				parsedRequest := processor.ParsedRequest{
+					Signature:         "abc",
+					SourceImageURL:    "http://google.com/image.jpg",
+					ProcessorEndpoint: "/crop",
+				}
+
+				calls := 0
+				failingRequestMaker := testReqFunc(502, nil, nil, nil, true, normalResponseSize, noAssertions)
+				succeedingRequestMaker := testReqFunc(200, testData, nil, nil, true, normalResponseSize, noAssertions)
+				requestMaker := func(req *http.Request) (*http.Response, error) {
+					calls++
+					if calls < 3 {
+						return failingRequestMaker(req)
+					}
+
+					return succeedingRequestMaker(req)
+				}
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				proc := newProcessor(config, requestMaker)
+				_, _, err := proc.ProcessImage(ctx, parsedRequest, &inputStream)
+
+				inputStream.Wait()
+				g.Assert(err).IsNil()
+				g.Assert(calls).Equal(3)
+				g.Assert(inputStream.SafelyGetDataSegment(0)).Equal(testData)
+			})
+
+			g.It("Should not retry request when imaginary service responds with non-retryable status code", func() {
+				config := Config{
+					ImaginaryServiceURL: "http://localhost:3000",
+					RetryPolicy:         testingRetryPolicy(3),
+				}
+				inputStream := mock_hub.NewMockTestingDataStreamInput(g, nil, nil, nil)
+				parsedRequest := processor.ParsedRequest{
+					Signature:         "abc",
+					SourceImageURL:    "http://google.com/image.jpg",
+					ProcessorEndpoint: "/crop",
+				}
+
+				calls := 0
+				requestMaker := testReqFunc(400, nil, nil, nil, true, normalResponseSize, func(req *http.Request) {
+					calls++
+				})
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				proc := newProcessor(config, requestMaker)
+				_, _, err := proc.ProcessImage(ctx, parsedRequest, &inputStream)
+
+				g.Assert(errors.Is(err, ErrResponseStatusNotOK)).IsTrue()
+				g.Assert(calls).Equal(1)
+			})
+
+			g.It("Should retry request when http request returns error and return the last error", func() {
+				config := Config{
+					ImaginaryServiceURL: "http://localhost:3000",
+					RetryPolicy:         testingRetryPolicy(2),
+				}
+				inputStream := mock_hub.NewMockTestingDataStreamInput(g, nil, nil, nil)
+				parsedRequest := processor.ParsedRequest{
+					Signature:         "abc",
+					SourceImageURL:    "http://google.com/image.jpg",
+					ProcessorEndpoint: "/crop",
+				}
+
+				calls := 0
+				requestMaker := testReqFunc(200, nil, io.ErrUnexpectedEOF, nil, true, normalResponseSize, func(req *http.Request) {
+					calls++
+				})
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				proc := newProcessor(config, requestMaker)
+				_, _, err := proc.ProcessImage(ctx, parsedRequest, &inputStream)
+
+				g.Assert(err).Equal(io.ErrUnexpectedEOF)
+				g.Assert(calls).Equal(2)
+			})
 		})
 	})
 }
@@ -478,7 +584,7 @@ func TestImaginaryProcessorIntegration_ShouldReturnErrorWhenResponseCodeIsNotCor
 	}
 
 	_, _, err = processor.ProcessImage(ctx, req, inputStream)
-	if err != ErrResponseStatusNotOK {
+	if !errors.Is(err, ErrResponseStatusNotOK) {
 		t.Fatalf("expected error to be ErrResponseStatusNotOK, got %v", err)
 	}
 }
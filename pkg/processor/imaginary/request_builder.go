@@ -0,0 +1,41 @@
+package imaginaryprocessor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// Operation is a single imaginary operation, it is used by processors
+// which translate other url formats to imaginary requests
+type Operation struct {
+	Name   string                 `json:"operation"`
+	Params map[string]interface{} `json:"params"`
+}
+
+// BuildRequestPath returns imaginary request path executing given operations,
+// multiple operations are executed using imaginary pipeline
+func BuildRequestPath(operations []Operation, sourceImageURL string) (string, error) {
+	if len(operations) == 0 {
+		return "", ErrNoOperations
+	}
+
+	query := url.Values{}
+	query.Set("url", sourceImageURL)
+
+	if len(operations) == 1 {
+		for key, value := range operations[0].Params {
+			query.Set(key, fmt.Sprint(value))
+		}
+
+		return "/" + operations[0].Name + "?" + query.Encode(), nil
+	}
+
+	encodedOperations, err := json.Marshal(operations)
+	if err != nil {
+		return "", err
+	}
+
+	query.Set("operations", string(encodedOperations))
+	return "/pipeline?" + query.Encode(), nil
+}
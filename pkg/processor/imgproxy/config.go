@@ -0,0 +1,8 @@
+package imgproxyprocessor
+
+type Config struct {
+	// Key and Salt are used to verify URL signatures, the same way as
+	// IMGPROXY_KEY and IMGPROXY_SALT, signatures are not checked if Key is empty.
+	Key  []byte
+	Salt []byte
+}
@@ -0,0 +1,110 @@
+package imgproxyprocessor
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/thebartekbanach/imcaxy/pkg/hub"
+	"github.com/thebartekbanach/imcaxy/pkg/processor"
+)
+
+// Processor parses imgproxy URLs and executes them using imaginary, equivalent
+// imgproxy URLs have the same signatures, but cache keys include the processor
+// type, so their images are cached separately from imaginary requests.
+type Processor struct {
+	config    Config
+	imaginary processor.ProcessingService
+}
+
+var _ processor.ProcessingService = (*Processor)(nil)
+var _ processor.CircuitBreaking = (*Processor)(nil)
+
+func NewProcessor(config Config, imaginary processor.ProcessingService) Processor {
+	return Processor{config, imaginary}
+}
+
+func (proc *Processor) ParseRequest(requestPath string) (processor.ParsedRequest, error) {
+	info, err := url.Parse(requestPath)
+	if err != nil {
+		return processor.ParsedRequest{}, err
+	}
+
+	path := info.Path
+	if info.RawQuery != "" {
+		// query belongs to the plain source url
+		path += "?" + info.RawQuery
+	}
+
+	imgproxy, err := parseImgproxyURL(path)
+	if err != nil {
+		return processor.ParsedRequest{}, err
+	}
+
+	if err := proc.verifySignature(imgproxy); err != nil {
+		return processor.ParsedRequest{}, err
+	}
+
+	imaginaryRequestPath, err := translateToImaginaryRequest(imgproxy)
+	if err != nil {
+		return processor.ParsedRequest{}, err
+	}
+
+	return proc.imaginary.ParseRequest(imaginaryRequestPath)
+}
+
+func (proc *Processor) ProcessImage(
+	ctx context.Context,
+	request processor.ParsedRequest,
+	streamInput hub.DataStreamInput,
+) (responseContentType string, responseSize int64, err error) {
+	return proc.imaginary.ProcessImage(ctx, request, streamInput)
+}
+
+func (proc *Processor) BreaksCircuit() bool {
+	return processor.BreaksCircuit(proc.imaginary)
+}
+
+func (proc *Processor) verifySignature(imgproxy imgproxyURL) error {
+	if len(proc.config.Key) == 0 {
+		return nil
+	}
+
+	// path cleaning removes double slash after scheme of plain source url,
+	// so the signature is checked against the restored path too
+	paths := []string{imgproxy.signedPath}
+	if restored := restorePlainSourceURLSlashes(imgproxy.signedPath); restored != imgproxy.signedPath {
+		paths = append(paths, restored)
+	}
+
+	for _, path := range paths {
+		if hmac.Equal([]byte(proc.sign(path)), []byte(imgproxy.signature)) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+func (proc *Processor) sign(path string) string {
+	mac := hmac.New(sha256.New, proc.config.Key)
+	mac.Write(proc.config.Salt)
+	mac.Write([]byte(path))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func restorePlainSourceURLSlashes(path string) string {
+	separatorIndex := strings.Index(path, "/plain/")
+	if separatorIndex == -1 {
+		return path
+	}
+
+	prefix := path[:separatorIndex+len("/plain/")]
+	return prefix + restoreSchemeSlashes(path[len(prefix):])
+}
+
+var ErrInvalidSignature = errors.New("invalid imgproxy url signature")
@@ -0,0 +1,192 @@
+package imgproxyprocessor
+
+import (
+	"context"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/thebartekbanach/imcaxy/pkg/processor"
+	imaginaryprocessor "github.com/thebartekbanach/imcaxy/pkg/processor/imaginary"
+	mock_processor "github.com/thebartekbanach/imcaxy/pkg/processor/mocks"
+)
+
+// signing example from imgproxy documentation
+const (
+	documentedKey       = "736563726574"
+	documentedSalt      = "68656C6C6F"
+	documentedSignedURL = "/oKfUtW34Dvo2BGQehJFR4Nr0_rIjOtdtzJ3QFsUcXH8/rs:fill:300:400:0/g:sm/aHR0cDovL2V4YW1w/bGUuY29tL2ltYWdl/cy9jdXJpb3NpdHku/anBn.png?"
+	documentedPlainURL  = "/insecure/rs:fill:300:400:0/g:sm/plain/http://example.com/images/curiosity.jpg@png?"
+)
+
+func newTestingProcessor(t *testing.T, key, salt string) Processor {
+	config := Config{}
+	if key != "" {
+		var err error
+		if config.Key, err = hex.DecodeString(key); err != nil {
+			t.Fatalf("Unexpected error when decoding key: %v", err)
+		}
+
+		if config.Salt, err = hex.DecodeString(salt); err != nil {
+			t.Fatalf("Unexpected error when decoding salt: %v", err)
+		}
+	}
+
+	imaginary := imaginaryprocessor.NewProcessor(imaginaryprocessor.Config{ImaginaryServiceURL: "localhost:8080"})
+	return NewProcessor(config, &imaginary)
+}
+
+func TestProcessor_AcceptsDocumentedSignedURL(t *testing.T) {
+	proc := newTestingProcessor(t, documentedKey, documentedSalt)
+
+	request, err := proc.ParseRequest(documentedSignedURL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedParams := map[string][]string{
+		"width":   {"300"},
+		"height":  {"400"},
+		"gravity": {"smart"},
+		"type":    {"png"},
+		"url":     {"http://example.com/images/curiosity.jpg"},
+	}
+
+	if request.ProcessorEndpoint != "/crop" {
+		t.Errorf("Expected /crop endpoint, got %s", request.ProcessorEndpoint)
+	}
+
+	if !reflect.DeepEqual(request.ProcessingParams, expectedParams) {
+		t.Errorf("Expected params %v, got %v", expectedParams, request.ProcessingParams)
+	}
+}
+
+func TestProcessor_RejectsInvalidSignatures(t *testing.T) {
+	proc := newTestingProcessor(t, documentedKey, documentedSalt)
+
+	tamperedURL := "/oKfUtW34Dvo2BGQehJFR4Nr0_rIjOtdtzJ3QFsUcXH8/rs:fill:600:400:0/g:sm/aHR0cDovL2V4YW1w/bGUuY29tL2ltYWdl/cy9jdXJpb3NpdHku/anBn.png?"
+	if _, err := proc.ParseRequest(tamperedURL); err != ErrInvalidSignature {
+		t.Errorf("Expected ErrInvalidSignature, got: %v", err)
+	}
+
+	if _, err := proc.ParseRequest(documentedPlainURL); err != ErrInvalidSignature {
+		t.Errorf("Expected ErrInvalidSignature for insecure url, got: %v", err)
+	}
+}
+
+func TestProcessor_AcceptsSignedPlainURLWithCleanedPath(t *testing.T) {
+	proc := newTestingProcessor(t, documentedKey, documentedSalt)
+	path := "/rs:fit:300:300/plain/http://example.com/images/curiosity.jpg"
+
+	if _, err := proc.ParseRequest("/" + proc.sign(path) + "/rs:fit:300:300/plain/http:/example.com/images/curiosity.jpg?"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestProcessor_PlainAndEncodedSourceURLsHaveTheSameSignature(t *testing.T) {
+	proc := newTestingProcessor(t, "", "")
+
+	encoded, err := proc.ParseRequest(documentedSignedURL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	plain, err := proc.ParseRequest(documentedPlainURL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if encoded.Signature != plain.Signature {
+		t.Errorf("Expected equivalent requests to have the same signature, got %s and %s", encoded.Signature, plain.Signature)
+	}
+
+	withCacheBuster, err := proc.ParseRequest("/insecure/cb:123/rs:fill:300:400:0/g:sm/plain/http://example.com/images/curiosity.jpg@png?")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if withCacheBuster.Signature != plain.Signature {
+		t.Errorf("Expected cache buster not to change signature, got %s and %s", withCacheBuster.Signature, plain.Signature)
+	}
+}
+
+func TestProcessor_TranslatesProcessingOptions(t *testing.T) {
+	proc := newTestingProcessor(t, "", "")
+	requests := map[string]struct {
+		endpoint string
+		params   map[string][]string
+	}{
+		"/_/rs:fit:300:200/q:80/f:webp/plain/http://example.com/image.jpg?": {
+			"/fit", map[string][]string{"width": {"300"}, "height": {"200"}, "quality": {"80"}, "type": {"webp"}, "url": {"http://example.com/image.jpg"}},
+		},
+		"/_/rs:force:300:200/plain/http://example.com/image.jpg?": {
+			"/resize", map[string][]string{"width": {"300"}, "height": {"200"}, "force": {"true"}, "url": {"http://example.com/image.jpg"}},
+		},
+		"/_/w:150/dpr:2/plain/http://example.com/image.jpg?": {
+			"/resize", map[string][]string{"width": {"300"}, "url": {"http://example.com/image.jpg"}},
+		},
+		"/_/f:png/plain/http://example.com/image.jpg?": {
+			"/convert", map[string][]string{"type": {"png"}, "url": {"http://example.com/image.jpg"}},
+		},
+	}
+
+	for path, expected := range requests {
+		request, err := proc.ParseRequest(path)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", path, err)
+			continue
+		}
+
+		if request.ProcessorEndpoint != expected.endpoint {
+			t.Errorf("Expected %s to be translated to %s, got %s", path, expected.endpoint, request.ProcessorEndpoint)
+		}
+
+		if !reflect.DeepEqual(request.ProcessingParams, expected.params) {
+			t.Errorf("Expected %s to be translated to params %v, got %v", path, expected.params, request.ProcessingParams)
+		}
+	}
+}
+
+func TestProcessor_TranslatesMultipleOperationsToPipeline(t *testing.T) {
+	proc := newTestingProcessor(t, "", "")
+
+	request, err := proc.ParseRequest("/_/rs:fill:300:200/bl:2/rot:90/plain/http://example.com/image.jpg?")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if request.ProcessorEndpoint != "/pipeline" {
+		t.Errorf("Expected /pipeline endpoint, got %s", request.ProcessorEndpoint)
+	}
+}
+
+func TestProcessor_RejectsUnsupportedAndInvalidOptions(t *testing.T) {
+	proc := newTestingProcessor(t, "", "")
+
+	if _, err := proc.ParseRequest("/_/wm:0.5/plain/http://example.com/image.jpg?"); err != ErrUnsupportedOption {
+		t.Errorf("Expected ErrUnsupportedOption, got: %v", err)
+	}
+
+	if _, err := proc.ParseRequest("/_/q:abc/plain/http://example.com/image.jpg?"); err != ErrInvalidOption {
+		t.Errorf("Expected ErrInvalidOption, got: %v", err)
+	}
+
+	if _, err := proc.ParseRequest("/_/rs:fit:300:200/!!!.png?"); err != ErrInvalidSourceURL {
+		t.Errorf("Expected ErrInvalidSourceURL, got: %v", err)
+	}
+}
+
+func TestProcessor_ProcessImageIsExecutedByImaginary(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	imaginary := mock_processor.NewMockProcessingService(mockCtrl)
+	proc := NewProcessor(Config{}, imaginary)
+
+	request := processor.ParsedRequest{Signature: "test-signature"}
+	imaginary.EXPECT().ProcessImage(gomock.Any(), request, nil).Return("image/png", int64(10), nil)
+
+	contentType, size, err := proc.ProcessImage(context.Background(), request, nil)
+	if contentType != "image/png" || size != 10 || err != nil {
+		t.Errorf("Expected result of imaginary processor, got %s, %d, %v", contentType, size, err)
+	}
+}
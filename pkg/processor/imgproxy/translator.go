@@ -0,0 +1,284 @@
+package imgproxyprocessor
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	imaginaryprocessor "github.com/thebartekbanach/imcaxy/pkg/processor/imaginary"
+)
+
+type processingOptions struct {
+	resizingType  string
+	width         int
+	height        int
+	dpr           float64
+	gravity       string
+	quality       int
+	format        string
+	blur          float64
+	rotate        int
+	background    string
+	stripMetadata bool
+}
+
+// translateToImaginaryRequest builds imaginary request path executing
+// the same operations as given imgproxy url, options which do not change
+// the result, like cache busters, are skipped, so equivalent urls
+// are translated to the same imaginary request
+func translateToImaginaryRequest(imgproxy imgproxyURL) (string, error) {
+	opts, err := parseProcessingOptions(imgproxy.options)
+	if err != nil {
+		return "", err
+	}
+
+	if imgproxy.extension != "" {
+		opts.format = normalizeFormat(imgproxy.extension)
+	}
+
+	operations := []imaginaryprocessor.Operation{}
+	if resize, ok := translateResize(opts); ok {
+		operations = append(operations, resize)
+	}
+
+	if opts.blur > 0 {
+		operations = append(operations, imaginaryprocessor.Operation{Name: "blur", Params: map[string]interface{}{"sigma": opts.blur}})
+	}
+
+	if opts.rotate != 0 {
+		operations = append(operations, imaginaryprocessor.Operation{Name: "rotate", Params: map[string]interface{}{"rotate": opts.rotate}})
+	}
+
+	if len(operations) == 0 {
+		if opts.format != "" {
+			operations = append(operations, imaginaryprocessor.Operation{Name: "convert", Params: map[string]interface{}{}})
+		} else {
+			operations = append(operations, imaginaryprocessor.Operation{Name: "autorotate", Params: map[string]interface{}{}})
+		}
+	}
+
+	// output options are applied by the last operation only
+	last := operations[len(operations)-1]
+	if opts.quality > 0 {
+		last.Params["quality"] = opts.quality
+	}
+
+	if opts.format != "" {
+		last.Params["type"] = opts.format
+	}
+
+	if opts.background != "" {
+		last.Params["background"] = opts.background
+	}
+
+	if opts.stripMetadata {
+		last.Params["stripmeta"] = true
+	}
+
+	return imaginaryprocessor.BuildRequestPath(operations, imgproxy.sourceURL)
+}
+
+func parseProcessingOptions(options []option) (opts processingOptions, err error) {
+	opts.resizingType = "fit"
+	opts.dpr = 1
+
+	for _, o := range options {
+		switch o.name {
+		case "resize", "rs":
+			if len(o.args) > 0 && o.args[0] != "" {
+				if opts.resizingType, err = parseResizingType(o.args[0]); err != nil {
+					return
+				}
+			}
+
+			if len(o.args) > 1 {
+				err = parseDimensions(o.args[1:], &opts)
+			}
+		case "size", "s":
+			err = parseDimensions(o.args, &opts)
+		case "resizing_type", "rt":
+			opts.resizingType, err = parseResizingType(arg(o, 0))
+		case "width", "w":
+			opts.width, err = parseNonNegativeInt(arg(o, 0))
+		case "height", "h":
+			opts.height, err = parseNonNegativeInt(arg(o, 0))
+		case "dpr":
+			if opts.dpr, err = strconv.ParseFloat(arg(o, 0), 64); err != nil || opts.dpr <= 0 {
+				err = ErrInvalidOption
+			}
+		case "gravity", "g":
+			opts.gravity, err = parseGravity(arg(o, 0))
+		case "quality", "q":
+			if opts.quality, err = parseNonNegativeInt(arg(o, 0)); err == nil && opts.quality > 100 {
+				err = ErrInvalidOption
+			}
+		case "format", "f", "ext":
+			opts.format = normalizeFormat(arg(o, 0))
+		case "blur", "bl":
+			if opts.blur, err = strconv.ParseFloat(arg(o, 0), 64); err != nil || opts.blur < 0 {
+				err = ErrInvalidOption
+			}
+		case "rotate", "rot":
+			opts.rotate, err = parseNonNegativeInt(arg(o, 0))
+			if err == nil && opts.rotate%90 != 0 {
+				err = ErrInvalidOption
+			}
+
+			opts.rotate %= 360
+		case "background", "bg":
+			opts.background, err = parseBackground(o.args)
+		case "strip_metadata", "sm":
+			opts.stripMetadata = parseBool(arg(o, 0))
+		case "enlarge", "el", "extend", "ex", "cachebuster", "cb", "expires", "exp", "filename", "fn":
+			// these options do not change the processed image
+		default:
+			return opts, ErrUnsupportedOption
+		}
+
+		if err != nil {
+			return opts, ErrInvalidOption
+		}
+	}
+
+	return
+}
+
+func translateResize(opts processingOptions) (imaginaryprocessor.Operation, bool) {
+	width := int(math.Round(float64(opts.width) * opts.dpr))
+	height := int(math.Round(float64(opts.height) * opts.dpr))
+	if width == 0 && height == 0 {
+		return imaginaryprocessor.Operation{}, false
+	}
+
+	params := map[string]interface{}{}
+	if width > 0 {
+		params["width"] = width
+	}
+
+	if height > 0 {
+		params["height"] = height
+	}
+
+	if width == 0 || height == 0 {
+		return imaginaryprocessor.Operation{Name: "resize", Params: params}, true
+	}
+
+	switch opts.resizingType {
+	case "force":
+		params["force"] = true
+		return imaginaryprocessor.Operation{Name: "resize", Params: params}, true
+	case "fill", "fill-down", "auto":
+		if opts.gravity != "" {
+			params["gravity"] = opts.gravity
+		}
+
+		return imaginaryprocessor.Operation{Name: "crop", Params: params}, true
+	}
+
+	return imaginaryprocessor.Operation{Name: "fit", Params: params}, true
+}
+
+func parseDimensions(args []string, opts *processingOptions) (err error) {
+	if len(args) > 0 && args[0] != "" {
+		if opts.width, err = parseNonNegativeInt(args[0]); err != nil {
+			return
+		}
+	}
+
+	if len(args) > 1 && args[1] != "" {
+		opts.height, err = parseNonNegativeInt(args[1])
+	}
+
+	return
+}
+
+func parseResizingType(value string) (string, error) {
+	switch value {
+	case "fit", "fill", "fill-down", "force", "auto":
+		return value, nil
+	}
+
+	return "", ErrInvalidOption
+}
+
+// parseGravity maps imgproxy gravity types to imaginary ones,
+// imaginary does not support corners, so they are mapped to vertical edges
+func parseGravity(value string) (string, error) {
+	switch value {
+	case "no", "noea", "nowe":
+		return "north", nil
+	case "so", "soea", "sowe":
+		return "south", nil
+	case "ea":
+		return "east", nil
+	case "we":
+		return "west", nil
+	case "sm":
+		return "smart", nil
+	case "ce", "fp":
+		return "", nil
+	}
+
+	return "", ErrInvalidOption
+}
+
+func parseBackground(args []string) (string, error) {
+	if len(args) == 3 {
+		for _, channel := range args {
+			if value, err := strconv.Atoi(channel); err != nil || value < 0 || value > 255 {
+				return "", ErrInvalidOption
+			}
+		}
+
+		return strings.Join(args, ","), nil
+	}
+
+	if len(args) == 1 {
+		decoded, err := hex.DecodeString(args[0])
+		if err != nil || len(decoded) != 3 {
+			return "", ErrInvalidOption
+		}
+
+		return fmt.Sprintf("%d,%d,%d", decoded[0], decoded[1], decoded[2]), nil
+	}
+
+	return "", ErrInvalidOption
+}
+
+func normalizeFormat(format string) string {
+	format = strings.ToLower(format)
+	if format == "jpg" {
+		return "jpeg"
+	}
+
+	return format
+}
+
+func parseNonNegativeInt(value string) (int, error) {
+	result, err := strconv.Atoi(value)
+	if err != nil || result < 0 {
+		return 0, ErrInvalidOption
+	}
+
+	return result, nil
+}
+
+func parseBool(value string) bool {
+	return value == "1" || value == "t" || value == "true"
+}
+
+func arg(o option, index int) string {
+	if index >= len(o.args) {
+		return ""
+	}
+
+	return o.args[index]
+}
+
+var (
+	ErrInvalidOption     = errors.New("invalid imgproxy processing option")
+	ErrUnsupportedOption = errors.New("unsupported imgproxy processing option")
+)
@@ -0,0 +1,93 @@
+package imgproxyprocessor
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+type option struct {
+	name string
+	args []string
+}
+
+// imgproxyURL contains all parts of imgproxy URL in form of:
+// /%signature/%option:%args/.../plain/%source_url@%extension
+// or /%signature/%option:%args/.../%base64_encoded_source_url.%extension
+type imgproxyURL struct {
+	signature  string
+	signedPath string
+
+	options   []option
+	sourceURL string
+	extension string
+}
+
+func parseImgproxyURL(path string) (result imgproxyURL, err error) {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(segments) < 2 {
+		return result, ErrInvalidURL
+	}
+
+	result.signature = segments[0]
+	result.signedPath = "/" + strings.Join(segments[1:], "/")
+	segments = segments[1:]
+
+	// base64 encoded source url never contains colon,
+	// so all segments with colon placed before it are options
+	for len(segments) > 0 && segments[0] != "plain" && strings.Contains(segments[0], ":") {
+		parts := strings.Split(segments[0], ":")
+		result.options = append(result.options, option{parts[0], parts[1:]})
+		segments = segments[1:]
+	}
+
+	if len(segments) == 0 {
+		return result, ErrInvalidURL
+	}
+
+	if segments[0] == "plain" {
+		source := strings.Join(segments[1:], "/")
+		if separatorIndex := strings.LastIndex(source, "@"); separatorIndex != -1 {
+			result.extension = source[separatorIndex+1:]
+			source = source[:separatorIndex]
+		}
+
+		result.sourceURL = restoreSchemeSlashes(source)
+	} else {
+		source := strings.Join(segments, "")
+		if separatorIndex := strings.LastIndex(source, "."); separatorIndex != -1 {
+			result.extension = source[separatorIndex+1:]
+			source = source[:separatorIndex]
+		}
+
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(source, "="))
+		if err != nil {
+			return result, ErrInvalidSourceURL
+		}
+
+		result.sourceURL = string(decoded)
+	}
+
+	if result.sourceURL == "" {
+		return result, ErrInvalidSourceURL
+	}
+
+	return result, nil
+}
+
+// restoreSchemeSlashes restores double slash after scheme
+// of plain source url, which is removed by path cleaning
+func restoreSchemeSlashes(source string) string {
+	for _, scheme := range []string{"http:", "https:"} {
+		if strings.HasPrefix(source, scheme) && !strings.HasPrefix(source, scheme+"//") {
+			return scheme + "//" + strings.TrimLeft(strings.TrimPrefix(source, scheme), "/")
+		}
+	}
+
+	return source
+}
+
+var (
+	ErrInvalidURL       = errors.New("invalid imgproxy url")
+	ErrInvalidSourceURL = errors.New("invalid imgproxy source url")
+)
@@ -16,6 +16,8 @@ type ParsedRequest struct {
 type ProcessingService interface {
 	ParseRequest(requestPath string) (ParsedRequest, error)
 
+	// ProcessImage returns negative response size
+	// when size of the response is not known upfront
 	ProcessImage(
 		ctx context.Context,
 		request ParsedRequest,
@@ -26,3 +28,25 @@ type ProcessingService interface {
 		err error,
 	)
 }
+
+// Canonicalizer is implemented by processing services which rewrite
+// equivalent requests to the same canonical form
+type Canonicalizer interface {
+	// CanonicalRequestPath reports whether the canonical form
+	// differs from the given request path
+	CanonicalRequestPath(requestPath string) (canonicalPath string, changed bool, err error)
+}
+
+// CircuitBreaking is implemented by processing services which keep
+// circuit breakers of their backends and return *circuitbreaker.OpenError
+// when the circuits of all of them are open
+type CircuitBreaking interface {
+	BreaksCircuit() bool
+}
+
+// BreaksCircuit reports whether the processing service keeps its own
+// circuit breakers, so it should not be wrapped with another one
+func BreaksCircuit(service ProcessingService) bool {
+	breaking, isBreaking := service.(CircuitBreaking)
+	return isBreaking && breaking.BreaksCircuit()
+}
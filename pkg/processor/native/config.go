@@ -0,0 +1,30 @@
+package nativeprocessor
+
+import (
+	"runtime"
+
+	"github.com/thebartekbanach/imcaxy/pkg/retry"
+)
+
+type Config struct {
+	// MaxSourceImageSize is the maximal size of source image in bytes.
+	MaxSourceImageSize int64
+
+	// MaxImagePixels limits number of pixels of both source and result image,
+	// so decoding or enlarging an image can not exhaust the memory.
+	MaxImagePixels int64
+
+	// MaxConcurrentOperations limits number of images processed at the same time.
+	MaxConcurrentOperations int
+
+	RetryPolicy retry.Policy
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxSourceImageSize:      32 * 1024 * 1024,
+		MaxImagePixels:          50 * 1000 * 1000,
+		MaxConcurrentOperations: runtime.NumCPU(),
+		RetryPolicy:             retry.DefaultPolicy(),
+	}
+}
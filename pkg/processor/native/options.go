@@ -0,0 +1,165 @@
+package nativeprocessor
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type gravity string
+
+const (
+	gravityCentre gravity = "centre"
+	gravityNorth  gravity = "north"
+	gravitySouth  gravity = "south"
+	gravityEast   gravity = "east"
+	gravityWest   gravity = "west"
+)
+
+type options struct {
+	width      int
+	height     int
+	force      bool
+	gravity    gravity
+	rotate     int
+	background *[3]uint8
+	outputType string
+	quality    int
+}
+
+// parseOptions reads the same query params as imaginary does,
+// params not supported by native processor are ignored
+func parseOptions(endpoint string, params url.Values) (opts options, err error) {
+	opts.gravity = gravityCentre
+	opts.quality = 80
+
+	if opts.width, err = parseDimension(params.Get("width")); err != nil {
+		return
+	}
+
+	if opts.height, err = parseDimension(params.Get("height")); err != nil {
+		return
+	}
+
+	if force := params.Get("force"); force != "" {
+		if opts.force, err = strconv.ParseBool(force); err != nil {
+			return opts, ErrInvalidParam
+		}
+	}
+
+	if opts.gravity, err = parseGravity(params.Get("gravity")); err != nil {
+		return
+	}
+
+	if rotate := params.Get("rotate"); rotate != "" {
+		if opts.rotate, err = strconv.Atoi(rotate); err != nil || opts.rotate%90 != 0 {
+			return opts, ErrInvalidParam
+		}
+
+		opts.rotate = (opts.rotate%360 + 360) % 360
+	}
+
+	if background := params.Get("background"); background != "" {
+		if opts.background, err = parseColor(background); err != nil {
+			return
+		}
+	}
+
+	if opts.outputType, err = parseOutputType(params.Get("type")); err != nil {
+		return
+	}
+
+	if quality := params.Get("quality"); quality != "" {
+		if opts.quality, err = strconv.Atoi(quality); err != nil || opts.quality < 1 || opts.quality > 100 {
+			return opts, ErrInvalidParam
+		}
+	}
+
+	return opts, validateRequiredOptions(endpoint, opts)
+}
+
+func validateRequiredOptions(endpoint string, opts options) error {
+	switch endpoint {
+	case "/resize", "/enlarge", "/crop", "/thumbnail":
+		if opts.width == 0 && opts.height == 0 {
+			return ErrMissingParam
+		}
+	case "/fit":
+		if opts.width == 0 || opts.height == 0 {
+			return ErrMissingParam
+		}
+	case "/rotate":
+		if opts.rotate == 0 {
+			return ErrMissingParam
+		}
+	case "/convert":
+		if opts.outputType == "" {
+			return ErrMissingParam
+		}
+	}
+
+	return nil
+}
+
+func parseDimension(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	dimension, err := strconv.Atoi(value)
+	if err != nil || dimension < 0 {
+		return 0, ErrInvalidParam
+	}
+
+	return dimension, nil
+}
+
+func parseGravity(value string) (gravity, error) {
+	switch value {
+	case "", "centre", "center", "smart":
+		return gravityCentre, nil
+	case string(gravityNorth), string(gravitySouth), string(gravityEast), string(gravityWest):
+		return gravity(value), nil
+	}
+
+	return "", ErrInvalidParam
+}
+
+func parseColor(value string) (*[3]uint8, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 3 {
+		return nil, ErrInvalidParam
+	}
+
+	var color [3]uint8
+	for i, part := range parts {
+		channel, err := strconv.ParseUint(strings.TrimSpace(part), 10, 8)
+		if err != nil {
+			return nil, ErrInvalidParam
+		}
+
+		color[i] = uint8(channel)
+	}
+
+	return &color, nil
+}
+
+func parseOutputType(value string) (string, error) {
+	switch value {
+	case "":
+		return "", nil
+	case "jpeg", "jpg":
+		return "jpeg", nil
+	case "png", "gif":
+		return value, nil
+	}
+
+	return "", ErrUnsupportedOutputType
+}
+
+var (
+	ErrInvalidParam          = errors.New("invalid param value")
+	ErrMissingParam          = errors.New("required param not included")
+	ErrUnsupportedOutputType = errors.New("unsupported output type")
+)
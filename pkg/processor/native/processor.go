@@ -0,0 +1,268 @@
+package nativeprocessor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	// registers webp decoder, webp images are decoded only
+	_ "golang.org/x/image/webp"
+
+	"github.com/thebartekbanach/imcaxy/pkg/hub"
+	"github.com/thebartekbanach/imcaxy/pkg/metrics"
+	"github.com/thebartekbanach/imcaxy/pkg/processor"
+)
+
+type httpRequestFunc func(req *http.Request) (*http.Response, error)
+
+// Processor processes images in-process using pure Go codecs,
+// it accepts the same endpoints and query params as imaginary.
+type Processor struct {
+	config      Config
+	makeRequest httpRequestFunc
+	operations  chan struct{}
+}
+
+var _ processor.ProcessingService = (*Processor)(nil)
+
+func NewProcessor(config Config) Processor {
+	return newProcessor(config, http.DefaultClient.Do)
+}
+
+func newProcessor(config Config, makeRequest httpRequestFunc) Processor {
+	maxConcurrentOperations := config.MaxConcurrentOperations
+	if maxConcurrentOperations < 1 {
+		maxConcurrentOperations = 1
+	}
+
+	return Processor{config, makeRequest, make(chan struct{}, maxConcurrentOperations)}
+}
+
+func (proc *Processor) ParseRequest(requestPath string) (processor.ParsedRequest, error) {
+	info, err := url.Parse(requestPath)
+	if err != nil {
+		return processor.ParsedRequest{}, err
+	}
+
+	if !info.Query().Has("url") {
+		return processor.ParsedRequest{}, ErrURLParamNotIncluded
+	}
+
+	if !proc.isOperationSupported(info.Path) {
+		return processor.ParsedRequest{}, ErrOperationNotSupported
+	}
+
+	if _, err := parseOptions(info.Path, info.Query()); err != nil {
+		return processor.ParsedRequest{}, err
+	}
+
+	source := info.Query().Get("url")
+	signature := proc.generateSignature(info.Path, source, info.Query())
+
+	request := processor.ParsedRequest{
+		ProcessorEndpoint: info.Path,
+		SourceImageURL:    source,
+		ProcessingParams:  info.Query(),
+		Signature:         signature,
+	}
+
+	return request, nil
+}
+
+func (proc *Processor) ProcessImage(
+	ctx context.Context,
+	request processor.ParsedRequest,
+	streamInput hub.DataStreamInput,
+) (responseContentType string, responseSize int64, err error) {
+	opts, err := parseOptions(request.ProcessorEndpoint, request.ProcessingParams)
+	if err != nil {
+		return
+	}
+
+	select {
+	case proc.operations <- struct{}{}:
+		defer func() { <-proc.operations }()
+	case <-ctx.Done():
+		err = ctx.Err()
+		return
+	}
+
+	source, err := proc.fetchSourceImage(ctx, request.SourceImageURL)
+	if err != nil {
+		return
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(source))
+	if err != nil {
+		return
+	}
+
+	if err = checkPixels(config.Width, config.Height, proc.config.MaxImagePixels); err != nil {
+		return
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(source))
+	if err != nil {
+		return
+	}
+
+	result, err := transform(img, request.ProcessorEndpoint, opts, proc.config.MaxImagePixels)
+	if err != nil {
+		return
+	}
+
+	outputType := opts.outputType
+	if outputType == "" {
+		outputType = defaultOutputType(format)
+	}
+
+	output := bytes.Buffer{}
+	if err = encode(&output, result, outputType, opts.quality); err != nil {
+		return
+	}
+
+	metrics.Add("native_processed_images", 1)
+
+	responseContentType = "image/" + outputType
+	responseSize = int64(output.Len())
+
+	go func() {
+		_, err := streamInput.ReadFrom(&output)
+		streamInput.Close(err)
+	}()
+
+	return
+}
+
+func (proc *Processor) fetchSourceImage(ctx context.Context, sourceImageURL string) (source []byte, err error) {
+	attempts, err := proc.config.RetryPolicy.Do(ctx, func(attempt int) (bool, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceImageURL, nil)
+		if err != nil {
+			return false, err
+		}
+
+		res, err := proc.makeRequest(req)
+		if err != nil {
+			return true, err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != 200 {
+			return proc.config.RetryPolicy.IsRetryableStatus(res.StatusCode), ErrSourceResponseStatusNotOK
+		}
+
+		body := io.Reader(res.Body)
+		if proc.config.MaxSourceImageSize > 0 {
+			body = io.LimitReader(res.Body, proc.config.MaxSourceImageSize+1)
+		}
+
+		source, err = ioutil.ReadAll(body)
+		if err != nil {
+			return true, err
+		}
+
+		if proc.config.MaxSourceImageSize > 0 && int64(len(source)) > proc.config.MaxSourceImageSize {
+			return false, ErrSourceImageTooLarge
+		}
+
+		return false, nil
+	})
+
+	if attempts > 1 {
+		metrics.Add("source_fetch_retries", int64(attempts-1))
+		log.Printf("native processor fetch of %s finished after %d attempts, error: %v", sourceImageURL, attempts, err)
+	}
+
+	return
+}
+
+func defaultOutputType(sourceFormat string) string {
+	switch sourceFormat {
+	case "jpeg", "png", "gif":
+		return sourceFormat
+	}
+
+	// there is no pure Go webp encoder
+	return "png"
+}
+
+func encode(w io.Writer, img image.Image, outputType string, quality int) error {
+	switch outputType {
+	case "jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case "png":
+		return png.Encode(w, img)
+	case "gif":
+		return gif.Encode(w, img, nil)
+	}
+
+	return ErrUnsupportedOutputType
+}
+
+func (proc *Processor) generateSignature(path, source string, params map[string][]string) string {
+	signature := "|" + path + "|" + source + "|"
+	for _, key := range proc.getSortedMapKeys(params) {
+		currentValue := ""
+		for _, value := range params[key] {
+			currentValue += value + ","
+		}
+
+		currentValue = strings.TrimRight(currentValue, ",")
+		signature += key + "=" + currentValue + "|"
+	}
+
+	return signature
+}
+
+func (proc *Processor) getSortedMapKeys(mapToSort map[string][]string) []string {
+	keys := make([]string, len(mapToSort))
+
+	i := 0
+	for key := range mapToSort {
+		keys[i] = key
+		i++
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func (proc *Processor) isOperationSupported(endpoint string) bool {
+	for _, supportedEndpoint := range supportedNativeEndpoints {
+		if supportedEndpoint == endpoint {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	ErrSourceResponseStatusNotOK = errors.New("source image response status not OK")
+	ErrSourceImageTooLarge       = errors.New("source image too large")
+	ErrURLParamNotIncluded       = errors.New("url param not included")
+	ErrOperationNotSupported     = errors.New("operation not supported")
+)
+
+var supportedNativeEndpoints = []string{
+	"/resize",
+	"/enlarge",
+	"/crop",
+	"/thumbnail",
+	"/fit",
+	"/rotate",
+	"/flip",
+	"/flop",
+	"/convert",
+}
@@ -0,0 +1,229 @@
+package nativeprocessor
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	mock_hub "github.com/thebartekbanach/imcaxy/pkg/hub/mocks"
+)
+
+var (
+	red  = color.RGBA{0xff, 0x0, 0x0, 0xff}
+	blue = color.RGBA{0x0, 0x0, 0xff, 0xff}
+)
+
+// testImage returns 40x20 png image with red left half and blue right half
+func testImage(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			if x < 20 {
+				img.Set(x, y, red)
+			} else {
+				img.Set(x, y, blue)
+			}
+		}
+	}
+
+	buff := bytes.Buffer{}
+	if err := png.Encode(&buff, img); err != nil {
+		t.Fatalf("Unexpected error when encoding test image: %v", err)
+	}
+
+	return buff.Bytes()
+}
+
+func testSourceRequestFunc(statusCode int, body []byte) httpRequestFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: statusCode,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	}
+}
+
+func processTestImage(t *testing.T, config Config, requestPath string) (image.Image, string, string) {
+	proc := newProcessor(config, testSourceRequestFunc(200, testImage(t)))
+
+	request, err := proc.ParseRequest(requestPath)
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing request: %v", err)
+	}
+
+	inputStream := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+	contentType, size, err := proc.ProcessImage(context.Background(), request, &inputStream)
+	if err != nil {
+		t.Fatalf("Unexpected error when processing image: %v", err)
+	}
+
+	inputStream.Wait()
+	response := inputStream.GetWholeResponse()
+	if int64(len(response)) != size {
+		t.Errorf("Expected response size to be %d, got %d", size, len(response))
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(response))
+	if err != nil {
+		t.Fatalf("Unexpected error when decoding result image: %v", err)
+	}
+
+	return img, format, contentType
+}
+
+func assertDimensions(t *testing.T, img image.Image, width, height int) {
+	if img.Bounds().Dx() != width || img.Bounds().Dy() != height {
+		t.Errorf("Expected image to be %dx%d, got %dx%d", width, height, img.Bounds().Dx(), img.Bounds().Dy())
+	}
+}
+
+func assertColor(t *testing.T, img image.Image, x, y int, expected color.RGBA) {
+	r, g, b, _ := img.At(x, y).RGBA()
+	if uint8(r>>8) != expected.R || uint8(g>>8) != expected.G || uint8(b>>8) != expected.B {
+		t.Errorf("Expected pixel %d,%d to be %v, got %v", x, y, expected, img.At(x, y))
+	}
+}
+
+func TestProcessor_ParseRequestReturnsErrorIfURLParamIsNotIncluded(t *testing.T) {
+	proc := NewProcessor(DefaultConfig())
+	if _, err := proc.ParseRequest("/resize?width=100"); err != ErrURLParamNotIncluded {
+		t.Errorf("Expected ErrURLParamNotIncluded, got: %v", err)
+	}
+}
+
+func TestProcessor_ParseRequestReturnsErrorIfOperationIsNotSupported(t *testing.T) {
+	proc := NewProcessor(DefaultConfig())
+	if _, err := proc.ParseRequest("/smartcrop?width=100&url=http://google.com/image.jpg"); err != ErrOperationNotSupported {
+		t.Errorf("Expected ErrOperationNotSupported, got: %v", err)
+	}
+}
+
+func TestProcessor_ParseRequestValidatesParams(t *testing.T) {
+	proc := NewProcessor(DefaultConfig())
+	requests := map[string]error{
+		"/resize?url=http://google.com/image.jpg":                    ErrMissingParam,
+		"/resize?width=abc&url=http://google.com/image.jpg":          ErrInvalidParam,
+		"/fit?width=100&url=http://google.com/image.jpg":             ErrMissingParam,
+		"/rotate?rotate=45&url=http://google.com/image.jpg":          ErrInvalidParam,
+		"/convert?type=webp&url=http://google.com/image.jpg":         ErrUnsupportedOutputType,
+		"/crop?width=10&gravity=top&url=http://google.com/image.jpg": ErrInvalidParam,
+	}
+
+	for request, expectedErr := range requests {
+		if _, err := proc.ParseRequest(request); err != expectedErr {
+			t.Errorf("Expected %v for request %s, got: %v", expectedErr, request, err)
+		}
+	}
+}
+
+func TestProcessor_ResizeKeepsAspectRatioWhenOnlyOneDimensionIsGiven(t *testing.T) {
+	img, format, contentType := processTestImage(t, DefaultConfig(), "/resize?width=20&url=http://google.com/image.png")
+
+	assertDimensions(t, img, 20, 10)
+	if format != "png" || contentType != "image/png" {
+		t.Errorf("Expected png image, got format %s with content type %s", format, contentType)
+	}
+}
+
+func TestProcessor_ResizeEmbedsImageWhenBothDimensionsAreGiven(t *testing.T) {
+	img, _, _ := processTestImage(t, DefaultConfig(), "/resize?width=20&height=20&background=0,255,0&url=http://google.com/image.png")
+
+	assertDimensions(t, img, 20, 20)
+	assertColor(t, img, 10, 0, color.RGBA{0x0, 0xff, 0x0, 0xff})
+	assertColor(t, img, 2, 10, red)
+}
+
+func TestProcessor_ResizeStretchesImageWhenForced(t *testing.T) {
+	img, _, _ := processTestImage(t, DefaultConfig(), "/resize?width=20&height=20&force=true&url=http://google.com/image.png")
+
+	assertDimensions(t, img, 20, 20)
+	assertColor(t, img, 2, 0, red)
+	assertColor(t, img, 17, 19, blue)
+}
+
+func TestProcessor_CropUsesGravity(t *testing.T) {
+	img, _, _ := processTestImage(t, DefaultConfig(), "/crop?width=10&height=10&gravity=east&url=http://google.com/image.png")
+
+	assertDimensions(t, img, 10, 10)
+	assertColor(t, img, 0, 0, blue)
+	assertColor(t, img, 9, 9, blue)
+}
+
+func TestProcessor_FitKeepsImageInsideBoundingBox(t *testing.T) {
+	img, _, _ := processTestImage(t, DefaultConfig(), "/fit?width=10&height=10&url=http://google.com/image.png")
+
+	assertDimensions(t, img, 10, 5)
+}
+
+func TestProcessor_RotateRotatesImageClockwise(t *testing.T) {
+	img, _, _ := processTestImage(t, DefaultConfig(), "/rotate?rotate=90&url=http://google.com/image.png")
+
+	assertDimensions(t, img, 20, 40)
+	assertColor(t, img, 0, 0, red)
+	assertColor(t, img, 19, 39, blue)
+}
+
+func TestProcessor_FlopMirrorsImageHorizontally(t *testing.T) {
+	img, _, _ := processTestImage(t, DefaultConfig(), "/flop?url=http://google.com/image.png")
+
+	assertDimensions(t, img, 40, 20)
+	assertColor(t, img, 0, 0, blue)
+	assertColor(t, img, 39, 0, red)
+}
+
+func TestProcessor_ConvertEncodesImageInGivenType(t *testing.T) {
+	img, format, contentType := processTestImage(t, DefaultConfig(), "/convert?type=jpeg&url=http://google.com/image.png")
+
+	assertDimensions(t, img, 40, 20)
+	if format != "jpeg" || contentType != "image/jpeg" {
+		t.Errorf("Expected jpeg image, got format %s with content type %s", format, contentType)
+	}
+
+	if _, ok := img.(*image.YCbCr); !ok {
+		t.Errorf("Expected image to be decoded by jpeg decoder")
+	}
+}
+
+func TestProcessor_ReturnsErrorWhenSourceImageIsTooLarge(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxSourceImageSize = 10
+	proc := newProcessor(config, testSourceRequestFunc(200, testImage(t)))
+	request, _ := proc.ParseRequest("/resize?width=20&url=http://google.com/image.png")
+
+	inputStream := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+	if _, _, err := proc.ProcessImage(context.Background(), request, &inputStream); err != ErrSourceImageTooLarge {
+		t.Errorf("Expected ErrSourceImageTooLarge, got: %v", err)
+	}
+}
+
+func TestProcessor_ReturnsErrorWhenImageHasTooManyPixels(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxImagePixels = 1000
+	proc := newProcessor(config, testSourceRequestFunc(200, testImage(t)))
+	request, _ := proc.ParseRequest("/enlarge?width=400&url=http://google.com/image.png")
+
+	inputStream := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+	if _, _, err := proc.ProcessImage(context.Background(), request, &inputStream); err != ErrImageTooLarge {
+		t.Errorf("Expected ErrImageTooLarge, got: %v", err)
+	}
+}
+
+func TestProcessor_ReturnsErrorWhenSourceResponseStatusIsNotOK(t *testing.T) {
+	proc := newProcessor(DefaultConfig(), testSourceRequestFunc(404, nil))
+	request, _ := proc.ParseRequest("/resize?width=20&url=http://google.com/image.png")
+
+	inputStream := mock_hub.NewMockTestingDataStreamInput(t, nil, nil, nil)
+	_, _, err := proc.ProcessImage(context.Background(), request, &inputStream)
+	if err != ErrSourceResponseStatusNotOK {
+		t.Errorf("Expected ErrSourceResponseStatusNotOK, got: %v", err)
+	}
+
+	if len(inputStream.DataSegments) != 0 || inputStream.ForwardedError != nil {
+		t.Errorf("Expected input stream not to be used on error")
+	}
+}
@@ -0,0 +1,219 @@
+package nativeprocessor
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+func transform(src image.Image, endpoint string, opts options, maxPixels int64) (image.Image, error) {
+	bounds := src.Bounds()
+	width, height := opts.width, opts.height
+
+	var result image.Image
+	switch endpoint {
+	case "/resize", "/enlarge":
+		if width > 0 && height > 0 && !opts.force {
+			fitWidth, fitHeight := fitDimensions(bounds.Dx(), bounds.Dy(), width, height)
+			if err := checkPixels(width, height, maxPixels); err != nil {
+				return nil, err
+			}
+
+			result = embed(scale(src, bounds, fitWidth, fitHeight), width, height, opts.background)
+			break
+		}
+
+		width, height = proportionalDimensions(bounds.Dx(), bounds.Dy(), width, height)
+		if err := checkPixels(width, height, maxPixels); err != nil {
+			return nil, err
+		}
+
+		result = scale(src, bounds, width, height)
+	case "/crop", "/thumbnail":
+		width, height = proportionalDimensions(bounds.Dx(), bounds.Dy(), width, height)
+		if err := checkPixels(width, height, maxPixels); err != nil {
+			return nil, err
+		}
+
+		result = scale(src, cropRectangle(bounds, width, height, opts.gravity), width, height)
+	case "/fit":
+		width, height = fitDimensions(bounds.Dx(), bounds.Dy(), width, height)
+		if err := checkPixels(width, height, maxPixels); err != nil {
+			return nil, err
+		}
+
+		result = scale(src, bounds, width, height)
+	case "/flip":
+		result = flip(toRGBA(src))
+	case "/flop":
+		result = flop(toRGBA(src))
+	default:
+		result = src
+	}
+
+	// rotation is applied after every other operation,
+	// the same as imaginary does
+	if opts.rotate != 0 {
+		result = rotate(toRGBA(result), opts.rotate)
+	}
+
+	return result, nil
+}
+
+func checkPixels(width, height int, maxPixels int64) error {
+	if maxPixels > 0 && int64(width)*int64(height) > maxPixels {
+		return ErrImageTooLarge
+	}
+
+	return nil
+}
+
+// proportionalDimensions calculates missing dimension keeping the aspect ratio
+func proportionalDimensions(srcWidth, srcHeight, width, height int) (int, int) {
+	if width == 0 {
+		width = atLeastOne(float64(height) * float64(srcWidth) / float64(srcHeight))
+	}
+
+	if height == 0 {
+		height = atLeastOne(float64(width) * float64(srcHeight) / float64(srcWidth))
+	}
+
+	return width, height
+}
+
+// fitDimensions calculates the largest dimensions with source aspect ratio
+// that fit in given bounding box
+func fitDimensions(srcWidth, srcHeight, width, height int) (int, int) {
+	factor := math.Min(float64(width)/float64(srcWidth), float64(height)/float64(srcHeight))
+	return atLeastOne(float64(srcWidth) * factor), atLeastOne(float64(srcHeight) * factor)
+}
+
+// cropRectangle returns the largest part of the source with aspect ratio
+// of given dimensions, placed according to gravity
+func cropRectangle(bounds image.Rectangle, width, height int, g gravity) image.Rectangle {
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	cropWidth, cropHeight := srcWidth, srcHeight
+
+	if float64(srcWidth)/float64(srcHeight) > float64(width)/float64(height) {
+		cropWidth = atLeastOne(float64(srcHeight) * float64(width) / float64(height))
+	} else {
+		cropHeight = atLeastOne(float64(srcWidth) * float64(height) / float64(width))
+	}
+
+	x, y := (srcWidth-cropWidth)/2, (srcHeight-cropHeight)/2
+	switch g {
+	case gravityNorth:
+		y = 0
+	case gravitySouth:
+		y = srcHeight - cropHeight
+	case gravityWest:
+		x = 0
+	case gravityEast:
+		x = srcWidth - cropWidth
+	}
+
+	min := bounds.Min.Add(image.Pt(x, y))
+	return image.Rectangle{Min: min, Max: min.Add(image.Pt(cropWidth, cropHeight))}
+}
+
+func scale(src image.Image, srcRect image.Rectangle, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.BiLinear.Scale(dst, dst.Bounds(), src, srcRect, xdraw.Src, nil)
+	return dst
+}
+
+// embed places the image in the centre of canvas of given dimensions,
+// the rest of canvas is transparent if background is not set
+func embed(src *image.RGBA, width, height int, background *[3]uint8) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if background != nil {
+		fill := color.RGBA{background[0], background[1], background[2], 0xff}
+		draw.Draw(dst, dst.Bounds(), &image.Uniform{fill}, image.Point{}, draw.Src)
+	}
+
+	offset := image.Pt((width-src.Bounds().Dx())/2, (height-src.Bounds().Dy())/2)
+	draw.Draw(dst, src.Bounds().Add(offset), src, src.Bounds().Min, draw.Over)
+	return dst
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+	return dst
+}
+
+// flip mirrors the image vertically
+func flip(src *image.RGBA) *image.RGBA {
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		copy(dst.Pix[y*dst.Stride:y*dst.Stride+width*4], src.Pix[(height-1-y)*src.Stride:])
+	}
+
+	return dst
+}
+
+// flop mirrors the image horizontally
+func flop(src *image.RGBA) *image.RGBA {
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			copyPixel(dst, x, y, src, width-1-x, y)
+		}
+	}
+
+	return dst
+}
+
+// rotate rotates the image clockwise by multiple of 90 degrees
+func rotate(src *image.RGBA, angle int) *image.RGBA {
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+
+	var dst *image.RGBA
+	if angle == 180 {
+		dst = image.NewRGBA(image.Rect(0, 0, width, height))
+	} else {
+		dst = image.NewRGBA(image.Rect(0, 0, height, width))
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			switch angle {
+			case 90:
+				copyPixel(dst, height-1-y, x, src, x, y)
+			case 180:
+				copyPixel(dst, width-1-x, height-1-y, src, x, y)
+			case 270:
+				copyPixel(dst, y, width-1-x, src, x, y)
+			}
+		}
+	}
+
+	return dst
+}
+
+func copyPixel(dst *image.RGBA, dstX, dstY int, src *image.RGBA, srcX, srcY int) {
+	dstOffset := dst.PixOffset(dstX, dstY)
+	srcOffset := src.PixOffset(srcX, srcY)
+	copy(dst.Pix[dstOffset:dstOffset+4], src.Pix[srcOffset:srcOffset+4])
+}
+
+func atLeastOne(value float64) int {
+	if rounded := int(math.Round(value)); rounded > 1 {
+		return rounded
+	}
+
+	return 1
+}
+
+var ErrImageTooLarge = errors.New("image too large")
@@ -0,0 +1,67 @@
+package rawprocessor
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/thebartekbanach/imcaxy/pkg/filefetcher"
+	"github.com/thebartekbanach/imcaxy/pkg/hub"
+	"github.com/thebartekbanach/imcaxy/pkg/processor"
+)
+
+// Processor caches original assets without processing them.
+// Requests have form of /?url=<source>, other query params are ignored,
+// so the signature of the request depends only on the source url.
+type Processor struct {
+	fetcher filefetcher.Fetcher
+}
+
+var _ processor.ProcessingService = (*Processor)(nil)
+
+func NewProcessor(fetcher filefetcher.Fetcher) Processor {
+	return Processor{fetcher}
+}
+
+func (proc *Processor) ParseRequest(requestPath string) (processor.ParsedRequest, error) {
+	info, err := url.Parse(requestPath)
+	if err != nil {
+		return processor.ParsedRequest{}, err
+	}
+
+	if info.Path != "/" {
+		return processor.ParsedRequest{}, ErrOperationNotSupported
+	}
+
+	source := info.Query().Get("url")
+	if source == "" {
+		return processor.ParsedRequest{}, ErrURLParamNotIncluded
+	}
+
+	request := processor.ParsedRequest{
+		ProcessorEndpoint: info.Path,
+		SourceImageURL:    source,
+		ProcessingParams:  map[string][]string{"url": {source}},
+		Signature:         "|" + info.Path + "|" + source + "|url=" + source + "|",
+	}
+
+	return request, nil
+}
+
+func (proc *Processor) ProcessImage(
+	ctx context.Context,
+	request processor.ParsedRequest,
+	streamInput hub.DataStreamInput,
+) (responseContentType string, responseSize int64, err error) {
+	info, err := proc.fetcher.FetchWithResponseInfo(ctx, request.SourceImageURL, streamInput)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return info.ContentType, info.Size, nil
+}
+
+var (
+	ErrURLParamNotIncluded   = errors.New("url param not included")
+	ErrOperationNotSupported = errors.New("operation not supported")
+)
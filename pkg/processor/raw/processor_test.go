@@ -0,0 +1,93 @@
+package rawprocessor
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/thebartekbanach/imcaxy/pkg/filefetcher"
+	mock_filefetcher "github.com/thebartekbanach/imcaxy/pkg/filefetcher/mocks"
+	mock_hub "github.com/thebartekbanach/imcaxy/pkg/hub/mocks"
+)
+
+func TestProcessor_SignatureDependsOnlyOnSourceURL(t *testing.T) {
+	proc := NewProcessor(nil)
+
+	first, err := proc.ParseRequest("/?url=http://example.com/file.pdf")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	second, err := proc.ParseRequest("/?v=2&url=http://example.com/file.pdf")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if first.Signature != second.Signature {
+		t.Errorf("Expected signatures to be equal, got %s and %s", first.Signature, second.Signature)
+	}
+
+	if first.SourceImageURL != "http://example.com/file.pdf" {
+		t.Errorf("Expected source url to be http://example.com/file.pdf, got %s", first.SourceImageURL)
+	}
+}
+
+func TestProcessor_ParseRequestShouldRejectRequestWithoutURL(t *testing.T) {
+	proc := NewProcessor(nil)
+
+	if _, err := proc.ParseRequest("/?width=100"); err != ErrURLParamNotIncluded {
+		t.Errorf("Expected error to be %v, got %v", ErrURLParamNotIncluded, err)
+	}
+}
+
+func TestProcessor_ParseRequestShouldRejectUnknownEndpoint(t *testing.T) {
+	proc := NewProcessor(nil)
+
+	if _, err := proc.ParseRequest("/resize?url=http://example.com/img.jpg"); err != ErrOperationNotSupported {
+		t.Errorf("Expected error to be %v, got %v", ErrOperationNotSupported, err)
+	}
+}
+
+func TestProcessor_ProcessImageShouldReturnUpstreamContentTypeAndSize(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx := context.Background()
+	input := mock_hub.NewMockDataStreamInput(mockCtrl)
+	fetcher := mock_filefetcher.NewMockFetcher(mockCtrl)
+	fetcher.EXPECT().
+		FetchWithResponseInfo(ctx, "http://example.com/font.woff2", input).
+		Return(filefetcher.ResponseInfo{ContentType: "font/woff2", Size: -1}, nil)
+
+	proc := NewProcessor(fetcher)
+	request, _ := proc.ParseRequest("/?url=http://example.com/font.woff2")
+
+	contentType, size, err := proc.ProcessImage(ctx, request, input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if contentType != "font/woff2" || size != -1 {
+		t.Errorf("Expected font/woff2 of size -1, got %s of size %d", contentType, size)
+	}
+}
+
+func TestProcessor_ProcessImageShouldReturnFetchError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	fetchErr := errors.New("fetch error")
+	input := mock_hub.NewMockDataStreamInput(mockCtrl)
+	fetcher := mock_filefetcher.NewMockFetcher(mockCtrl)
+	fetcher.EXPECT().
+		FetchWithResponseInfo(gomock.Any(), gomock.Any(), input).
+		Return(filefetcher.ResponseInfo{}, fetchErr)
+
+	proc := NewProcessor(fetcher)
+	request, _ := proc.ParseRequest("/?url=http://example.com/file.pdf")
+
+	if _, _, err := proc.ProcessImage(context.Background(), request, input); err != fetchErr {
+		t.Errorf("Expected error to be %v, got %v", fetchErr, err)
+	}
+}
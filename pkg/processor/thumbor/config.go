@@ -0,0 +1,11 @@
+package thumborprocessor
+
+type Config struct {
+	// SecurityKey is used to verify HMAC signatures of signed URLs,
+	// signed URLs are rejected if it is not set.
+	SecurityKey string
+
+	// AllowUnsafe allows URLs starting with /unsafe/ segment,
+	// which are not signed.
+	AllowUnsafe bool
+}
@@ -0,0 +1,121 @@
+package thumborprocessor
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/thebartekbanach/imcaxy/pkg/hub"
+	"github.com/thebartekbanach/imcaxy/pkg/processor"
+)
+
+// Processor parses thumbor URLs and executes them using imaginary, equivalent
+// thumbor URLs have the same signatures, but cache keys include the processor
+// type, so their images are cached separately from imaginary requests.
+type Processor struct {
+	config    Config
+	imaginary processor.ProcessingService
+}
+
+var _ processor.ProcessingService = (*Processor)(nil)
+var _ processor.CircuitBreaking = (*Processor)(nil)
+
+func NewProcessor(config Config, imaginary processor.ProcessingService) Processor {
+	return Processor{config, imaginary}
+}
+
+func (proc *Processor) ParseRequest(requestPath string) (processor.ParsedRequest, error) {
+	info, err := url.Parse(requestPath)
+	if err != nil {
+		return processor.ParsedRequest{}, err
+	}
+
+	path := info.Path
+	if info.RawQuery != "" {
+		// query belongs to the image url
+		path += "?" + info.RawQuery
+	}
+
+	thumbor, err := parseThumborURL(path)
+	if err != nil {
+		return processor.ParsedRequest{}, err
+	}
+
+	if err := proc.verifySignature(thumbor); err != nil {
+		return processor.ParsedRequest{}, err
+	}
+
+	imaginaryRequestPath, err := translateToImaginaryRequest(thumbor)
+	if err != nil {
+		return processor.ParsedRequest{}, err
+	}
+
+	return proc.imaginary.ParseRequest(imaginaryRequestPath)
+}
+
+func (proc *Processor) ProcessImage(
+	ctx context.Context,
+	request processor.ParsedRequest,
+	streamInput hub.DataStreamInput,
+) (responseContentType string, responseSize int64, err error) {
+	return proc.imaginary.ProcessImage(ctx, request, streamInput)
+}
+
+func (proc *Processor) BreaksCircuit() bool {
+	return processor.BreaksCircuit(proc.imaginary)
+}
+
+func (proc *Processor) verifySignature(thumbor thumborURL) error {
+	if thumbor.hash == "unsafe" {
+		if !proc.config.AllowUnsafe {
+			return ErrUnsafeURLNotAllowed
+		}
+
+		return nil
+	}
+
+	if proc.config.SecurityKey == "" {
+		return ErrInvalidSignature
+	}
+
+	// path cleaning removes double slash after scheme of the image url,
+	// so the signature is checked against the restored path too
+	paths := []string{thumbor.signedPath}
+	if restored := restoreImageURLSlashes(thumbor); restored != thumbor.signedPath {
+		paths = append(paths, restored)
+	}
+
+	for _, path := range paths {
+		if hmac.Equal([]byte(proc.sign(path)), []byte(thumbor.hash)) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+func (proc *Processor) sign(path string) string {
+	mac := hmac.New(sha1.New, []byte(proc.config.SecurityKey))
+	mac.Write([]byte(path))
+	return base64.URLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func restoreImageURLSlashes(thumbor thumborURL) string {
+	prefix := strings.TrimSuffix(thumbor.signedPath, thumbor.image)
+	for _, scheme := range []string{"http:", "https:"} {
+		if strings.HasPrefix(thumbor.image, scheme) && !strings.HasPrefix(thumbor.image, scheme+"//") {
+			return prefix + scheme + "//" + strings.TrimLeft(strings.TrimPrefix(thumbor.image, scheme), "/")
+		}
+	}
+
+	return thumbor.signedPath
+}
+
+var (
+	ErrUnsafeURLNotAllowed = errors.New("unsafe thumbor urls are not allowed")
+	ErrInvalidSignature    = errors.New("invalid thumbor url signature")
+)
@@ -0,0 +1,185 @@
+package thumborprocessor
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/thebartekbanach/imcaxy/pkg/processor"
+	imaginaryprocessor "github.com/thebartekbanach/imcaxy/pkg/processor/imaginary"
+	mock_processor "github.com/thebartekbanach/imcaxy/pkg/processor/mocks"
+)
+
+func newTestingProcessor(config Config) Processor {
+	imaginary := imaginaryprocessor.NewProcessor(imaginaryprocessor.Config{ImaginaryServiceURL: "localhost:8080"})
+	return NewProcessor(config, &imaginary)
+}
+
+func sign(key, path string) string {
+	mac := hmac.New(sha1.New, []byte(key))
+	mac.Write([]byte(path))
+	return base64.URLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestProcessor_TranslatesThumborURLToImaginaryRequest(t *testing.T) {
+	proc := newTestingProcessor(Config{AllowUnsafe: true})
+
+	request, err := proc.ParseRequest("/unsafe/300x200/smart/filters:quality(80)/host/img.jpg?")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedParams := map[string][]string{
+		"width":   {"300"},
+		"height":  {"200"},
+		"gravity": {"smart"},
+		"quality": {"80"},
+		"url":     {"http://host/img.jpg"},
+	}
+
+	if request.ProcessorEndpoint != "/crop" {
+		t.Errorf("Expected /crop endpoint, got %s", request.ProcessorEndpoint)
+	}
+
+	if !reflect.DeepEqual(request.ProcessingParams, expectedParams) {
+		t.Errorf("Expected params %v, got %v", expectedParams, request.ProcessingParams)
+	}
+
+	if request.SourceImageURL != "http://host/img.jpg" {
+		t.Errorf("Expected source image url http://host/img.jpg, got %s", request.SourceImageURL)
+	}
+}
+
+func TestProcessor_TranslatesFitInRequests(t *testing.T) {
+	proc := newTestingProcessor(Config{AllowUnsafe: true})
+	requests := map[string]string{
+		"/unsafe/fit-in/300x200/host/img.jpg?":       "/fit",
+		"/unsafe/full-fit-in/300x0/host/img.jpg?":    "/resize",
+		"/unsafe/filters:format(webp)/host/img.jpg?": "/convert",
+		"/unsafe/host/img.jpg?":                      "/autorotate",
+	}
+
+	for path, expectedEndpoint := range requests {
+		request, err := proc.ParseRequest(path)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", path, err)
+			continue
+		}
+
+		if request.ProcessorEndpoint != expectedEndpoint {
+			t.Errorf("Expected %s to be translated to %s, got %s", path, expectedEndpoint, request.ProcessorEndpoint)
+		}
+	}
+}
+
+func TestProcessor_TranslatesMultipleOperationsToPipeline(t *testing.T) {
+	proc := newTestingProcessor(Config{AllowUnsafe: true})
+
+	request, err := proc.ParseRequest("/unsafe/10x20:110x220/-50x50/filters:blur(2):format(png)/https:/host/img.jpg?v=1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if request.ProcessorEndpoint != "/pipeline" {
+		t.Fatalf("Expected /pipeline endpoint, got %s", request.ProcessorEndpoint)
+	}
+
+	if request.SourceImageURL != "https://host/img.jpg?v=1" {
+		t.Errorf("Expected source image url https://host/img.jpg?v=1, got %s", request.SourceImageURL)
+	}
+
+	operations := []imaginaryprocessor.Operation{}
+	if err := json.Unmarshal([]byte(request.ProcessingParams["operations"][0]), &operations); err != nil {
+		t.Fatalf("Unexpected error when decoding operations: %v", err)
+	}
+
+	names := []string{}
+	for _, operation := range operations {
+		names = append(names, operation.Name)
+	}
+
+	expectedNames := []string{"extract", "crop", "flop", "blur"}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("Expected operations %v, got %v", expectedNames, names)
+	}
+
+	if operations[3].Params["type"] != "png" {
+		t.Errorf("Expected output type to be set on the last operation, got %v", operations[3].Params)
+	}
+}
+
+func TestProcessor_EquivalentRequestsHaveTheSameSignature(t *testing.T) {
+	proc := newTestingProcessor(Config{SecurityKey: "secret", AllowUnsafe: true})
+
+	path := "300x200/filters:quality(80):format(png)/host/img.jpg"
+	signed, err := proc.ParseRequest("/" + sign("secret", path) + "/" + path + "?")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	unsafe, err := proc.ParseRequest("/unsafe/300x200/filters:format(png):quality(80)/http:/host/img.jpg?")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if signed.Signature != unsafe.Signature {
+		t.Errorf("Expected equivalent requests to have the same signature, got %s and %s", signed.Signature, unsafe.Signature)
+	}
+}
+
+func TestProcessor_RejectsInvalidSignatures(t *testing.T) {
+	proc := newTestingProcessor(Config{SecurityKey: "secret"})
+
+	path := "300x200/host/img.jpg"
+	if _, err := proc.ParseRequest("/" + sign("other-secret", path) + "/" + path + "?"); err != ErrInvalidSignature {
+		t.Errorf("Expected ErrInvalidSignature, got: %v", err)
+	}
+
+	if _, err := proc.ParseRequest("/" + sign("secret", path) + "/400x200/host/img.jpg?"); err != ErrInvalidSignature {
+		t.Errorf("Expected ErrInvalidSignature for tampered url, got: %v", err)
+	}
+
+	if _, err := proc.ParseRequest("/unsafe/" + path + "?"); err != ErrUnsafeURLNotAllowed {
+		t.Errorf("Expected ErrUnsafeURLNotAllowed, got: %v", err)
+	}
+}
+
+func TestProcessor_AcceptsSignaturesOfImageURLsWithCleanedSchemeSlashes(t *testing.T) {
+	proc := newTestingProcessor(Config{SecurityKey: "MY_SECURE_KEY"})
+
+	// signature of 300x200/smart/http://example.com/image.jpg made by libthumbor
+	if _, err := proc.ParseRequest("/o_x_JavLgRg97UljRI7wVwhXg0w=/300x200/smart/http:/example.com/image.jpg?"); err != nil {
+		t.Errorf("Expected signature of the url with restored slashes to be accepted, got: %v", err)
+	}
+
+	if _, err := proc.ParseRequest("/o_x_JavLgRg97UljRI7wVwhXg0w=/300x200/smart/http:/example.com/other.jpg?"); err != ErrInvalidSignature {
+		t.Errorf("Expected ErrInvalidSignature for tampered url, got: %v", err)
+	}
+}
+
+func TestProcessor_RejectsInvalidFilters(t *testing.T) {
+	proc := newTestingProcessor(Config{AllowUnsafe: true})
+
+	if _, err := proc.ParseRequest("/unsafe/filters:quality(abc)/host/img.jpg?"); err != ErrInvalidFilter {
+		t.Errorf("Expected ErrInvalidFilter, got: %v", err)
+	}
+}
+
+func TestProcessor_ProcessImageIsExecutedByImaginary(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	imaginary := mock_processor.NewMockProcessingService(mockCtrl)
+	proc := NewProcessor(Config{AllowUnsafe: true}, imaginary)
+
+	request := processor.ParsedRequest{Signature: "test-signature"}
+	imaginary.EXPECT().ProcessImage(gomock.Any(), request, nil).Return("image/png", int64(10), nil)
+
+	contentType, size, err := proc.ProcessImage(context.Background(), request, nil)
+	if contentType != "image/png" || size != 10 || err != nil {
+		t.Errorf("Expected result of imaginary processor, got %s, %d, %v", contentType, size, err)
+	}
+}
@@ -0,0 +1,209 @@
+package thumborprocessor
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	imaginaryprocessor "github.com/thebartekbanach/imcaxy/pkg/processor/imaginary"
+)
+
+// translateToImaginaryRequest builds imaginary request path executing
+// the same operations as given thumbor url, requests consisting of
+// multiple operations are translated to imaginary pipeline
+func translateToImaginaryRequest(thumbor thumborURL) (string, error) {
+	operations := []imaginaryprocessor.Operation{}
+	outputParams := map[string]interface{}{}
+
+	if crop := thumbor.crop; crop != nil && crop.right > crop.left && crop.bottom > crop.top {
+		operations = append(operations, imaginaryprocessor.Operation{Name: "extract", Params: map[string]interface{}{
+			"left":       crop.left,
+			"top":        crop.top,
+			"areawidth":  crop.right - crop.left,
+			"areaheight": crop.bottom - crop.top,
+		}})
+	}
+
+	if resize, ok := translateResize(thumbor); ok {
+		operations = append(operations, resize)
+	}
+
+	if thumbor.flipHorizontal {
+		operations = append(operations, imaginaryprocessor.Operation{Name: "flop", Params: map[string]interface{}{}})
+	}
+
+	if thumbor.flipVertical {
+		operations = append(operations, imaginaryprocessor.Operation{Name: "flip", Params: map[string]interface{}{}})
+	}
+
+	for _, f := range thumbor.filters {
+		operation, err := translateFilter(f, outputParams)
+		if err != nil {
+			return "", err
+		}
+
+		if operation != nil {
+			operations = append(operations, *operation)
+		}
+	}
+
+	if len(operations) == 0 {
+		if _, convert := outputParams["type"]; convert {
+			operations = append(operations, imaginaryprocessor.Operation{Name: "convert", Params: map[string]interface{}{}})
+		} else {
+			operations = append(operations, imaginaryprocessor.Operation{Name: "autorotate", Params: map[string]interface{}{}})
+		}
+	}
+
+	// output params are applied by the last operation only
+	last := operations[len(operations)-1]
+	for key, value := range outputParams {
+		last.Params[key] = value
+	}
+
+	return imaginaryprocessor.BuildRequestPath(operations, imageURL(thumbor.image))
+}
+
+func translateResize(thumbor thumborURL) (imaginaryprocessor.Operation, bool) {
+	width, height := thumbor.width, thumbor.height
+	if width == 0 && height == 0 {
+		return imaginaryprocessor.Operation{}, false
+	}
+
+	params := map[string]interface{}{}
+	if width > 0 {
+		params["width"] = width
+	}
+
+	if height > 0 {
+		params["height"] = height
+	}
+
+	if width == 0 || height == 0 {
+		return imaginaryprocessor.Operation{Name: "resize", Params: params}, true
+	}
+
+	if thumbor.fitIn {
+		return imaginaryprocessor.Operation{Name: "fit", Params: params}, true
+	}
+
+	if gravity := translateGravity(thumbor); gravity != "" {
+		params["gravity"] = gravity
+	}
+
+	return imaginaryprocessor.Operation{Name: "crop", Params: params}, true
+}
+
+func translateGravity(thumbor thumborURL) string {
+	if thumbor.smart {
+		return "smart"
+	}
+
+	switch {
+	case thumbor.vAlign == "top":
+		return "north"
+	case thumbor.vAlign == "bottom":
+		return "south"
+	case thumbor.hAlign == "left":
+		return "west"
+	case thumbor.hAlign == "right":
+		return "east"
+	}
+
+	return ""
+}
+
+// translateFilter returns imaginary operation for filters which need to be
+// executed as separate operation, filters which change output image only
+// are stored in outputParams, filters not supported by imaginary are ignored
+func translateFilter(f filter, outputParams map[string]interface{}) (*imaginaryprocessor.Operation, error) {
+	switch f.name {
+	case "quality":
+		quality, err := intArg(f, 0)
+		if err != nil || quality < 1 || quality > 100 {
+			return nil, ErrInvalidFilter
+		}
+
+		outputParams["quality"] = quality
+	case "format":
+		if len(f.args) != 1 {
+			return nil, ErrInvalidFilter
+		}
+
+		format := strings.ToLower(f.args[0])
+		if format == "jpg" {
+			format = "jpeg"
+		}
+
+		outputParams["type"] = format
+	case "grayscale":
+		outputParams["colorspace"] = "bw"
+	case "fill":
+		if len(f.args) != 1 {
+			return nil, ErrInvalidFilter
+		}
+
+		if background, ok := hexColorToRGB(f.args[0]); ok {
+			outputParams["background"] = background
+		}
+	case "strip_exif", "strip_icc":
+		outputParams["stripmeta"] = true
+	case "blur":
+		radius, err := intArg(f, 0)
+		if err != nil || radius < 1 {
+			return nil, ErrInvalidFilter
+		}
+
+		sigma := radius
+		if len(f.args) > 1 {
+			if sigma, err = intArg(f, 1); err != nil {
+				return nil, ErrInvalidFilter
+			}
+		}
+
+		return &imaginaryprocessor.Operation{Name: "blur", Params: map[string]interface{}{"sigma": sigma}}, nil
+	case "rotate":
+		angle, err := intArg(f, 0)
+		if err != nil || angle%90 != 0 {
+			return nil, ErrInvalidFilter
+		}
+
+		if angle = (angle%360 + 360) % 360; angle == 0 {
+			return nil, nil
+		}
+
+		return &imaginaryprocessor.Operation{Name: "rotate", Params: map[string]interface{}{"rotate": angle}}, nil
+	}
+
+	return nil, nil
+}
+
+func intArg(f filter, index int) (int, error) {
+	if index >= len(f.args) {
+		return 0, ErrInvalidFilter
+	}
+
+	return strconv.Atoi(strings.TrimSpace(f.args[index]))
+}
+
+func hexColorToRGB(color string) (string, bool) {
+	decoded, err := hex.DecodeString(strings.TrimPrefix(color, "#"))
+	if err != nil || len(decoded) != 3 {
+		return "", false
+	}
+
+	return fmt.Sprintf("%d,%d,%d", decoded[0], decoded[1], decoded[2]), true
+}
+
+// imageURL adds scheme to image urls, which thumbor allows to skip,
+// and restores double slash after scheme removed by path cleaning
+func imageURL(image string) string {
+	for _, scheme := range []string{"http:", "https:"} {
+		if strings.HasPrefix(image, scheme) {
+			return scheme + "//" + strings.TrimLeft(strings.TrimPrefix(image, scheme), "/")
+		}
+	}
+
+	return "http://" + image
+}
@@ -0,0 +1,167 @@
+package thumborprocessor
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type cropArea struct {
+	left, top, right, bottom int
+}
+
+type filter struct {
+	name string
+	args []string
+}
+
+// thumborURL contains all parts of thumbor URL in form of:
+// /(unsafe|HASH)/[trim/][AxB:CxD/][fit-in/][-]Ex[-]F/[HALIGN/][VALIGN/][smart/][filters:NAME(ARGS):NAME(ARGS)/]IMAGE
+type thumborURL struct {
+	hash       string
+	signedPath string
+
+	crop           *cropArea
+	fitIn          bool
+	width, height  int
+	flipHorizontal bool
+	flipVertical   bool
+	hAlign, vAlign string
+	smart          bool
+	filters        []filter
+	image          string
+}
+
+var (
+	cropPattern    = regexp.MustCompile(`^(\d+)x(\d+):(\d+)x(\d+)$`)
+	sizePattern    = regexp.MustCompile(`^(-?)(\d*)x(-?)(\d*)$`)
+	filterPattern  = regexp.MustCompile(`^([a-z_]+)\((.*)\)$`)
+	fitInSegments  = []string{"fit-in", "full-fit-in", "adaptive-fit-in", "adaptive-full-fit-in"}
+	hAlignSegments = []string{"left", "center", "right"}
+	vAlignSegments = []string{"top", "middle", "bottom"}
+)
+
+func parseThumborURL(path string) (result thumborURL, err error) {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(segments) < 2 {
+		return result, ErrInvalidURL
+	}
+
+	result.hash = segments[0]
+	result.signedPath = strings.Join(segments[1:], "/")
+	segments = segments[1:]
+
+	// every optional part can occur only once and in given order,
+	// so parts are consumed one after another until the image part is found
+	next := func(matches func(segment string) bool) (string, bool) {
+		if len(segments) > 1 && matches(segments[0]) {
+			segment := segments[0]
+			segments = segments[1:]
+			return segment, true
+		}
+
+		return "", false
+	}
+
+	next(func(s string) bool { return s == "trim" || strings.HasPrefix(s, "trim:") })
+
+	if segment, found := next(cropPattern.MatchString); found {
+		result.crop = parseCropArea(segment)
+	}
+
+	if _, found := next(func(s string) bool { return contains(fitInSegments, s) }); found {
+		result.fitIn = true
+	}
+
+	if segment, found := next(sizePattern.MatchString); found {
+		parts := sizePattern.FindStringSubmatch(segment)
+		result.flipHorizontal = parts[1] == "-"
+		result.width, _ = strconv.Atoi(parts[2])
+		result.flipVertical = parts[3] == "-"
+		result.height, _ = strconv.Atoi(parts[4])
+	}
+
+	result.hAlign, _ = next(func(s string) bool { return contains(hAlignSegments, s) })
+	result.vAlign, _ = next(func(s string) bool { return contains(vAlignSegments, s) })
+	_, result.smart = next(func(s string) bool { return s == "smart" })
+
+	if segment, found := next(func(s string) bool { return strings.HasPrefix(s, "filters:") }); found {
+		if result.filters, err = parseFilters(strings.TrimPrefix(segment, "filters:")); err != nil {
+			return
+		}
+	}
+
+	result.image = strings.Join(segments, "/")
+	if result.image == "" {
+		return result, ErrInvalidURL
+	}
+
+	return
+}
+
+func parseCropArea(segment string) *cropArea {
+	parts := cropPattern.FindStringSubmatch(segment)
+	values := make([]int, 4)
+	for i := range values {
+		values[i], _ = strconv.Atoi(parts[i+1])
+	}
+
+	return &cropArea{values[0], values[1], values[2], values[3]}
+}
+
+func parseFilters(segment string) ([]filter, error) {
+	filters := []filter{}
+	for _, rawFilter := range splitFilters(segment) {
+		parts := filterPattern.FindStringSubmatch(rawFilter)
+		if parts == nil {
+			return nil, ErrInvalidFilter
+		}
+
+		args := []string{}
+		if parts[2] != "" {
+			args = strings.Split(parts[2], ",")
+		}
+
+		filters = append(filters, filter{parts[1], args})
+	}
+
+	return filters, nil
+}
+
+// splitFilters splits filters separated with colon,
+// ignoring colons placed inside of filter arguments
+func splitFilters(segment string) []string {
+	filters := []string{}
+	depth, start := 0, 0
+	for i, char := range segment {
+		switch char {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ':':
+			if depth == 0 {
+				filters = append(filters, segment[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(filters, segment[start:])
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	ErrInvalidURL    = errors.New("invalid thumbor url")
+	ErrInvalidFilter = errors.New("invalid thumbor filter")
+)
@@ -3,14 +3,25 @@ package proxy
 import (
 	"context"
 	"io"
+	"time"
 )
 
 type ProxyResponseWriter interface {
 	WriteOK(reader io.ReadCloser)
 	WriteError(code int, message string)
 	WriteErrorWithFallback(code int, message string, fallbackImageReader io.ReadCloser)
+	WriteErrorWithRetryAfter(code int, message string, retryAfter time.Duration)
+	WriteRedirect(code int, location string)
 }
 
 type ProxyService interface {
 	Handle(ctx context.Context, requestPath, callerOrigin string, responseWriter ProxyResponseWriter)
+	// Cached reports whether the response to the request is already cached,
+	// the request is not checked against allowed origins and domains
+	Cached(ctx context.Context, requestPath string) (bool, error)
+	// WaitForSave blocks until the image of the request, if it is being saved, is saved in the cache,
+	// it does not tell whether the save succeeded, so it should be followed by Cached
+	WaitForSave(ctx context.Context, requestPath string) error
+	// WaitForSaves blocks until images processed so far are saved in the cache
+	WaitForSaves()
 }
@@ -7,6 +7,7 @@ package mock_proxy
 import (
 	io "io"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -58,6 +59,18 @@ func (mr *MockProxyResponseWriterMockRecorder) WriteErrorWithFallback(arg0, arg1
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteErrorWithFallback", reflect.TypeOf((*MockProxyResponseWriter)(nil).WriteErrorWithFallback), arg0, arg1, arg2)
 }
 
+// WriteErrorWithRetryAfter mocks base method.
+func (m *MockProxyResponseWriter) WriteErrorWithRetryAfter(arg0 int, arg1 string, arg2 time.Duration) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "WriteErrorWithRetryAfter", arg0, arg1, arg2)
+}
+
+// WriteErrorWithRetryAfter indicates an expected call of WriteErrorWithRetryAfter.
+func (mr *MockProxyResponseWriterMockRecorder) WriteErrorWithRetryAfter(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteErrorWithRetryAfter", reflect.TypeOf((*MockProxyResponseWriter)(nil).WriteErrorWithRetryAfter), arg0, arg1, arg2)
+}
+
 // WriteOK mocks base method.
 func (m *MockProxyResponseWriter) WriteOK(arg0 io.ReadCloser) {
 	m.ctrl.T.Helper()
@@ -69,3 +82,15 @@ func (mr *MockProxyResponseWriterMockRecorder) WriteOK(arg0 interface{}) *gomock
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteOK", reflect.TypeOf((*MockProxyResponseWriter)(nil).WriteOK), arg0)
 }
+
+// WriteRedirect mocks base method.
+func (m *MockProxyResponseWriter) WriteRedirect(arg0 int, arg1 string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "WriteRedirect", arg0, arg1)
+}
+
+// WriteRedirect indicates an expected call of WriteRedirect.
+func (mr *MockProxyResponseWriterMockRecorder) WriteRedirect(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteRedirect", reflect.TypeOf((*MockProxyResponseWriter)(nil).WriteRedirect), arg0, arg1)
+}
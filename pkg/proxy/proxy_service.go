@@ -7,36 +7,76 @@ import (
 	"log"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ryanuber/go-glob"
 	"github.com/thebartekbanach/imcaxy/pkg/cache"
 	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	"github.com/thebartekbanach/imcaxy/pkg/circuitbreaker"
 	"github.com/thebartekbanach/imcaxy/pkg/filefetcher"
 	"github.com/thebartekbanach/imcaxy/pkg/hub"
 	"github.com/thebartekbanach/imcaxy/pkg/processor"
 )
 
+type CircuitOpenBehaviour string
+
+const (
+	// FallbackOnOpenCircuit serves the original image, the same as on processing error
+	FallbackOnOpenCircuit CircuitOpenBehaviour = "fallback"
+	// RejectOnOpenCircuit responds with 503 status and Retry-After header
+	RejectOnOpenCircuit CircuitOpenBehaviour = "reject"
+)
+
 type ProxyServiceConfig struct {
 	Processors     map[string]processor.ProcessingService
 	AllowedDomains []string
 	AllowedOrigins []string
+
+	CircuitBreaker       circuitbreaker.Config
+	CircuitOpenBehaviour CircuitOpenBehaviour
+
+	// RedirectToCanonical makes requests to processors implementing
+	// processor.Canonicalizer to be redirected to their canonical form
+	RedirectToCanonical bool
 }
 
 type ProxyServiceImplementation struct {
-	config  ProxyServiceConfig
-	cache   cache.CacheService
-	datahub hub.DataHub
-	fetcher filefetcher.Fetcher
+	config   ProxyServiceConfig
+	cache    cache.CacheService
+	datahub  hub.DataHub
+	fetcher  filefetcher.Fetcher
+	breakers map[string]*circuitbreaker.Breaker
+	saves    sync.WaitGroup
+
+	pendingSavesMutex sync.Mutex
+	pendingSaves      map[string]chan struct{}
 }
 
 var _ ProxyService = (*ProxyServiceImplementation)(nil)
 
 func NewProxyService(config ProxyServiceConfig, cache cache.CacheService, datahub hub.DataHub, fetcher filefetcher.Fetcher) ProxyService {
+	breakers := map[string]*circuitbreaker.Breaker{}
+	if config.CircuitBreaker.Enabled() {
+		for processorType, proc := range config.Processors {
+			// processors keeping breakers of their backends, like imaginary
+			// with many backends, report open circuit by returning an error
+			if processor.BreaksCircuit(proc) {
+				continue
+			}
+
+			breakers[processorType] = circuitbreaker.NewBreaker(processorType, config.CircuitBreaker)
+		}
+	}
+
 	return &ProxyServiceImplementation{
-		config:  config,
-		cache:   cache,
-		datahub: datahub,
-		fetcher: fetcher,
+		config:   config,
+		cache:    cache,
+		datahub:  datahub,
+		fetcher:  fetcher,
+		breakers: breakers,
+
+		pendingSaves: map[string]chan struct{}{},
 	}
 }
 
@@ -46,7 +86,7 @@ func (p *ProxyServiceImplementation) Handle(ctx context.Context, rawRequestPath,
 		return
 	}
 
-	imageOutput, imageInput, err := p.datahub.GetOrCreateStream(parsedRequest.Signature)
+	imageOutput, imageInput, err := p.datahub.GetOrCreateStream(p.makeStreamID(processorType, parsedRequest.Signature))
 	if err != nil {
 		log.Printf("failed to get or create stream: %s", err)
 		rw.WriteError(500, "data stream creation error")
@@ -65,6 +105,56 @@ func (p *ProxyServiceImplementation) Handle(ctx context.Context, rawRequestPath,
 	p.tryToProcessAndServeImage(ctx, parsedRequest, rawRequestPath, processorType, processor, imageInput, imageOutput, rw)
 }
 
+func (p *ProxyServiceImplementation) Cached(ctx context.Context, rawRequestPath string) (bool, error) {
+	requestSignature, processorType, err := p.parseCacheKey(rawRequestPath)
+	if err != nil {
+		return false, err
+	}
+
+	return p.cache.Contains(ctx, requestSignature, processorType)
+}
+
+func (p *ProxyServiceImplementation) WaitForSave(ctx context.Context, rawRequestPath string) error {
+	requestSignature, processorType, err := p.parseCacheKey(rawRequestPath)
+	if err != nil {
+		return err
+	}
+
+	p.pendingSavesMutex.Lock()
+	saved, found := p.pendingSaves[p.makeStreamID(processorType, requestSignature)]
+	p.pendingSavesMutex.Unlock()
+
+	if !found {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-saved:
+		return nil
+	}
+}
+
+func (p *ProxyServiceImplementation) parseCacheKey(rawRequestPath string) (requestSignature, processorType string, err error) {
+	processorType, requestPath, err := p.parseRawRequestPath(rawRequestPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	processor, found := p.config.Processors[processorType]
+	if !found {
+		return "", "", ErrUnknownProcessor
+	}
+
+	parsedRequest, err := processor.ParseRequest(requestPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	return parsedRequest.Signature, processorType, nil
+}
+
 func (p *ProxyServiceImplementation) parseRequest(rawRequestPath string, callerOrigin string, rw ProxyResponseWriter) (
 	parsedRequest processor.ParsedRequest,
 	processorType string,
@@ -104,9 +194,26 @@ func (p *ProxyServiceImplementation) parseRequest(rawRequestPath string, callerO
 		return
 	}
 
+	if canonicalPath, changed := p.getCanonicalRequestPath(processor, requestPath); changed {
+		rw.WriteRedirect(301, "/"+processorType+canonicalPath)
+		err = errors.New("redirected to canonical request")
+		return
+	}
+
 	return
 }
 
+func (p *ProxyServiceImplementation) getCanonicalRequestPath(proc processor.ProcessingService, requestPath string) (canonicalPath string, changed bool) {
+	canonicalizer, isCanonicalizer := proc.(processor.Canonicalizer)
+	if !p.config.RedirectToCanonical || !isCanonicalizer {
+		return "", false
+	}
+
+	// request was already parsed successfully, so it can not fail here
+	canonicalPath, changed, err := canonicalizer.CanonicalRequestPath(requestPath)
+	return canonicalPath, changed && err == nil
+}
+
 // returns: get success
 func (p *ProxyServiceImplementation) tryToGetImageFromCache(
 	ctx context.Context,
@@ -144,9 +251,27 @@ func (p *ProxyServiceImplementation) tryToProcessAndServeImage(
 	output hub.DataStreamOutput,
 	rw ProxyResponseWriter,
 ) error {
+	// cache hits are served before the breaker is checked,
+	// so only cache misses fail fast when processor is unavailable
+	breaker, hasBreaker := p.breakers[processorType]
+	if hasBreaker {
+		if err := breaker.Allow(); err != nil {
+			return p.handleOpenCircuit(ctx, breaker.RetryAfter(), parsedRequest, input, output, rw)
+		}
+	}
+
 	// process image does not close the input stream on initial fetch error,
 	// only when error occurs when fetches the image from processing service
 	contentType, size, err := processor.ProcessImage(ctx, parsedRequest, input)
+	if hasBreaker {
+		p.reportProcessingResult(ctx, breaker, err)
+	}
+
+	var openErr *circuitbreaker.OpenError
+	if errors.As(err, &openErr) {
+		return p.handleOpenCircuit(ctx, openErr.RetryAfter, parsedRequest, input, output, rw)
+	}
+
 	if err != nil {
 		log.Printf("writing fallback image because: %s", err)
 		return p.writeFallbackImage(
@@ -173,12 +298,49 @@ func (p *ProxyServiceImplementation) tryToProcessAndServeImage(
 		ProcessingParams: parsedRequest.ProcessingParams,
 	}
 
-	p.saveImageInCache(ctx, imageInfo)
+	p.saveImageInCache(imageInfo)
 
 	rw.WriteOK(output)
 	return nil
 }
 
+// requests rejected by the processor, like requests of not existing images, are
+// successful for the breaker and requests cancelled by the caller are not counted,
+// but requests which exceeded their deadline are failures of the processor
+func (p *ProxyServiceImplementation) reportProcessingResult(ctx context.Context, breaker *circuitbreaker.Breaker, err error) {
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		breaker.Ignore()
+		return
+	}
+
+	breaker.Report(!processor.IsServiceFailure(err))
+}
+
+func (p *ProxyServiceImplementation) handleOpenCircuit(
+	ctx context.Context,
+	retryAfter time.Duration,
+	parsedRequest processor.ParsedRequest,
+	input hub.DataStreamInput,
+	output hub.DataStreamOutput,
+	rw ProxyResponseWriter,
+) error {
+	if p.config.CircuitOpenBehaviour == RejectOnOpenCircuit {
+		input.Close(circuitbreaker.ErrCircuitOpen)
+		rw.WriteErrorWithRetryAfter(503, "processing service unavailable", retryAfter)
+		return circuitbreaker.ErrCircuitOpen
+	}
+
+	return p.writeFallbackImage(
+		ctx,
+		503,
+		"processing service unavailable",
+		parsedRequest,
+		input,
+		output,
+		rw,
+	)
+}
+
 func (p *ProxyServiceImplementation) writeFallbackImage(
 	ctx context.Context,
 	originalCode int,
@@ -199,22 +361,64 @@ func (p *ProxyServiceImplementation) writeFallbackImage(
 	return nil
 }
 
-func (p *ProxyServiceImplementation) saveImageInCache(ctx context.Context, imageInfo cacherepositories.CachedImageModel) {
-	processedImageOutput, err := p.datahub.GetStreamOutput(imageInfo.RequestSignature)
+// image is saved in the background after the response is written, so the save
+// can not use the request context, which is cancelled when the request ends
+func (p *ProxyServiceImplementation) saveImageInCache(imageInfo cacherepositories.CachedImageModel) {
+	streamID := p.makeStreamID(imageInfo.ProcessorType, imageInfo.RequestSignature)
+	processedImageOutput, err := p.datahub.GetStreamOutput(streamID)
 	if err != nil {
 		log.Printf("failed to get stream output to save image in cache: %s", err)
 		return
 	}
 
+	saved := p.addPendingSave(streamID)
+
+	p.saves.Add(1)
 	go func() {
+		defer p.saves.Done()
+		defer p.removePendingSave(streamID, saved)
 		defer processedImageOutput.Close()
 
+		ctx, cancel := context.WithTimeout(context.Background(), imageSaveTimeout)
+		defer cancel()
+
 		if err := p.cache.Save(ctx, imageInfo, processedImageOutput); err != nil {
 			log.Printf("failed to save entry to cache: %s", err)
 		}
 	}()
 }
 
+func (p *ProxyServiceImplementation) WaitForSaves() {
+	p.saves.Wait()
+}
+
+// the save is registered before the response is written,
+// so it can be awaited by the caller as soon as the request is handled
+func (p *ProxyServiceImplementation) addPendingSave(streamID string) chan struct{} {
+	p.pendingSavesMutex.Lock()
+	defer p.pendingSavesMutex.Unlock()
+
+	saved := make(chan struct{})
+	p.pendingSaves[streamID] = saved
+	return saved
+}
+
+func (p *ProxyServiceImplementation) removePendingSave(streamID string, saved chan struct{}) {
+	p.pendingSavesMutex.Lock()
+	defer p.pendingSavesMutex.Unlock()
+
+	if p.pendingSaves[streamID] == saved {
+		delete(p.pendingSaves, streamID)
+	}
+
+	close(saved)
+}
+
+// signatures are unique only within a processor type
+func (p *ProxyServiceImplementation) makeStreamID(processorType, requestSignature string) string {
+	return processorType + "::" + requestSignature
+}
+
 func (p *ProxyServiceImplementation) parseRawRequestPath(rawRequestPath string) (processorType string, requestPath string, err error) {
 	url, err := url.Parse(rawRequestPath)
 	if err != nil {
@@ -265,3 +469,9 @@ func (p *ProxyServiceImplementation) isAllowedImageSourceDomain(sourceImageURL s
 
 	return false
 }
+
+// imageSaveTimeout is shorter than the time after which
+// the cache treats pending entries as abandoned
+const imageSaveTimeout = 30 * time.Minute
+
+var ErrUnknownProcessor = errors.New("unknown processor")
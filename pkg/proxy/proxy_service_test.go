@@ -3,6 +3,7 @@ package proxy_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -11,11 +12,13 @@ import (
 	"github.com/thebartekbanach/imcaxy/pkg/cache"
 	mock_cache "github.com/thebartekbanach/imcaxy/pkg/cache/mocks"
 	cacherepositories "github.com/thebartekbanach/imcaxy/pkg/cache/repositories"
+	"github.com/thebartekbanach/imcaxy/pkg/circuitbreaker"
 	"github.com/thebartekbanach/imcaxy/pkg/filefetcher"
 	mock_filefetcher "github.com/thebartekbanach/imcaxy/pkg/filefetcher/mocks"
 	"github.com/thebartekbanach/imcaxy/pkg/hub"
 	datahubstorage "github.com/thebartekbanach/imcaxy/pkg/hub/storage"
 	"github.com/thebartekbanach/imcaxy/pkg/processor"
+	canonicalprocessor "github.com/thebartekbanach/imcaxy/pkg/processor/canonical"
 	mock_processor "github.com/thebartekbanach/imcaxy/pkg/processor/mocks"
 	"github.com/thebartekbanach/imcaxy/pkg/proxy"
 	mock_proxy "github.com/thebartekbanach/imcaxy/pkg/proxy/mocks"
@@ -36,9 +39,13 @@ type testingProxyServiceDeps struct {
 }
 
 type testingProxyServiceCreationConfig struct {
-	processorMocks []string
-	allowedDomains []string
-	allowedOrigins []string
+	processorMocks       []string
+	allowedDomains       []string
+	allowedOrigins       []string
+	circuitBreaker       circuitbreaker.Config
+	circuitOpenBehaviour proxy.CircuitOpenBehaviour
+	canonicalRules       map[string]canonicalprocessor.Rules
+	redirectToCanonical  bool
 }
 
 func createTestingProxyService(t *testing.T, cfg testingProxyServiceCreationConfig) (proxy.ProxyService, *testingProxyServiceDeps, *gomock.Controller) {
@@ -64,6 +71,11 @@ func createTestingProxyService(t *testing.T, cfg testingProxyServiceCreationConf
 		mockProcessingService := mock_processor.NewMockProcessingService(mockCtrl)
 		processors[name] = mockProcessingService
 		processorMocks[name] = mockProcessingService
+
+		if rules, canonicalized := cfg.canonicalRules[name]; canonicalized {
+			canonicalProcessor := canonicalprocessor.NewProcessor(rules, mockProcessingService)
+			processors[name] = &canonicalProcessor
+		}
 	}
 
 	if cfg.allowedDomains == nil || len(cfg.allowedDomains) == 0 {
@@ -75,9 +87,12 @@ func createTestingProxyService(t *testing.T, cfg testingProxyServiceCreationConf
 	}
 
 	config := proxy.ProxyServiceConfig{
-		Processors:     processors,
-		AllowedDomains: cfg.allowedDomains,
-		AllowedOrigins: cfg.allowedOrigins,
+		Processors:           processors,
+		AllowedDomains:       cfg.allowedDomains,
+		AllowedOrigins:       cfg.allowedOrigins,
+		CircuitBreaker:       cfg.circuitBreaker,
+		CircuitOpenBehaviour: cfg.circuitOpenBehaviour,
+		RedirectToCanonical:  cfg.redirectToCanonical,
 	}
 
 	mockConfig := proxyServiceTestingConfig{
@@ -173,6 +188,47 @@ func TestProxyService_FirstHandleShouldProcessImageAndSaveInCacheAndReturn(t *te
 	proxy.Handle(ctx, requestURL, "github.com", deps.responseWriter)
 }
 
+func TestProxyService_SaveShouldNotBeCancelledWithRequestContext(t *testing.T) {
+	proxy, deps, _ := createTestingProxyService(t, testingProxyServiceCreationConfig{})
+
+	requestURLWithoutProcessor := "/test?url=http://google.com/image.jpg"
+	requestURL := "/imaginary" + requestURLWithoutProcessor
+	parsedRequest := processor.ParsedRequest{
+		Signature:         "test-signature",
+		SourceImageURL:    "http://google.com/image.jpg",
+		ProcessorEndpoint: "/test",
+	}
+
+	deps.config.processors["imaginary"].EXPECT().ParseRequest(requestURLWithoutProcessor).Return(parsedRequest, nil)
+	deps.cache.EXPECT().Get(gomock.Any(), parsedRequest.Signature, "imaginary", gomock.Any()).Return(cache.ErrEntryNotFound)
+	deps.config.processors["imaginary"].EXPECT().ProcessImage(gomock.Any(), parsedRequest, gomock.Any()).Return("image/jpeg", int64(1), nil)
+	deps.responseWriter.EXPECT().WriteOK(gomock.Any())
+
+	requestEnded := make(chan struct{})
+	saveErr := make(chan error, 1)
+	deps.cache.EXPECT().Save(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, imageInfo cacherepositories.CachedImageModel, r hub.DataStreamOutput) error {
+			<-requestEnded
+			saveErr <- ctx.Err()
+			return ctx.Err()
+		},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	proxy.Handle(ctx, requestURL, "github.com", deps.responseWriter)
+	cancel()
+	close(requestEnded)
+
+	select {
+	case err := <-saveErr:
+		if err != nil {
+			t.Errorf("Expected save context to be alive after request end, got: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("save was not called")
+	}
+}
+
 func TestProxyService_SecondHandleShouldReturnImageFromCache(t *testing.T) {
 	proxy, deps, _ := createTestingProxyService(t, testingProxyServiceCreationConfig{})
 
@@ -252,6 +308,30 @@ func TestProxyService_RejectsRequestIfSourceImageDomainIsNotAllowed(t *testing.T
 	proxy.Handle(ctx, requestURL, "github.com", deps.responseWriter)
 }
 
+func TestProxyService_RedirectsNonCanonicalRequestToCanonicalOne(t *testing.T) {
+	proxy, deps, _ := createTestingProxyService(t, testingProxyServiceCreationConfig{
+		canonicalRules:      map[string]canonicalprocessor.Rules{"imaginary": canonicalprocessor.ImaginaryRules().WithIgnoredParams("v")},
+		redirectToCanonical: true,
+	})
+
+	requestURL := "/imaginary/resize?url=http://Google.com/image.jpg&width=0300&v=2"
+	canonicalRequestURLWithoutProcessor := "/resize?url=http%3A%2F%2Fgoogle.com%2Fimage.jpg&width=300"
+	parsedRequest := processor.ParsedRequest{
+		Signature:         "test-signature",
+		SourceImageURL:    "http://google.com/image.jpg",
+		ProcessorEndpoint: "/resize",
+		ProcessingParams:  map[string][]string{"url": {"http://google.com/image.jpg"}, "width": {"300"}},
+	}
+
+	deps.config.processors["imaginary"].EXPECT().ParseRequest(canonicalRequestURLWithoutProcessor).Return(parsedRequest, nil)
+	deps.responseWriter.EXPECT().WriteRedirect(301, "/imaginary"+canonicalRequestURLWithoutProcessor)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proxy.Handle(ctx, requestURL, "github.com", deps.responseWriter)
+}
+
 func TestProxyService_AllowsRequestIfSourceImageDomainIsAllowed(t *testing.T) {
 	proxy, deps, _ := createTestingProxyService(t, testingProxyServiceCreationConfig{
 		allowedDomains: []string{"github.com", "google.com"},
@@ -654,12 +734,294 @@ func TestProxyService_ReturnsStreamFromImageIfItIsAlreadyProcessing(t *testing.T
 	}
 
 	deps.config.processors["imaginary"].EXPECT().ParseRequest(requestURLWithoutProcessor).Return(parsedRequest, nil)
-	deps.datahub.CreateStream("test-signature")
+	deps.datahub.CreateStream("imaginary::test-signature")
+
+	deps.responseWriter.EXPECT().WriteOK(gomock.Any())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proxy.Handle(ctx, requestURL, "github.com", deps.responseWriter)
+}
+
+func openCircuitOfTestingProxyService(proxy proxy.ProxyService, deps *testingProxyServiceDeps, failures int) {
+	handleFailingRequestsOfTestingProxyService(context.Background(), proxy, deps, failures, &processor.StatusError{StatusCode: 502, Err: errors.New("bad gateway")})
+}
+
+func handleFailingRequestsOfTestingProxyService(parentCtx context.Context, proxy proxy.ProxyService, deps *testingProxyServiceDeps, requests int, processingErr error) {
+	for i := 0; i < requests; i++ {
+		requestURLWithoutProcessor := fmt.Sprintf("/test?url=http://google.com/image.jpg&failure=%d", i)
+		parsedRequest := processor.ParsedRequest{
+			Signature:         fmt.Sprintf("failing-signature-%d", i),
+			SourceImageURL:    "http://google.com/image.jpg",
+			ProcessorEndpoint: "/test",
+		}
+
+		deps.config.processors["imaginary"].EXPECT().ParseRequest(requestURLWithoutProcessor).Return(parsedRequest, nil)
+		deps.cache.EXPECT().Get(gomock.Any(), parsedRequest.Signature, "imaginary", gomock.Any()).Return(cache.ErrEntryNotFound)
+		deps.config.processors["imaginary"].EXPECT().ProcessImage(gomock.Any(), parsedRequest, gomock.Any()).Return("", int64(0), processingErr)
+		deps.fetcher.EXPECT().Fetch(gomock.Any(), parsedRequest.SourceImageURL, gomock.Any()).Return(nil)
+		deps.responseWriter.EXPECT().WriteErrorWithFallback(500, "processing error ocurred", gomock.Any())
+
+		ctx, cancel := context.WithCancel(parentCtx)
+		proxy.Handle(ctx, "/imaginary"+requestURLWithoutProcessor, "google.com", deps.responseWriter)
+		cancel()
+	}
+}
+
+func TestProxyService_RejectsCacheMissWith503WhenCircuitIsOpen(t *testing.T) {
+	proxy, deps, _ := createTestingProxyService(t, testingProxyServiceCreationConfig{
+		circuitBreaker:       circuitbreaker.Config{FailureThreshold: 2, OpenDuration: time.Minute},
+		circuitOpenBehaviour: proxy.RejectOnOpenCircuit,
+	})
+
+	openCircuitOfTestingProxyService(proxy, deps, 2)
+
+	requestURLWithoutProcessor := "/test?url=http://google.com/image.jpg"
+	parsedRequest := processor.ParsedRequest{
+		Signature:         "test-signature",
+		SourceImageURL:    "http://google.com/image.jpg",
+		ProcessorEndpoint: "/test",
+	}
+
+	deps.config.processors["imaginary"].EXPECT().ParseRequest(requestURLWithoutProcessor).Return(parsedRequest, nil)
+	deps.cache.EXPECT().Get(gomock.Any(), parsedRequest.Signature, "imaginary", gomock.Any()).Return(cache.ErrEntryNotFound)
+	deps.config.processors["imaginary"].EXPECT().ProcessImage(gomock.Any(), parsedRequest, gomock.Any()).Times(0)
+	deps.responseWriter.EXPECT().WriteErrorWithRetryAfter(503, "processing service unavailable", gomock.Any())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proxy.Handle(ctx, "/imaginary"+requestURLWithoutProcessor, "google.com", deps.responseWriter)
+}
+
+func TestProxyService_ReturnsFallbackImageWhenCircuitIsOpen(t *testing.T) {
+	proxy, deps, _ := createTestingProxyService(t, testingProxyServiceCreationConfig{
+		circuitBreaker:       circuitbreaker.Config{FailureThreshold: 2, OpenDuration: time.Minute},
+		circuitOpenBehaviour: proxy.FallbackOnOpenCircuit,
+	})
+
+	openCircuitOfTestingProxyService(proxy, deps, 2)
+
+	requestURLWithoutProcessor := "/test?url=http://google.com/image.jpg"
+	parsedRequest := processor.ParsedRequest{
+		Signature:         "test-signature",
+		SourceImageURL:    "http://google.com/image.jpg",
+		ProcessorEndpoint: "/test",
+	}
+
+	deps.config.processors["imaginary"].EXPECT().ParseRequest(requestURLWithoutProcessor).Return(parsedRequest, nil)
+	deps.cache.EXPECT().Get(gomock.Any(), parsedRequest.Signature, "imaginary", gomock.Any()).Return(cache.ErrEntryNotFound)
+	deps.config.processors["imaginary"].EXPECT().ProcessImage(gomock.Any(), parsedRequest, gomock.Any()).Times(0)
+	deps.fetcher.EXPECT().Fetch(gomock.Any(), parsedRequest.SourceImageURL, gomock.Any()).Return(nil)
+	deps.responseWriter.EXPECT().WriteErrorWithFallback(503, "processing service unavailable", gomock.Any())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proxy.Handle(ctx, "/imaginary"+requestURLWithoutProcessor, "google.com", deps.responseWriter)
+}
+
+func TestProxyService_DoesNotOpenCircuitOnClientErrorsOfProcessor(t *testing.T) {
+	proxy, deps, _ := createTestingProxyService(t, testingProxyServiceCreationConfig{
+		circuitBreaker:       circuitbreaker.Config{FailureThreshold: 2, OpenDuration: time.Minute},
+		circuitOpenBehaviour: proxy.RejectOnOpenCircuit,
+	})
+
+	handleFailingRequestsOfTestingProxyService(context.Background(), proxy, deps, 3, &processor.StatusError{StatusCode: 404, Err: errors.New("not found")})
+
+	requestURLWithoutProcessor := "/test?url=http://google.com/image.jpg"
+	parsedRequest := processor.ParsedRequest{
+		Signature:         "test-signature",
+		SourceImageURL:    "http://google.com/image.jpg",
+		ProcessorEndpoint: "/test",
+	}
+
+	deps.config.processors["imaginary"].EXPECT().ParseRequest(requestURLWithoutProcessor).Return(parsedRequest, nil)
+	deps.cache.EXPECT().Get(gomock.Any(), parsedRequest.Signature, "imaginary", gomock.Any()).Return(cache.ErrEntryNotFound)
+	deps.config.processors["imaginary"].EXPECT().ProcessImage(gomock.Any(), parsedRequest, gomock.Any()).Return("", int64(0), &processor.StatusError{StatusCode: 404, Err: errors.New("not found")})
+	deps.fetcher.EXPECT().Fetch(gomock.Any(), parsedRequest.SourceImageURL, gomock.Any()).Return(nil)
+	deps.responseWriter.EXPECT().WriteErrorWithFallback(500, "processing error ocurred", gomock.Any())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proxy.Handle(ctx, "/imaginary"+requestURLWithoutProcessor, "google.com", deps.responseWriter)
+}
+
+func TestProxyService_OpensCircuitWhenProcessingExceedsRequestDeadline(t *testing.T) {
+	proxy, deps, _ := createTestingProxyService(t, testingProxyServiceCreationConfig{
+		circuitBreaker:       circuitbreaker.Config{FailureThreshold: 2, OpenDuration: time.Minute},
+		circuitOpenBehaviour: proxy.RejectOnOpenCircuit,
+	})
+
+	expiredCtx, cancelExpired := context.WithTimeout(context.Background(), 0)
+	defer cancelExpired()
+
+	handleFailingRequestsOfTestingProxyService(expiredCtx, proxy, deps, 2, context.DeadlineExceeded)
+
+	requestURLWithoutProcessor := "/test?url=http://google.com/image.jpg"
+	parsedRequest := processor.ParsedRequest{
+		Signature:         "test-signature",
+		SourceImageURL:    "http://google.com/image.jpg",
+		ProcessorEndpoint: "/test",
+	}
+
+	deps.config.processors["imaginary"].EXPECT().ParseRequest(requestURLWithoutProcessor).Return(parsedRequest, nil)
+	deps.cache.EXPECT().Get(gomock.Any(), parsedRequest.Signature, "imaginary", gomock.Any()).Return(cache.ErrEntryNotFound)
+	deps.config.processors["imaginary"].EXPECT().ProcessImage(gomock.Any(), parsedRequest, gomock.Any()).Times(0)
+	deps.responseWriter.EXPECT().WriteErrorWithRetryAfter(503, "processing service unavailable", gomock.Any())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proxy.Handle(ctx, "/imaginary"+requestURLWithoutProcessor, "google.com", deps.responseWriter)
+}
+
+func TestProxyService_DoesNotOpenCircuitWhenRequestsAreCancelledByCaller(t *testing.T) {
+	proxy, deps, _ := createTestingProxyService(t, testingProxyServiceCreationConfig{
+		circuitBreaker:       circuitbreaker.Config{FailureThreshold: 2, OpenDuration: time.Minute},
+		circuitOpenBehaviour: proxy.RejectOnOpenCircuit,
+	})
+
+	cancelledCtx, cancelCaller := context.WithCancel(context.Background())
+	cancelCaller()
+
+	handleFailingRequestsOfTestingProxyService(cancelledCtx, proxy, deps, 3, context.Canceled)
 
+	requestURLWithoutProcessor := "/test?url=http://google.com/image.jpg"
+	parsedRequest := processor.ParsedRequest{
+		Signature:         "test-signature",
+		SourceImageURL:    "http://google.com/image.jpg",
+		ProcessorEndpoint: "/test",
+	}
+
+	deps.config.processors["imaginary"].EXPECT().ParseRequest(requestURLWithoutProcessor).Return(parsedRequest, nil)
+	deps.cache.EXPECT().Get(gomock.Any(), parsedRequest.Signature, "imaginary", gomock.Any()).Return(cache.ErrEntryNotFound)
+	deps.config.processors["imaginary"].EXPECT().ProcessImage(gomock.Any(), parsedRequest, gomock.Any()).Return("", int64(0), &processor.StatusError{StatusCode: 404, Err: errors.New("not found")})
+	deps.fetcher.EXPECT().Fetch(gomock.Any(), parsedRequest.SourceImageURL, gomock.Any()).Return(nil)
+	deps.responseWriter.EXPECT().WriteErrorWithFallback(500, "processing error ocurred", gomock.Any())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proxy.Handle(ctx, "/imaginary"+requestURLWithoutProcessor, "google.com", deps.responseWriter)
+}
+
+func TestProxyService_RejectsRequestWith503WhenCircuitsOfAllProcessorBackendsAreOpen(t *testing.T) {
+	proxy, deps, _ := createTestingProxyService(t, testingProxyServiceCreationConfig{
+		circuitOpenBehaviour: proxy.RejectOnOpenCircuit,
+	})
+
+	requestURLWithoutProcessor := "/test?url=http://google.com/image.jpg"
+	parsedRequest := processor.ParsedRequest{
+		Signature:         "test-signature",
+		SourceImageURL:    "http://google.com/image.jpg",
+		ProcessorEndpoint: "/test",
+	}
+
+	deps.config.processors["imaginary"].EXPECT().ParseRequest(requestURLWithoutProcessor).Return(parsedRequest, nil)
+	deps.cache.EXPECT().Get(gomock.Any(), parsedRequest.Signature, "imaginary", gomock.Any()).Return(cache.ErrEntryNotFound)
+	deps.config.processors["imaginary"].EXPECT().ProcessImage(gomock.Any(), parsedRequest, gomock.Any()).Return("", int64(0), &circuitbreaker.OpenError{RetryAfter: 10 * time.Second})
+	deps.responseWriter.EXPECT().WriteErrorWithRetryAfter(503, "processing service unavailable", 10*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proxy.Handle(ctx, "/imaginary"+requestURLWithoutProcessor, "google.com", deps.responseWriter)
+}
+
+func TestProxyService_ServesCacheHitsWhenCircuitIsOpen(t *testing.T) {
+	proxy, deps, _ := createTestingProxyService(t, testingProxyServiceCreationConfig{
+		circuitBreaker:       circuitbreaker.Config{FailureThreshold: 1, OpenDuration: time.Minute},
+		circuitOpenBehaviour: proxy.RejectOnOpenCircuit,
+	})
+
+	openCircuitOfTestingProxyService(proxy, deps, 1)
+
+	requestURLWithoutProcessor := "/test?url=http://google.com/image.jpg"
+	parsedRequest := processor.ParsedRequest{
+		Signature:         "test-signature",
+		SourceImageURL:    "http://google.com/image.jpg",
+		ProcessorEndpoint: "/test",
+	}
+
+	deps.config.processors["imaginary"].EXPECT().ParseRequest(requestURLWithoutProcessor).Return(parsedRequest, nil)
+	deps.cache.EXPECT().Get(gomock.Any(), parsedRequest.Signature, "imaginary", gomock.Any()).Return(nil)
+	deps.responseWriter.EXPECT().WriteOK(gomock.Any())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proxy.Handle(ctx, "/imaginary"+requestURLWithoutProcessor, "google.com", deps.responseWriter)
+}
+
+func TestProxyService_CachedShouldCheckCacheUsingParsedRequestSignature(t *testing.T) {
+	proxy, deps, _ := createTestingProxyService(t, testingProxyServiceCreationConfig{})
+
+	requestURLWithoutProcessor := "/test?url=http://google.com/image.jpg"
+	parsedRequest := processor.ParsedRequest{Signature: "test-signature"}
+
+	deps.config.processors["imaginary"].EXPECT().ParseRequest(requestURLWithoutProcessor).Return(parsedRequest, nil)
+	deps.cache.EXPECT().Contains(gomock.Any(), parsedRequest.Signature, "imaginary").Return(true, nil)
+
+	cached, err := proxy.Cached(context.Background(), "/imaginary"+requestURLWithoutProcessor)
+	if err != nil || !cached {
+		t.Errorf("Expected request to be cached, got: %v, %v", cached, err)
+	}
+}
+
+func TestProxyService_WaitForSaveShouldBlockUntilImageOfRequestIsSaved(t *testing.T) {
+	proxy, deps, _ := createTestingProxyService(t, testingProxyServiceCreationConfig{})
+
+	requestURLWithoutProcessor := "/test?url=http://google.com/image.jpg"
+	requestURL := "/imaginary" + requestURLWithoutProcessor
+	parsedRequest := processor.ParsedRequest{
+		Signature:         "test-signature",
+		SourceImageURL:    "http://google.com/image.jpg",
+		ProcessorEndpoint: "/test",
+	}
+
+	deps.config.processors["imaginary"].EXPECT().ParseRequest(requestURLWithoutProcessor).Return(parsedRequest, nil).Times(2)
+	deps.cache.EXPECT().Get(gomock.Any(), parsedRequest.Signature, "imaginary", gomock.Any()).Return(cache.ErrEntryNotFound)
+	deps.config.processors["imaginary"].EXPECT().ProcessImage(gomock.Any(), parsedRequest, gomock.Any()).Return("image/jpeg", int64(1), nil)
 	deps.responseWriter.EXPECT().WriteOK(gomock.Any())
 
+	finishSave := make(chan struct{})
+	saveFinished := make(chan struct{})
+	deps.cache.EXPECT().Save(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, imageInfo cacherepositories.CachedImageModel, r hub.DataStreamOutput) error {
+			<-finishSave
+			close(saveFinished)
+			return nil
+		},
+	)
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	proxy.Handle(ctx, requestURL, "github.com", deps.responseWriter)
+
+	waitCtx, cancelWait := context.WithTimeout(ctx, time.Second)
+	defer cancelWait()
+
+	go close(finishSave)
+	if err := proxy.WaitForSave(waitCtx, requestURL); err != nil {
+		t.Fatalf("Expected no error, got: %s", err)
+	}
+
+	select {
+	case <-saveFinished:
+	default:
+		t.Error("Expected wait to end after the image is saved")
+	}
+}
+
+func TestProxyService_CachedShouldReturnErrorOnUnknownProcessor(t *testing.T) {
+	proxyService, _, _ := createTestingProxyService(t, testingProxyServiceCreationConfig{})
+
+	_, err := proxyService.Cached(context.Background(), "/unknown/test?url=http://google.com/image.jpg")
+	if err != proxy.ErrUnknownProcessor {
+		t.Errorf("Expected unknown processor error, got: %v", err)
+	}
 }
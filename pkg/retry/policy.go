@@ -0,0 +1,105 @@
+package retry
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+type Policy struct {
+	// MaxAttempts is the number of attempts including the first one,
+	// values lower than 2 disable retrying.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	// Jitter is a fraction of computed backoff, in range from 0 to 1,
+	// that is randomly added to or subtracted from each backoff.
+	Jitter float64
+
+	RetryableStatusCodes []int
+}
+
+// Operation is a single attempt of retried action.
+// It returns error and information if given error can be retried.
+type Operation func(attempt int) (retryable bool, err error)
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:          3,
+		InitialBackoff:       100 * time.Millisecond,
+		MaxBackoff:           2 * time.Second,
+		Multiplier:           2,
+		Jitter:               0.2,
+		RetryableStatusCodes: []int{502, 503, 504},
+	}
+}
+
+// Do runs given operation until it succeeds, returns non-retryable error
+// or the number of attempts is exhausted. It never waits longer than
+// the deadline of given context allows.
+func (p Policy) Do(ctx context.Context, op Operation) (attempts int, err error) {
+	for {
+		attempts++
+
+		var retryable bool
+		retryable, err = op(attempts)
+		if err == nil || !retryable || attempts >= p.MaxAttempts {
+			return attempts, err
+		}
+
+		if ctx.Err() != nil {
+			return attempts, err
+		}
+
+		backoff := p.Backoff(attempts)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= backoff {
+			return attempts, err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempts, err
+		case <-timer.C:
+		}
+	}
+}
+
+// Backoff returns the time to wait after given attempt.
+func (p Policy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		backoff += backoff * p.Jitter * (2*randomFloat() - 1)
+	}
+
+	if backoff < 0 {
+		return 0
+	}
+
+	return time.Duration(backoff)
+}
+
+func (p Policy) IsRetryableStatus(statusCode int) bool {
+	for _, code := range p.RetryableStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+var randomFloat = rand.Float64
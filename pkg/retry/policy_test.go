@@ -0,0 +1,188 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testPolicy(maxAttempts int) Policy {
+	return Policy{
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+		Multiplier:     2,
+	}
+}
+
+func TestPolicy_DoReturnsAfterFirstSuccessfulAttempt(t *testing.T) {
+	calls := 0
+	attempts, err := testPolicy(3).Do(context.Background(), func(attempt int) (bool, error) {
+		calls++
+		return true, nil
+	})
+
+	if err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+
+	if attempts != 1 || calls != 1 {
+		t.Errorf("Expected single attempt, got %d attempts and %d calls", attempts, calls)
+	}
+}
+
+func TestPolicy_DoRetriesRetryableErrorsUntilSuccess(t *testing.T) {
+	testErr := errors.New("test error")
+	attempts, err := testPolicy(5).Do(context.Background(), func(attempt int) (bool, error) {
+		if attempt < 3 {
+			return true, testErr
+		}
+
+		return false, nil
+	})
+
+	if err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestPolicy_DoDoesNotRetryNonRetryableErrors(t *testing.T) {
+	testErr := errors.New("test error")
+	attempts, err := testPolicy(5).Do(context.Background(), func(attempt int) (bool, error) {
+		return false, testErr
+	})
+
+	if err != testErr {
+		t.Errorf("Expected test error, got: %v", err)
+	}
+
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestPolicy_DoReturnsLastErrorWhenAttemptsAreExhausted(t *testing.T) {
+	testErr := errors.New("test error")
+	attempts, err := testPolicy(3).Do(context.Background(), func(attempt int) (bool, error) {
+		return true, testErr
+	})
+
+	if err != testErr {
+		t.Errorf("Expected test error, got: %v", err)
+	}
+
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestPolicy_ZeroValueDoesNotRetry(t *testing.T) {
+	testErr := errors.New("test error")
+	attempts, _ := Policy{}.Do(context.Background(), func(attempt int) (bool, error) {
+		return true, testErr
+	})
+
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestPolicy_DoDoesNotWaitBeyondContextDeadline(t *testing.T) {
+	policy := Policy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		Multiplier:     2,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	attempts, err := policy.Do(ctx, func(attempt int) (bool, error) {
+		return true, errors.New("test error")
+	})
+
+	if err == nil {
+		t.Errorf("Expected error to be returned")
+	}
+
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+
+	if time.Since(start) > 40*time.Millisecond {
+		t.Errorf("Expected Do to return immediately, it took %s", time.Since(start))
+	}
+}
+
+func TestPolicy_DoStopsWhenContextIsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	attempts, _ := testPolicy(5).Do(ctx, func(attempt int) (bool, error) {
+		cancel()
+		return true, errors.New("test error")
+	})
+
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestPolicy_BackoffGrowsExponentiallyUpToMaxBackoff(t *testing.T) {
+	policy := Policy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+	}
+
+	for i, expectedBackoff := range expected {
+		if backoff := policy.Backoff(i + 1); backoff != expectedBackoff {
+			t.Errorf("Expected backoff of attempt %d to be %s, got %s", i+1, expectedBackoff, backoff)
+		}
+	}
+}
+
+func TestPolicy_BackoffAppliesJitter(t *testing.T) {
+	defer func(original func() float64) { randomFloat = original }(randomFloat)
+
+	policy := Policy{
+		InitialBackoff: 100 * time.Millisecond,
+		Multiplier:     2,
+		Jitter:         0.5,
+	}
+
+	randomFloat = func() float64 { return 0 }
+	if backoff := policy.Backoff(1); backoff != 50*time.Millisecond {
+		t.Errorf("Expected backoff with minimal jitter to be 50ms, got %s", backoff)
+	}
+
+	randomFloat = func() float64 { return 1 }
+	if backoff := policy.Backoff(1); backoff != 150*time.Millisecond {
+		t.Errorf("Expected backoff with maximal jitter to be 150ms, got %s", backoff)
+	}
+}
+
+func TestPolicy_IsRetryableStatus(t *testing.T) {
+	policy := Policy{RetryableStatusCodes: []int{502, 503}}
+
+	if !policy.IsRetryableStatus(503) {
+		t.Errorf("Expected 503 to be retryable")
+	}
+
+	if policy.IsRetryableStatus(404) {
+		t.Errorf("Expected 404 not to be retryable")
+	}
+}
@@ -0,0 +1,83 @@
+package warming
+
+import "time"
+
+type JobRequest struct {
+	SourceImageURLs []string `json:"sourceImageURLs"`
+	// Presets are names of configured presets warmed for every source image URL
+	Presets []string `json:"presets"`
+	// Requests are warmed for every source image URL when they contain
+	// the {url} placeholder, otherwise they are warmed as they are
+	Requests []string `json:"requests"`
+	// Origin is sent with all requests of the job, so it has to be allowed
+	Origin string `json:"origin"`
+}
+
+type JobState string
+
+const (
+	JobQueued   JobState = "queued"
+	JobRunning  JobState = "running"
+	JobFinished JobState = "finished"
+)
+
+type ItemResult string
+
+const (
+	ItemPending ItemResult = "pending"
+	// ItemWarmed was processed, its image is saved in the cache in the background
+	ItemWarmed  ItemResult = "warmed"
+	ItemSkipped ItemResult = "skipped"
+	ItemFailed  ItemResult = "failed"
+)
+
+type JobItem struct {
+	Request string     `json:"request"`
+	Result  ItemResult `json:"result"`
+	Error   string     `json:"error,omitempty"`
+}
+
+type Job struct {
+	ID    string   `json:"id"`
+	State JobState `json:"state"`
+
+	CreatedAt  time.Time `json:"createdAt"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+
+	TotalItems   int `json:"totalItems"`
+	WarmedItems  int `json:"warmedItems"`
+	SkippedItems int `json:"skippedItems"`
+	FailedItems  int `json:"failedItems"`
+
+	Items []JobItem `json:"items"`
+}
+
+// job is shared by the warmer and its workers, so it is accessed only under the warmer mutex
+type job struct {
+	Job
+	origin string
+	done   chan struct{}
+}
+
+func (j *job) snapshot() Job {
+	snapshot := j.Job
+	snapshot.Items = append([]JobItem{}, j.Items...)
+	return snapshot
+}
+
+func (j *job) setResult(index int, result ItemResult, err error) {
+	j.Items[index].Result = result
+	if err != nil {
+		j.Items[index].Error = err.Error()
+	}
+
+	switch result {
+	case ItemWarmed:
+		j.WarmedItems++
+	case ItemSkipped:
+		j.SkippedItems++
+	case ItemFailed:
+		j.FailedItems++
+	}
+}
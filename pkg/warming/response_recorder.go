@@ -0,0 +1,42 @@
+package warming
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/thebartekbanach/imcaxy/pkg/proxy"
+)
+
+// responseRecorder reads the whole processed image, so the request
+// is finished only when the image is processed
+type responseRecorder struct {
+	location string
+	err      error
+}
+
+var _ proxy.ProxyResponseWriter = (*responseRecorder)(nil)
+
+func (r *responseRecorder) WriteOK(reader io.ReadCloser) {
+	_, r.err = io.Copy(ioutil.Discard, reader)
+	reader.Close()
+}
+
+func (r *responseRecorder) WriteError(code int, message string) {
+	r.err = fmt.Errorf("%d %s", code, message)
+}
+
+// fallback image is the original one, so the processed image is not cached
+func (r *responseRecorder) WriteErrorWithFallback(code int, message string, fallbackImageReader io.ReadCloser) {
+	fallbackImageReader.Close()
+	r.err = fmt.Errorf("%d %s", code, message)
+}
+
+func (r *responseRecorder) WriteErrorWithRetryAfter(code int, message string, retryAfter time.Duration) {
+	r.err = fmt.Errorf("%d %s, retry after %s", code, message, retryAfter)
+}
+
+func (r *responseRecorder) WriteRedirect(code int, location string) {
+	r.location = location
+}
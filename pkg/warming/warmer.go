@@ -0,0 +1,308 @@
+package warming
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thebartekbanach/imcaxy/pkg/metrics"
+	"github.com/thebartekbanach/imcaxy/pkg/proxy"
+)
+
+type WarmerConfig struct {
+	// Concurrency is the number of requests processed at once by all jobs
+	Concurrency int
+	// MaxJobItems is the maximal number of requests of a single job
+	MaxJobItems int
+	// Presets are request paths in which {url} is replaced with source image URLs
+	Presets map[string]string
+}
+
+// Warmer processes requests through the proxy service before they are requested by visitors,
+// jobs are kept in memory of the instance which runs them
+type Warmer struct {
+	config       WarmerConfig
+	proxyService proxy.ProxyService
+	slots        chan struct{}
+
+	mutex        sync.Mutex
+	jobs         map[string]*job
+	finishedJobs []string
+}
+
+// finished jobs over this limit are forgotten, starting with the oldest ones
+const maxKeptFinishedJobs = 100
+
+// canonical requests are not redirected again
+const maxFollowedRedirects = 1
+
+const urlPlaceholder = "{url}"
+
+func NewWarmer(config WarmerConfig, proxyService proxy.ProxyService) *Warmer {
+	return &Warmer{
+		config:       config,
+		proxyService: proxyService,
+		slots:        make(chan struct{}, config.Concurrency),
+		jobs:         map[string]*job{},
+	}
+}
+
+// Start runs the job in the background until it is finished or the context is cancelled
+func (w *Warmer) Start(ctx context.Context, request JobRequest) (Job, error) {
+	requests, err := w.expandRequests(request)
+	if err != nil {
+		return Job{}, err
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	j := &job{
+		Job: Job{
+			ID:         id,
+			State:      JobQueued,
+			CreatedAt:  time.Now(),
+			TotalItems: len(requests),
+			Items:      make([]JobItem, len(requests)),
+		},
+		origin: request.Origin,
+		done:   make(chan struct{}),
+	}
+
+	for i, request := range requests {
+		j.Items[i] = JobItem{Request: request, Result: ItemPending}
+	}
+
+	w.mutex.Lock()
+	w.jobs[id] = j
+	snapshot := j.snapshot()
+	w.mutex.Unlock()
+
+	go w.run(ctx, j)
+	return snapshot, nil
+}
+
+func (w *Warmer) Job(id string) (Job, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	j, found := w.jobs[id]
+	if !found {
+		return Job{}, false
+	}
+
+	return j.snapshot(), true
+}
+
+func (w *Warmer) Wait(ctx context.Context, id string) (Job, error) {
+	w.mutex.Lock()
+	j, found := w.jobs[id]
+	w.mutex.Unlock()
+
+	if !found {
+		return Job{}, ErrJobNotFound
+	}
+
+	select {
+	case <-ctx.Done():
+		return Job{}, ctx.Err()
+	case <-j.done:
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return j.snapshot(), nil
+}
+
+// expandRequests returns request paths of the job without duplicates
+func (w *Warmer) expandRequests(request JobRequest) ([]string, error) {
+	templates := []string{}
+	for _, name := range request.Presets {
+		template, found := w.config.Presets[name]
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPreset, name)
+		}
+
+		templates = append(templates, template)
+	}
+
+	requests := []string{}
+	for _, template := range append(templates, request.Requests...) {
+		if !strings.Contains(template, urlPlaceholder) {
+			requests = append(requests, template)
+			continue
+		}
+
+		for _, sourceImageURL := range request.SourceImageURLs {
+			requests = append(requests, strings.ReplaceAll(template, urlPlaceholder, url.QueryEscape(sourceImageURL)))
+		}
+	}
+
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, request := range requests {
+		if !seen[request] {
+			seen[request] = true
+			unique = append(unique, request)
+		}
+	}
+
+	if len(unique) == 0 {
+		return nil, ErrEmptyJob
+	}
+
+	if len(unique) > w.config.MaxJobItems {
+		return nil, fmt.Errorf("%w: job has %d requests, limit is %d", ErrTooManyItems, len(unique), w.config.MaxJobItems)
+	}
+
+	return unique, nil
+}
+
+// run takes a slot of the warmer for every request, so all jobs together
+// process no more requests at once than the configured concurrency
+func (w *Warmer) run(ctx context.Context, j *job) {
+	w.mutex.Lock()
+	j.State = JobRunning
+	j.StartedAt = time.Now()
+	w.mutex.Unlock()
+
+	wg := sync.WaitGroup{}
+	for i := range j.Items {
+		select {
+		case <-ctx.Done():
+			w.setResult(j, i, ItemFailed, ctx.Err())
+			continue
+		case w.slots <- struct{}{}:
+		}
+
+		// items are not modified after the job is created, only their results
+		wg.Add(1)
+		go func(i int, request string) {
+			defer wg.Done()
+			defer func() { <-w.slots }()
+
+			result, err := w.warm(ctx, request, j.origin)
+			w.setResult(j, i, result, err)
+		}(i, j.Items[i].Request)
+	}
+
+	wg.Wait()
+	w.finish(j)
+}
+
+func (w *Warmer) warm(ctx context.Context, request, origin string) (ItemResult, error) {
+	for redirects := 0; ; redirects++ {
+		cached, err := w.proxyService.Cached(ctx, request)
+		if err != nil {
+			return ItemFailed, err
+		}
+
+		if cached {
+			return ItemSkipped, nil
+		}
+
+		recorder := &responseRecorder{}
+		w.proxyService.Handle(ctx, request, origin, recorder)
+		if recorder.location != "" && redirects < maxFollowedRedirects {
+			request = recorder.location
+			continue
+		}
+
+		if recorder.location != "" {
+			return ItemFailed, ErrTooManyRedirects
+		}
+
+		if recorder.err != nil {
+			return ItemFailed, recorder.err
+		}
+
+		return w.confirmSaved(ctx, request)
+	}
+}
+
+// images are saved in the cache after they are served,
+// so the request is warmed only when the save succeeds
+func (w *Warmer) confirmSaved(ctx context.Context, request string) (ItemResult, error) {
+	if err := w.proxyService.WaitForSave(ctx, request); err != nil {
+		return ItemFailed, err
+	}
+
+	cached, err := w.proxyService.Cached(ctx, request)
+	if err != nil {
+		return ItemFailed, err
+	}
+
+	if !cached {
+		return ItemFailed, ErrNotSaved
+	}
+
+	return ItemWarmed, nil
+}
+
+func (w *Warmer) setResult(j *job, index int, result ItemResult, err error) {
+	metrics.Add("warming_"+string(result)+"_requests", 1)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	j.setResult(index, result, err)
+}
+
+func (w *Warmer) finish(j *job) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	j.State = JobFinished
+	j.FinishedAt = time.Now()
+	close(j.done)
+
+	w.finishedJobs = append(w.finishedJobs, j.ID)
+	if len(w.finishedJobs) > maxKeptFinishedJobs {
+		delete(w.jobs, w.finishedJobs[0])
+		w.finishedJobs = w.finishedJobs[1:]
+	}
+}
+
+func newJobID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// ParsePresets parses JSON object of preset names and request paths, for example:
+// {"thumbnail": "/imaginary/thumbnail?width=64&height=64&url={url}"}
+func ParsePresets(data []byte) (map[string]string, error) {
+	presets := map[string]string{}
+	if err := json.Unmarshal(data, &presets); err != nil {
+		return nil, err
+	}
+
+	for name, template := range presets {
+		if !strings.HasPrefix(template, "/") || !strings.Contains(template, urlPlaceholder) {
+			return nil, fmt.Errorf("%w: %s must be a request path containing %s", ErrInvalidPreset, name, urlPlaceholder)
+		}
+	}
+
+	return presets, nil
+}
+
+var (
+	ErrJobNotFound      = errors.New("warming job not found")
+	ErrEmptyJob         = errors.New("warming job has no requests")
+	ErrTooManyItems     = errors.New("warming job has too many requests")
+	ErrUnknownPreset    = errors.New("unknown preset")
+	ErrInvalidPreset    = errors.New("invalid preset")
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrNotSaved         = errors.New("image was not saved in the cache")
+)
@@ -0,0 +1,270 @@
+package warming_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thebartekbanach/imcaxy/pkg/proxy"
+	"github.com/thebartekbanach/imcaxy/pkg/warming"
+)
+
+// testingProxyService caches every handled request in the background after saveDelay,
+// requests starting with /failing are rejected, requests starting with /unsaved
+// are not cached and requests starting with /redirect are redirected to /imaginary
+type testingProxyService struct {
+	mutex     sync.Mutex
+	cached    map[string]bool
+	saves     map[string]chan struct{}
+	handled   []string
+	running   int
+	maxAtOnce int
+	delay     time.Duration
+	saveDelay time.Duration
+}
+
+var _ proxy.ProxyService = (*testingProxyService)(nil)
+
+func newTestingProxyService(cached ...string) *testingProxyService {
+	service := &testingProxyService{cached: map[string]bool{}, saves: map[string]chan struct{}{}}
+	for _, request := range cached {
+		service.cached[request] = true
+	}
+
+	return service
+}
+
+func (p *testingProxyService) Handle(ctx context.Context, requestPath, callerOrigin string, rw proxy.ProxyResponseWriter) {
+	p.mutex.Lock()
+	p.handled = append(p.handled, requestPath)
+	p.running++
+	if p.running > p.maxAtOnce {
+		p.maxAtOnce = p.running
+	}
+	p.mutex.Unlock()
+
+	time.Sleep(p.delay)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.running--
+
+	switch {
+	case strings.HasPrefix(requestPath, "/failing"):
+		rw.WriteError(500, "processing error ocurred")
+	case strings.HasPrefix(requestPath, "/redirect"):
+		rw.WriteRedirect(301, strings.Replace(requestPath, "/redirect", "/imaginary", 1))
+	case strings.HasPrefix(requestPath, "/unsaved"):
+		rw.WriteOK(ioutil.NopCloser(strings.NewReader("image")))
+	default:
+		saved := make(chan struct{})
+		p.saves[requestPath] = saved
+		go p.save(requestPath, saved)
+		rw.WriteOK(ioutil.NopCloser(strings.NewReader("image")))
+	}
+}
+
+func (p *testingProxyService) save(requestPath string, saved chan struct{}) {
+	time.Sleep(p.saveDelay)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.cached[requestPath] = true
+	close(saved)
+}
+
+func (p *testingProxyService) Cached(ctx context.Context, requestPath string) (bool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if strings.HasPrefix(requestPath, "/unknown") {
+		return false, proxy.ErrUnknownProcessor
+	}
+
+	return p.cached[requestPath], nil
+}
+
+func (p *testingProxyService) WaitForSave(ctx context.Context, requestPath string) error {
+	p.mutex.Lock()
+	saved, found := p.saves[requestPath]
+	p.mutex.Unlock()
+
+	if found {
+		<-saved
+	}
+
+	return nil
+}
+
+func (p *testingProxyService) WaitForSaves() {}
+
+func newTestingWarmer(proxyService proxy.ProxyService, concurrency int) *warming.Warmer {
+	return warming.NewWarmer(warming.WarmerConfig{
+		Concurrency: concurrency,
+		MaxJobItems: 10,
+		Presets: map[string]string{
+			"thumbnail": "/imaginary/thumbnail?width=64&url={url}",
+		},
+	}, proxyService)
+}
+
+func runTestingJob(t *testing.T, warmer *warming.Warmer, request warming.JobRequest) warming.Job {
+	job, err := warmer.Start(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job, err = warmer.Wait(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Expected job to finish, got: %v", err)
+	}
+
+	return job
+}
+
+func TestWarmer_ShouldWarmPresetsOfAllSourceImages(t *testing.T) {
+	proxyService := newTestingProxyService()
+	warmer := newTestingWarmer(proxyService, 2)
+
+	job := runTestingJob(t, warmer, warming.JobRequest{
+		SourceImageURLs: []string{"http://example.com/a.jpg", "http://example.com/b.jpg"},
+		Presets:         []string{"thumbnail"},
+		Requests:        []string{"/imaginary/resize?width=10&url={url}", "/imaginary/crop?width=10&url=http://example.com/c.jpg"},
+	})
+
+	if job.State != warming.JobFinished || job.TotalItems != 5 || job.WarmedItems != 5 {
+		t.Fatalf("Expected 5 warmed requests in finished job, got: %+v", job)
+	}
+
+	expectedRequest := "/imaginary/thumbnail?width=64&url=http%3A%2F%2Fexample.com%2Fa.jpg"
+	if job.Items[0].Request != expectedRequest || !proxyService.cached[expectedRequest] {
+		t.Errorf("Expected %s to be warmed first, got: %+v", expectedRequest, job.Items[0])
+	}
+}
+
+func TestWarmer_ShouldSkipCachedRequests(t *testing.T) {
+	proxyService := newTestingProxyService("/imaginary/crop?width=10")
+	warmer := newTestingWarmer(proxyService, 2)
+
+	job := runTestingJob(t, warmer, warming.JobRequest{
+		Requests: []string{"/imaginary/crop?width=10", "/imaginary/crop?width=20", "/imaginary/crop?width=20"},
+	})
+
+	if job.TotalItems != 2 || job.SkippedItems != 1 || job.WarmedItems != 1 {
+		t.Errorf("Expected one skipped and one warmed request, got: %+v", job)
+	}
+
+	if len(proxyService.handled) != 1 || proxyService.handled[0] != "/imaginary/crop?width=20" {
+		t.Errorf("Expected only not cached request to be handled, got: %v", proxyService.handled)
+	}
+}
+
+func TestWarmer_ShouldReportFailedRequests(t *testing.T) {
+	warmer := newTestingWarmer(newTestingProxyService(), 2)
+
+	job := runTestingJob(t, warmer, warming.JobRequest{
+		Requests: []string{"/failing/crop?width=10", "/unknown/crop?width=10"},
+	})
+
+	if job.FailedItems != 2 {
+		t.Fatalf("Expected two failed requests, got: %+v", job)
+	}
+
+	if job.Items[0].Error != "500 processing error ocurred" || job.Items[1].Error != proxy.ErrUnknownProcessor.Error() {
+		t.Errorf("Expected errors of failed requests to be reported, got: %+v", job.Items)
+	}
+}
+
+func TestWarmer_ShouldReportRequestsAsWarmedOnlyWhenTheyAreSaved(t *testing.T) {
+	proxyService := newTestingProxyService()
+	proxyService.saveDelay = 50 * time.Millisecond
+	warmer := newTestingWarmer(proxyService, 2)
+
+	job := runTestingJob(t, warmer, warming.JobRequest{
+		Requests: []string{"/imaginary/crop?width=10", "/unsaved/crop?width=10"},
+	})
+
+	if job.WarmedItems != 1 || job.Items[0].Result != warming.ItemWarmed {
+		t.Fatalf("Expected saved request to be warmed, got: %+v", job)
+	}
+
+	if job.FailedItems != 1 || job.Items[1].Error != warming.ErrNotSaved.Error() {
+		t.Errorf("Expected not saved request to fail, got: %+v", job.Items[1])
+	}
+}
+
+func TestWarmer_ShouldFollowRedirectToCanonicalRequest(t *testing.T) {
+	proxyService := newTestingProxyService()
+	warmer := newTestingWarmer(proxyService, 1)
+
+	job := runTestingJob(t, warmer, warming.JobRequest{
+		Requests: []string{"/redirect/crop?width=10"},
+	})
+
+	if job.WarmedItems != 1 || !proxyService.cached["/imaginary/crop?width=10"] {
+		t.Errorf("Expected canonical request to be warmed, got: %+v", job)
+	}
+}
+
+func TestWarmer_ShouldBoundConcurrencyOfAllJobs(t *testing.T) {
+	proxyService := newTestingProxyService()
+	proxyService.delay = 10 * time.Millisecond
+	warmer := newTestingWarmer(proxyService, 2)
+
+	first, _ := warmer.Start(context.Background(), warming.JobRequest{
+		Requests: []string{"/imaginary/a", "/imaginary/b", "/imaginary/c"},
+	})
+	second := runTestingJob(t, warmer, warming.JobRequest{
+		Requests: []string{"/imaginary/d", "/imaginary/e", "/imaginary/f"},
+	})
+
+	if _, err := warmer.Wait(context.Background(), first.ID); err != nil || second.WarmedItems != 3 {
+		t.Fatalf("Expected both jobs to finish, got: %v, %+v", err, second)
+	}
+
+	if proxyService.maxAtOnce != 2 {
+		t.Errorf("Expected at most 2 requests processed at once, got: %d", proxyService.maxAtOnce)
+	}
+}
+
+func TestWarmer_ShouldRejectInvalidJobs(t *testing.T) {
+	warmer := newTestingWarmer(newTestingProxyService(), 1)
+
+	jobs := map[error]warming.JobRequest{
+		warming.ErrUnknownPreset: {SourceImageURLs: []string{"http://example.com/a.jpg"}, Presets: []string{"unknown"}},
+		warming.ErrEmptyJob:      {Presets: []string{"thumbnail"}},
+		warming.ErrTooManyItems:  {SourceImageURLs: strings.Split("a,b,c,d,e,f,g,h,i,j,k", ","), Presets: []string{"thumbnail"}},
+	}
+
+	for expectedErr, request := range jobs {
+		if _, err := warmer.Start(context.Background(), request); !errors.Is(err, expectedErr) {
+			t.Errorf("Expected %v error, got: %v", expectedErr, err)
+		}
+	}
+}
+
+func TestWarmer_JobShouldReturnNotFoundForUnknownJob(t *testing.T) {
+	warmer := newTestingWarmer(newTestingProxyService(), 1)
+
+	if _, found := warmer.Job("unknown"); found {
+		t.Error("Expected unknown job to not be found")
+	}
+}
+
+func TestParsePresets_ShouldRejectPresetsWithoutURLPlaceholder(t *testing.T) {
+	if _, err := warming.ParsePresets([]byte(`{"thumbnail": "/imaginary/thumbnail?width=64"}`)); !errors.Is(err, warming.ErrInvalidPreset) {
+		t.Errorf("Expected invalid preset error, got: %v", err)
+	}
+
+	presets, err := warming.ParsePresets([]byte(`{"thumbnail": "/imaginary/thumbnail?width=64&url={url}"}`))
+	if err != nil || presets["thumbnail"] != "/imaginary/thumbnail?width=64&url={url}" {
+		t.Errorf("Expected preset to be parsed, got: %v, %v", presets, err)
+	}
+}